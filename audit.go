@@ -0,0 +1,157 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrAuditNotConfigured represents reading the audit log when no AuditStore is configured.
+var ErrAuditNotConfigured = errors.New("audit store not configured")
+
+// AuditOperation is the kind of change recorded by an AuditEntry.
+type AuditOperation string
+
+const (
+	AuditUpdate AuditOperation = "update"
+	AuditPatch  AuditOperation = "patch"
+	AuditDelete AuditOperation = "delete"
+)
+
+// AuditChange is the change to a single top level metadata key.
+// Old is nil if the key was added and New is nil if it was removed.
+type AuditChange struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+// AuditEntry records a single change to the metadata of an indexed object.
+type AuditEntry struct {
+	Time      time.Time
+	Operation AuditOperation
+	Changes   []AuditChange
+}
+
+// AuditStore keeps the history of changes to metadata.
+type AuditStore interface {
+	Append(ctx context.Context, id string, entry AuditEntry) error
+
+	// List returns all the entries for the id, oldest first.
+	List(ctx context.Context, id string) ([]AuditEntry, error)
+}
+
+type InMemoryAuditStore struct {
+	mu      sync.Mutex
+	entries map[string][]AuditEntry
+}
+
+func NewInMemoryAuditStore() *InMemoryAuditStore {
+	return &InMemoryAuditStore{
+		entries: make(map[string][]AuditEntry),
+	}
+}
+
+func (a *InMemoryAuditStore) Append(ctx context.Context, id string, entry AuditEntry) error {
+	a.mu.Lock()
+	a.entries[id] = append(a.entries[id], entry)
+	a.mu.Unlock()
+
+	return nil
+}
+
+func (a *InMemoryAuditStore) List(ctx context.Context, id string) ([]AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entries := make([]AuditEntry, len(a.entries[id]))
+	copy(entries, a.entries[id])
+	return entries, nil
+}
+
+// GetAuditLog returns the history of changes to the metadata of an indexed object, oldest first.
+func (s *Service) GetAuditLog(ctx context.Context, id string) (entries []AuditEntry, err error) {
+	defer s.observe("GetAuditLog", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	if s.auditStore == nil {
+		return nil, ErrAuditNotConfigured
+	}
+	return s.auditStore.List(ctx, id)
+}
+
+// auditSnapshot reads the metadata before a change which doesn't otherwise
+// need it, for working out what changed. It reports false if the change
+// won't be audited.
+func (s *Service) auditSnapshot(ctx context.Context, id string) (map[string]interface{}, bool) {
+	if s.auditStore == nil {
+		return nil, false
+	}
+
+	doc, err := s.docDB.Get(ctx, id)
+	if err != nil {
+		s.logger(id).Error("unable to read metadata for the audit log", zap.Error(err))
+		return nil, false
+	}
+	return CopyDoc(doc), true
+}
+
+// audit appends the changes between the old and new metadata to the audit log.
+// Failures are only logged since they mustn't fail the change itself.
+func (s *Service) audit(ctx context.Context, id string, op AuditOperation, old, new map[string]interface{}) {
+	if s.auditStore == nil {
+		return
+	}
+
+	entry := AuditEntry{
+		Time:      s.now(),
+		Operation: op,
+		Changes:   diffMetadata(old, new),
+	}
+	err := s.auditStore.Append(ctx, id, entry)
+	if err != nil {
+		s.logger(id).Error("unable to append to the audit log", zap.Error(err))
+	}
+}
+
+// upsertedMetadata returns the metadata old became once metadata was upserted
+// into it. The DocumentStore has already merged them, so they can't conflict.
+func upsertedMetadata(metadata, old map[string]interface{}) map[string]interface{} {
+	merged, _ := MergeDocs(CopyDoc(metadata), CopyDoc(old))
+	return merged
+}
+
+// diffMetadata returns the top level keys which differ, ignoring the reserved metadata.
+func diffMetadata(old, new map[string]interface{}) []AuditChange {
+	keys := make(map[string]struct{}, len(old)+len(new))
+	for k := range old {
+		keys[k] = struct{}{}
+	}
+	for k := range new {
+		keys[k] = struct{}{}
+	}
+	delete(keys, ReservedMetadataKey)
+
+	var changes []AuditChange
+	for k := range keys {
+		ov, nv := old[k], new[k]
+		if reflect.DeepEqual(ov, nv) {
+			continue
+		}
+		changes = append(changes, AuditChange{Key: k, Old: ov, New: nv})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
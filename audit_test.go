@@ -0,0 +1,106 @@
+package sakuin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingAuditStore fails every Append.
+type failingAuditStore struct {
+	*InMemoryAuditStore
+}
+
+func (a failingAuditStore) Append(ctx context.Context, id string, entry AuditEntry) error {
+	return errors.New("audit store is down")
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Run("should record the changed keys of every change", func(subT *testing.T) {
+		now := time.Now()
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test", "tag": "a"}),
+			Now:           func() time.Time { return now },
+			AuditStore:    NewInMemoryAuditStore(),
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "updated", "tag": "a"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{Id: "test", Metadata: metadata})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.MergePatchMetadata(context.Background(), "test", json.RawMessage(`{"tag":null,"owner":"me"}`))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		entries, err := s.GetAuditLog(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []AuditEntry{
+			{
+				Time:      now,
+				Operation: AuditUpdate,
+				Changes: []AuditChange{
+					{Key: "name", Old: "test", New: "updated"},
+				},
+			},
+			{
+				Time:      now,
+				Operation: AuditPatch,
+				Changes: []AuditChange{
+					{Key: "owner", New: "me"},
+					{Key: "tag", Old: "a"},
+				},
+			},
+			{
+				Time:      now,
+				Operation: AuditDelete,
+				Changes: []AuditChange{
+					{Key: "name", Old: "updated"},
+					{Key: "owner", Old: "me"},
+				},
+			},
+		}, entries)
+	})
+
+	t.Run("should not fail the change if the audit log can't be written", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+			AuditStore:    failingAuditStore{NewInMemoryAuditStore()},
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "updated"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{Id: "test", Metadata: metadata})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should fail if no audit store is configured", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.GetAuditLog(context.Background(), "test")
+		assert.Equal(subT, ErrAuditNotConfigured, err)
+	})
+}
@@ -0,0 +1,163 @@
+package sakuin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// BatchDocumentStore is an optional interface a DocumentStore can
+// implement to read and write many documents in a single call, for
+// backends with multi-document operations.
+type BatchDocumentStore interface {
+	DocumentStore
+
+	// GetMany returns the documents which exist, keyed by id. Ids which
+	// don't exist are left out rather than failing the call.
+	GetMany(ctx context.Context, ids []string) (map[string]map[string]interface{}, error)
+
+	// UpsertMany merges every document into the stored one under its id,
+	// in the same way as Upsert. If only some of the documents couldn't be
+	// written a BatchErr is returned naming them.
+	UpsertMany(ctx context.Context, docs map[string]map[string]interface{}) error
+}
+
+// BatchErr represents a batch operation which failed for some of its ids.
+// The ids which aren't in Errs succeeded.
+type BatchErr struct {
+	Errs map[string]error
+}
+
+// IDs returns the ids which failed, in ascending order.
+func (e BatchErr) IDs() []string {
+	ids := make([]string, 0, len(e.Errs))
+	for id := range e.Errs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (e BatchErr) Error() string {
+	ids := e.IDs()
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", id, e.Errs[id]))
+	}
+	return fmt.Sprintf("batch failed for %d ids: %s", len(ids), strings.Join(msgs, ", "))
+}
+
+func (s *InMemoryDocumentStore) GetMany(ctx context.Context, ids []string) (map[string]map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	docs := make(map[string]map[string]interface{}, len(ids))
+	for _, id := range ids {
+		doc, exists := s.docs[id]
+		if !exists {
+			continue
+		}
+		s.touch(id)
+		docs[id] = CopyDoc(doc)
+	}
+	return docs, nil
+}
+
+func (s *InMemoryDocumentStore) UpsertMany(ctx context.Context, docs map[string]map[string]interface{}) error {
+	s.mu.Lock()
+	var evicted []string
+	errs := make(map[string]error)
+	for id, doc := range docs {
+		ids, err := s.upsert(id, doc)
+		if err != nil {
+			errs[id] = err
+			continue
+		}
+		evicted = append(evicted, ids...)
+	}
+	s.mu.Unlock()
+
+	s.evicted(evicted)
+	if len(errs) > 0 {
+		return BatchErr{Errs: errs}
+	}
+	return nil
+}
+
+// RunBatchDocumentStorageTests checks the batch operations behave the
+// same as their single document equivalents.
+func RunBatchDocumentStorageTests(t TestingT, docStore BatchDocumentStore) {
+	t.Run("get many should leave out missing documents", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "batchGet", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		docs, err := docStore.GetMany(context.Background(), []string{"batchGet", "batchMissing"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]map[string]interface{}{"batchGet": {"name": "test"}}, docs)
+	})
+
+	t.Run("get many should succeed with no ids", func(subT TestingT) {
+		docs, err := docStore.GetMany(context.Background(), nil)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, docs)
+	})
+
+	t.Run("upsert many should merge like upsert", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "batchMerge", map[string]interface{}{"name": "test", "description": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = docStore.UpsertMany(context.Background(), map[string]map[string]interface{}{
+			"batchMerge": {"name": "updated"},
+			"batchNew":   {"name": "new"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		docs, err := docStore.GetMany(context.Background(), []string{"batchMerge", "batchNew"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]map[string]interface{}{
+			"batchMerge": {"name": "updated", "description": "test"},
+			"batchNew":   {"name": "new"},
+		}, docs)
+	})
+
+	t.Run("upsert many should succeed with no documents", func(subT TestingT) {
+		err := docStore.UpsertMany(context.Background(), nil)
+		assert.Nil(subT, err)
+	})
+
+	t.Run("documents should not alias caller memory", func(subT TestingT) {
+		doc := map[string]interface{}{"nested": map[string]interface{}{"a": "b"}}
+		err := docStore.UpsertMany(context.Background(), map[string]map[string]interface{}{"batchAlias": doc})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		doc["nested"].(map[string]interface{})["a"] = "modified"
+
+		docs, err := docStore.GetMany(context.Background(), []string{"batchAlias"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		docs["batchAlias"]["nested"].(map[string]interface{})["a"] = "modified"
+
+		got, err := docStore.Get(context.Background(), "batchAlias")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"nested": map[string]interface{}{"a": "b"}}, got)
+	})
+}
@@ -0,0 +1,19 @@
+package sakuin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryBatchDocumentStore(t *testing.T) {
+	RunBatchDocumentStorageTests(liftTestingT(t), NewInMemoryDocumentStore())
+}
+
+func TestBatchErr(t *testing.T) {
+	err := BatchErr{Errs: map[string]error{"b": errors.New("failed"), "a": errors.New("failed")}}
+
+	assert.Equal(t, []string{"a", "b"}, err.IDs())
+	assert.EqualError(t, err, "batch failed for 2 ids: a: failed, b: failed")
+}
@@ -0,0 +1,151 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultBulkConcurrency is the number of ids a bulk operation
+// processes concurrently when Config.BulkConcurrency isn't set.
+const DefaultBulkConcurrency = 8
+
+// BulkUpdateResult is the outcome of a bulk update for a single id.
+type BulkUpdateResult struct {
+	ID string
+
+	// Revision is the new revision, if the DocumentStore supports revisions.
+	// It's always empty when the update was batched.
+	Revision string
+
+	// Err is nil if the update succeeded.
+	Err error
+}
+
+// BulkUpdateMetadata merges the same patch into the metadata of every given id,
+// in the same way as UpdateMetadata. The results are in the same order as the ids.
+//
+// Failures, e.g. an id which doesn't exist, are reported in the result for that id
+// and don't stop the other updates. If the context is cancelled no further updates
+// are started, their results hold the context error, which is also returned.
+//
+// If the DocumentStore implements BatchDocumentStore all the ids are read and
+// written with a single GetMany and UpsertMany, otherwise they're updated one
+// by one, up to Config.BulkConcurrency at a time.
+func (s *Service) BulkUpdateMetadata(ctx context.Context, ids []string, patch map[string]interface{}) (results []BulkUpdateResult, err error) {
+	defer s.observe("BulkUpdateMetadata", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	results = make([]BulkUpdateResult, len(ids))
+
+	if batchDB, ok := s.rawDocDB.(BatchDocumentStore); ok {
+		s.batchUpdateMetadata(ctx, batchDB, ids, patch, results)
+		return results, ctx.Err()
+	}
+
+	var g errgroup.Group
+	g.SetLimit(s.bulkConcurrency)
+	for i, id := range ids {
+		i, id := i, id
+		results[i].ID = id
+
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				results[i].Err = err
+				return nil
+			}
+
+			revision, err := s.updateMetadata(ctx, id, CopyDoc(patch), "")
+			if err != nil {
+				s.log.Warn("unable to update metadata in bulk", zap.String("id", id), zap.Error(err))
+			}
+			results[i].Revision = revision
+			results[i].Err = err
+			return nil
+		})
+	}
+	g.Wait()
+
+	return results, ctx.Err()
+}
+
+// batchUpdateMetadata is BulkUpdateMetadata for stores which can read and
+// write all the ids at once.
+func (s *Service) batchUpdateMetadata(ctx context.Context, batchDB BatchDocumentStore, ids []string, patch map[string]interface{}, results []BulkUpdateResult) {
+	fail := func(err error) {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+	}
+
+	for i, id := range ids {
+		results[i].ID = id
+	}
+	if err := ctx.Err(); err != nil {
+		fail(err)
+		return
+	}
+
+	olds, err := batchDB.GetMany(ctx, ids)
+	if err != nil {
+		s.log.Error("unexpected error when getting metadata in bulk", zap.Error(err))
+		fail(err)
+		return
+	}
+
+	docs := make(map[string]map[string]interface{}, len(ids))
+	for i, id := range ids {
+		if _, exists := olds[id]; !exists {
+			results[i].Err = DocumentDoesNotExistErr{ID: id}
+			continue
+		}
+
+		metadata := CopyDoc(patch)
+		err := s.validateMetadata(ctx, id, metadata)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		docs[id] = metadata
+	}
+	if len(docs) == 0 {
+		return
+	}
+
+	err = batchDB.UpsertMany(ctx, docs)
+	var batchErr BatchErr
+	if err != nil && !errors.As(err, &batchErr) {
+		s.log.Error("unexpected error when updating metadata in bulk", zap.Error(err))
+		fail(err)
+		return
+	}
+
+	for i, id := range ids {
+		if results[i].Err != nil {
+			continue
+		}
+		if err := batchErr.Errs[id]; err != nil {
+			s.log.Warn("unable to update metadata in bulk", zap.String("id", id), zap.Error(err))
+			results[i].Err = err
+			continue
+		}
+
+		s.audit(ctx, id, AuditUpdate, olds[id], upsertedMetadata(docs[id], olds[id]))
+		s.runHook("OnMetadataUpdated", s.hooks.OnMetadataUpdated, id, HookSummary{})
+	}
+}
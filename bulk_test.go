@@ -0,0 +1,252 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// concurrencyTrackingDocumentStore records the maximum number of concurrent Upsert calls.
+type concurrencyTrackingDocumentStore struct {
+	DocumentStore
+
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (s *concurrencyTrackingDocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	s.mu.Lock()
+	s.current++
+	if s.current > s.max {
+		s.max = s.current
+	}
+	s.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.mu.Lock()
+	s.current--
+	s.mu.Unlock()
+
+	return s.DocumentStore.Upsert(ctx, id, doc)
+}
+
+// unbatchedDocumentStore hides the BatchDocumentStore implementation of the wrapped store.
+type unbatchedDocumentStore struct {
+	RevisionedDocumentStore
+}
+
+// batchCountingDocumentStore counts batch calls and fails UpsertMany for the ids in fail.
+type batchCountingDocumentStore struct {
+	*InMemoryDocumentStore
+
+	getManys    int
+	upsertManys int
+	fail        map[string]bool
+}
+
+func (s *batchCountingDocumentStore) GetMany(ctx context.Context, ids []string) (map[string]map[string]interface{}, error) {
+	s.getManys++
+	return s.InMemoryDocumentStore.GetMany(ctx, ids)
+}
+
+func (s *batchCountingDocumentStore) UpsertMany(ctx context.Context, docs map[string]map[string]interface{}) error {
+	s.upsertManys++
+
+	errs := make(map[string]error)
+	ok := make(map[string]map[string]interface{})
+	for id, doc := range docs {
+		if s.fail[id] {
+			errs[id] = errors.New("failed")
+			continue
+		}
+		ok[id] = doc
+	}
+	err := s.InMemoryDocumentStore.UpsertMany(ctx, ok)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return BatchErr{Errs: errs}
+	}
+	return nil
+}
+
+func TestBulkUpdateMetadata(t *testing.T) {
+	t.Run("should update every id", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().
+			WithDocument("a", map[string]interface{}{"name": "a"}).
+			WithDocument("b", map[string]interface{}{"name": "b"})
+
+		s := New(Config{
+			DocumentStore: unbatchedDocumentStore{docStore},
+		})
+
+		results, err := s.BulkUpdateMetadata(context.Background(), []string{"a", "b"}, map[string]interface{}{"reviewed": true})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Len(subT, results, 2) {
+			return
+		}
+
+		for i, id := range []string{"a", "b"} {
+			assert.Equal(subT, id, results[i].ID)
+			assert.Nil(subT, results[i].Err)
+			assert.NotEmpty(subT, results[i].Revision)
+
+			doc, err := docStore.Get(context.Background(), id)
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, map[string]interface{}{"name": id, "reviewed": true}, doc)
+		}
+	})
+
+	t.Run("should report missing ids individually", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: unbatchedDocumentStore{NewInMemoryDocumentStore().WithDocument("a", map[string]interface{}{"name": "a"})},
+		})
+
+		results, err := s.BulkUpdateMetadata(context.Background(), []string{"missing", "a"}, map[string]interface{}{"reviewed": true})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, results[0].Err, &docErr)
+		assert.Nil(subT, results[1].Err)
+	})
+
+	t.Run("should respect the concurrency limit", func(subT *testing.T) {
+		inner := NewInMemoryDocumentStore()
+		var ids []string
+		for i := 0; i < 20; i++ {
+			id := fmt.Sprintf("doc-%d", i)
+			inner.WithDocument(id, map[string]interface{}{"name": id})
+			ids = append(ids, id)
+		}
+		docStore := &concurrencyTrackingDocumentStore{DocumentStore: inner}
+
+		s := New(Config{
+			DocumentStore:   docStore,
+			BulkConcurrency: 3,
+		})
+
+		results, err := s.BulkUpdateMetadata(context.Background(), ids, map[string]interface{}{"reviewed": true})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		for _, result := range results {
+			assert.Nil(subT, result.Err)
+		}
+		assert.LessOrEqual(subT, docStore.max, 3)
+		assert.Greater(subT, docStore.max, 1)
+	})
+
+	t.Run("should stop once the context is cancelled", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("a", map[string]interface{}{"name": "a"})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := s.BulkUpdateMetadata(ctx, []string{"a"}, map[string]interface{}{"reviewed": true})
+		assert.Equal(subT, context.Canceled, err)
+		assert.Equal(subT, context.Canceled, results[0].Err)
+
+		doc, err := docStore.Get(context.Background(), "a")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.NotContains(subT, doc, "reviewed")
+	})
+}
+
+func TestBulkUpdateMetadataInBatch(t *testing.T) {
+	t.Run("should update every id with a single batch", func(subT *testing.T) {
+		docStore := &batchCountingDocumentStore{
+			InMemoryDocumentStore: NewInMemoryDocumentStore().
+				WithDocument("a", map[string]interface{}{"name": "a"}).
+				WithDocument("b", map[string]interface{}{"name": "b"}),
+		}
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		results, err := s.BulkUpdateMetadata(context.Background(), []string{"a", "b"}, map[string]interface{}{"reviewed": true})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 1, docStore.getManys)
+		assert.Equal(subT, 1, docStore.upsertManys)
+
+		for i, id := range []string{"a", "b"} {
+			assert.Equal(subT, id, results[i].ID)
+			assert.Nil(subT, results[i].Err)
+
+			doc, err := docStore.Get(context.Background(), id)
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, map[string]interface{}{"name": id, "reviewed": true}, doc)
+		}
+	})
+
+	t.Run("should report missing and failed ids individually", func(subT *testing.T) {
+		docStore := &batchCountingDocumentStore{
+			InMemoryDocumentStore: NewInMemoryDocumentStore().
+				WithDocument("a", map[string]interface{}{"name": "a"}).
+				WithDocument("b", map[string]interface{}{"name": "b"}),
+			fail: map[string]bool{"b": true},
+		}
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		results, err := s.BulkUpdateMetadata(context.Background(), []string{"missing", "a", "b"}, map[string]interface{}{"reviewed": true})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, results[0].Err, &docErr)
+		assert.Nil(subT, results[1].Err)
+		assert.EqualError(subT, results[2].Err, "failed")
+
+		doc, err := docStore.Get(context.Background(), "b")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.NotContains(subT, doc, "reviewed")
+	})
+
+	t.Run("should stop once the context is cancelled", func(subT *testing.T) {
+		docStore := &batchCountingDocumentStore{
+			InMemoryDocumentStore: NewInMemoryDocumentStore().WithDocument("a", map[string]interface{}{"name": "a"}),
+		}
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := s.BulkUpdateMetadata(ctx, []string{"a"}, map[string]interface{}{"reviewed": true})
+		assert.Equal(subT, context.Canceled, err)
+		assert.Equal(subT, context.Canceled, results[0].Err)
+		assert.Equal(subT, 0, docStore.upsertManys)
+	})
+}
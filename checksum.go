@@ -0,0 +1,85 @@
+package sakuin
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strings"
+)
+
+// ChecksumAlgorithm identifies the hash used to compute object checksums.
+type ChecksumAlgorithm string
+
+const (
+	SHA256 ChecksumAlgorithm = "sha256"
+	SHA512 ChecksumAlgorithm = "sha512"
+	CRC32C ChecksumAlgorithm = "crc32c"
+)
+
+// UnsupportedChecksumAlgorithmErr represents an unknown ChecksumAlgorithm.
+type UnsupportedChecksumAlgorithmErr struct {
+	Algorithm ChecksumAlgorithm
+}
+
+func (e UnsupportedChecksumAlgorithmErr) Error() string {
+	return fmt.Sprintf("unsupported checksum algorithm: %s", e.Algorithm)
+}
+
+// ChecksumMismatchErr represents a conditional update of an object whose
+// content doesn't match any of the expected checksums.
+type ChecksumMismatchErr struct {
+	ID       string
+	Expected []string
+}
+
+func (e ChecksumMismatchErr) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: expected one of %s", e.ID, strings.Join(e.Expected, ", "))
+}
+
+func (a ChecksumAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA512:
+		return sha512.New(), nil
+	case CRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	default:
+		return nil, UnsupportedChecksumAlgorithmErr{Algorithm: a}
+	}
+}
+
+// Checksum computes the checksum of b. Checksums are formatted
+// as "<algorithm>:<hex digest>" so they can be verified without
+// knowing which algorithm the Service was configured with.
+func (a ChecksumAlgorithm) Checksum(b []byte) (string, error) {
+	h, err := a.newHash()
+	if err != nil {
+		return "", err
+	}
+	h.Write(b)
+
+	return a.format(h), nil
+}
+
+func (a ChecksumAlgorithm) format(h hash.Hash) string {
+	return string(a) + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyChecksum reports whether the checksum, as returned by the Service,
+// matches the given content.
+func VerifyChecksum(checksum string, b []byte) (bool, error) {
+	alg, _, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return false, fmt.Errorf("malformed checksum: %s", checksum)
+	}
+
+	actual, err := ChecksumAlgorithm(alg).Checksum(b)
+	if err != nil {
+		return false, err
+	}
+	return actual == checksum, nil
+}
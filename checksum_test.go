@@ -0,0 +1,66 @@
+package sakuin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksum(t *testing.T) {
+	content := []byte("test content")
+
+	t.Run("should prefix checksum with algorithm", func(subT *testing.T) {
+		for _, alg := range []ChecksumAlgorithm{SHA256, SHA512, CRC32C} {
+			checksum, err := alg.Checksum(content)
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			assert.Regexp(subT, "^"+string(alg)+":[0-9a-f]+$", checksum)
+		}
+	})
+
+	t.Run("should fail if algorithm is unknown", func(subT *testing.T) {
+		_, err := ChecksumAlgorithm("md4").Checksum(content)
+
+		var algErr UnsupportedChecksumAlgorithmErr
+		assert.ErrorAs(subT, err, &algErr)
+	})
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	content := []byte("test content")
+
+	t.Run("should succeed if content matches", func(subT *testing.T) {
+		for _, alg := range []ChecksumAlgorithm{SHA256, SHA512, CRC32C} {
+			checksum, err := alg.Checksum(content)
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			ok, err := VerifyChecksum(checksum, content)
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.True(subT, ok)
+		}
+	})
+
+	t.Run("should not match if content differs", func(subT *testing.T) {
+		checksum, err := SHA256.Checksum(content)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		ok, err := VerifyChecksum(checksum, []byte("corrupted content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, ok)
+	})
+
+	t.Run("should fail if checksum is malformed", func(subT *testing.T) {
+		_, err := VerifyChecksum("abcdef", content)
+		assert.Error(subT, err)
+	})
+}
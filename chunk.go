@@ -0,0 +1,481 @@
+package sakuin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// UploadDoesNotExistErr represents an upload which was never created,
+// or has already been completed or aborted.
+type UploadDoesNotExistErr struct {
+	UploadID string
+}
+
+func (e UploadDoesNotExistErr) Error() string {
+	return fmt.Sprintf("upload does not exist: %s", e.UploadID)
+}
+
+// InvalidChunkErr represents a chunk with a negative index.
+type InvalidChunkErr struct {
+	UploadID string
+	Index    int
+}
+
+func (e InvalidChunkErr) Error() string {
+	return fmt.Sprintf("invalid chunk index %d for upload %s", e.Index, e.UploadID)
+}
+
+// MissingChunkErr represents completing an upload with a gap in its chunks.
+type MissingChunkErr struct {
+	UploadID string
+	Index    int
+}
+
+func (e MissingChunkErr) Error() string {
+	return fmt.Sprintf("upload %s is missing chunk %d", e.UploadID, e.Index)
+}
+
+// ChunkedObjectStore is an optional interface an ObjectStore can implement
+// to store objects uploaded in chunks, e.g. objects too large to send in a
+// single request.
+type ChunkedObjectStore interface {
+	ObjectStore
+
+	// CreateUpload starts an upload of the object with the given id.
+	// Nothing is visible under the id until the upload is completed.
+	CreateUpload(ctx context.Context, id string) (uploadID string, err error)
+
+	// PutChunk stores the chunk at the given index, replacing any chunk
+	// already stored at it. Chunks may be put in any order.
+	PutChunk(ctx context.Context, uploadID string, index int, data []byte) error
+
+	// CompleteUpload stores the chunks, in ascending order of index, as the
+	// object. The indexes must run from zero without any gaps, otherwise a
+	// MissingChunkErr is returned and the upload can still be completed once
+	// the missing chunks are put.
+	CompleteUpload(ctx context.Context, uploadID string) error
+
+	// AbortUpload discards the upload and its chunks.
+	AbortUpload(ctx context.Context, uploadID string) error
+}
+
+// AsChunked returns the given store if it implements ChunkedObjectStore,
+// otherwise it adapts the store by holding the chunks as objects under
+// UploadChunkPrefix until the upload is completed. Which uploads exist is
+// only known to the returned store, so chunks of uploads in progress when
+// the process exits are left behind.
+func AsChunked(objStore ObjectStore) ChunkedObjectStore {
+	if chunkStore, ok := objStore.(ChunkedObjectStore); ok {
+		return chunkStore
+	}
+	return &emulatedChunkedObjectStore{
+		ObjectStore: objStore,
+		uploads:     make(map[string]*emulatedUpload),
+	}
+}
+
+// UploadChunkPrefix prefixes the ids of the objects holding the chunks
+// of uploads to stores adapted by AsChunked.
+const UploadChunkPrefix = ".uploads/"
+
+type emulatedChunkedObjectStore struct {
+	ObjectStore
+
+	mu      sync.Mutex
+	uploads map[string]*emulatedUpload
+}
+
+type emulatedUpload struct {
+	id string
+
+	// sizes holds the size of every chunk put, by index.
+	sizes map[int]int64
+}
+
+func chunkID(uploadID string, index int) string {
+	return fmt.Sprintf("%s%s/%d", UploadChunkPrefix, uploadID, index)
+}
+
+func (s *emulatedChunkedObjectStore) CreateUpload(ctx context.Context, id string) (string, error) {
+	uploadID := uuid.NewString()
+
+	s.mu.Lock()
+	s.uploads[uploadID] = &emulatedUpload{id: id, sizes: make(map[int]int64)}
+	s.mu.Unlock()
+
+	return uploadID, nil
+}
+
+func (s *emulatedChunkedObjectStore) PutChunk(ctx context.Context, uploadID string, index int, data []byte) error {
+	if index < 0 {
+		return InvalidChunkErr{UploadID: uploadID, Index: index}
+	}
+
+	s.mu.Lock()
+	_, exists := s.uploads[uploadID]
+	s.mu.Unlock()
+	if !exists {
+		return UploadDoesNotExistErr{UploadID: uploadID}
+	}
+
+	err := s.Put(ctx, chunkID(uploadID, index), data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, exists := s.uploads[uploadID]
+	if !exists {
+		// Aborted while the chunk was being put
+		s.Delete(ctx, chunkID(uploadID, index))
+		return UploadDoesNotExistErr{UploadID: uploadID}
+	}
+	upload.sizes[index] = int64(len(data))
+	return nil
+}
+
+func (s *emulatedChunkedObjectStore) CompleteUpload(ctx context.Context, uploadID string) error {
+	// The upload is taken out while completing so it can't be completed twice
+	s.mu.Lock()
+	upload, exists := s.uploads[uploadID]
+	delete(s.uploads, uploadID)
+	s.mu.Unlock()
+	if !exists {
+		return UploadDoesNotExistErr{UploadID: uploadID}
+	}
+
+	restore := func() {
+		s.mu.Lock()
+		s.uploads[uploadID] = upload
+		s.mu.Unlock()
+	}
+
+	var size int64
+	ids := make([]string, len(upload.sizes))
+	for i := range ids {
+		chunkSize, ok := upload.sizes[i]
+		if !ok {
+			restore()
+			return MissingChunkErr{UploadID: uploadID, Index: i}
+		}
+		size += chunkSize
+		ids[i] = chunkID(uploadID, i)
+	}
+
+	r := &chunkReader{ctx: ctx, objStore: s.ObjectStore, ids: ids}
+	err := AsStreaming(s.ObjectStore).PutStream(ctx, upload.id, r, size)
+	if err != nil {
+		restore()
+		return err
+	}
+
+	s.deleteChunks(ctx, uploadID, upload)
+	return nil
+}
+
+func (s *emulatedChunkedObjectStore) AbortUpload(ctx context.Context, uploadID string) error {
+	s.mu.Lock()
+	upload, exists := s.uploads[uploadID]
+	delete(s.uploads, uploadID)
+	s.mu.Unlock()
+	if !exists {
+		return UploadDoesNotExistErr{UploadID: uploadID}
+	}
+
+	s.deleteChunks(ctx, uploadID, upload)
+	return nil
+}
+
+// deleteChunks is best effort, since the chunks aren't visible as the object.
+func (s *emulatedChunkedObjectStore) deleteChunks(ctx context.Context, uploadID string, upload *emulatedUpload) {
+	for index := range upload.sizes {
+		s.Delete(ctx, chunkID(uploadID, index))
+	}
+}
+
+// chunkReader reads the objects holding the chunks one after another,
+// only holding a single chunk in memory at a time.
+type chunkReader struct {
+	ctx      context.Context
+	objStore ObjectStore
+	ids      []string
+	buf      []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if len(r.ids) == 0 {
+			return 0, io.EOF
+		}
+
+		b, err := r.objStore.Get(r.ctx, r.ids[0])
+		if err != nil {
+			return 0, err
+		}
+		r.buf, r.ids = b, r.ids[1:]
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// memUpload is an upload to an InMemoryObjectStore.
+type memUpload struct {
+	id     string
+	chunks map[int][]byte
+}
+
+func (s *InMemoryObjectStore) CreateUpload(ctx context.Context, id string) (string, error) {
+	uploadID := uuid.NewString()
+
+	s.mu.Lock()
+	s.uploads[uploadID] = &memUpload{id: id, chunks: make(map[int][]byte)}
+	s.mu.Unlock()
+
+	return uploadID, nil
+}
+
+func (s *InMemoryObjectStore) PutChunk(ctx context.Context, uploadID string, index int, data []byte) error {
+	if index < 0 {
+		return InvalidChunkErr{UploadID: uploadID, Index: index}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, exists := s.uploads[uploadID]
+	if !exists {
+		return UploadDoesNotExistErr{UploadID: uploadID}
+	}
+	upload.chunks[index] = copyBytes(data)
+	return nil
+}
+
+func (s *InMemoryObjectStore) CompleteUpload(ctx context.Context, uploadID string) error {
+	s.mu.Lock()
+	upload, exists := s.uploads[uploadID]
+	if !exists {
+		s.mu.Unlock()
+		return UploadDoesNotExistErr{UploadID: uploadID}
+	}
+
+	indexes := make([]int, 0, len(upload.chunks))
+	var size int
+	for index, chunk := range upload.chunks {
+		indexes = append(indexes, index)
+		size += len(chunk)
+	}
+	sort.Ints(indexes)
+
+	obj := make([]byte, 0, size)
+	for i, index := range indexes {
+		if i != index {
+			s.mu.Unlock()
+			return MissingChunkErr{UploadID: uploadID, Index: i}
+		}
+		obj = append(obj, upload.chunks[index]...)
+	}
+
+	if s.lru != nil && !s.lru.fits(int64(size)) {
+		s.mu.Unlock()
+		return ObjectTooLargeErr{Limit: s.lru.maxBytes, Size: int64(size)}
+	}
+
+	delete(s.uploads, uploadID)
+	evicted := s.put(upload.id, obj)
+	s.mu.Unlock()
+
+	s.evicted(evicted)
+	return nil
+}
+
+func (s *InMemoryObjectStore) AbortUpload(ctx context.Context, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.uploads[uploadID]; !exists {
+		return UploadDoesNotExistErr{UploadID: uploadID}
+	}
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+// RunChunkedObjectStorageTests checks the contract of ChunkedObjectStore.
+func RunChunkedObjectStorageTests(t TestingT, objStore ChunkedObjectStore) {
+	upload := func(subT TestingT, id string, chunks map[int]string) (string, bool) {
+		uploadID, err := objStore.CreateUpload(context.Background(), id)
+		if !assert.Nil(subT, err) {
+			return "", false
+		}
+		for index, chunk := range chunks {
+			err := objStore.PutChunk(context.Background(), uploadID, index, []byte(chunk))
+			if !assert.Nil(subT, err) {
+				return "", false
+			}
+		}
+		return uploadID, true
+	}
+
+	t.Run("should assemble chunks put out of order", func(subT TestingT) {
+		uploadID, err := objStore.CreateUpload(context.Background(), "chunkOrder")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		for _, index := range []int{2, 0, 1} {
+			err := objStore.PutChunk(context.Background(), uploadID, index, []byte(fmt.Sprint("chunk-", index, ";")))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		err = objStore.CompleteUpload(context.Background(), uploadID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := objStore.Get(context.Background(), "chunkOrder")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("chunk-0;chunk-1;chunk-2;"), b)
+	})
+
+	t.Run("should replace chunks put at the same index", func(subT TestingT) {
+		uploadID, ok := upload(subT, "chunkReplace", map[int]string{0: "old"})
+		if !ok {
+			return
+		}
+		err := objStore.PutChunk(context.Background(), uploadID, 0, []byte("new"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = objStore.CompleteUpload(context.Background(), uploadID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := objStore.Get(context.Background(), "chunkReplace")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("new"), b)
+	})
+
+	t.Run("incomplete uploads should not be visible", func(subT TestingT) {
+		uploadID, ok := upload(subT, "chunkIncomplete", map[int]string{0: "content"})
+		if !ok {
+			return
+		}
+		defer objStore.AbortUpload(context.Background(), uploadID)
+
+		info, err := objStore.Stat(context.Background(), "chunkIncomplete")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, info.Exists)
+
+		var objErr ObjectDoesNotExistErr
+		_, err = objStore.Get(context.Background(), "chunkIncomplete")
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should fail to complete an upload twice", func(subT TestingT) {
+		uploadID, ok := upload(subT, "chunkTwice", map[int]string{0: "content"})
+		if !ok {
+			return
+		}
+
+		err := objStore.CompleteUpload(context.Background(), uploadID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var uploadErr UploadDoesNotExistErr
+		err = objStore.CompleteUpload(context.Background(), uploadID)
+		assert.ErrorAs(subT, err, &uploadErr)
+	})
+
+	t.Run("should fail to complete an upload with missing chunks", func(subT TestingT) {
+		uploadID, ok := upload(subT, "chunkMissing", map[int]string{0: "a", 2: "c"})
+		if !ok {
+			return
+		}
+
+		var chunkErr MissingChunkErr
+		err := objStore.CompleteUpload(context.Background(), uploadID)
+		if !assert.ErrorAs(subT, err, &chunkErr) {
+			return
+		}
+		assert.Equal(subT, 1, chunkErr.Index)
+
+		err = objStore.PutChunk(context.Background(), uploadID, 1, []byte("b"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = objStore.CompleteUpload(context.Background(), uploadID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := objStore.Get(context.Background(), "chunkMissing")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("abc"), b)
+	})
+
+	t.Run("should fail to put chunks with a negative index", func(subT TestingT) {
+		uploadID, ok := upload(subT, "chunkNegative", nil)
+		if !ok {
+			return
+		}
+		defer objStore.AbortUpload(context.Background(), uploadID)
+
+		var chunkErr InvalidChunkErr
+		err := objStore.PutChunk(context.Background(), uploadID, -1, []byte("content"))
+		assert.ErrorAs(subT, err, &chunkErr)
+	})
+
+	t.Run("aborted uploads should not be completed", func(subT TestingT) {
+		uploadID, ok := upload(subT, "chunkAborted", map[int]string{0: "content"})
+		if !ok {
+			return
+		}
+
+		err := objStore.AbortUpload(context.Background(), uploadID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var uploadErr UploadDoesNotExistErr
+		err = objStore.PutChunk(context.Background(), uploadID, 1, []byte("content"))
+		assert.ErrorAs(subT, err, &uploadErr)
+
+		err = objStore.CompleteUpload(context.Background(), uploadID)
+		assert.ErrorAs(subT, err, &uploadErr)
+
+		info, err := objStore.Stat(context.Background(), "chunkAborted")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, info.Exists)
+	})
+
+	t.Run("should fail for uploads which don't exist", func(subT TestingT) {
+		var uploadErr UploadDoesNotExistErr
+		err := objStore.PutChunk(context.Background(), "missing", 0, []byte("content"))
+		assert.ErrorAs(subT, err, &uploadErr)
+
+		err = objStore.AbortUpload(context.Background(), "missing")
+		assert.ErrorAs(subT, err, &uploadErr)
+	})
+}
@@ -0,0 +1,89 @@
+package sakuin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryChunkedObjectStore(t *testing.T) {
+	RunChunkedObjectStorageTests(liftTestingT(t), NewInMemoryObjectStore())
+
+	t.Run("aborted uploads should release their chunks", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+
+		uploadID, err := objStore.CreateUpload(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = objStore.PutChunk(context.Background(), uploadID, 0, []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = objStore.AbortUpload(context.Background(), uploadID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, objStore.uploads)
+	})
+}
+
+func TestAsChunked(t *testing.T) {
+	RunChunkedObjectStorageTests(liftTestingT(t), AsChunked(nonStreamingObjectStore{NewInMemoryObjectStore()}))
+	RunChunkedObjectStorageTests(liftTestingT(t), AsChunked(struct{ StreamingObjectStore }{NewInMemoryObjectStore()}))
+
+	t.Run("should return stores which already support chunking", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		assert.Same(subT, objStore, AsChunked(objStore))
+	})
+
+	t.Run("should delete the chunks once completed", func(subT *testing.T) {
+		inner := NewInMemoryObjectStore()
+		objStore := AsChunked(nonStreamingObjectStore{inner})
+
+		uploadID, ok := putChunks(subT, objStore, "a", "b")
+		if !ok {
+			return
+		}
+		assert.Equal(subT, 2, inner.NumOfObects())
+
+		err := objStore.CompleteUpload(context.Background(), uploadID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 1, inner.NumOfObects())
+	})
+
+	t.Run("should delete the chunks once aborted", func(subT *testing.T) {
+		inner := NewInMemoryObjectStore()
+		objStore := AsChunked(nonStreamingObjectStore{inner})
+
+		uploadID, ok := putChunks(subT, objStore, "a", "b")
+		if !ok {
+			return
+		}
+
+		err := objStore.AbortUpload(context.Background(), uploadID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 0, inner.NumOfObects())
+	})
+}
+
+// putChunks uploads the chunks for the object "test", in order, without completing the upload.
+func putChunks(t *testing.T, objStore ChunkedObjectStore, chunks ...string) (string, bool) {
+	uploadID, err := objStore.CreateUpload(context.Background(), "test")
+	if !assert.Nil(t, err) {
+		return "", false
+	}
+	for i, chunk := range chunks {
+		err = objStore.PutChunk(context.Background(), uploadID, i, []byte(chunk))
+		if !assert.Nil(t, err) {
+			return "", false
+		}
+	}
+	return uploadID, true
+}
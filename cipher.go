@@ -0,0 +1,125 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ObjectCipher encrypts objects before they're handed to the ObjectStore
+// and decrypts them after they're read back.
+type ObjectCipher interface {
+	Encrypt(id string, plaintext []byte) ([]byte, error)
+	Decrypt(id string, ciphertext []byte) ([]byte, error)
+}
+
+// AESGCMKeySize is the key size, in bytes, required by NewAESGCMCipher.
+const AESGCMKeySize = 32
+
+// ErrCiphertextTooShort represents decrypting content which is too
+// short to have been produced by the cipher.
+var ErrCiphertextTooShort = errors.New("ciphertext too short")
+
+// AESGCMCipher encrypts objects with AES-256-GCM. A random nonce is
+// generated for every object and stored in front of the ciphertext.
+// The object id is authenticated along with the content, so the
+// ciphertext of one object can't be passed off as another's.
+type AESGCMCipher struct {
+	aead cipher.AEAD
+
+	// RandSrc is the source of randomness for the nonces.
+	// Defaults to crypto/rand.Reader.
+	RandSrc io.Reader
+}
+
+func NewAESGCMCipher(key []byte) (*AESGCMCipher, error) {
+	if len(key) != AESGCMKeySize {
+		return nil, fmt.Errorf("AES-256-GCM key must be %d bytes, got %d", AESGCMKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESGCMCipher{aead: aead, RandSrc: rand.Reader}, nil
+}
+
+func (c *AESGCMCipher) Encrypt(id string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plaintext)+c.aead.Overhead())
+	_, err := io.ReadFull(c.RandSrc, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, []byte(id)), nil
+}
+
+func (c *AESGCMCipher) Decrypt(id string, ciphertext []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(ciphertext) < n+c.aead.Overhead() {
+		return nil, ErrCiphertextTooShort
+	}
+
+	plaintext, err := c.aead.Open(nil, ciphertext[:n], ciphertext[n:], []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	if plaintext == nil {
+		plaintext = []byte{}
+	}
+	return plaintext, nil
+}
+
+// encryptObjectStore encrypts every object written to the given store and
+// decrypts every object read from it. The wrapped store never implements
+// StreamingObjectStore, since the whole object is needed to authenticate it.
+func encryptObjectStore(c ObjectCipher, objDB ObjectStore) ObjectStore {
+	if objDB == nil || c == nil {
+		return objDB
+	}
+	return cipherObjectStore{objDB: objDB, cipher: c}
+}
+
+type cipherObjectStore struct {
+	objDB  ObjectStore
+	cipher ObjectCipher
+}
+
+func (s cipherObjectStore) Stat(ctx context.Context, id string) (*StatInfo, error) {
+	return s.objDB.Stat(ctx, id)
+}
+
+func (s cipherObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.objDB.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.cipher.Decrypt(id, b)
+}
+
+func (s cipherObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	b, err := s.cipher.Encrypt(id, b)
+	if err != nil {
+		return err
+	}
+	return s.objDB.Put(ctx, id, b)
+}
+
+func (s cipherObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	b, err := s.cipher.Encrypt(id, b)
+	if err != nil {
+		return err
+	}
+	return s.objDB.Update(ctx, id, b)
+}
+
+func (s cipherObjectStore) Delete(ctx context.Context, id string) error {
+	return s.objDB.Delete(ctx, id)
+}
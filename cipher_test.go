@@ -0,0 +1,105 @@
+package sakuin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAESGCMCipher(t *testing.T) {
+	newCipher := func(t *testing.T) *AESGCMCipher {
+		c, err := NewAESGCMCipher(make([]byte, AESGCMKeySize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	t.Run("should reject keys which aren't 32 bytes", func(subT *testing.T) {
+		_, err := NewAESGCMCipher(make([]byte, 16))
+		assert.NotNil(subT, err)
+	})
+
+	t.Run("should not decrypt under a different id", func(subT *testing.T) {
+		c := newCipher(subT)
+
+		ciphertext, err := c.Encrypt("a", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = c.Decrypt("b", ciphertext)
+		assert.NotNil(subT, err)
+	})
+
+	t.Run("should fail to decrypt truncated content", func(subT *testing.T) {
+		_, err := newCipher(subT).Decrypt("a", []byte("short"))
+		assert.Equal(subT, ErrCiphertextTooShort, err)
+	})
+
+	testCases := []struct {
+		Name    string
+		Content []byte
+	}{
+		{Name: "empty", Content: []byte{}},
+		{Name: "small", Content: []byte("test object content")},
+		{Name: "multi-megabyte", Content: bytes.Repeat([]byte("0123456789abcdef"), 4<<16)},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+		t.Run("should round trip "+tc.Name+" objects through the service", func(subT *testing.T) {
+			objStore := NewInMemoryObjectStore()
+			s := New(Config{
+				ObjectStore:   objStore,
+				DocumentStore: NewInMemoryDocumentStore(),
+				RandSrc:       rand.Reader,
+				ObjectCipher:  newCipher(subT),
+			})
+
+			resp, err := s.Index(context.Background(), &pb.IndexRequest{
+				Object:     tc.Content,
+				AllowEmpty: true,
+			})
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			stored := objStore.objects[resp.Id]
+			if !assert.NotEqual(subT, tc.Content, stored) {
+				return
+			}
+			if len(tc.Content) > 0 && !assert.False(subT, bytes.Contains(stored, tc.Content)) {
+				return
+			}
+
+			obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+			if !assert.Nil(subT, err) {
+				return
+			}
+			if !assert.Equal(subT, tc.Content, obj.Content) {
+				return
+			}
+
+			_, err = s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{
+				Id:         resp.Id,
+				Content:    tc.Content,
+				AllowEmpty: true,
+			})
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			obj, err = s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, tc.Content, obj.Content)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// ErrServiceClosed is returned by every Service operation called after Close.
+var ErrServiceClosed = errors.New("service is closed")
+
+// CloserWithContext is implemented by stores whose shutdown should respect a deadline.
+type CloserWithContext interface {
+	Close(ctx context.Context) error
+}
+
+// enter registers an in-flight operation. Every successful call
+// to enter must be followed by a call to exit.
+func (s *Service) enter() error {
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+
+	if s.closed {
+		return ErrServiceClosed
+	}
+	s.inflight.Add(1)
+	return nil
+}
+
+func (s *Service) exit() {
+	s.inflight.Done()
+}
+
+// Close stops the Service from accepting new operations, waits for
+// in-flight operations to finish and then closes the configured stores,
+// if they implement io.Closer or CloserWithContext.
+//
+// If the context is done before all in-flight operations have finished
+// the stores are closed anyway.
+func (s *Service) Close(ctx context.Context) error {
+	s.closeMu.Lock()
+	if s.closed {
+		s.closeMu.Unlock()
+		return ErrServiceClosed
+	}
+	s.closed = true
+	s.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.log.Warn("closing service before in-flight operations finished", zap.Error(ctx.Err()))
+	}
+
+	return multierr.Combine(
+		closeStore(ctx, s.rawObjDB),
+		closeStore(ctx, s.rawDocDB),
+	)
+}
+
+func closeStore(ctx context.Context, store interface{}) error {
+	switch c := store.(type) {
+	case CloserWithContext:
+		return c.Close(ctx)
+	case io.Closer:
+		return c.Close()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,160 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type closableObjectStore struct {
+	ObjectStore
+	closed bool
+	err    error
+}
+
+func (s *closableObjectStore) Close() error {
+	s.closed = true
+	return s.err
+}
+
+type closableDocumentStore struct {
+	DocumentStore
+	closed bool
+	err    error
+}
+
+func (s *closableDocumentStore) Close(ctx context.Context) error {
+	s.closed = true
+	return s.err
+}
+
+// blockingObjectStore blocks every Get until release is closed.
+type blockingObjectStore struct {
+	ObjectStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s blockingObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	close(s.started)
+	<-s.release
+	return s.ObjectStore.Get(ctx, id)
+}
+
+func TestClose(t *testing.T) {
+	t.Run("should close stores which implement a closer", func(subT *testing.T) {
+		objStore := &closableObjectStore{ObjectStore: NewInMemoryObjectStore()}
+		docStore := &closableDocumentStore{DocumentStore: NewInMemoryDocumentStore()}
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+			RetryPolicy:   RetryPolicy{MaxAttempts: 2},
+		})
+
+		err := s.Close(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, objStore.closed)
+		assert.True(subT, docStore.closed)
+	})
+
+	t.Run("should aggregate close errors", func(subT *testing.T) {
+		objErr := errors.New("object store")
+		docErr := errors.New("document store")
+
+		s := New(Config{
+			ObjectStore:   &closableObjectStore{ObjectStore: NewInMemoryObjectStore(), err: objErr},
+			DocumentStore: &closableDocumentStore{DocumentStore: NewInMemoryDocumentStore(), err: docErr},
+		})
+
+		err := s.Close(context.Background())
+		assert.ErrorIs(subT, err, objErr)
+		assert.ErrorIs(subT, err, docErr)
+	})
+
+	t.Run("should fail new calls once closed", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		err := s.Close(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		assert.Equal(subT, ErrServiceClosed, err)
+
+		err = s.Close(context.Background())
+		assert.Equal(subT, ErrServiceClosed, err)
+	})
+
+	t.Run("should wait for in-flight calls to finish", func(subT *testing.T) {
+		objStore := blockingObjectStore{
+			ObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			started:     make(chan struct{}),
+			release:     make(chan struct{}),
+		}
+		docStore := &closableDocumentStore{DocumentStore: NewInMemoryDocumentStore()}
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+		})
+
+		getErr := make(chan error, 1)
+		go func() {
+			_, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+			getErr <- err
+		}()
+		<-objStore.started
+
+		closeErr := make(chan error, 1)
+		go func() {
+			closeErr <- s.Close(context.Background())
+		}()
+
+		select {
+		case <-closeErr:
+			subT.Error("close should wait for in-flight calls")
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		close(objStore.release)
+		assert.Nil(subT, <-getErr)
+		assert.Nil(subT, <-closeErr)
+		assert.True(subT, docStore.closed)
+	})
+
+	t.Run("should stop waiting once the context is done", func(subT *testing.T) {
+		objStore := blockingObjectStore{
+			ObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			started:     make(chan struct{}),
+			release:     make(chan struct{}),
+		}
+		defer close(objStore.release)
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		go s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		<-objStore.started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := s.Close(ctx)
+		assert.Nil(subT, err)
+	})
+}
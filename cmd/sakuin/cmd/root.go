@@ -22,17 +22,28 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
+	"net"
+	nethttp "net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/z5labs/sakuin"
 	_ "github.com/z5labs/sakuin/docs"
+	sakuingrpc "github.com/z5labs/sakuin/grpc"
 	"github.com/z5labs/sakuin/http"
+	"github.com/z5labs/sakuin/storage/logging"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 var cfgFile string
@@ -51,16 +62,117 @@ var rootCmd = &cobra.Command{
 		}
 		defer zap.ReplaceGlobals(l)()
 
+		objStore := sakuin.NewInMemoryObjectStoreWithLimit(viper.GetInt64("max-object-bytes"), viper.GetInt("max-objects")).
+			WithEvictionHandler(func(id string) {
+				l.Warn("evicted object from memory", zap.String("id", id))
+			})
+		docStore := sakuin.NewInMemoryDocumentStoreWithLimit(viper.GetInt("max-docs")).
+			WithEvictionHandler(func(id string) {
+				l.Warn("evicted metadata from memory", zap.String("id", id))
+			})
+
 		s := sakuin.New(sakuin.Config{
-			ObjectStore:   sakuin.NewInMemoryObjectStore(),
-			DocumentStore: sakuin.NewInMemoryDocumentStore(),
+			ObjectStore:   logging.NewObjectStore(objStore, l),
+			DocumentStore: logging.NewDocumentStore(docStore, l),
 			RandSrc:       rand.Reader,
+			Logger:        l,
 		})
 
-		app := http.NewServer(s)
+		limits := http.Limits{
+			Object:   viper.GetInt64("max-upload-bytes"),
+			Metadata: viper.GetInt64("max-metadata-bytes"),
+		}
+		// The gRPC metrics share this registry, so the HTTP API serves both at /metrics
+		reg := prometheus.NewRegistry()
+		app := http.NewServer(s, http.WithLimits(limits), http.WithMetricsRegistry(reg))
+
+		var grpcOpts []sakuingrpc.Option
+		if viper.GetBool("grpc-reflection") {
+			grpcOpts = append(grpcOpts, sakuingrpc.WithReflection())
+		}
+		grpcSrv := sakuingrpc.NewServer(s, grpcOpts...)
+		var gs *grpc.Server
+		if addr := viper.GetString("grpc-addr"); addr != "" {
+			ls, err := net.Listen("tcp", addr)
+			if err != nil {
+				zap.L().Fatal("unable to listen for grpc", zap.Error(err))
+			}
+
+			// Panics are recovered innermost so they're logged and recorded as internal errors
+			m := sakuingrpc.NewMetrics(reg)
+			gs = grpc.NewServer(
+				grpc.ChainUnaryInterceptor(
+					sakuingrpc.LoggingUnaryInterceptor(l),
+					m.UnaryInterceptor(),
+					sakuingrpc.RecoveryUnaryInterceptor(l),
+				),
+				grpc.ChainStreamInterceptor(
+					sakuingrpc.LoggingStreamInterceptor(l),
+					m.StreamInterceptor(),
+					sakuingrpc.RecoveryStreamInterceptor(l),
+				),
+			)
+			grpcSrv.Register(gs)
+			go func() {
+				err := gs.Serve(ls)
+				if err != nil {
+					zap.L().Error("grpc server shutdown", zap.Error(err))
+				}
+			}()
+		}
+
+		var gw *nethttp.Server
+		if addr := viper.GetString("gateway-addr"); addr != "" {
+			mux, err := sakuingrpc.NewGateway(context.Background(), grpcSrv, limits)
+			if err != nil {
+				zap.L().Fatal("unable to create gateway", zap.Error(err))
+			}
+
+			gw = &nethttp.Server{Addr: addr, Handler: mux}
+			go func() {
+				err := gw.ListenAndServe()
+				if err != nil && err != nethttp.ErrServerClosed {
+					zap.L().Error("gateway shutdown", zap.Error(err))
+				}
+			}()
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigCh
+			zap.L().Info("shutting down server")
+
+			// Fail health checks first so load balancers stop sending requests
+			grpcSrv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+			if gs != nil {
+				gs.GracefulStop()
+			}
+			if gw != nil {
+				err := gw.Shutdown(context.Background())
+				if err != nil {
+					zap.L().Error("unable to shutdown gateway", zap.Error(err))
+				}
+			}
+
+			err := app.Shutdown()
+			if err != nil {
+				zap.L().Error("unable to shutdown server", zap.Error(err))
+			}
+		}()
+
 		err = app.Listen(":8080")
+		if err != nil {
+			zap.L().Fatal("server shutdown", zap.Error(err))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
 
-		zap.L().Fatal("server shutdown", zap.Error(err))
+		err = s.Close(ctx)
+		if err != nil {
+			zap.L().Error("unable to close service", zap.Error(err))
+		}
 	},
 }
 
@@ -81,6 +193,16 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cmd.yaml)")
+
+	rootCmd.Flags().Int64("max-object-bytes", 0, "max bytes of objects held in memory before evicting the least recently used, 0 is unlimited")
+	rootCmd.Flags().Int("max-objects", 0, "max objects held in memory before evicting the least recently used, 0 is unlimited")
+	rootCmd.Flags().Int("max-docs", 0, "max metadata documents held in memory before evicting the least recently used, 0 is unlimited")
+	rootCmd.Flags().Int64("max-upload-bytes", 0, "max bytes of an uploaded object, 0 is unlimited")
+	rootCmd.Flags().Int64("max-metadata-bytes", http.DefaultMetadataLimit, "max bytes of a metadata request body")
+	rootCmd.Flags().String("grpc-addr", "", "address to serve the gRPC API on, disabled if empty")
+	rootCmd.Flags().Bool("grpc-reflection", false, "serve gRPC server reflection, so tools like grpcurl can discover the API")
+	rootCmd.Flags().String("gateway-addr", "", "address to serve the gRPC API over HTTP on, disabled if empty")
+	viper.BindPFlags(rootCmd.Flags())
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,216 @@
+package sakuin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies how objects are compressed before being stored.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// UnsupportedCompressionErr represents an unknown Compression.
+type UnsupportedCompressionErr struct {
+	Compression Compression
+}
+
+func (e UnsupportedCompressionErr) Error() string {
+	return fmt.Sprintf("unsupported compression: %s", e.Compression)
+}
+
+// compressionMagic starts the header in front of every compressed object,
+// followed by a single byte identifying the compression. Objects without
+// it are returned as they were stored, which keeps objects written before
+// compression was enabled readable.
+var compressionMagic = []byte("\x00SKZ")
+
+const (
+	gzipHeaderByte byte = 1
+	zstdHeaderByte byte = 2
+)
+
+// compressObjectStore compresses every object written to the given store
+// and decompresses every object read from it. Reads are decompressed even
+// when compression is disabled, so objects written while it was enabled
+// stay readable. The wrapped store only implements StreamingObjectStore
+// while compression is disabled.
+func compressObjectStore(c Compression, objDB ObjectStore) ObjectStore {
+	if objDB == nil {
+		return objDB
+	}
+
+	s := compressingObjectStore{objDB: objDB, compression: c}
+	if streamDB, ok := objDB.(StreamingObjectStore); ok && c == CompressionNone {
+		return decompressingStreamingObjectStore{compressingObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// zstd encoders and decoders are safe for concurrent use through
+// EncodeAll and DecodeAll, so they're shared by every store.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+type compressingObjectStore struct {
+	objDB       ObjectStore
+	compression Compression
+}
+
+func (s compressingObjectStore) compress(b []byte) ([]byte, error) {
+	return CompressObject(s.compression, b, 0)
+}
+
+// CompressObject compresses b and prepends the header read by DecompressObject.
+// Unless compression shrinks b by more than minSavings percent, b is returned
+// as it is, so objects which are already compressed aren't stored any larger.
+func CompressObject(c Compression, b []byte, minSavings int) ([]byte, error) {
+	if c == CompressionNone {
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Write(compressionMagic)
+
+	switch c {
+	case CompressionGzip:
+		buf.WriteByte(gzipHeaderByte)
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write(b)
+		if err != nil {
+			return nil, err
+		}
+		err = zw.Close()
+		if err != nil {
+			return nil, err
+		}
+	case CompressionZstd:
+		buf.WriteByte(zstdHeaderByte)
+		buf.Write(zstdEncoder.EncodeAll(b, nil))
+	default:
+		return nil, UnsupportedCompressionErr{Compression: c}
+	}
+
+	if buf.Len() >= len(b)-len(b)*minSavings/100 {
+		return b, nil
+	}
+	return buf.Bytes(), nil
+}
+
+func isCompressed(b []byte) bool {
+	n := len(compressionMagic)
+	return len(b) > n && bytes.Equal(b[:n], compressionMagic)
+}
+
+// DecompressObject reverses CompressObject. Objects without the header
+// are returned as they are.
+func DecompressObject(b []byte) ([]byte, error) {
+	if !isCompressed(b) {
+		return b, nil
+	}
+
+	n := len(compressionMagic)
+	switch b[n] {
+	case gzipHeaderByte:
+		zr, err := gzip.NewReader(bytes.NewReader(b[n+1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	case zstdHeaderByte:
+		return zstdDecoder.DecodeAll(b[n+1:], nil)
+	default:
+		return b, nil
+	}
+}
+
+func (s compressingObjectStore) Stat(ctx context.Context, id string) (*StatInfo, error) {
+	return s.objDB.Stat(ctx, id)
+}
+
+func (s compressingObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.objDB.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return DecompressObject(b)
+}
+
+func (s compressingObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	b, err := s.compress(b)
+	if err != nil {
+		return err
+	}
+	return s.objDB.Put(ctx, id, b)
+}
+
+func (s compressingObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	b, err := s.compress(b)
+	if err != nil {
+		return err
+	}
+	return s.objDB.Update(ctx, id, b)
+}
+
+func (s compressingObjectStore) Delete(ctx context.Context, id string) error {
+	return s.objDB.Delete(ctx, id)
+}
+
+// decompressingStreamingObjectStore streams objects through untouched,
+// unless they were compressed, in which case they're decompressed into memory.
+type decompressingStreamingObjectStore struct {
+	compressingObjectStore
+	streamDB StreamingObjectStore
+}
+
+func (s decompressingStreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.streamDB.PutStream(ctx, id, r, size)
+}
+
+func (s decompressingStreamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	rc, size, err := s.streamDB.GetStream(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	header := make([]byte, len(compressionMagic)+1)
+	n, err := io.ReadFull(rc, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		rc.Close()
+		return nil, 0, err
+	}
+	header = header[:n]
+
+	if !isCompressed(header) {
+		return readCloser{Reader: io.MultiReader(bytes.NewReader(header), rc), Closer: rc}, size, nil
+	}
+	defer rc.Close()
+
+	rest, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, 0, err
+	}
+	b, err := DecompressObject(append(header, rest...))
+	if err != nil {
+		return nil, 0, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,213 @@
+package sakuin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// compressibleObject is representative of the JSON objects which are commonly indexed.
+var compressibleObject = []byte(strings.Repeat(`{"name":"test","description":"test description","tags":["a","b","c"]}`+"\n", 1<<10))
+
+func TestCompressObjects(t *testing.T) {
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd} {
+		c := compression
+
+		t.Run("should round trip "+string(c)+" compressed objects", func(subT *testing.T) {
+			objStore := NewInMemoryObjectStore()
+			s := New(Config{
+				ObjectStore:     objStore,
+				DocumentStore:   NewInMemoryDocumentStore(),
+				RandSrc:         rand.Reader,
+				CompressObjects: c,
+			})
+
+			resp, err := s.Index(context.Background(), &pb.IndexRequest{Object: compressibleObject})
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			stored := objStore.objects[resp.Id]
+			if !assert.Less(subT, len(stored), len(compressibleObject)) {
+				return
+			}
+
+			obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, compressibleObject, obj.Content)
+		})
+	}
+
+	t.Run("should store empty objects as they are", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore:     objStore,
+			DocumentStore:   NewInMemoryDocumentStore(),
+			RandSrc:         rand.Reader,
+			CompressObjects: CompressionZstd,
+		})
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{AllowEmpty: true})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Empty(subT, objStore.objects[resp.Id]) {
+			return
+		}
+
+		obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, obj.Content)
+	})
+
+	t.Run("should store already compressed objects as they are", func(subT *testing.T) {
+		random := make([]byte, 4<<10)
+		_, err := rand.Read(random)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore:     objStore,
+			DocumentStore:   NewInMemoryDocumentStore(),
+			RandSrc:         rand.Reader,
+			CompressObjects: CompressionGzip,
+		})
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{Object: random})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Equal(subT, random, objStore.objects[resp.Id]) {
+			return
+		}
+
+		obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, random, obj.Content)
+	})
+
+	t.Run("should read objects written before compression was enabled", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:     NewInMemoryObjectStore().WithObject("test", compressibleObject),
+			DocumentStore:   NewInMemoryDocumentStore(),
+			CompressObjects: CompressionZstd,
+		})
+
+		obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, compressibleObject, obj.Content)
+	})
+
+	t.Run("should read compressed objects after compression is disabled", func(subT *testing.T) {
+		objStore := &streamingObjectStore{InMemoryObjectStore: NewInMemoryObjectStore()}
+		docStore := NewInMemoryDocumentStore()
+
+		resp, err := New(Config{
+			ObjectStore:     objStore,
+			DocumentStore:   docStore,
+			RandSrc:         rand.Reader,
+			CompressObjects: CompressionGzip,
+		}).Index(context.Background(), &pb.IndexRequest{Object: compressibleObject})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+		})
+
+		obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Equal(subT, compressibleObject, obj.Content) {
+			return
+		}
+
+		rc, size, err := s.GetObjectStream(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer rc.Close()
+
+		b, err := ioutil.ReadAll(rc)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, compressibleObject, b)
+		assert.Equal(subT, int64(len(compressibleObject)), size)
+	})
+
+	t.Run("should fail to store objects with an unsupported compression", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:     NewInMemoryObjectStore(),
+			DocumentStore:   NewInMemoryDocumentStore(),
+			RandSrc:         rand.Reader,
+			CompressObjects: "lz4",
+		})
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{Object: compressibleObject})
+		assert.IsType(subT, UnsupportedCompressionErr{}, err)
+	})
+}
+
+// BenchmarkCompressedGetObject reads back a text object stored with each
+// compression, reporting how many bytes the store had to hold for it.
+func BenchmarkCompressedGetObject(b *testing.B) {
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		c := compression
+		name := string(c)
+		if c == CompressionNone {
+			name = "none"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			objStore := NewInMemoryObjectStore()
+			s := New(Config{
+				ObjectStore:     objStore,
+				DocumentStore:   NewInMemoryDocumentStore(),
+				RandSrc:         rand.Reader,
+				CompressObjects: c,
+			})
+
+			resp, err := s.Index(context.Background(), &pb.IndexRequest{Object: compressibleObject})
+			if err != nil {
+				b.Error(err)
+				return
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				if !bytes.Equal(compressibleObject, obj.Content) {
+					b.Error("object was corrupted")
+					return
+				}
+			}
+			b.ReportMetric(float64(len(objStore.objects[resp.Id])), "stored-bytes")
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package sakuin
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// HashIndex maps object checksums to the id of an object with that content.
+type HashIndex interface {
+	// Get returns the id recorded for the checksum, if any.
+	Get(ctx context.Context, checksum string) (string, bool, error)
+	Put(ctx context.Context, checksum, id string) error
+	Delete(ctx context.Context, checksum string) error
+}
+
+type InMemoryHashIndex struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func NewInMemoryHashIndex() *InMemoryHashIndex {
+	return &InMemoryHashIndex{
+		ids: make(map[string]string),
+	}
+}
+
+func (idx *InMemoryHashIndex) Get(ctx context.Context, checksum string) (string, bool, error) {
+	idx.mu.Lock()
+	id, ok := idx.ids[checksum]
+	idx.mu.Unlock()
+
+	return id, ok, nil
+}
+
+func (idx *InMemoryHashIndex) Put(ctx context.Context, checksum, id string) error {
+	idx.mu.Lock()
+	idx.ids[checksum] = id
+	idx.mu.Unlock()
+
+	return nil
+}
+
+func (idx *InMemoryHashIndex) Delete(ctx context.Context, checksum string) error {
+	idx.mu.Lock()
+	delete(idx.ids, checksum)
+	idx.mu.Unlock()
+
+	return nil
+}
+
+// deduplicate looks for an already indexed object with the given checksum and,
+// if found, merges the metadata onto it and returns its id.
+//
+// The hash index is only a hint, since the object may have since been updated,
+// moved or removed, so the recorded checksum of the existing entry is always checked.
+func (s *Service) deduplicate(ctx context.Context, checksum string, metadata map[string]interface{}) (string, bool, error) {
+	id, ok, err := s.hashes.Get(ctx, checksum)
+	if err != nil {
+		s.log.Error("unexpected error when looking up checksum", zap.String("checksum", checksum), zap.Error(err))
+		return "", false, err
+	}
+	if !ok {
+		return "", false, nil
+	}
+
+	doc, err := s.docDB.Get(ctx, id)
+	if _, ok := err.(DocumentDoesNotExistErr); ok {
+		doc = nil
+		err = nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if doc == nil || getReservedString(doc, checksumMetadataKey) != checksum || s.isExpired(doc) {
+		s.log.Info("removing stale checksum", zap.String("checksum", checksum), zap.String("id", id))
+		err = s.hashes.Delete(ctx, checksum)
+		if err != nil {
+			s.log.Error("unable to remove stale checksum", zap.String("checksum", checksum), zap.Error(err))
+		}
+		return "", false, nil
+	}
+
+	s.log.Info("deduplicated object", zap.String("id", id))
+	if len(metadata) == 0 {
+		return id, true, nil
+	}
+
+	err = s.validateMetadata(ctx, id, metadata)
+	if err != nil {
+		return "", false, err
+	}
+
+	err = s.docDB.Upsert(ctx, id, metadata)
+	if err != nil {
+		s.log.Error("unexpected error when merging metadata", zap.String("id", id), zap.Error(err))
+		return "", false, err
+	}
+
+	s.runHook("OnMetadataUpdated", s.hooks.OnMetadataUpdated, id, HookSummary{})
+	return id, true, nil
+}
+
+// recordChecksum adds a newly indexed object to the hash index. Failures
+// are only logged since they only cause a later duplicate to be stored.
+func (s *Service) recordChecksum(ctx context.Context, checksum, id string) {
+	if !s.dedupe {
+		return
+	}
+
+	err := s.hashes.Put(ctx, checksum, id)
+	if err != nil {
+		s.log.Error("unable to record checksum", zap.String("checksum", checksum), zap.String("id", id), zap.Error(err))
+	}
+}
+
+// forgetChecksum removes a deleted object from the hash index, so later
+// duplicates are stored instead of being merged onto its remaining metadata.
+// Failures are only logged since deduplicate re-checks entries anyway.
+func (s *Service) forgetChecksum(ctx context.Context, id string) {
+	if !s.dedupe {
+		return
+	}
+
+	doc, err := s.getReserved(ctx, id)
+	if err != nil {
+		return
+	}
+	checksum := getReservedString(doc, checksumMetadataKey)
+	if checksum == "" {
+		return
+	}
+
+	indexed, ok, err := s.hashes.Get(ctx, checksum)
+	if err != nil || !ok || indexed != id {
+		return
+	}
+	err = s.hashes.Delete(ctx, checksum)
+	if err != nil {
+		s.log.Error("unable to remove checksum", zap.String("checksum", checksum), zap.String("id", id), zap.Error(err))
+	}
+}
@@ -0,0 +1,135 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupeByContent(t *testing.T) {
+	newService := func(objStore ObjectStore, docStore DocumentStore) *Service {
+		return New(Config{
+			ObjectStore:     objStore,
+			DocumentStore:   docStore,
+			RandSrc:         rand.Reader,
+			DedupeByContent: true,
+		})
+	}
+
+	t.Run("should return the existing id for identical objects", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		docStore := NewInMemoryDocumentStore()
+		s := newService(objStore, docStore)
+
+		first, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, first.Deduplicated)
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "duplicate"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		second, err := s.Index(context.Background(), &pb.IndexRequest{Metadata: metadata, Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, second.Deduplicated)
+		assert.Equal(subT, first.Id, second.Id)
+		assert.Equal(subT, first.Checksum, second.Checksum)
+		assert.Equal(subT, 1, objStore.NumOfObects())
+
+		doc, err := docStore.Get(context.Background(), first.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "duplicate", doc["name"])
+		assert.Equal(subT, first.Checksum, getReservedString(doc, checksumMetadataKey))
+	})
+
+	t.Run("should store different objects separately", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := newService(objStore, NewInMemoryDocumentStore())
+
+		first, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		second, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("other content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, second.Deduplicated)
+		assert.NotEqual(subT, first.Id, second.Id)
+		assert.Equal(subT, 2, objStore.NumOfObects())
+	})
+
+	t.Run("should ignore stale checksums", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := newService(objStore, NewInMemoryDocumentStore())
+
+		first, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{Id: first.Id, Content: []byte("updated")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		second, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, second.Deduplicated)
+		assert.NotEqual(subT, first.Id, second.Id)
+	})
+
+	t.Run("should not deduplicate caller supplied ids", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := newService(objStore, NewInMemoryDocumentStore())
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{Id: "mine", Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, resp.Deduplicated)
+		assert.Equal(subT, "mine", resp.Id)
+		assert.Equal(subT, 2, objStore.NumOfObects())
+	})
+	t.Run("should not deduplicate onto deleted objects", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := newService(objStore, NewInMemoryDocumentStore())
+
+		first, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.DeleteObject(context.Background(), first.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		second, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, second.Deduplicated)
+		assert.NotEqual(subT, first.Id, second.Id)
+		assert.Equal(subT, 1, objStore.NumOfObects())
+	})
+}
@@ -0,0 +1,223 @@
+// Package cache provides a DocumentStore which caches the documents
+// of another DocumentStore in memory.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/z5labs/sakuin"
+)
+
+// CacheOptions bounds how much is cached. Zero values mean no bound.
+type CacheOptions struct {
+	// MaxEntries is the maximum number of cached documents.
+	MaxEntries int
+
+	// TTL is how long a document stays cached after being read or written.
+	TTL time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// CacheStats counts how the cache has been used.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+}
+
+// DocumentStore caches documents read from the inner store, evicting the
+// least recently used documents once MaxEntries is reached.
+//
+// Writes always go to the inner store first. Once they succeed, Upsert
+// merges the document into the cached one, Replace caches the new document
+// and Delete drops it. Documents read or merged while another write is in
+// flight aren't cached, so the cache never holds a document which has since
+// been replaced. Stat is answered from the cache when possible.
+//
+// Documents are copied going in and out of the cache, so callers are free
+// to modify the documents they pass in or get back.
+type DocumentStore struct {
+	inner sakuin.DocumentStore
+	opts  CacheOptions
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	writes  uint64
+	stats   CacheStats
+}
+
+type entry struct {
+	id        string
+	doc       map[string]interface{}
+	expiresAt time.Time
+}
+
+// NewCached returns a DocumentStore caching the documents of inner.
+func NewCached(inner sakuin.DocumentStore, opts CacheOptions) *DocumentStore {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &DocumentStore{
+		inner:   inner,
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Stats returns how the cache has been used so far.
+func (s *DocumentStore) Stats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Entries = s.lru.Len()
+	return stats
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	s.mu.Lock()
+	e, ok := s.lookup(id)
+	s.mu.Unlock()
+	if ok {
+		return &sakuin.StatInfo{Exists: true, Size: len(e.doc)}, nil
+	}
+	return s.inner.Stat(ctx, id)
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	e, ok := s.lookup(id)
+	if ok {
+		s.stats.Hits++
+		doc := sakuin.CopyDoc(e.doc)
+		s.mu.Unlock()
+		return doc, nil
+	}
+	s.stats.Misses++
+	writes := s.writes
+	s.mu.Unlock()
+
+	doc, err := s.inner.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	doc = sakuin.CopyDoc(doc)
+	s.mu.Lock()
+	if s.writes == writes {
+		s.add(id, sakuin.CopyDoc(doc))
+	}
+	s.mu.Unlock()
+	return doc, nil
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	doc = sakuin.CopyDoc(doc)
+	return s.write(id, func() error {
+		return s.inner.Upsert(ctx, id, sakuin.CopyDoc(doc))
+	}, func(cached map[string]interface{}, ok bool) (map[string]interface{}, bool) {
+		if !ok {
+			return nil, false
+		}
+		merged, err := sakuin.MergeDocs(doc, cached)
+		return merged, err == nil
+	})
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	doc = sakuin.CopyDoc(doc)
+	return s.write(id, func() error {
+		return s.inner.Replace(ctx, id, sakuin.CopyDoc(doc))
+	}, func(map[string]interface{}, bool) (map[string]interface{}, bool) {
+		return doc, true
+	})
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	return s.write(id, func() error {
+		return s.inner.Delete(ctx, id)
+	}, func(map[string]interface{}, bool) (map[string]interface{}, bool) {
+		return nil, false
+	})
+}
+
+// write runs f against the inner store, then drops the document from
+// the cache. If f succeeded and no other write finished in the meantime,
+// the document returned by update is cached in its place. update is
+// given the cached document, if any, which it may modify.
+func (s *DocumentStore) write(id string, f func() error, update func(map[string]interface{}, bool) (map[string]interface{}, bool)) error {
+	s.mu.Lock()
+	writes := s.writes
+	s.mu.Unlock()
+
+	err := f()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writes++
+	e, cached := s.lookup(id)
+	if cached {
+		s.remove(s.entries[id])
+	}
+	if err != nil || s.writes != writes+1 {
+		return err
+	}
+
+	var cachedDoc map[string]interface{}
+	if cached {
+		cachedDoc = e.doc
+	}
+	if doc, ok := update(cachedDoc, cached); ok {
+		s.add(id, doc)
+	}
+	return nil
+}
+
+// lookup must be called with the lock held.
+func (s *DocumentStore) lookup(id string) (*entry, bool) {
+	el, ok := s.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if s.opts.TTL > 0 && !s.opts.Now().Before(e.expiresAt) {
+		s.remove(el)
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return e, true
+}
+
+// add must be called with the lock held.
+func (s *DocumentStore) add(id string, doc map[string]interface{}) {
+	if el, ok := s.entries[id]; ok {
+		s.remove(el)
+	}
+
+	e := &entry{id: id, doc: doc}
+	if s.opts.TTL > 0 {
+		e.expiresAt = s.opts.Now().Add(s.opts.TTL)
+	}
+	s.entries[id] = s.lru.PushFront(e)
+
+	for s.opts.MaxEntries > 0 && s.lru.Len() > s.opts.MaxEntries {
+		s.remove(s.lru.Back())
+		s.stats.Evictions++
+	}
+}
+
+// remove must be called with the lock held.
+func (s *DocumentStore) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.entries, e.id)
+}
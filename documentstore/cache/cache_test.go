@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingDocumentStore counts the reads which reach the inner store.
+type countingDocumentStore struct {
+	*sakuin.InMemoryDocumentStore
+	gets  int32
+	stats int32
+}
+
+func (s *countingDocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	atomic.AddInt32(&s.gets, 1)
+	return s.InMemoryDocumentStore.Get(ctx, id)
+}
+
+func (s *countingDocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	atomic.AddInt32(&s.stats, 1)
+	return s.InMemoryDocumentStore.Stat(ctx, id)
+}
+
+// blockingDocumentStore blocks Gets until they're released.
+type blockingDocumentStore struct {
+	*sakuin.InMemoryDocumentStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingDocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	doc, err := s.InMemoryDocumentStore.Get(ctx, id)
+	doc = sakuin.CopyDoc(doc)
+	s.started <- struct{}{}
+	<-s.release
+	return doc, err
+}
+
+func TestCachedDocumentStore(t *testing.T) {
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), NewCached(sakuin.NewInMemoryDocumentStore(), CacheOptions{}))
+
+	t.Run("should serve repeated reads from the cache", func(subT *testing.T) {
+		inner := &countingDocumentStore{
+			InMemoryDocumentStore: sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+		}
+		s := NewCached(inner, CacheOptions{})
+
+		for i := 0; i < 3; i++ {
+			doc, err := s.Get(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+		}
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: 1}, stats)
+
+		assert.Equal(subT, int32(1), inner.gets)
+		assert.Equal(subT, int32(0), inner.stats)
+		assert.Equal(subT, CacheStats{Hits: 2, Misses: 1, Entries: 1}, s.Stats())
+	})
+
+	t.Run("should not let callers modify cached documents", func(subT *testing.T) {
+		s := NewCached(sakuin.NewInMemoryDocumentStore(), CacheOptions{})
+
+		in := map[string]interface{}{"owner": map[string]interface{}{"name": "a"}}
+		err := s.Replace(context.Background(), "test", in)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		in["owner"].(map[string]interface{})["name"] = "b"
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		doc["owner"].(map[string]interface{})["name"] = "c"
+
+		doc, err = s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"owner": map[string]interface{}{"name": "a"}}, doc)
+	})
+
+	t.Run("should merge upserts into the cached document", func(subT *testing.T) {
+		inner := &countingDocumentStore{
+			InMemoryDocumentStore: sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+				"name":  "test",
+				"owner": map[string]interface{}{"name": "a", "team": "b"},
+			}),
+		}
+		s := NewCached(inner, CacheOptions{})
+
+		_, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{
+			"owner": map[string]interface{}{"name": "c"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		want, err := inner.InMemoryDocumentStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, want, doc)
+		assert.Equal(subT, int32(1), inner.gets)
+	})
+
+	t.Run("should evict deleted documents", func(subT *testing.T) {
+		s := NewCached(sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}), CacheOptions{})
+
+		_, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Delete(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.Get(context.Background(), "test")
+		var docErr sakuin.DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, stats.Exists)
+	})
+
+	t.Run("should evict the least recently used documents", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryDocumentStore()
+		for _, id := range []string{"a", "b", "c"} {
+			inner.WithDocument(id, map[string]interface{}{"name": id})
+		}
+		s := NewCached(inner, CacheOptions{MaxEntries: 2})
+
+		for _, id := range []string{"a", "b", "a", "c"} {
+			_, err := s.Get(context.Background(), id)
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		stats := s.Stats()
+		assert.Equal(subT, int64(1), stats.Evictions)
+		assert.Equal(subT, 2, stats.Entries)
+		assert.Contains(subT, s.entries, "a")
+		assert.Contains(subT, s.entries, "c")
+	})
+
+	t.Run("should expire cached documents after the ttl", func(subT *testing.T) {
+		now := time.Now()
+		inner := &countingDocumentStore{
+			InMemoryDocumentStore: sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+		}
+		s := NewCached(inner, CacheOptions{
+			TTL: time.Minute,
+			Now: func() time.Time { return now },
+		})
+
+		_, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		now = now.Add(time.Minute)
+		_, err = s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, int32(2), inner.gets)
+	})
+
+	t.Run("should not cache a document replaced while it was being read", func(subT *testing.T) {
+		inner := &blockingDocumentStore{
+			InMemoryDocumentStore: sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "old"}),
+			started:               make(chan struct{}),
+			release:               make(chan struct{}),
+		}
+		s := NewCached(inner, CacheOptions{})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.Get(context.Background(), "test")
+		}()
+		<-inner.started
+
+		err := s.Delete(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		close(inner.release)
+		<-done
+
+		assert.Equal(subT, 0, s.Stats().Entries)
+	})
+
+	t.Run("should always read the latest write under concurrent access", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"n": "0"})
+		s := NewCached(inner, CacheOptions{MaxEntries: 1})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					doc, err := s.Get(context.Background(), "test")
+					if err == nil {
+						doc["n"] = "modified"
+					}
+				}
+			}()
+		}
+		for i := 1; i <= 100; i++ {
+			err := s.Replace(context.Background(), "test", map[string]interface{}{"n": fmt.Sprint(i)})
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+		wg.Wait()
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"n": "100"}, doc)
+	})
+}
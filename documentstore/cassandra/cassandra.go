@@ -0,0 +1,222 @@
+// Package cassandra provides a DocumentStore which keeps documents in a
+// Cassandra or ScyllaDB table.
+package cassandra
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/gocql/gocql"
+)
+
+// DefaultMaxRetries is how many times writes are retried after losing a
+// race with a concurrent write, if no other limit is given.
+const DefaultMaxRetries = 20
+
+// ErrTooManyRetries is returned when a write loses a race with concurrent
+// writes of the same document more than Options.MaxRetries times.
+var ErrTooManyRetries = errors.New("cassandra: too many concurrent writes")
+
+// Setup creates the table documents are stored in, if it doesn't exist.
+// The keyspace must exist.
+func Setup(ctx context.Context, session *gocql.Session, keyspace string, table string) error {
+	return session.Query(`CREATE TABLE IF NOT EXISTS ` + qualify(keyspace, table) + ` (
+		id text PRIMARY KEY,
+		doc text
+	)`).WithContext(ctx).Exec()
+}
+
+// qualify returns the quoted name of the table in the keyspace.
+func qualify(keyspace string, table string) string {
+	return quote(keyspace) + "." + quote(table)
+}
+
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Options configures the DocumentStore.
+type Options struct {
+	// MaxRetries is how many times writes are retried after losing a race
+	// with a concurrent write of the same document. Zero uses
+	// DefaultMaxRetries.
+	MaxRetries int
+}
+
+// DocumentStore stores documents as JSON in a table created by Setup, one
+// row per document.
+//
+// Every write is a lightweight transaction which only applies if the row
+// still holds the document it was based on, and is redone with the row
+// Cassandra returns if it doesn't, so concurrent Upserts don't lose
+// fields. Mixing lightweight transactions with plain writes of the same
+// row isn't safe, so the table shouldn't be written to by anything else.
+type DocumentStore struct {
+	session    *gocql.Session
+	table      string
+	maxRetries int
+}
+
+// New returns a DocumentStore which stores documents in the given table,
+// which must have been created by Setup.
+func New(session *gocql.Session, keyspace string, table string, opts Options) *DocumentStore {
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	return &DocumentStore{session: session, table: qualify(keyspace, table), maxRetries: maxRetries}
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	doc, err := s.Get(ctx, id)
+	var docErr sakuin.DocumentDoesNotExistErr
+	if errors.As(err, &docErr) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{Exists: true, Size: len(doc)}, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	b, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return decode(*b)
+}
+
+// get reads the JSON of a document, which is nil if it doesn't exist.
+func (s *DocumentStore) get(ctx context.Context, id string) (*string, error) {
+	// Cassandra doesn't allow empty keys, so no such document can exist.
+	if id == "" {
+		return nil, nil
+	}
+
+	var b string
+	err := s.session.Query(`SELECT doc FROM `+s.table+` WHERE id = ?`, id).WithContext(ctx).Scan(&b)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, id, func(old *string) (string, error) {
+		if old == nil {
+			return string(b), nil
+		}
+
+		// Decoding the encoded document copies it, so merging can't modify
+		// the caller's document.
+		newDoc, err := decode(string(b))
+		if err != nil {
+			return "", err
+		}
+		oldDoc, err := decode(*old)
+		if err != nil {
+			return "", err
+		}
+		merged, err := sakuin.MergeDocs(newDoc, oldDoc)
+		if err != nil {
+			return "", err
+		}
+
+		mb, err := json.Marshal(merged)
+		return string(mb), err
+	})
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, id, func(*string) (string, error) {
+		return string(b), nil
+	})
+}
+
+// write replaces the JSON of a document with the JSON returned by f for
+// its current JSON, which is nil if it doesn't exist.
+func (s *DocumentStore) write(ctx context.Context, id string, f func(old *string) (string, error)) error {
+	old, err := s.get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		b, err := f(old)
+		if err != nil {
+			return err
+		}
+
+		var q *gocql.Query
+		if old == nil {
+			q = s.session.Query(`INSERT INTO `+s.table+` (id, doc) VALUES (?, ?) IF NOT EXISTS`, id, b)
+		} else {
+			q = s.session.Query(`UPDATE `+s.table+` SET doc = ? WHERE id = ? IF doc = ?`, b, id, *old)
+		}
+		current := map[string]interface{}{}
+		applied, err := q.WithContext(ctx).MapScanCAS(current)
+		if err != nil {
+			return err
+		}
+		if applied {
+			return nil
+		}
+
+		// The row Cassandra returns is the one the write lost to.
+		old = nil
+		if cur, ok := current["doc"].(string); ok {
+			old = &cur
+		}
+	}
+	return ErrTooManyRetries
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+
+	applied, err := s.session.Query(`DELETE FROM `+s.table+` WHERE id = ? IF EXISTS`, id).
+		WithContext(ctx).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return nil
+}
+
+func decode(b string) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	err := json.Unmarshal([]byte(b), &doc)
+	if err != nil {
+		return nil, fmt.Errorf("cassandra: failed to decode document: %w", err)
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	return doc, nil
+}
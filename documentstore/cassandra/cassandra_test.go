@@ -0,0 +1,94 @@
+package cassandra
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+// hostsEnv names the environment variable holding the comma separated
+// addresses of the cluster the tests run against, e.g. localhost:9042.
+// The tests are skipped without it.
+const hostsEnv = "SAKUIN_CASSANDRA_HOSTS"
+
+const keyspace = "sakuin_test"
+
+// newStore returns a DocumentStore backed by a table of its own, which is
+// dropped once the test finishes.
+func newStore(t *testing.T, opts Options) *DocumentStore {
+	hosts := os.Getenv(hostsEnv)
+	if hosts == "" {
+		t.Skipf("%s isn't set", hostsEnv)
+	}
+
+	cluster := gocql.NewCluster(strings.Split(hosts, ",")...)
+	cluster.Timeout = 10 * time.Second
+	session, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(session.Close)
+
+	ctx := context.Background()
+	err = session.Query(`CREATE KEYSPACE IF NOT EXISTS ` + keyspace + `
+		WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}`).WithContext(ctx).Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := fmt.Sprintf("docs_%d", time.Now().UnixNano())
+	err = Setup(ctx, session, keyspace, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		session.Query(`DROP TABLE ` + qualify(keyspace, table)).Exec()
+	})
+	return New(session, keyspace, table, opts)
+}
+
+func TestDocumentStore(t *testing.T) {
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), newStore(t, Options{}))
+
+	t.Run("should leave the document untouched if the merge fails", func(subT *testing.T) {
+		s := newStore(subT, Options{})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{
+			"owner": map[string]interface{}{"name": "a"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{"owner": "b"})
+		var mergeErr sakuin.MergeConflictErr
+		if !assert.ErrorAs(subT, err, &mergeErr) {
+			return
+		}
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"owner": map[string]interface{}{"name": "a"}}, doc)
+	})
+}
+
+func TestQualify(t *testing.T) {
+	t.Run("should quote the keyspace and table", func(subT *testing.T) {
+		assert.Equal(subT, `"sakuin"."Documents"`, qualify("sakuin", "Documents"))
+	})
+
+	t.Run("should escape quotes in names", func(subT *testing.T) {
+		assert.Equal(subT, `"sakuin"."docs""; DROP TABLE x; --"`, qualify("sakuin", `docs"; DROP TABLE x; --`))
+	})
+}
@@ -0,0 +1,455 @@
+// Package elasticsearch provides a QueryableDocumentStore which keeps
+// documents in an Elasticsearch index and evaluates queries with it.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// IDField is the field the id of every document is indexed under, so
+// queries can be sorted by id. It's removed from the documents returned
+// by the store.
+const IDField = "@sakuin_id"
+
+// retryOnConflict is how many times Elasticsearch retries an Upsert which
+// races with another write of the same document.
+const retryOnConflict = 10
+
+// Refresh is when writes become visible to queries.
+type Refresh string
+
+const (
+	// RefreshNone leaves writes to become visible at the next periodic
+	// refresh of the index, which is the cheapest option.
+	RefreshNone Refresh = ""
+
+	// RefreshWaitFor waits for the next periodic refresh before returning.
+	RefreshWaitFor Refresh = "wait_for"
+
+	// RefreshImmediate refreshes the index straight after every write,
+	// which is mostly useful in tests.
+	RefreshImmediate Refresh = "true"
+)
+
+// Options configures the DocumentStore.
+type Options struct {
+	// Index is the name of the index documents are stored in. Deployments
+	// sharing a cluster should use an index each.
+	Index string
+
+	// Refresh is when writes become visible to queries. Gets see writes
+	// straight away regardless.
+	Refresh Refresh
+}
+
+// APIError is an error response from Elasticsearch.
+type APIError struct {
+	Status int
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("elasticsearch: %d: %s: %s", e.Status, e.Type, e.Reason)
+}
+
+// DocumentStore stores documents in an index, with the id of every
+// document as its _id.
+//
+// Upserts are partial updates with doc_as_upsert, which Elasticsearch
+// merges into the stored document the same way as sakuin.MergeDocs,
+// retrying if the document is written concurrently. Whether a field holds
+// an object is fixed by the index mapping though, so changing a field
+// between an object and any other value fails with a
+// sakuin.MergeConflictErr, even across different documents.
+//
+// Strings longer than 8191 characters aren't indexed, so queries never
+// match them.
+type DocumentStore struct {
+	client  *elasticsearch.Client
+	index   string
+	refresh Refresh
+}
+
+// New returns a DocumentStore which stores documents using client, which
+// is configured with the addresses and credentials of the cluster.
+func New(client *elasticsearch.Client, opts Options) *DocumentStore {
+	return &DocumentStore{
+		client:  client,
+		index:   opts.Index,
+		refresh: opts.Refresh,
+	}
+}
+
+// mappings indexes every string, number and boolean as a keyword, for
+// equality and prefix queries, and every number as a double too, for
+// numeric equality and range queries. Mapping every value the same way
+// keeps the mapping of a field from depending on the type it first had.
+var mappings = map[string]interface{}{
+	"properties": map[string]interface{}{
+		IDField: map[string]interface{}{"type": "keyword"},
+	},
+	"dynamic_templates": []interface{}{
+		leafTemplate("strings", "string"),
+		leafTemplate("longs", "long"),
+		leafTemplate("doubles", "double"),
+		leafTemplate("booleans", "boolean"),
+	},
+}
+
+func leafTemplate(name string, mappingType string) map[string]interface{} {
+	return map[string]interface{}{
+		name: map[string]interface{}{
+			"match_mapping_type": mappingType,
+			"mapping": map[string]interface{}{
+				"type":         "keyword",
+				"ignore_above": 8191,
+				"fields": map[string]interface{}{
+					"num": map[string]interface{}{
+						"type":             "double",
+						"coerce":           false,
+						"ignore_malformed": true,
+					},
+				},
+			},
+		},
+	}
+}
+
+// Setup creates the index with the mappings queries rely on, if it
+// doesn't exist.
+func (s *DocumentStore) Setup(ctx context.Context) error {
+	body, err := encode(map[string]interface{}{"mappings": mappings})
+	if err != nil {
+		return err
+	}
+	req := esapi.IndicesCreateRequest{Index: s.index, Body: body}
+	err = s.do(ctx, req, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Type == "resource_already_exists_exception" {
+		return nil
+	}
+	return err
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	doc, err := s.Get(ctx, id)
+	var docErr sakuin.DocumentDoesNotExistErr
+	if errors.As(err, &docErr) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{Exists: true, Size: len(doc)}, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	// Elasticsearch doesn't allow empty ids, so no such document can exist.
+	if id == "" {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+
+	var resp struct {
+		Found  bool                   `json:"found"`
+		Source map[string]interface{} `json:"_source"`
+	}
+	req := esapi.GetRequest{Index: s.index, DocumentID: id}
+	err := s.do(ctx, req, &resp)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	if !resp.Found {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+
+	delete(resp.Source, IDField)
+	return resp.Source, nil
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	body, err := encode(map[string]interface{}{
+		"doc":           withID(id, doc),
+		"doc_as_upsert": true,
+	})
+	if err != nil {
+		return err
+	}
+	retries := retryOnConflict
+	req := esapi.UpdateRequest{
+		Index:           s.index,
+		DocumentID:      id,
+		Body:            body,
+		Refresh:         string(s.refresh),
+		RetryOnConflict: &retries,
+	}
+	return mergeConflict(s.do(ctx, req, nil))
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	body, err := encode(withID(id, doc))
+	if err != nil {
+		return err
+	}
+	req := esapi.IndexRequest{
+		Index:      s.index,
+		DocumentID: id,
+		Body:       body,
+		Refresh:    string(s.refresh),
+	}
+	return mergeConflict(s.do(ctx, req, nil))
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+
+	req := esapi.DeleteRequest{Index: s.index, DocumentID: id, Refresh: string(s.refresh)}
+	err := s.do(ctx, req, nil)
+	if isNotFound(err) {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return err
+}
+
+// withID returns a shallow copy of the document with its id added.
+func withID(id string, doc map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(doc)+1)
+	for k, v := range doc {
+		m[k] = v
+	}
+	m[IDField] = id
+	return m
+}
+
+// fieldPattern finds the field named in the reason of a mapping error,
+// e.g. "object mapping for [owner] tried to parse field [owner] as object,
+// but found a concrete value".
+var fieldPattern = regexp.MustCompile(`\[([^\]]+)\]`)
+
+// mergeConflict translates errors caused by a field changing type.
+func mergeConflict(err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.Type {
+	case "mapper_parsing_exception", "document_parsing_exception":
+	default:
+		return err
+	}
+
+	field := ""
+	if m := fieldPattern.FindStringSubmatch(apiErr.Reason); m != nil {
+		field = m[1]
+	}
+	return sakuin.MergeConflictErr{Field: field}
+}
+
+// queryBatchSize is how many documents are read per search when a query
+// has no limit.
+const queryBatchSize = 1000
+
+// Query translates the predicates into a bool query, which matches a
+// superset of the documents the predicates do, e.g. because Elasticsearch
+// flattens arrays. The matching documents are then checked against the
+// predicates themselves.
+func (s *DocumentStore) Query(ctx context.Context, q sakuin.Query) (sakuin.QueryResult, error) {
+	err := q.Validate()
+	if err != nil {
+		return sakuin.QueryResult{}, err
+	}
+
+	size := queryBatchSize
+	if q.Limit > 0 {
+		// Reading one more document than asked for tells whether there's
+		// another page.
+		size = q.Limit + 1
+	}
+	body := map[string]interface{}{
+		"size":  size,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters(q.Predicates)}},
+		"sort":  []interface{}{map[string]interface{}{IDField: "asc"}},
+	}
+
+	var docs []sakuin.QueryDocument
+	cursor := q.Cursor
+	for {
+		if cursor != "" {
+			body["search_after"] = []interface{}{cursor}
+		}
+
+		b, err := encode(body)
+		if err != nil {
+			return sakuin.QueryResult{}, err
+		}
+		req := esapi.SearchRequest{Index: []string{s.index}, Body: b}
+
+		var resp struct {
+			Hits struct {
+				Hits []struct {
+					Source map[string]interface{} `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		err = s.do(ctx, req, &resp)
+		if err != nil {
+			return sakuin.QueryResult{}, err
+		}
+
+		for _, hit := range resp.Hits.Hits {
+			id, _ := hit.Source[IDField].(string)
+			cursor = id
+			delete(hit.Source, IDField)
+			if q.Matches(hit.Source) {
+				docs = append(docs, sakuin.QueryDocument{ID: id, Document: hit.Source})
+			}
+		}
+
+		if q.Limit > 0 && len(docs) > q.Limit {
+			return sakuin.QueryResult{Documents: docs[:q.Limit], NextCursor: docs[q.Limit-1].ID}, nil
+		}
+		if len(resp.Hits.Hits) < size {
+			return sakuin.QueryResult{Documents: docs}, nil
+		}
+	}
+}
+
+func filters(preds []sakuin.Predicate) []interface{} {
+	clauses := make([]interface{}, 0, len(preds))
+	for _, p := range preds {
+		if clause := filter(p); clause != nil {
+			clauses = append(clauses, clause)
+		}
+	}
+	return clauses
+}
+
+// filter returns the clause matching the predicate, or nil if every
+// document has to be checked against it.
+func filter(p sakuin.Predicate) map[string]interface{} {
+	switch p.Kind {
+	case sakuin.PredicateEquals:
+		switch v := p.Value.(type) {
+		case string:
+			return term(p.Path, v)
+		case bool:
+			return term(p.Path, strconv.FormatBool(v))
+		case nil:
+			// Null values aren't indexed.
+			return nil
+		}
+		if f, ok := toFloat(p.Value); ok {
+			return term(p.Path+".num", f)
+		}
+		return map[string]interface{}{"exists": map[string]interface{}{"field": p.Path}}
+	case sakuin.PredicatePrefix:
+		return map[string]interface{}{"prefix": map[string]interface{}{p.Path: p.Value}}
+	case sakuin.PredicateRange:
+		bounds := map[string]interface{}{}
+		if !math.IsInf(p.Min, -1) {
+			bounds["gte"] = p.Min
+		}
+		if !math.IsInf(p.Max, 1) {
+			bounds["lte"] = p.Max
+		}
+		if len(bounds) == 0 {
+			return map[string]interface{}{"exists": map[string]interface{}{"field": p.Path + ".num"}}
+		}
+		return map[string]interface{}{"range": map[string]interface{}{p.Path + ".num": bounds}}
+	default:
+		return nil
+	}
+}
+
+func term(field string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"term": map[string]interface{}{field: value}}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// encode returns the JSON encoding of a request body.
+func encode(body interface{}) (io.Reader, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// do sends the request and decodes the JSON response into v, if it's not
+// nil. Failed responses are decoded into v too, as well as being returned
+// as an *APIError.
+func (s *DocumentStore) do(ctx context.Context, req esapi.Request, v interface{}) error {
+	resp, err := req.Do(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if v != nil && len(b) > 0 {
+		err = json.Unmarshal(b, v)
+		if err != nil && !resp.IsError() {
+			return err
+		}
+	}
+	if !resp.IsError() {
+		return nil
+	}
+
+	var errResp struct {
+		Error *APIError `json:"error"`
+	}
+	if json.Unmarshal(b, &errResp) != nil || errResp.Error == nil {
+		// Missing documents are reported without an error object.
+		errResp.Error = &APIError{Reason: strings.TrimSpace(string(b))}
+	}
+	errResp.Error.Status = resp.StatusCode
+	return errResp.Error
+}
+
+func isNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound && apiErr.Type == ""
+}
@@ -0,0 +1,518 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer implements the parts of the REST API used by the store, for
+// a single index. Writes only become visible to searches once they're
+// refreshed, and fields can't change between holding objects and other
+// values, like with the mappings created by Setup.
+type fakeServer struct {
+	mu         sync.Mutex
+	created    bool
+	docs       map[string]map[string]interface{}
+	searchable map[string]map[string]interface{}
+	objects    map[string]bool
+}
+
+// newFakeServer starts a fake server and returns a client for it.
+func newFakeServer(t *testing.T) (*fakeServer, *elasticsearch.Client) {
+	f := &fakeServer{
+		docs:       make(map[string]map[string]interface{}),
+		searchable: make(map[string]map[string]interface{}),
+		objects:    make(map[string]bool),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, newClient(t, srv.URL)
+}
+
+func newClient(t *testing.T, address string) *elasticsearch.Client {
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{address}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The client refuses responses without this header.
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if parts[0] != "test" {
+		writeError(w, http.StatusNotFound, "index_not_found_exception", "no such index ["+parts[0]+"]")
+		return
+	}
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	var status int
+	var resp interface{}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		if f.created {
+			writeError(w, http.StatusBadRequest, "resource_already_exists_exception", "index [test] already exists")
+			return
+		}
+		f.created = true
+		status, resp = http.StatusOK, map[string]interface{}{"acknowledged": true}
+	case len(parts) == 2 && parts[1] == "_search":
+		status, resp = f.search(body)
+	case len(parts) == 3 && parts[1] == "_doc" && r.Method == http.MethodGet:
+		doc, ok := f.docs[parts[2]]
+		status, resp = http.StatusOK, map[string]interface{}{"found": ok, "_source": doc}
+		if !ok {
+			status = http.StatusNotFound
+		}
+	case len(parts) == 3 && parts[1] == "_doc" && r.Method == http.MethodPut:
+		status, resp = f.index(parts[2], body)
+	case len(parts) == 3 && parts[1] == "_doc" && r.Method == http.MethodDelete:
+		status, resp = http.StatusOK, map[string]interface{}{"result": "deleted"}
+		if _, ok := f.docs[parts[2]]; !ok {
+			status, resp = http.StatusNotFound, map[string]interface{}{"result": "not_found"}
+		}
+		delete(f.docs, parts[2])
+	case len(parts) == 3 && parts[1] == "_update" && r.Method == http.MethodPost:
+		doc, _ := body["doc"].(map[string]interface{})
+		if old, ok := f.docs[parts[2]]; ok {
+			doc = merge(copyDoc(old), doc)
+		}
+		status, resp = f.index(parts[2], doc)
+	default:
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception", r.Method+" "+r.URL.Path)
+		return
+	}
+	if status < 300 && r.URL.Query().Get("refresh") != "" {
+		f.refresh()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func writeError(w http.ResponseWriter, status int, typ string, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  map[string]interface{}{"type": typ, "reason": reason},
+		"status": status,
+	})
+}
+
+func (f *fakeServer) index(id string, doc map[string]interface{}) (int, interface{}) {
+	err := f.checkMapping(doc, "")
+	if err != nil {
+		return http.StatusBadRequest, map[string]interface{}{
+			"error":  map[string]interface{}{"type": "document_parsing_exception", "reason": err.Error()},
+			"status": http.StatusBadRequest,
+		}
+	}
+	f.docs[id] = doc
+	return http.StatusOK, map[string]interface{}{"result": "updated"}
+}
+
+// checkMapping records whether each field holds an object, and fails if a
+// field held something else before. Arrays aren't checked.
+func (f *fakeServer) checkMapping(doc map[string]interface{}, prefix string) error {
+	for k, v := range doc {
+		path := prefix + k
+		if _, isArray := v.([]interface{}); isArray {
+			continue
+		}
+		m, isObject := v.(map[string]interface{})
+		if wasObject, ok := f.objects[path]; ok && wasObject != isObject {
+			return fmt.Errorf("object mapping for [%s] tried to parse field [%s] as object, but found a concrete value", path, path)
+		}
+		f.objects[path] = isObject
+		if isObject {
+			err := f.checkMapping(m, path+".")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeServer) refresh() {
+	f.searchable = make(map[string]map[string]interface{}, len(f.docs))
+	for id, doc := range f.docs {
+		f.searchable[id] = copyDoc(doc)
+	}
+}
+
+// merge merges src into dst the way partial updates do.
+func merge(dst, src map[string]interface{}) map[string]interface{} {
+	for k, sv := range src {
+		svMap, ok := sv.(map[string]interface{})
+		dvMap, dok := dst[k].(map[string]interface{})
+		if ok && dok {
+			dst[k] = merge(dvMap, svMap)
+			continue
+		}
+		dst[k] = sv
+	}
+	return dst
+}
+
+func copyDoc(doc map[string]interface{}) map[string]interface{} {
+	b, _ := json.Marshal(doc)
+	var m map[string]interface{}
+	json.Unmarshal(b, &m)
+	return m
+}
+
+func (f *fakeServer) search(body map[string]interface{}) (int, interface{}) {
+	size := int(body["size"].(float64))
+	after := ""
+	if sa, ok := body["search_after"].([]interface{}); ok {
+		after = sa[0].(string)
+	}
+	filters := body["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"].([]interface{})
+
+	var ids []string
+	for id, doc := range f.searchable {
+		if id <= after {
+			continue
+		}
+		matches := true
+		for _, clause := range filters {
+			matches = matches && matchClause(doc, clause.(map[string]interface{}))
+		}
+		if matches {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > size {
+		ids = ids[:size]
+	}
+
+	hits := make([]interface{}, len(ids))
+	for i, id := range ids {
+		hits[i] = map[string]interface{}{"_id": id, "_source": f.searchable[id]}
+	}
+	return http.StatusOK, map[string]interface{}{"hits": map[string]interface{}{"hits": hits}}
+}
+
+// matchClause evaluates a term, prefix, range or exists clause against
+// every value indexed at its field. Arrays are flattened, and values are
+// indexed as keywords, and as doubles under the "num" subfield if they're
+// numbers.
+func matchClause(doc map[string]interface{}, clause map[string]interface{}) bool {
+	for kind, arg := range clause {
+		for field, want := range arg.(map[string]interface{}) {
+			if kind == "exists" {
+				field = want.(string)
+			}
+			path := strings.TrimSuffix(field, ".num")
+			numeric := path != field
+			for _, v := range leafValues(doc, strings.Split(path, ".")) {
+				if matchValue(kind, v, numeric, want) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func matchValue(kind string, v interface{}, numeric bool, want interface{}) bool {
+	n, isNumber := v.(float64)
+	if numeric && !isNumber {
+		return false
+	}
+
+	switch kind {
+	case "exists":
+		return true
+	case "term":
+		if numeric {
+			return n == want.(float64)
+		}
+		return keyword(v) == want
+	case "prefix":
+		return strings.HasPrefix(keyword(v), want.(string))
+	case "range":
+		bounds := want.(map[string]interface{})
+		min, max := math.Inf(-1), math.Inf(1)
+		if gte, ok := bounds["gte"].(float64); ok {
+			min = gte
+		}
+		if lte, ok := bounds["lte"].(float64); ok {
+			max = lte
+		}
+		return min <= n && n <= max
+	default:
+		return false
+	}
+}
+
+func keyword(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func leafValues(v interface{}, path []string) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		var values []interface{}
+		for _, e := range v {
+			values = append(values, leafValues(e, path)...)
+		}
+		return values
+	case map[string]interface{}:
+		if len(path) == 0 {
+			return []interface{}{v}
+		}
+		return leafValues(v[path[0]], path[1:])
+	case nil:
+		return nil
+	default:
+		if len(path) > 0 {
+			return nil
+		}
+		return []interface{}{v}
+	}
+}
+
+func newStore(t *testing.T, refresh Refresh) (*fakeServer, *DocumentStore) {
+	f, client := newFakeServer(t)
+	s := New(client, Options{Index: "test", Refresh: refresh})
+	err := s.Setup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, s
+}
+
+func TestDocumentStore(t *testing.T) {
+	_, s := newStore(t, RefreshImmediate)
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), s)
+	_, s = newStore(t, RefreshImmediate)
+	sakuin.RunQueryableDocumentStorageTests(storagetest.Lift(t), s)
+
+	t.Run("should not return the id field", func(subT *testing.T) {
+		f, s := newStore(subT, RefreshImmediate)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", f.docs["test"][IDField])
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: 1}, stats)
+	})
+
+	t.Run("should fail with MergeConflictErr if an object becomes a value", func(subT *testing.T) {
+		_, s := newStore(subT, RefreshImmediate)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{
+			"owner": map[string]interface{}{"name": "a"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{"owner": "b"})
+		var mergeErr sakuin.MergeConflictErr
+		if !assert.ErrorAs(subT, err, &mergeErr) {
+			return
+		}
+		assert.Equal(subT, "owner", mergeErr.Field)
+	})
+
+	t.Run("should only find writes once they're refreshed", func(subT *testing.T) {
+		f, s := newStore(subT, RefreshNone)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		result, err := s.Query(context.Background(), sakuin.Query{})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, result.Documents)
+
+		f.mu.Lock()
+		f.refresh()
+		f.mu.Unlock()
+
+		result, err = s.Query(context.Background(), sakuin.Query{})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []sakuin.QueryDocument{{ID: "test", Document: map[string]interface{}{"name": "test"}}}, result.Documents)
+	})
+
+	t.Run("should fill pages with documents the filters can't rule out", func(subT *testing.T) {
+		_, s := newStore(subT, RefreshImmediate)
+
+		for i, doc := range []map[string]interface{}{
+			{"tags": []interface{}{map[string]interface{}{"name": "a"}}},
+			{"tags": map[string]interface{}{"name": "a"}},
+			{"tags": []interface{}{map[string]interface{}{"name": "a"}}},
+			{"tags": map[string]interface{}{"name": "a"}},
+		} {
+			err := s.Upsert(context.Background(), fmt.Sprint(i), doc)
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		result, err := s.Query(context.Background(), sakuin.Query{
+			Predicates: []sakuin.Predicate{sakuin.FieldEquals("tags.name", "a")},
+			Limit:      1,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, sakuin.QueryResult{
+			Documents:  []sakuin.QueryDocument{{ID: "1", Document: map[string]interface{}{"tags": map[string]interface{}{"name": "a"}}}},
+			NextCursor: "1",
+		}, result)
+	})
+
+	t.Run("should surface errors of missing indices", func(subT *testing.T) {
+		_, client := newFakeServer(subT)
+		s := New(client, Options{Index: "missing"})
+
+		_, err := s.Get(context.Background(), "test")
+		var apiErr *APIError
+		if !assert.ErrorAs(subT, err, &apiErr) {
+			return
+		}
+		assert.Equal(subT, "index_not_found_exception", apiErr.Type)
+	})
+}
+
+func TestFilter(t *testing.T) {
+	testCases := []struct {
+		Name      string
+		Predicate sakuin.Predicate
+		Filter    map[string]interface{}
+	}{
+		{
+			Name:      "should match strings as keywords",
+			Predicate: sakuin.FieldEquals("owner.name", "ann"),
+			Filter:    map[string]interface{}{"term": map[string]interface{}{"owner.name": "ann"}},
+		},
+		{
+			Name:      "should match numbers as doubles",
+			Predicate: sakuin.FieldEquals("size", 20),
+			Filter:    map[string]interface{}{"term": map[string]interface{}{"size.num": 20.0}},
+		},
+		{
+			Name:      "should match booleans as keywords",
+			Predicate: sakuin.FieldEquals("public", true),
+			Filter:    map[string]interface{}{"term": map[string]interface{}{"public": "true"}},
+		},
+		{
+			Name:      "should check other values exist",
+			Predicate: sakuin.FieldEquals("tags", []interface{}{"a"}),
+			Filter:    map[string]interface{}{"exists": map[string]interface{}{"field": "tags"}},
+		},
+		{
+			Name:      "should not filter on null",
+			Predicate: sakuin.FieldEquals("deleted", nil),
+			Filter:    nil,
+		},
+		{
+			Name:      "should match prefixes of keywords",
+			Predicate: sakuin.FieldHasPrefix("name", "alpha"),
+			Filter:    map[string]interface{}{"prefix": map[string]interface{}{"name": "alpha"}},
+		},
+		{
+			Name:      "should leave open bounds out of ranges",
+			Predicate: sakuin.FieldInRange("size", 20, math.Inf(1)),
+			Filter:    map[string]interface{}{"range": map[string]interface{}{"size.num": map[string]interface{}{"gte": 20.0}}},
+		},
+		{
+			Name:      "should check numbers exist for unbounded ranges",
+			Predicate: sakuin.FieldInRange("size", math.Inf(-1), math.Inf(1)),
+			Filter:    map[string]interface{}{"exists": map[string]interface{}{"field": "size.num"}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+		t.Run(tc.Name, func(subT *testing.T) {
+			assert.Equal(subT, tc.Filter, filter(tc.Predicate))
+		})
+	}
+}
+
+// urlEnv names the environment variable holding the address of the
+// cluster the integration tests run against, e.g. http://localhost:9200.
+// The tests are skipped without it.
+const urlEnv = "SAKUIN_ELASTICSEARCH_URL"
+
+func TestElasticsearch(t *testing.T) {
+	endpoint := os.Getenv(urlEnv)
+	if endpoint == "" {
+		t.Skipf("%s isn't set", urlEnv)
+	}
+	client := newClient(t, endpoint)
+
+	newStore := func() *DocumentStore {
+		index := fmt.Sprintf("sakuin-test-%d", time.Now().UnixNano())
+		s := New(client, Options{Index: index, Refresh: RefreshImmediate})
+		err := s.Setup(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			resp, err := client.Indices.Delete([]string{index})
+			if err == nil {
+				resp.Body.Close()
+			}
+		})
+		return s
+	}
+
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), newStore())
+	sakuin.RunQueryableDocumentStorageTests(storagetest.Lift(t), newStore())
+}
@@ -0,0 +1,255 @@
+// Package etcd provides a DocumentStore which keeps documents in etcd.
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/z5labs/sakuin"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// DefaultMaxValueSize is the largest encoded document the store writes, if
+// no other limit is given. It's a little under the 1.5 MiB requests etcd
+// accepts by default, leaving room for the key and the rest of the request.
+const DefaultMaxValueSize = 1536*1024 - 4096
+
+// DefaultMaxRetries is how many times an Upsert is retried after losing a
+// race with a concurrent write, if no other limit is given.
+const DefaultMaxRetries = 20
+
+// ErrTooManyRetries is returned when an Upsert loses a race with
+// concurrent writes of the same document more than Options.MaxRetries
+// times.
+var ErrTooManyRetries = errors.New("etcd: too many concurrent writes")
+
+// ValueTooLargeErr is returned when a document is too large to be stored
+// in etcd.
+type ValueTooLargeErr struct {
+	ID string
+
+	// Size is the length of the encoded document.
+	Size int
+
+	// Limit is the size the document exceeds, or zero if it was etcd which
+	// rejected the document, since its limit isn't known.
+	Limit int
+}
+
+func (e ValueTooLargeErr) Error() string {
+	if e.Limit == 0 {
+		return fmt.Sprintf("document %s is too large for etcd at %d bytes", e.ID, e.Size)
+	}
+	return fmt.Sprintf("document %s is too large for etcd at %d bytes, over the %d byte limit", e.ID, e.Size, e.Limit)
+}
+
+// Options configures the DocumentStore.
+type Options struct {
+	// Prefix is prepended to the id of every document to form its key,
+	// e.g. "/sakuin/docs/", so documents can share a cluster.
+	Prefix string
+
+	// MaxValueSize is the largest encoded document the store writes, which
+	// should be lower than the --max-request-bytes of the cluster. Zero
+	// uses DefaultMaxValueSize.
+	MaxValueSize int
+
+	// MaxRetries is how many times an Upsert is retried after losing a race
+	// with a concurrent write of the same document. Zero uses
+	// DefaultMaxRetries.
+	MaxRetries int
+}
+
+// DocumentStore stores documents as JSON, one key per document.
+//
+// Upserts read the document, merge it and write it back in a transaction
+// which only succeeds if the key's mod revision hasn't changed since it
+// was read, so concurrent Upserts don't lose fields. A transaction which
+// fails reads the key again in the same round trip, so the retry doesn't
+// need another read.
+type DocumentStore struct {
+	kv   clientv3.KV
+	opts Options
+}
+
+// New returns a DocumentStore which stores documents with the given client,
+// e.g. a *clientv3.Client, or a namespaced clientv3.KV.
+func New(kv clientv3.KV, opts Options) *DocumentStore {
+	if opts.MaxValueSize == 0 {
+		opts.MaxValueSize = DefaultMaxValueSize
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = DefaultMaxRetries
+	}
+	return &DocumentStore{kv: kv, opts: opts}
+}
+
+func (s *DocumentStore) key(id string) string {
+	return s.opts.Prefix + id
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	doc, err := s.Get(ctx, id)
+	var docErr sakuin.DocumentDoesNotExistErr
+	if errors.As(err, &docErr) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{Exists: true, Size: len(doc)}, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	kv, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return decode(kv.Value)
+}
+
+// get reads the key of a document, which is nil if it doesn't exist.
+func (s *DocumentStore) get(ctx context.Context, id string) (*mvccpb.KeyValue, error) {
+	// etcd doesn't allow empty keys, so no such document can exist.
+	if len(s.key(id)) == 0 {
+		return nil, nil
+	}
+
+	resp, err := s.kv.Get(ctx, s.key(id))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	return resp.Kvs[0], nil
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	kv, err := s.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt <= s.opts.MaxRetries; attempt++ {
+		value := b
+		modRevision := int64(0)
+		if kv != nil {
+			modRevision = kv.ModRevision
+			value, err = merge(b, kv.Value)
+			if err != nil {
+				return err
+			}
+		}
+		err = s.checkSize(id, value)
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.kv.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(s.key(id)), "=", modRevision)).
+			Then(clientv3.OpPut(s.key(id), string(value))).
+			Else(clientv3.OpGet(s.key(id))).
+			Commit()
+		if err != nil {
+			return s.translate(id, value, err)
+		}
+		if resp.Succeeded {
+			return nil
+		}
+
+		kv = nil
+		if kvs := resp.Responses[0].GetResponseRange().GetKvs(); len(kvs) > 0 {
+			kv = kvs[0]
+		}
+	}
+	return ErrTooManyRetries
+}
+
+// merge merges the encoded new document into the encoded stored one.
+func merge(b []byte, stored []byte) ([]byte, error) {
+	// Decoding the encoded document copies it, so merging can't modify
+	// the caller's document.
+	newDoc, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+	old, err := decode(stored)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := sakuin.MergeDocs(newDoc, old)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	err = s.checkSize(id, b)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.kv.Put(ctx, s.key(id), string(b))
+	return s.translate(id, b, err)
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	if len(s.key(id)) == 0 {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+
+	resp, err := s.kv.Delete(ctx, s.key(id))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return nil
+}
+
+func (s *DocumentStore) checkSize(id string, value []byte) error {
+	if len(value) > s.opts.MaxValueSize {
+		return ValueTooLargeErr{ID: id, Size: len(value), Limit: s.opts.MaxValueSize}
+	}
+	return nil
+}
+
+// translate turns etcd rejecting a write for being too large into a
+// ValueTooLargeErr.
+func (s *DocumentStore) translate(id string, value []byte, err error) error {
+	if err != nil && rpctypes.ErrorDesc(err) == rpctypes.ErrorDesc(rpctypes.ErrGRPCRequestTooLarge) {
+		return ValueTooLargeErr{ID: id, Size: len(value)}
+	}
+	return err
+}
+
+func decode(b []byte) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	err := json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("etcd: failed to decode document: %w", err)
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	return doc, nil
+}
@@ -0,0 +1,202 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// endpointsEnv names the environment variable holding the comma separated
+// addresses of the cluster TestCluster runs against, e.g. localhost:2379.
+const endpointsEnv = "SAKUIN_ETCD_ENDPOINTS"
+
+// freeURL returns a URL for a port which is free on localhost.
+func freeURL(t *testing.T) url.URL {
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return url.URL{Scheme: "http", Host: lis.Addr().String()}
+}
+
+// startEtcd starts a single member cluster, which accepts requests of up to
+// maxRequestBytes, or the etcd default if it's zero, and returns a client
+// for it.
+func startEtcd(t *testing.T, maxRequestBytes uint) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{clientURL}, []url.URL{clientURL}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{peerURL}, []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	if maxRequestBytes > 0 {
+		cfg.MaxRequestBytes = maxRequestBytes
+	}
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd didn't start in time")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// hookedKV calls beforeTxn, if it's set, before every transaction.
+type hookedKV struct {
+	clientv3.KV
+	beforeTxn func()
+}
+
+func (kv *hookedKV) Txn(ctx context.Context) clientv3.Txn {
+	if kv.beforeTxn != nil {
+		kv.beforeTxn()
+	}
+	return kv.KV.Txn(ctx)
+}
+
+func TestDocumentStore(t *testing.T) {
+	client := startEtcd(t, 0)
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), New(client, Options{Prefix: "/suite/"}))
+
+	t.Run("should store documents under the prefix", func(subT *testing.T) {
+		s := New(client, Options{Prefix: "/sakuin/"})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		resp, err := client.Get(context.Background(), "/sakuin/test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, int64(1), resp.Count)
+
+		_, err = New(client, Options{}).Get(context.Background(), "")
+		var docErr sakuin.DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+	})
+
+	t.Run("should redo upserts which lose a race", func(subT *testing.T) {
+		kv := &hookedKV{KV: client}
+		s := New(kv, Options{Prefix: "/race/"})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"a": "a"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		// Write the document behind the store's back before its first
+		// transaction, so the transaction fails.
+		var once sync.Once
+		kv.beforeTxn = func() {
+			once.Do(func() {
+				client.Put(context.Background(), "/race/test", `{"a":"a","b":"b"}`)
+			})
+		}
+
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{"c": "c"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"a": "a", "b": "b", "c": "c"}, doc)
+	})
+
+	t.Run("should give up after too many retries", func(subT *testing.T) {
+		kv := &hookedKV{KV: client}
+		s := New(kv, Options{Prefix: "/retries/", MaxRetries: 2})
+
+		kv.beforeTxn = func() {
+			client.Put(context.Background(), "/retries/test", `{}`)
+		}
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"a": "a"})
+		assert.ErrorIs(subT, err, ErrTooManyRetries)
+	})
+
+	t.Run("should reject documents over the size limit", func(subT *testing.T) {
+		s := New(client, Options{Prefix: "/limit/", MaxValueSize: 16})
+
+		err := s.Replace(context.Background(), "test", map[string]interface{}{"name": strings.Repeat("a", 16)})
+		var sizeErr ValueTooLargeErr
+		if !assert.ErrorAs(subT, err, &sizeErr) {
+			return
+		}
+		assert.Equal(subT, 16, sizeErr.Limit)
+
+		resp, err := client.Get(context.Background(), "/limit/", clientv3.WithPrefix())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Zero(subT, resp.Count)
+	})
+
+	t.Run("should report documents etcd rejects for their size", func(subT *testing.T) {
+		s := New(startEtcd(subT, 1024), Options{})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": strings.Repeat("a", 1024)})
+		var sizeErr ValueTooLargeErr
+		if !assert.ErrorAs(subT, err, &sizeErr) {
+			return
+		}
+		assert.Equal(subT, "test", sizeErr.ID)
+		assert.Equal(subT, 0, sizeErr.Limit)
+	})
+}
+
+// TestCluster runs the storage tests against the cluster named by
+// SAKUIN_ETCD_ENDPOINTS, under a prefix of their own.
+func TestCluster(t *testing.T) {
+	endpoints := os.Getenv(endpointsEnv)
+	if endpoints == "" {
+		t.Skipf("%s isn't set", endpointsEnv)
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	prefix := fmt.Sprintf("/sakuin-test/%d/", time.Now().UnixNano())
+	t.Cleanup(func() {
+		client.Delete(context.Background(), prefix, clientv3.WithPrefix())
+	})
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), New(client, Options{Prefix: prefix}))
+}
@@ -0,0 +1,176 @@
+// Package firestore provides a DocumentStore which keeps documents in a
+// Cloud Firestore collection.
+package firestore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/genproto/googleapis/type/latlng"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DocumentStore stores documents in a collection, one Firestore document
+// per document.
+//
+// Upserts are sets with MergeAll, which update the paths of every value in
+// the new document, so Firestore merges nested maps atomically. Unlike
+// sakuin.MergeDocs, replacing a map with another value succeeds rather than
+// failing with a MergeConflictErr, and empty maps are left out, since they
+// have no values to merge.
+//
+// Numbers are stored as doubles, like they are in JSON, and Firestore
+// values which JSON has no equivalent for are returned as strings, e.g.
+// timestamps.
+//
+// Firestore ids can't contain slashes, among other restrictions, so
+// "%", "/", "." and "_" are percent encoded in the ids of Firestore
+// documents.
+type DocumentStore struct {
+	collection *firestore.CollectionRef
+}
+
+// New returns a DocumentStore which stores documents in the collection at
+// the given path, e.g. "sakuin" or "deployments/prod/documents", using
+// client. firestore.NewClient points the client at the emulator named by
+// FIRESTORE_EMULATOR_HOST, if it's set.
+func New(client *firestore.Client, collection string) *DocumentStore {
+	return &DocumentStore{collection: client.Collection(strings.Trim(collection, "/"))}
+}
+
+// escaper percent encodes the characters Firestore restricts in ids.
+var escaper = strings.NewReplacer("%", "%25", "/", "%2F", ".", "%2E", "_", "%5F")
+
+func (s *DocumentStore) doc(id string) *firestore.DocumentRef {
+	return s.collection.Doc(escaper.Replace(id))
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	snap, err := s.get(ctx, id)
+	var docErr sakuin.DocumentDoesNotExistErr
+	if errors.As(err, &docErr) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{
+		Exists:       true,
+		Size:         len(snap.Data()),
+		CreatedAt:    snap.CreateTime,
+		LastModified: snap.UpdateTime,
+	}, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	snap, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMap(snap.Data()), nil
+}
+
+func (s *DocumentStore) get(ctx context.Context, id string) (*firestore.DocumentSnapshot, error) {
+	// Firestore doesn't allow empty ids, so no such document can exist.
+	if id == "" {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+
+	snap, err := s.doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	data, err := encodeDoc(doc)
+	if err != nil {
+		return err
+	}
+	_, err = s.doc(id).Set(ctx, data, firestore.MergeAll)
+	return err
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	data, err := encodeDoc(doc)
+	if err != nil {
+		return err
+	}
+	_, err = s.doc(id).Set(ctx, data)
+	return err
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+
+	_, err := s.doc(id).Delete(ctx, firestore.Exists)
+	if status.Code(err) == codes.NotFound {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return err
+}
+
+// encodeDoc round trips the document through JSON, so any document which
+// can be stored as JSON can be stored in Firestore, as the same values.
+func encodeDoc(doc map[string]interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]interface{}
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	return data, nil
+}
+
+func decodeMap(m map[string]interface{}) map[string]interface{} {
+	doc := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		doc[k] = decodeValue(v)
+	}
+	return doc
+}
+
+// decodeValue turns the values Firestore has, but JSON doesn't, into the
+// values they're written as in the REST API of Firestore.
+func decodeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case *latlng.LatLng:
+		return map[string]interface{}{"latitude": v.Latitude, "longitude": v.Longitude}
+	case *firestore.DocumentRef:
+		return v.Path
+	case map[string]interface{}:
+		return decodeMap(v)
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, e := range v {
+			values[i] = decodeValue(e)
+		}
+		return values
+	default:
+		return v
+	}
+}
@@ -0,0 +1,317 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"cloud.google.com/go/firestore"
+	pb "cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const collectionName = "projects/test/databases/(default)/documents/sakuin/"
+
+// fakeServer implements the parts of the Firestore API used by the store,
+// for a single collection, including field masks and preconditions.
+type fakeServer struct {
+	pb.UnimplementedFirestoreServer
+
+	mu sync.Mutex
+
+	// docs are keyed by their id in the collection.
+	docs map[string]*pb.Document
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *firestore.Client) {
+	f := &fakeServer{docs: make(map[string]*pb.Document)}
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	pb.RegisterFirestoreServer(srv, f)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := firestore.NewClient(context.Background(), "test", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return f, client
+}
+
+func (f *fakeServer) BatchGetDocuments(req *pb.BatchGetDocumentsRequest, stream pb.Firestore_BatchGetDocumentsServer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, name := range req.Documents {
+		resp := &pb.BatchGetDocumentsResponse{
+			Result:   &pb.BatchGetDocumentsResponse_Missing{Missing: name},
+			ReadTime: timestamppb.Now(),
+		}
+		if doc, ok := f.docs[strings.TrimPrefix(name, collectionName)]; ok {
+			resp.Result = &pb.BatchGetDocumentsResponse_Found{Found: doc}
+		}
+		err := stream.Send(resp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeServer) Commit(_ context.Context, req *pb.CommitRequest) (*pb.CommitResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := timestamppb.Now()
+	resp := &pb.CommitResponse{CommitTime: now}
+	for _, w := range req.Writes {
+		var name string
+		switch op := w.Operation.(type) {
+		case *pb.Write_Update:
+			name = op.Update.Name
+		case *pb.Write_Delete:
+			name = op.Delete
+		default:
+			return nil, status.Error(codes.Unimplemented, "unsupported write")
+		}
+		id := strings.TrimPrefix(name, collectionName)
+		doc, exists := f.docs[id]
+
+		if pc, ok := w.GetCurrentDocument().GetConditionType().(*pb.Precondition_Exists); ok {
+			if pc.Exists && !exists {
+				return nil, status.Error(codes.NotFound, name)
+			}
+			if !pc.Exists && exists {
+				return nil, status.Error(codes.AlreadyExists, name)
+			}
+		}
+
+		if w.GetDelete() != "" {
+			delete(f.docs, id)
+			resp.WriteResults = append(resp.WriteResults, &pb.WriteResult{})
+			continue
+		}
+
+		if !exists {
+			doc = &pb.Document{Name: name, Fields: map[string]*pb.Value{}, CreateTime: now}
+			f.docs[id] = doc
+		}
+		doc.UpdateTime = now
+		if w.UpdateMask == nil {
+			doc.Fields = w.GetUpdate().Fields
+		}
+		for _, path := range w.GetUpdateMask().GetFieldPaths() {
+			applyMask(doc.Fields, w.GetUpdate().Fields, parseFieldPath(path))
+		}
+		resp.WriteResults = append(resp.WriteResults, &pb.WriteResult{UpdateTime: now})
+	}
+	return resp, nil
+}
+
+// applyMask copies the value at path in src to dst, or deletes it from dst
+// if src has no such value.
+func applyMask(dst, src map[string]*pb.Value, path []string) {
+	v, ok := src[path[0]]
+	if len(path) == 1 {
+		if ok {
+			dst[path[0]] = v
+		} else {
+			delete(dst, path[0])
+		}
+		return
+	}
+
+	d := dst[path[0]].GetMapValue()
+	if d == nil {
+		d = &pb.MapValue{}
+		dst[path[0]] = &pb.Value{ValueType: &pb.Value_MapValue{MapValue: d}}
+	}
+	if d.Fields == nil {
+		d.Fields = map[string]*pb.Value{}
+	}
+	applyMask(d.Fields, v.GetMapValue().GetFields(), path[1:])
+}
+
+// parseFieldPath splits a field path into its field names, unquoting
+// quoted names.
+func parseFieldPath(path string) []string {
+	var names []string
+	var name strings.Builder
+	quoted, escaped := false, false
+	for _, c := range path {
+		switch {
+		case escaped:
+			name.WriteRune(c)
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '`':
+			quoted = !quoted
+		case c == '.' && !quoted:
+			names = append(names, name.String())
+			name.Reset()
+		default:
+			name.WriteRune(c)
+		}
+	}
+	return append(names, name.String())
+}
+
+func newStore(t *testing.T) (*fakeServer, *DocumentStore) {
+	f, client := newFakeServer(t)
+	return f, New(client, "sakuin")
+}
+
+func TestDocumentStore(t *testing.T) {
+	_, s := newStore(t)
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), s)
+
+	t.Run("should merge nested maps with any field names", func(subT *testing.T) {
+		_, s := newStore(subT)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{
+			"owner": map[string]interface{}{
+				"name":    "a",
+				"address": map[string]interface{}{"city": "x"},
+			},
+			"tags": []interface{}{"a", "b"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{
+			"owner": map[string]interface{}{
+				"address":  map[string]interface{}{"zip": 1.0},
+				"a.b `c\\": map[string]interface{}{"d": true},
+			},
+			"tags": []interface{}{"c"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{
+			"owner": map[string]interface{}{
+				"name":     "a",
+				"address":  map[string]interface{}{"city": "x", "zip": 1.0},
+				"a.b `c\\": map[string]interface{}{"d": true},
+			},
+			"tags": []interface{}{"c"},
+		}, doc)
+	})
+
+	t.Run("should keep documents when upserting empty documents", func(subT *testing.T) {
+		_, s := newStore(subT)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Upsert(context.Background(), "empty", map[string]interface{}{})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+
+		doc, err = s.Get(context.Background(), "empty")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{}, doc)
+	})
+
+	t.Run("should encode ids Firestore restricts", func(subT *testing.T) {
+		f, s := newStore(subT)
+
+		err := s.Replace(context.Background(), "trash/../__a__%", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Contains(subT, f.docs, "trash%2F%2E%2E%2F%5F%5Fa%5F%5F%25")
+
+		doc, err := s.Get(context.Background(), "trash/../__a__%")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+	})
+
+	t.Run("should decode values JSON has no equivalent for", func(subT *testing.T) {
+		f, s := newStore(subT)
+
+		ts := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+		f.docs["test"] = &pb.Document{
+			Name: collectionName + "test",
+			Fields: map[string]*pb.Value{
+				"count":   {ValueType: &pb.Value_IntegerValue{IntegerValue: 42}},
+				"created": {ValueType: &pb.Value_TimestampValue{TimestampValue: timestamppb.New(ts)}},
+			},
+			CreateTime: timestamppb.Now(),
+			UpdateTime: timestamppb.Now(),
+		}
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"count": int64(42), "created": "2023-04-01T12:00:00Z"}, doc)
+	})
+}
+
+// TestEmulator runs the storage tests against the emulator named by
+// FIRESTORE_EMULATOR_HOST, in a collection of their own.
+func TestEmulator(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST isn't set")
+	}
+
+	client, err := firestore.NewClient(context.Background(), "sakuin-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	collection := fmt.Sprintf("sakuin-test-%d", time.Now().UnixNano())
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), New(client, collection))
+}
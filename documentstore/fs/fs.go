@@ -0,0 +1,178 @@
+// Package fs provides a DocumentStore which keeps each document as a
+// JSON file on the local filesystem.
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"sync"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/internal/fsutil"
+
+	"go.uber.org/zap"
+)
+
+// documentExt is appended to the file name of every document,
+// which keeps them apart from in progress temporary files.
+const documentExt = ".json"
+
+// DocumentStore stores documents as pretty-printed JSON files under a
+// root directory. Documents are laid out as described by fsutil.Path,
+// so ids can never escape the root.
+//
+// Writes go to a temporary file which is then renamed over the document,
+// so readers only ever see complete documents. Writes to the same id are
+// serialized within a single DocumentStore, but not across processes
+// sharing the same root.
+type DocumentStore struct {
+	root string
+	log  *zap.Logger
+
+	mu    sync.Mutex
+	locks map[string]*idLock
+}
+
+type idLock struct {
+	sync.Mutex
+	refs int
+}
+
+// New returns a DocumentStore rooted at the given directory, creating it if needed.
+func New(root string) (*DocumentStore, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentStore{
+		root:  root,
+		log:   zap.NewNop(),
+		locks: make(map[string]*idLock),
+	}, nil
+}
+
+// WithLogger sets the logger, which defaults to discarding logs.
+func (s *DocumentStore) WithLogger(log *zap.Logger) *DocumentStore {
+	s.log = log
+	return s
+}
+
+// lock holds the lock for the given id until the returned func is called.
+func (s *DocumentStore) lock(id string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &idLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		s.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *DocumentStore) path(id string) string {
+	return fsutil.Path(s.root, id, documentExt)
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	doc, err := s.read(id)
+	if _, ok := err.(sakuin.DocumentDoesNotExistErr); ok {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{Exists: true, Size: len(doc)}, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	doc, err := s.read(id)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Debug("successfully retrieved document from disk", zap.String("id", id))
+	return doc, nil
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	old, err := s.read(id)
+	if _, ok := err.(sakuin.DocumentDoesNotExistErr); ok {
+		return s.write(id, doc)
+	}
+	if err != nil {
+		return err
+	}
+	merged, err := sakuin.MergeDocs(doc, old)
+	if err != nil {
+		return err
+	}
+	return s.write(id, merged)
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	return s.write(id, doc)
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	unlock := s.lock(id)
+	defer unlock()
+
+	err := os.Remove(s.path(id))
+	if errors.Is(err, iofs.ErrNotExist) {
+		s.log.Warn("unable to find document on disk", zap.String("id", id))
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return err
+}
+
+func (s *DocumentStore) read(id string) (map[string]interface{}, error) {
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, iofs.ErrNotExist) {
+		s.log.Warn("unable to find document on disk", zap.String("id", id))
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (s *DocumentStore) write(id string, doc map[string]interface{}) error {
+	err := fsutil.WriteFile(s.path(id), func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	})
+	if err != nil {
+		return err
+	}
+	s.log.Debug("successfully stored document on disk", zap.String("id", id))
+	return nil
+}
@@ -0,0 +1,141 @@
+package fs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(t *testing.T) *DocumentStore {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDocumentStore(t *testing.T) {
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), newStore(t))
+
+	t.Run("should store ids too long for a single file name", func(subT *testing.T) {
+		s := newStore(subT)
+		id := strings.Repeat("a", 300)
+
+		err := s.Upsert(context.Background(), id, map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := s.Get(context.Background(), id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+	})
+
+	t.Run("should deep merge upserted documents", func(subT *testing.T) {
+		s := newStore(subT)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{
+			"name":  "test",
+			"owner": map[string]interface{}{"name": "a", "team": "b"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{
+			"owner": map[string]interface{}{"name": "c"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{
+			"name":  "test",
+			"owner": map[string]interface{}{"name": "c", "team": "b"},
+		}, doc)
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: 2}, stats)
+	})
+
+	t.Run("should not lose concurrent upserts to the same id", func(subT *testing.T) {
+		s := newStore(subT)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := s.Upsert(context.Background(), "test", map[string]interface{}{fmt.Sprintf("key%d", i): true})
+				assert.Nil(subT, err)
+			}(i)
+		}
+		wg.Wait()
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Len(subT, doc, 20)
+		assert.Empty(subT, s.locks)
+	})
+
+	t.Run("should keep ids from escaping the root", func(subT *testing.T) {
+		parent := subT.TempDir()
+		root := filepath.Join(parent, "root")
+		s, err := New(root)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Replace(context.Background(), "../../escape", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		entries, err := os.ReadDir(parent)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Len(subT, entries, 1) {
+			return
+		}
+
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.Contains(info.Name(), "escape") {
+				return fmt.Errorf("id was used as a path: %s", path)
+			}
+			return nil
+		})
+		assert.Nil(subT, err)
+	})
+}
+
+func BenchmarkDocumentStore(b *testing.B) {
+	s, err := New(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	storagetest.RunDocumentStorageBenchmarks(b, s)
+}
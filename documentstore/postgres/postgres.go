@@ -0,0 +1,149 @@
+// Package postgres provides a DocumentStore which keeps documents in a
+// PostgreSQL jsonb column.
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Setup creates the table documents are stored in, if it doesn't exist.
+// The table may be qualified with its schema, e.g. "sakuin.documents".
+func Setup(ctx context.Context, pool *pgxpool.Pool, table string) error {
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+sanitize(table)+` (
+		id TEXT PRIMARY KEY,
+		doc JSONB NOT NULL
+	)`)
+	return err
+}
+
+func sanitize(table string) string {
+	return pgx.Identifier(strings.Split(table, ".")).Sanitize()
+}
+
+// DocumentStore stores documents in a table created by Setup, one row
+// per document.
+//
+// Upserts lock the row of the document, merge it with sakuin.MergeDocs
+// and write it back in a single transaction, rather than using jsonb's ||
+// operator, which only merges top level fields. Concurrent Upserts of the
+// same document are therefore serialized and don't lose fields.
+type DocumentStore struct {
+	pool  *pgxpool.Pool
+	table string
+}
+
+// New returns a DocumentStore which stores documents in the given table,
+// which must have been created by Setup.
+func New(pool *pgxpool.Pool, table string) *DocumentStore {
+	return &DocumentStore{pool: pool, table: sanitize(table)}
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	var size int
+	err := s.pool.QueryRow(ctx, `SELECT (SELECT count(*) FROM jsonb_object_keys(doc)) FROM `+s.table+` WHERE id = $1`, id).Scan(&size)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{Exists: true, Size: size}, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	return s.get(ctx, s.pool, id, "")
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	// Decoding the encoded document copies it, so merging can't modify
+	// the caller's document.
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var newDoc map[string]interface{}
+	err = json.Unmarshal(b, &newDoc)
+	if err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		// Inserting an empty document first gives concurrent Upserts of a
+		// new document a row to lock. It's rolled back if the Upsert fails.
+		_, err := tx.Exec(ctx, `INSERT INTO `+s.table+` (id, doc) VALUES ($1, '{}') ON CONFLICT (id) DO NOTHING`, id)
+		if err != nil {
+			return err
+		}
+
+		old, err := s.get(ctx, tx, id, " FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		merged, err := sakuin.MergeDocs(newDoc, old)
+		if err != nil {
+			return err
+		}
+
+		b, err := json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE `+s.table+` SET doc = $2 WHERE id = $1`, id, b)
+		return err
+	})
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, `INSERT INTO `+s.table+` (id, doc) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET doc = EXCLUDED.doc`,
+		id, b,
+	)
+	return err
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM `+s.table+` WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return nil
+}
+
+// querier is implemented by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// get reads the document, with the given locking clause appended to the query.
+func (s *DocumentStore) get(ctx context.Context, q querier, id string, lock string) (map[string]interface{}, error) {
+	var b []byte
+	err := q.QueryRow(ctx, `SELECT doc FROM `+s.table+` WHERE id = $1`+lock, id).Scan(&b)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
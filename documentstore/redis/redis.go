@@ -0,0 +1,181 @@
+// Package redis provides a DocumentStore which keeps each document in a
+// Redis hash.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Options configures the DocumentStore.
+type Options struct {
+	// Prefix is prepended to the id of every document to form its key,
+	// e.g. "sakuin:docs:", so documents can share a database.
+	Prefix string
+
+	// TTL expires documents once it has passed since they were last
+	// written. Zero never expires them.
+	TTL time.Duration
+}
+
+// DocumentStore stores documents as Redis hashes, with a field for every
+// top level field of the document holding its JSON encoded value.
+//
+// Upserts read the fields they write under WATCH, merge them with
+// sakuin.MergeDocs and write them back in a transaction, which is retried
+// if the document changes in between, so concurrent Upserts don't lose
+// fields. Replaces and Deletes are single transactions.
+//
+// Redis removes hashes without any fields, so empty documents aren't
+// kept: replacing a document with an empty one deletes it, and upserting
+// an empty document doesn't create one.
+type DocumentStore struct {
+	client redis.UniversalClient
+	opts   Options
+}
+
+// New returns a DocumentStore which stores documents with the given client.
+func New(client redis.UniversalClient, opts Options) *DocumentStore {
+	return &DocumentStore{client: client, opts: opts}
+}
+
+func (s *DocumentStore) key(id string) string {
+	return s.opts.Prefix + id
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	n, err := s.client.HLen(ctx, s.key(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	return &sakuin.StatInfo{Exists: true, Size: int(n)}, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	fields, err := s.client.HGetAll(ctx, s.key(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return decodeFields(fields)
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	if len(doc) == 0 {
+		return nil
+	}
+
+	// Decoding the encoded document copies it, so merging can't modify
+	// the caller's document.
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(doc))
+	for name := range doc {
+		names = append(names, name)
+	}
+
+	key := s.key(id)
+	for {
+		err = s.client.Watch(ctx, func(tx *redis.Tx) error {
+			stored, err := tx.HMGet(ctx, key, names...).Result()
+			if err != nil {
+				return err
+			}
+			old := make(map[string]string, len(names))
+			for i, v := range stored {
+				if v, ok := v.(string); ok {
+					old[names[i]] = v
+				}
+			}
+			oldDoc, err := decodeFields(old)
+			if err != nil {
+				return err
+			}
+
+			var newDoc map[string]interface{}
+			err = json.Unmarshal(b, &newDoc)
+			if err != nil {
+				return err
+			}
+			merged, err := sakuin.MergeDocs(newDoc, oldDoc)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+				return s.write(ctx, p, key, merged)
+			})
+			return err
+		}, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	key := s.key(id)
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, key)
+		if len(doc) == 0 {
+			return nil
+		}
+		return s.write(ctx, p, key, doc)
+	})
+	return err
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	n, err := s.client.Del(ctx, s.key(id)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return nil
+}
+
+// write queues the commands which set the fields of doc, and the TTL.
+func (s *DocumentStore) write(ctx context.Context, p redis.Pipeliner, key string, doc map[string]interface{}) error {
+	fields := make(map[string]interface{}, len(doc))
+	for name, v := range doc {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fields[name] = b
+	}
+
+	p.HSet(ctx, key, fields)
+	if s.opts.TTL > 0 {
+		p.Expire(ctx, key, s.opts.TTL)
+	}
+	return nil
+}
+
+func decodeFields(fields map[string]string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{}, len(fields))
+	for name, v := range fields {
+		var value interface{}
+		err := json.Unmarshal([]byte(v), &value)
+		if err != nil {
+			return nil, err
+		}
+		doc[name] = value
+	}
+	return doc, nil
+}
@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(t *testing.T, opts Options) (*DocumentStore, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, opts), mr
+}
+
+func TestDocumentStore(t *testing.T) {
+	s, _ := newStore(t, Options{Prefix: "sakuin:docs:"})
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), s)
+
+	t.Run("should store a hash field for every top level field", func(subT *testing.T) {
+		s, mr := newStore(subT, Options{Prefix: "sakuin:docs:"})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{
+			"name":  "test",
+			"owner": map[string]interface{}{"name": "a"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.Equal(subT, []string{"sakuin:docs:test"}, mr.Keys())
+		assert.Equal(subT, `"test"`, mr.HGet("sakuin:docs:test", "name"))
+		assert.Equal(subT, `{"name":"a"}`, mr.HGet("sakuin:docs:test", "owner"))
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: 2}, stats)
+	})
+
+	t.Run("should fail to merge an object into another value", func(subT *testing.T) {
+		s, _ := newStore(subT, Options{})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{
+			"owner": map[string]interface{}{"name": "a"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{"owner": "b"})
+		var mergeErr sakuin.MergeConflictErr
+		assert.ErrorAs(subT, err, &mergeErr)
+	})
+
+	t.Run("should delete documents replaced with an empty one", func(subT *testing.T) {
+		s, _ := newStore(subT, Options{})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Replace(context.Background(), "test", map[string]interface{}{})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var docErr sakuin.DocumentDoesNotExistErr
+		_, err = s.Get(context.Background(), "test")
+		assert.ErrorAs(subT, err, &docErr)
+	})
+
+	t.Run("should expire documents after the ttl", func(subT *testing.T) {
+		s, mr := newStore(subT, Options{TTL: time.Minute})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, time.Minute, mr.TTL("test"))
+
+		mr.FastForward(30 * time.Second)
+		err = s.Replace(context.Background(), "test", map[string]interface{}{"name": "new"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, time.Minute, mr.TTL("test"))
+
+		mr.FastForward(time.Minute)
+		var docErr sakuin.DocumentDoesNotExistErr
+		_, err = s.Get(context.Background(), "test")
+		assert.ErrorAs(subT, err, &docErr)
+	})
+}
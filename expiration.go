@@ -0,0 +1,172 @@
+package sakuin
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"go.uber.org/zap"
+)
+
+const expiresAtMetadataKey = "expiresAt"
+
+// ExpirationIndex keeps track of when indexed entries expire
+// so they can be found and removed by the expiration worker.
+type ExpirationIndex interface {
+	Add(ctx context.Context, id string, expiresAt time.Time) error
+	Remove(ctx context.Context, id string) error
+
+	// Expired returns the ids of all entries which expire at or before the given time.
+	Expired(ctx context.Context, now time.Time) ([]string, error)
+}
+
+type InMemoryExpirationIndex struct {
+	mu        sync.Mutex
+	expiresAt map[string]time.Time
+}
+
+func NewInMemoryExpirationIndex() *InMemoryExpirationIndex {
+	return &InMemoryExpirationIndex{
+		expiresAt: make(map[string]time.Time),
+	}
+}
+
+func (idx *InMemoryExpirationIndex) Add(ctx context.Context, id string, expiresAt time.Time) error {
+	idx.mu.Lock()
+	idx.expiresAt[id] = expiresAt
+	idx.mu.Unlock()
+
+	return nil
+}
+
+func (idx *InMemoryExpirationIndex) Remove(ctx context.Context, id string) error {
+	idx.mu.Lock()
+	delete(idx.expiresAt, id)
+	idx.mu.Unlock()
+
+	return nil
+}
+
+func (idx *InMemoryExpirationIndex) Expired(ctx context.Context, now time.Time) ([]string, error) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var ids []string
+	for id, expiresAt := range idx.expiresAt {
+		if !expiresAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// StartExpirationWorker periodically removes expired entries from
+// both stores until the given context is cancelled or the Service is closed.
+func (s *Service) StartExpirationWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				s.log.Info("stopping expiration worker")
+				return
+			case <-ticker.C:
+			}
+
+			n, err := s.ReapExpired(ctx)
+			if err == ErrServiceClosed {
+				s.log.Info("stopping expiration worker since service is closed")
+				return
+			}
+			if err != nil {
+				s.log.Error("unexpected error when reaping expired entries", zap.Error(err))
+				continue
+			}
+			s.log.Debug("reaped expired entries", zap.Int("count", n))
+		}
+	}()
+}
+
+// ReapExpired removes all currently expired entries from both stores
+// and returns how many were removed.
+func (s *Service) ReapExpired(ctx context.Context) (n int, err error) {
+	defer s.observe("ReapExpired", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return 0, err
+	}
+	defer s.exit()
+
+	ids, err := s.expirations.Expired(ctx, s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		s.log.Info("removing expired entry", zap.String("id", id))
+		err = s.deleteEntry(ctx, id)
+		if err != nil {
+			s.log.Error("unable to remove expired entry", zap.String("id", id), zap.Error(err))
+			return i, err
+		}
+
+		err = s.expirations.Remove(ctx, id)
+		if err != nil {
+			return i, err
+		}
+
+		s.runHook("OnDeleted", s.hooks.OnDeleted, id, HookSummary{})
+	}
+	return len(ids), nil
+}
+
+// expiresAt determines when a newly indexed entry should expire, if ever.
+func (s *Service) expiresAt(req *pb.IndexRequest) (time.Time, bool) {
+	if req.ExpiresAt != nil {
+		return req.ExpiresAt.AsTime(), true
+	}
+	if req.Ttl != nil {
+		return s.now().Add(req.Ttl.AsDuration()), true
+	}
+	return time.Time{}, false
+}
+
+// trackExpiration registers an entry with the expiration index. Failures are
+// only logged since expired entries are still hidden from reads.
+func (s *Service) trackExpiration(ctx context.Context, id string, expiresAt time.Time) {
+	err := s.expirations.Add(ctx, id, expiresAt)
+	if err != nil {
+		s.log.Error("unable to track expiration", zap.String("id", id), zap.Error(err))
+	}
+}
+
+func (s *Service) isExpired(doc map[string]interface{}) bool {
+	expiresAt, ok := s.getExpiresAt(doc)
+	return ok && !expiresAt.After(s.now())
+}
+
+func (s *Service) getExpiresAt(doc map[string]interface{}) (time.Time, bool) {
+	v := getReservedString(doc, expiresAtMetadataKey)
+	if v == "" {
+		return time.Time{}, false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		s.log.Warn("invalid expiration time", zap.String("expiresAt", v), zap.Error(err))
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+func formatExpiresAt(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
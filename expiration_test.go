@@ -0,0 +1,210 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestInMemoryExpirationIndex(t *testing.T) {
+	t.Run("should only return expired ids", func(subT *testing.T) {
+		now := time.Now()
+		idx := NewInMemoryExpirationIndex()
+		idx.Add(context.Background(), "past", now.Add(-time.Minute))
+		idx.Add(context.Background(), "now", now)
+		idx.Add(context.Background(), "future", now.Add(time.Minute))
+
+		ids, err := idx.Expired(context.Background(), now)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"now", "past"}, ids)
+	})
+
+	t.Run("should not return removed ids", func(subT *testing.T) {
+		now := time.Now()
+		idx := NewInMemoryExpirationIndex()
+		idx.Add(context.Background(), "past", now.Add(-time.Minute))
+		idx.Remove(context.Background(), "past")
+
+		ids, err := idx.Expired(context.Background(), now)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, ids)
+	})
+}
+
+func TestExpiration(t *testing.T) {
+	newService := func(clock *fakeClock) (*Service, *InMemoryObjectStore, *InMemoryDocumentStore) {
+		objStore := NewInMemoryObjectStore()
+		docStore := NewInMemoryDocumentStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+			RandSrc:       rand.Reader,
+			Now:           clock.Now,
+		})
+		return s, objStore, docStore
+	}
+
+	t.Run("should stat expired entries as missing", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		s, _, _ := newService(clock)
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("content"),
+			Ttl:    durationpb.New(time.Hour),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		stat, err := s.Stat(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.NotNil(subT, stat.Object)
+
+		clock.Advance(time.Hour)
+
+		stat, err = s.Stat(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &EntryStat{}, stat)
+	})
+
+	t.Run("should treat expired entries as not found", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		s, _, _ := newService(clock)
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("content"),
+			Ttl:    durationpb.New(time.Hour),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		clock.Advance(time.Hour)
+
+		var objErr ObjectDoesNotExistErr
+		_, err = s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+		assert.ErrorAs(subT, err, &objErr)
+
+		var docErr DocumentDoesNotExistErr
+		_, err = s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: resp.Id})
+		assert.ErrorAs(subT, err, &docErr)
+	})
+
+	t.Run("should prefer expires at over ttl", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		s, _, _ := newService(clock)
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object:    []byte("content"),
+			ExpiresAt: timestamppb.New(clock.Now().Add(time.Minute)),
+			Ttl:       durationpb.New(time.Hour),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		clock.Advance(time.Minute)
+
+		var objErr ObjectDoesNotExistErr
+		_, err = s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should remove expired entries from both stores when reaped", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		s, objStore, docStore := newService(clock)
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("content"),
+			Ttl:    durationpb.New(time.Minute),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("content"),
+			Ttl:    durationpb.New(time.Hour),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("content"),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		clock.Advance(time.Minute)
+
+		n, err := s.ReapExpired(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.Equal(subT, 1, n)
+		assert.Equal(subT, 2, objStore.NumOfObects())
+		assert.Equal(subT, 2, docStore.NumOfDocs())
+	})
+
+	t.Run("should reap expired entries in the background", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		s, objStore, docStore := newService(clock)
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("content"),
+			Ttl:    durationpb.New(time.Minute),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		clock.Advance(time.Minute)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s.StartExpirationWorker(ctx, time.Millisecond)
+
+		assert.Eventually(subT, func() bool {
+			return objStore.NumOfObects() == 0 && docStore.NumOfDocs() == 0
+		}, time.Second, time.Millisecond)
+	})
+}
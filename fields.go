@@ -0,0 +1,118 @@
+package sakuin
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// GetMetadataFields returns only the requested fields of the metadata. Fields are
+// given as dotted paths, e.g. "author.name", and paths which don't exist are simply
+// absent from the result. When a path passes through an array, the rest of the path
+// is projected onto every object in the array and all other elements are dropped.
+func (s *Service) GetMetadataFields(ctx context.Context, id string, paths []string) (fields map[string]interface{}, err error) {
+	defer s.observe("GetMetadataFields", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	log := s.logger(id)
+
+	metadata, _, err := s.getMetadata(ctx, id)
+	if err != nil {
+		log.Error("unexpected error when getting metadata", zap.Error(err))
+		return nil, err
+	}
+	if s.isExpired(metadata) {
+		log.Warn("metadata has expired")
+		return nil, DocumentDoesNotExistErr{ID: id}
+	}
+
+	return projectFields(metadata, paths), nil
+}
+
+// fieldTree is a tree of the requested path segments.
+// A nil subtree means the whole field was requested.
+type fieldTree map[string]fieldTree
+
+func newFieldTree(paths []string) fieldTree {
+	root := make(fieldTree)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		root.insert(strings.Split(path, "."))
+	}
+	return root
+}
+
+func (t fieldTree) insert(segments []string) {
+	node := t
+	for i, seg := range segments {
+		if i == len(segments)-1 {
+			// Requesting the whole field overrides any of its subfields
+			node[seg] = nil
+			return
+		}
+
+		child, ok := node[seg]
+		if ok && child == nil {
+			// The whole field has already been requested
+			return
+		}
+		if !ok {
+			child = make(fieldTree)
+			node[seg] = child
+		}
+		node = child
+	}
+}
+
+func projectFields(doc map[string]interface{}, paths []string) map[string]interface{} {
+	v, ok := project(doc, newFieldTree(paths))
+	if !ok {
+		return make(map[string]interface{})
+	}
+	return v.(map[string]interface{})
+}
+
+// project returns the parts of v selected by t and whether anything was selected at all.
+func project(v interface{}, t fieldTree) (interface{}, bool) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for k, sub := range t {
+			fv, ok := x[k]
+			if !ok {
+				continue
+			}
+			if sub == nil {
+				out[k] = copyValue(fv)
+				continue
+			}
+			if pv, ok := project(fv, sub); ok {
+				out[k] = pv
+			}
+		}
+		return out, len(out) > 0
+	case []interface{}:
+		var out []interface{}
+		for _, e := range x {
+			m, ok := e.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if pv, ok := project(m, t); ok {
+				out = append(out, pv)
+			}
+		}
+		return out, len(out) > 0
+	default:
+		return nil, false
+	}
+}
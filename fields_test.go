@@ -0,0 +1,117 @@
+package sakuin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectFields(t *testing.T) {
+	doc := map[string]interface{}{
+		"title": "test",
+		"author": map[string]interface{}{
+			"name":  "someone",
+			"email": "someone@example.com",
+			"address": map[string]interface{}{
+				"city":    "somewhere",
+				"country": "elsewhere",
+			},
+		},
+		"tags": []interface{}{"a", "b"},
+		"reviews": []interface{}{
+			map[string]interface{}{"rating": 5.0, "text": "great"},
+			"not an object",
+			map[string]interface{}{"text": "no rating"},
+			map[string]interface{}{"rating": 1.0},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		paths    []string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "top level fields",
+			paths:    []string{"title", "tags"},
+			expected: map[string]interface{}{"title": "test", "tags": []interface{}{"a", "b"}},
+		},
+		{
+			name:  "nested fields",
+			paths: []string{"author.name", "author.address.city"},
+			expected: map[string]interface{}{
+				"author": map[string]interface{}{
+					"name":    "someone",
+					"address": map[string]interface{}{"city": "somewhere"},
+				},
+			},
+		},
+		{
+			name:     "unknown fields",
+			paths:    []string{"missing", "author.missing", "title.length", "tags.length", ""},
+			expected: map[string]interface{}{},
+		},
+		{
+			name:  "fields of objects in arrays",
+			paths: []string{"reviews.rating"},
+			expected: map[string]interface{}{
+				"reviews": []interface{}{
+					map[string]interface{}{"rating": 5.0},
+					map[string]interface{}{"rating": 1.0},
+				},
+			},
+		},
+		{
+			name:     "whole field before subfield",
+			paths:    []string{"author", "author.name"},
+			expected: map[string]interface{}{"author": doc["author"]},
+		},
+		{
+			name:     "subfield before whole field",
+			paths:    []string{"author.address.city", "author"},
+			expected: map[string]interface{}{"author": doc["author"]},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(subT *testing.T) {
+			assert.Equal(subT, testCase.expected, projectFields(doc, testCase.paths))
+		})
+	}
+
+	t.Run("should copy projected values", func(subT *testing.T) {
+		fields := projectFields(doc, []string{"author"})
+		fields["author"].(map[string]interface{})["name"] = "changed"
+
+		assert.Equal(subT, "someone", doc["author"].(map[string]interface{})["name"])
+	})
+}
+
+func TestGetMetadataFields(t *testing.T) {
+	t.Run("should return only the requested fields", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+				"name":        "test",
+				"description": "test description",
+			}),
+		})
+
+		fields, err := s.GetMetadataFields(context.Background(), "test", []string{"name"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, fields)
+	})
+
+	t.Run("should fail if ID doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.GetMetadataFields(context.Background(), "docDoesNotExistID", []string{"name"})
+
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+	})
+}
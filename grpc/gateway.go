@@ -0,0 +1,192 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/z5labs/sakuin"
+	sakuinhttp "github.com/z5labs/sakuin/http"
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// NewGateway returns a mux serving the RPCs of srv over HTTP, at the routes
+// they're annotated with in the proto, along with multipart indexing on
+// POST /index. Errors are sent as a sakuinhttp.APIError, like the HTTP API.
+func NewGateway(ctx context.Context, srv *Server, limits sakuinhttp.Limits) (*runtime.ServeMux, error) {
+	m := &gatewayMarshaler{
+		JSONPb: runtime.JSONPb{
+			// Field names match the JSON the HTTP API sends
+			MarshalOptions: protojson.MarshalOptions{UseProtoNames: true},
+		},
+	}
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, m),
+		runtime.WithErrorHandler(sendGatewayError),
+		runtime.WithForwardResponseOption(setObjectHeaders),
+	)
+
+	err := pb.RegisterSakuinHandlerServer(ctx, mux, srv)
+	if err != nil {
+		return nil, err
+	}
+
+	err = mux.HandlePath(http.MethodPost, "/index", newMultipartIndexHandler(mux, srv.s, limits.PartLimits()))
+	if err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// gatewayMarshaler sends objects and metadata as is, rather than wrapped in
+// JSON, when they're bound to the request or response body, so the gateway
+// is compatible with the HTTP API. Everything else is sent as JSON.
+type gatewayMarshaler struct {
+	runtime.JSONPb
+}
+
+func (m *gatewayMarshaler) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case *anypb.Any:
+		if !v.MessageIs(&pb.JSONMetadata{}) {
+			msg, err := v.UnmarshalNew()
+			if err != nil {
+				return nil, err
+			}
+			return m.JSONPb.Marshal(msg)
+		}
+
+		var msg pb.JSONMetadata
+		err := v.UnmarshalTo(&msg)
+		if err != nil {
+			return nil, err
+		}
+		return msg.Json, nil
+	}
+	return m.JSONPb.Marshal(v)
+}
+
+func (m *gatewayMarshaler) NewDecoder(r io.Reader) runtime.Decoder {
+	return runtime.DecoderFunc(func(v interface{}) error {
+		switch v := v.(type) {
+		case *[]byte:
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			*v = b
+			return nil
+		case **anypb.Any:
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if !json.Valid(b) {
+				return errors.New("metadata must be valid JSON")
+			}
+			any, err := anypb.New(&pb.JSONMetadata{Json: b})
+			if err != nil {
+				return err
+			}
+			*v = any
+			return nil
+		}
+		return m.JSONPb.NewDecoder(r).Decode(v)
+	})
+}
+
+// setObjectHeaders sets the headers the HTTP API sends along with objects.
+func setObjectHeaders(ctx context.Context, w http.ResponseWriter, msg proto.Message) error {
+	// Responses with a body field are wrapped, so unwrap them through reflection
+	resp, ok := msg.ProtoReflect().Interface().(*pb.GetObjectResponse)
+	if !ok {
+		return nil
+	}
+
+	contentType := resp.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if resp.Checksum != "" {
+		w.Header().Set(sakuinhttp.ChecksumHeader, resp.Checksum)
+	}
+	return nil
+}
+
+func sendGatewayError(ctx context.Context, mux *runtime.ServeMux, m runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+
+	code := runtime.HTTPStatusFromCode(st.Code())
+	if st.Code() == codes.ResourceExhausted {
+		// Only objects and parts which are too large are resource exhausted
+		code = http.StatusRequestEntityTooLarge
+	}
+
+	w.Header().Del("Trailer")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err = json.NewEncoder(w).Encode(sakuinhttp.APIError{Message: st.Message()})
+	if err != nil {
+		zap.L().Error("unable to send error", zap.Error(err))
+	}
+}
+
+// newMultipartIndexHandler indexes the object part of multipart/form-data
+// bodies as it's read, like the HTTP API.
+func newMultipartIndexHandler(mux *runtime.ServeMux, s *sakuin.Service, limits sakuin.PartLimits) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		ctx := r.Context()
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+
+		var resp *pb.IndexResponse
+		indexed := false
+		_, err := sakuin.StreamIndexParts(r.Body, r.Header.Get("Content-Type"), limits, func(parts *sakuin.IndexParts, object io.Reader) (err error) {
+			indexed = true
+
+			var any *anypb.Any
+			if parts.Metadata != nil {
+				any, err = anypb.New(&pb.JSONMetadata{Json: parts.Metadata})
+				if err != nil {
+					return err
+				}
+			}
+
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				id = parts.ID
+			}
+			resp, err = s.IndexObjectStream(ctx, &pb.IndexRequest{
+				Id:             id,
+				Metadata:       any,
+				ContentType:    parts.ObjectContentType,
+				Filename:       parts.ObjectFilename,
+				IdempotencyKey: r.Header.Get("Idempotency-Key"),
+			}, object)
+			return err
+		})
+		if err == nil && !indexed {
+			err = status.Error(codes.InvalidArgument, sakuinhttp.ErrMissingObjectPart.Message)
+		}
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outbound, w, r, toStatus(err))
+			return
+		}
+
+		runtime.ForwardResponseMessage(ctx, mux, outbound, w, r, resp)
+	}
+}
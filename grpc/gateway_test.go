@@ -0,0 +1,216 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	sakuinhttp "github.com/z5labs/sakuin/http"
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestService() *sakuin.Service {
+	return sakuin.New(sakuin.Config{
+		ObjectStore:   sakuin.NewInMemoryObjectStore(),
+		DocumentStore: sakuin.NewInMemoryDocumentStore(),
+		RandSrc:       rand.Reader,
+	})
+}
+
+// startTransports starts the HTTP API and the gateway, each in front of
+// their own Service, and returns their base urls.
+func startTransports(t *testing.T) (string, string) {
+	app := sakuinhttp.NewServer(newTestService(), sakuinhttp.WithFiberConfig(fiber.Config{
+		DisableStartupMessage: true,
+	}))
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ls)
+	t.Cleanup(func() { app.Shutdown() })
+
+	mux, err := NewGateway(context.Background(), NewServer(newTestService()), sakuinhttp.Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := httptest.NewServer(mux)
+	t.Cleanup(gw.Close)
+
+	return "http://" + ls.Addr().String(), gw.URL
+}
+
+type testResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// doBoth sends the same request to both transports.
+func doBoth(t *testing.T, httpURL, gwURL, method, path, contentType string, body []byte) (*testResponse, *testResponse) {
+	do := func(base string) *testResponse {
+		req, err := http.NewRequest(method, base+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &testResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: b}
+	}
+	return do(httpURL), do(gwURL)
+}
+
+func indexForm(t *testing.T, metadata string, object string) ([]byte, string) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	mw, err := w.CreatePart(map[string][]string{
+		"Content-Disposition": {`form-data; name="metadata"`},
+		"Content-Type":        {"application/json"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw.Write([]byte(metadata))
+
+	ow, err := w.CreatePart(map[string][]string{
+		"Content-Disposition": {`form-data; name="object"`},
+		"Content-Type":        {"text/plain"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ow.Write([]byte(object))
+
+	w.Close()
+	return b.Bytes(), w.FormDataContentType()
+}
+
+// assertEqualMessages decodes both bodies as m and compares them.
+func assertEqualMessages(t *testing.T, m proto.Message, httpBody, gwBody []byte) bool {
+	httpMsg := m.ProtoReflect().New().Interface()
+	gwMsg := m.ProtoReflect().New().Interface()
+	if !assert.Nil(t, protojson.Unmarshal(httpBody, httpMsg)) {
+		return false
+	}
+	if !assert.Nil(t, protojson.Unmarshal(gwBody, gwMsg)) {
+		return false
+	}
+	return assert.True(t, proto.Equal(httpMsg, gwMsg), "%s != %s", httpMsg, gwMsg)
+}
+
+func TestGateway(t *testing.T) {
+	t.Run("should respond like the HTTP API", func(subT *testing.T) {
+		httpURL, gwURL := startTransports(subT)
+
+		form, contentType := indexForm(subT, `{"name":"test"}`, "hello, world")
+		httpResp, gwResp := doBoth(subT, httpURL, gwURL, http.MethodPost, "/index?id=test", contentType, form)
+		if !assert.Equal(subT, http.StatusOK, httpResp.StatusCode) || !assert.Equal(subT, http.StatusOK, gwResp.StatusCode) {
+			return
+		}
+		if !assertEqualMessages(subT, &pb.IndexResponse{}, httpResp.Body, gwResp.Body) {
+			return
+		}
+
+		httpResp, gwResp = doBoth(subT, httpURL, gwURL, http.MethodGet, "/index/test/object", "", nil)
+		if !assert.Equal(subT, http.StatusOK, httpResp.StatusCode) || !assert.Equal(subT, http.StatusOK, gwResp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, "hello, world", string(gwResp.Body))
+		assert.Equal(subT, httpResp.Body, gwResp.Body)
+		assert.Equal(subT, httpResp.Header.Get("Content-Type"), gwResp.Header.Get("Content-Type"))
+		assert.Equal(subT, httpResp.Header.Get(sakuinhttp.ChecksumHeader), gwResp.Header.Get(sakuinhttp.ChecksumHeader))
+
+		httpResp, gwResp = doBoth(subT, httpURL, gwURL, http.MethodPut, "/index/test/object", "", []byte("goodbye, world"))
+		assert.Equal(subT, http.StatusOK, httpResp.StatusCode)
+		assert.Equal(subT, http.StatusOK, gwResp.StatusCode)
+
+		httpResp, gwResp = doBoth(subT, httpURL, gwURL, http.MethodGet, "/index/test/object", "", nil)
+		assert.Equal(subT, "goodbye, world", string(gwResp.Body))
+		assert.Equal(subT, httpResp.Body, gwResp.Body)
+
+		httpResp, gwResp = doBoth(subT, httpURL, gwURL, http.MethodGet, "/index/test/metadata", "", nil)
+		if !assert.Equal(subT, http.StatusOK, httpResp.StatusCode) || !assert.Equal(subT, http.StatusOK, gwResp.StatusCode) {
+			return
+		}
+		assert.Contains(subT, string(gwResp.Body), `"name":"test"`)
+		assert.JSONEq(subT, string(httpResp.Body), string(gwResp.Body))
+
+		httpResp, gwResp = doBoth(subT, httpURL, gwURL, http.MethodPut, "/index/test/metadata", "application/json", []byte(`{"name":"updated"}`))
+		assert.Equal(subT, http.StatusOK, httpResp.StatusCode)
+		assert.Equal(subT, http.StatusOK, gwResp.StatusCode)
+
+		httpResp, gwResp = doBoth(subT, httpURL, gwURL, http.MethodGet, "/index/test/metadata", "", nil)
+		assert.Contains(subT, string(gwResp.Body), `"name":"updated"`)
+		assert.JSONEq(subT, string(httpResp.Body), string(gwResp.Body))
+
+		httpResp, gwResp = doBoth(subT, httpURL, gwURL, http.MethodDelete, "/index/test", "", nil)
+		if !assert.Equal(subT, http.StatusOK, httpResp.StatusCode) || !assert.Equal(subT, http.StatusOK, gwResp.StatusCode) {
+			return
+		}
+		assertEqualMessages(subT, &pb.DeleteResponse{}, httpResp.Body, gwResp.Body)
+
+		httpResp, gwResp = doBoth(subT, httpURL, gwURL, http.MethodGet, "/index/test/object", "", nil)
+		assert.Equal(subT, http.StatusNotFound, httpResp.StatusCode)
+		assert.Equal(subT, http.StatusNotFound, gwResp.StatusCode)
+	})
+
+	t.Run("should send errors like the HTTP API", func(subT *testing.T) {
+		httpURL, gwURL := startTransports(subT)
+
+		httpResp, gwResp := doBoth(subT, httpURL, gwURL, http.MethodPost, "/index", "application/json", []byte(`{}`))
+		if !assert.Equal(subT, http.StatusBadRequest, httpResp.StatusCode) || !assert.Equal(subT, http.StatusBadRequest, gwResp.StatusCode) {
+			return
+		}
+
+		var httpErr, gwErr sakuinhttp.APIError
+		if !assert.Nil(subT, json.Unmarshal(httpResp.Body, &httpErr)) || !assert.Nil(subT, json.Unmarshal(gwResp.Body, &gwErr)) {
+			return
+		}
+		assert.NotEmpty(subT, gwErr.Message)
+		assert.Equal(subT, httpErr, gwErr)
+	})
+
+	t.Run("should send errors as an APIError", func(subT *testing.T) {
+		_, gwURL := startTransports(subT)
+
+		resp, err := http.Get(gwURL + "/index/test/metadata")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer resp.Body.Close()
+		if !assert.Equal(subT, http.StatusNotFound, resp.StatusCode) {
+			return
+		}
+
+		var apiErr sakuinhttp.APIError
+		if !assert.Nil(subT, json.NewDecoder(resp.Body).Decode(&apiErr)) {
+			return
+		}
+		assert.NotEmpty(subT, apiErr.Message)
+	})
+}
@@ -0,0 +1,129 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	pb "github.com/z5labs/sakuin/proto"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// ReadinessTimeout bounds how long a health check waits on the stores.
+const ReadinessTimeout = 2 * time.Second
+
+// HealthWatchInterval is how often the stores are probed for each
+// Watch on the health service.
+const HealthWatchInterval = 5 * time.Second
+
+// Health implements the gRPC health service, reporting each service as
+// serving as long as the stores are ready. The empty service name
+// reports on the server as a whole.
+type Health struct {
+	healthpb.UnimplementedHealthServer
+
+	s        *sakuin.Service
+	timeout  time.Duration
+	interval time.Duration
+
+	mu       sync.Mutex
+	statuses map[string]healthpb.HealthCheckResponse_ServingStatus
+}
+
+func newHealth(s *sakuin.Service) *Health {
+	return &Health{
+		s:        s,
+		timeout:  ReadinessTimeout,
+		interval: HealthWatchInterval,
+		statuses: map[string]healthpb.HealthCheckResponse_ServingStatus{
+			"":                                healthpb.HealthCheckResponse_SERVING,
+			pb.Sakuin_ServiceDesc.ServiceName: healthpb.HealthCheckResponse_SERVING,
+		},
+	}
+}
+
+// SetServingStatus overrides the status of service, e.g. so it can be set to
+// NOT_SERVING while the server drains connections during a graceful shutdown.
+// Setting the empty service name applies to every service. Setting SERVING
+// lets the stores decide the status again.
+func (h *Health) SetServingStatus(service string, st healthpb.HealthCheckResponse_ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if service == "" {
+		for name := range h.statuses {
+			h.statuses[name] = st
+		}
+		return
+	}
+	if _, ok := h.statuses[service]; ok {
+		h.statuses[service] = st
+	}
+}
+
+func (h *Health) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, err := h.status(ctx, req.Service)
+	if err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch probes the stores every HealthWatchInterval and sends the status
+// of the service whenever it changes.
+func (h *Health) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		st, err := h.status(ctx, req.Service)
+		if status.Code(err) == codes.NotFound {
+			st = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		} else if err != nil {
+			return err
+		}
+		if st != last {
+			err = stream.Send(&healthpb.HealthCheckResponse{Status: st})
+			if err != nil {
+				return err
+			}
+			last = st
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Health) status(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	h.mu.Lock()
+	st, ok := h.statuses[service]
+	h.mu.Unlock()
+	if !ok {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, status.Errorf(codes.NotFound, "unknown service: %s", service)
+	}
+	if st != healthpb.HealthCheckResponse_SERVING {
+		return st, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	err := h.s.Ready(ctx)
+	if err != nil {
+		zap.L().Warn("service is not ready", zap.String("service", service), zap.Error(err))
+		return healthpb.HealthCheckResponse_NOT_SERVING, nil
+	}
+	return healthpb.HealthCheckResponse_SERVING, nil
+}
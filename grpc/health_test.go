@@ -0,0 +1,162 @@
+package grpc
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// pingObjectStore fails its pings with the error it was last given by fail.
+type pingObjectStore struct {
+	sakuin.ObjectStore
+
+	mu  sync.Mutex
+	err error
+}
+
+func (s *pingObjectStore) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *pingObjectStore) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func startHealthTestServer(t *testing.T, objStore sakuin.ObjectStore, opts ...Option) (*Server, healthpb.HealthClient) {
+	srv, cc := startTestServerWithConfig(t, sakuin.Config{
+		ObjectStore:   objStore,
+		DocumentStore: sakuin.NewInMemoryDocumentStore(),
+		RandSrc:       rand.Reader,
+	}, opts...)
+	return srv, healthpb.NewHealthClient(cc)
+}
+
+func checkHealth(t *testing.T, client healthpb.HealthClient, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if !assert.Nil(t, err) {
+		return healthpb.HealthCheckResponse_UNKNOWN
+	}
+	return resp.Status
+}
+
+func TestHealth(t *testing.T) {
+	t.Run("should stop serving once a store fails", func(subT *testing.T) {
+		objStore := &pingObjectStore{ObjectStore: sakuin.NewInMemoryObjectStore()}
+		_, client := startHealthTestServer(subT, objStore)
+
+		for _, service := range []string{"", pb.Sakuin_ServiceDesc.ServiceName} {
+			assert.Equal(subT, healthpb.HealthCheckResponse_SERVING, checkHealth(subT, client, service))
+		}
+
+		objStore.fail(errors.New("oh no something went wrong"))
+
+		for _, service := range []string{"", pb.Sakuin_ServiceDesc.ServiceName} {
+			assert.Equal(subT, healthpb.HealthCheckResponse_NOT_SERVING, checkHealth(subT, client, service))
+		}
+
+		objStore.fail(nil)
+
+		for _, service := range []string{"", pb.Sakuin_ServiceDesc.ServiceName} {
+			assert.Equal(subT, healthpb.HealthCheckResponse_SERVING, checkHealth(subT, client, service))
+		}
+	})
+
+	t.Run("should report the status it's set to", func(subT *testing.T) {
+		srv, client := startHealthTestServer(subT, sakuin.NewInMemoryObjectStore())
+
+		srv.SetServingStatus(pb.Sakuin_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+		assert.Equal(subT, healthpb.HealthCheckResponse_SERVING, checkHealth(subT, client, ""))
+		assert.Equal(subT, healthpb.HealthCheckResponse_NOT_SERVING, checkHealth(subT, client, pb.Sakuin_ServiceDesc.ServiceName))
+
+		srv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		assert.Equal(subT, healthpb.HealthCheckResponse_NOT_SERVING, checkHealth(subT, client, ""))
+
+		srv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		assert.Equal(subT, healthpb.HealthCheckResponse_SERVING, checkHealth(subT, client, ""))
+		assert.Equal(subT, healthpb.HealthCheckResponse_SERVING, checkHealth(subT, client, pb.Sakuin_ServiceDesc.ServiceName))
+	})
+
+	t.Run("should fail for unknown services", func(subT *testing.T) {
+		_, client := startHealthTestServer(subT, sakuin.NewInMemoryObjectStore())
+
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+		assert.Equal(subT, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("should send the status when watched", func(subT *testing.T) {
+		_, client := startHealthTestServer(subT, sakuin.NewInMemoryObjectStore())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		resp, err := stream.Recv()
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, healthpb.HealthCheckResponse_SERVING, resp.Status)
+	})
+}
+
+func TestReflection(t *testing.T) {
+	listServices := func(t *testing.T, opts ...Option) ([]string, error) {
+		_, cc := startTestServerWithConfig(t, sakuin.Config{
+			ObjectStore:   sakuin.NewInMemoryObjectStore(),
+			DocumentStore: sakuin.NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		}, opts...)
+
+		stream, err := reflectionpb.NewServerReflectionClient(cc).ServerReflectionInfo(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		err = stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+
+		var services []string
+		for _, service := range resp.GetListServicesResponse().GetService() {
+			services = append(services, service.Name)
+		}
+		return services, nil
+	}
+
+	t.Run("should list the services if enabled", func(subT *testing.T) {
+		services, err := listServices(subT, WithReflection())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Contains(subT, services, pb.Sakuin_ServiceDesc.ServiceName)
+		assert.Contains(subT, services, healthpb.Health_ServiceDesc.ServiceName)
+	})
+
+	t.Run("should be unimplemented by default", func(subT *testing.T) {
+		_, err := listServices(subT)
+		assert.Equal(subT, codes.Unimplemented, status.Code(err))
+	})
+}
@@ -0,0 +1,160 @@
+package grpc
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey is the metadata key the request id of an RPC is read from.
+const RequestIDKey = "x-request-id"
+
+// LoggingUnaryInterceptor logs every unary RPC with its method, duration,
+// status code and request id. Successful RPCs are logged at info level,
+// RPCs failed by the client at warn level and any other failure at error level.
+func LoggingUnaryInterceptor(log *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logRPC(log, ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// LoggingStreamInterceptor logs every streaming RPC in the same way as
+// LoggingUnaryInterceptor.
+func LoggingStreamInterceptor(log *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logRPC(log, ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logRPC(log *zap.Logger, ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.Duration("duration", time.Since(start)),
+		zap.String("code", code.String()),
+		zap.String("request_id", requestID(ctx)),
+	}
+
+	switch code {
+	case codes.OK:
+		log.Info("rpc handled", fields...)
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.FailedPrecondition, codes.OutOfRange,
+		codes.Unimplemented, codes.Unauthenticated, codes.ResourceExhausted:
+		log.Warn("rpc failed", append(fields, zap.Error(err))...)
+	default:
+		log.Error("rpc failed", append(fields, zap.Error(err))...)
+	}
+}
+
+func requestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if ids := md.Get(RequestIDKey); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// Metrics records the RPCs handled by its interceptors, labeled by
+// method and status code.
+type Metrics struct {
+	rpcs     *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewMetrics registers the RPC metrics with reg, which panics if they
+// already are, so a single Metrics should be shared by both interceptors.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		rpcs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "sakuin",
+			Subsystem: "grpc",
+			Name:      "rpcs_total",
+			Help:      "Number of RPCs handled.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "sakuin",
+			Subsystem: "grpc",
+			Name:      "rpc_duration_seconds",
+			Help:      "Time taken to handle RPCs.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+	}
+	reg.MustRegister(m.rpcs, m.duration)
+	return m
+}
+
+// UnaryInterceptor records every unary RPC.
+func (m *Metrics) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		m.observe(info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor records every streaming RPC.
+func (m *Metrics) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		m.observe(info.FullMethod, start, err)
+		return err
+	}
+}
+
+func (m *Metrics) observe(method string, start time.Time, err error) {
+	code := status.Code(err).String()
+	m.rpcs.WithLabelValues(method, code).Inc()
+	m.duration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+}
+
+// RecoveryUnaryInterceptor fails unary RPCs which panic with codes.Internal,
+// rather than letting the panic crash the process. The panic is logged to
+// log along with its stack trace.
+func RecoveryUnaryInterceptor(log *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer recoverRPC(log, info.FullMethod, &err)
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamInterceptor fails streaming RPCs which panic in the same
+// way as RecoveryUnaryInterceptor.
+func RecoveryStreamInterceptor(log *zap.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverRPC(log, info.FullMethod, &err)
+		return handler(srv, ss)
+	}
+}
+
+func recoverRPC(log *zap.Logger, method string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	log.Error(
+		"rpc panicked",
+		zap.String("method", method),
+		zap.Any("panic", r),
+		zap.ByteString("stack", debug.Stack()),
+	)
+	*err = status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,172 @@
+package grpc
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// panicObjectStore panics on every call, since it doesn't wrap a store.
+type panicObjectStore struct {
+	sakuin.ObjectStore
+}
+
+func startInterceptedTestServer(t *testing.T, objStore sakuin.ObjectStore, opts ...grpc.ServerOption) pb.SakuinClient {
+	srv := NewServer(sakuin.New(sakuin.Config{
+		ObjectStore:   objStore,
+		DocumentStore: sakuin.NewInMemoryDocumentStore(),
+		RandSrc:       rand.Reader,
+	}))
+
+	gs := grpc.NewServer(opts...)
+	srv.Register(gs)
+	return pb.NewSakuinClient(dialTestServer(t, gs))
+}
+
+func fullMethod(name string) string {
+	return "/" + pb.Sakuin_ServiceDesc.ServiceName + "/" + name
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	t.Run("should log each rpc with its status code", func(subT *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		log := zap.New(core)
+		client := startInterceptedTestServer(
+			subT,
+			sakuin.NewInMemoryObjectStore(),
+			grpc.UnaryInterceptor(LoggingUnaryInterceptor(log)),
+			grpc.StreamInterceptor(LoggingStreamInterceptor(log)),
+		)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDKey, "abc")
+		_, err := client.Index(ctx, &pb.IndexRequest{Id: "test", Object: []byte("hello, world")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = client.GetObject(ctx, &pb.GetObjectRequest{Id: "missing"})
+		if !assert.Equal(subT, codes.NotFound, status.Code(err)) {
+			return
+		}
+		_, _, err = getObject(context.Background(), client, "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		entries := logs.AllUntimed()
+		if !assert.Len(subT, entries, 3) {
+			return
+		}
+
+		index := entries[0]
+		assert.Equal(subT, zapcore.InfoLevel, index.Level)
+		fields := index.ContextMap()
+		assert.Equal(subT, fullMethod("Index"), fields["method"])
+		assert.Equal(subT, codes.OK.String(), fields["code"])
+		assert.Equal(subT, "abc", fields["request_id"])
+		assert.Contains(subT, fields, "duration")
+
+		get := entries[1]
+		assert.Equal(subT, zapcore.WarnLevel, get.Level)
+		fields = get.ContextMap()
+		assert.Equal(subT, fullMethod("GetObject"), fields["method"])
+		assert.Equal(subT, codes.NotFound.String(), fields["code"])
+		assert.Contains(subT, fields, "error")
+
+		stream := entries[2]
+		assert.Equal(subT, zapcore.InfoLevel, stream.Level)
+		fields = stream.ContextMap()
+		assert.Equal(subT, fullMethod("GetObjectStream"), fields["method"])
+		assert.Equal(subT, "", fields["request_id"])
+	})
+}
+
+func TestMetricsInterceptor(t *testing.T) {
+	t.Run("should count rpcs by method and status code", func(subT *testing.T) {
+		reg := prometheus.NewRegistry()
+		m := NewMetrics(reg)
+		client := startInterceptedTestServer(
+			subT,
+			sakuin.NewInMemoryObjectStore(),
+			grpc.UnaryInterceptor(m.UnaryInterceptor()),
+			grpc.StreamInterceptor(m.StreamInterceptor()),
+		)
+
+		ctx := context.Background()
+		_, err := client.Index(ctx, &pb.IndexRequest{Id: "test", Object: []byte("hello, world")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		for i := 0; i < 2; i++ {
+			_, err = client.GetObject(ctx, &pb.GetObjectRequest{Id: "missing"})
+			if !assert.Equal(subT, codes.NotFound, status.Code(err)) {
+				return
+			}
+		}
+		_, _, err = getObject(ctx, client, "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		expected := `
+# HELP sakuin_grpc_rpcs_total Number of RPCs handled.
+# TYPE sakuin_grpc_rpcs_total counter
+sakuin_grpc_rpcs_total{code="NotFound",method="` + fullMethod("GetObject") + `"} 2
+sakuin_grpc_rpcs_total{code="OK",method="` + fullMethod("GetObjectStream") + `"} 1
+sakuin_grpc_rpcs_total{code="OK",method="` + fullMethod("Index") + `"} 1
+`
+		err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "sakuin_grpc_rpcs_total")
+		assert.Nil(subT, err)
+
+		n, err := testutil.GatherAndCount(reg, "sakuin_grpc_rpc_duration_seconds")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 3, n)
+	})
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	t.Run("should fail rpcs which panic with internal", func(subT *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		log := zap.New(core)
+		client := startInterceptedTestServer(
+			subT,
+			panicObjectStore{},
+			grpc.UnaryInterceptor(RecoveryUnaryInterceptor(log)),
+			grpc.StreamInterceptor(RecoveryStreamInterceptor(log)),
+		)
+
+		ctx := context.Background()
+		_, err := client.GetObject(ctx, &pb.GetObjectRequest{Id: "test"})
+		assert.Equal(subT, codes.Internal, status.Code(err))
+
+		_, _, err = getObject(ctx, client, "test")
+		assert.Equal(subT, codes.Internal, status.Code(err))
+
+		// The server should keep serving after a panic
+		_, err = client.GetMetadata(ctx, &pb.GetMetadataRequest{Id: "test"})
+		assert.Equal(subT, codes.NotFound, status.Code(err))
+
+		entries := logs.FilterMessage("rpc panicked").AllUntimed()
+		if !assert.Len(subT, entries, 2) {
+			return
+		}
+		assert.Equal(subT, fullMethod("GetObject"), entries[0].ContextMap()["method"])
+		assert.Equal(subT, fullMethod("GetObjectStream"), entries[1].ContextMap()["method"])
+	})
+}
@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultPageSize and MaxPageSize are the default and largest
+// number of ids returned per page when listing.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+// List pages through the ids of indexed objects. Page sizes above
+// MaxPageSize are clamped to it rather than rejected.
+func (srv *Server) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	size := int(req.PageSize)
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+
+	cursor, err := decodePageToken(req.PageToken)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+
+	ids, next, err := srv.s.List(ctx, req.Prefix, cursor, size)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.ListResponse{Ids: ids, NextPageToken: encodePageToken(next)}, nil
+}
+
+// Page tokens wrap the cursors of the ObjectStore so clients
+// don't come to rely on their format.
+
+func encodePageToken(cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+func decodePageToken(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,94 @@
+package grpc
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/mocks"
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func startListTestServer(t *testing.T, objStore sakuin.ObjectStore) pb.SakuinClient {
+	_, cc := startTestServerWithConfig(t, sakuin.Config{
+		ObjectStore:   objStore,
+		DocumentStore: sakuin.NewInMemoryDocumentStore(),
+		RandSrc:       rand.Reader,
+	})
+	return pb.NewSakuinClient(cc)
+}
+
+func TestList(t *testing.T) {
+	objStore := sakuin.NewInMemoryObjectStore()
+	var expected []string
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("a%02d", i)
+		objStore.WithObject(id, []byte("hello, world"))
+		expected = append(expected, id)
+	}
+	for i := 0; i < 5; i++ {
+		objStore.WithObject(fmt.Sprintf("b%02d", i), []byte("hello, world"))
+	}
+
+	client := startListTestServer(t, objStore)
+	ctx := context.Background()
+
+	t.Run("should page through all ids", func(subT *testing.T) {
+		var ids []string
+		var token string
+		pages := 0
+		for {
+			resp, err := client.List(ctx, &pb.ListRequest{PageSize: 8, PageToken: token, Prefix: "a"})
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.LessOrEqual(subT, len(resp.Ids), 8)
+			ids = append(ids, resp.Ids...)
+			pages++
+
+			if resp.NextPageToken == "" {
+				break
+			}
+			token = resp.NextPageToken
+		}
+
+		assert.Equal(subT, expected, ids)
+		assert.Equal(subT, 7, pages)
+	})
+
+	t.Run("should default the page size", func(subT *testing.T) {
+		resp, err := client.List(ctx, &pb.ListRequest{})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Len(subT, resp.Ids, DefaultPageSize)
+		assert.NotEmpty(subT, resp.NextPageToken)
+	})
+
+	t.Run("should clamp oversized pages", func(subT *testing.T) {
+		resp, err := client.List(ctx, &pb.ListRequest{PageSize: MaxPageSize + 1})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Len(subT, resp.Ids, 55)
+		assert.Empty(subT, resp.NextPageToken)
+	})
+
+	t.Run("should fail for invalid page tokens", func(subT *testing.T) {
+		_, err := client.List(ctx, &pb.ListRequest{PageToken: "not a token!"})
+		assert.Equal(subT, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("should be unimplemented if the store can't list", func(subT *testing.T) {
+		client := startListTestServer(subT, &mocks.ObjectStore{})
+
+		_, err := client.List(ctx, &pb.ListRequest{})
+		assert.Equal(subT, codes.Unimplemented, status.Code(err))
+	})
+}
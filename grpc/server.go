@@ -0,0 +1,228 @@
+// Package grpc
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	pb "github.com/z5labs/sakuin/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultChunkSize is the size of the chunks objects are streamed in,
+// well below the default maximum message size of 4MB.
+const DefaultChunkSize = 1024 * 1024
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithChunkSize sets the size of the chunks objects are streamed in.
+func WithChunkSize(size int) Option {
+	return func(srv *Server) {
+		if size > 0 {
+			srv.chunkSize = size
+		}
+	}
+}
+
+// WithReflection registers the server reflection service alongside
+// the Sakuin service, for tools like grpcurl.
+func WithReflection() Option {
+	return func(srv *Server) {
+		srv.reflection = true
+	}
+}
+
+// Server implements the Sakuin gRPC service on top of a sakuin.Service.
+type Server struct {
+	pb.UnimplementedSakuinServer
+
+	s          *sakuin.Service
+	health     *Health
+	chunkSize  int
+	reflection bool
+}
+
+func NewServer(s *sakuin.Service, opts ...Option) *Server {
+	srv := &Server{
+		s:         s,
+		health:    newHealth(s),
+		chunkSize: DefaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
+
+// Register registers the Sakuin and health services with gs,
+// as well as reflection if enabled.
+func (srv *Server) Register(gs *grpc.Server) {
+	pb.RegisterSakuinServer(gs, srv)
+	healthpb.RegisterHealthServer(gs, srv.health)
+	if srv.reflection {
+		reflection.Register(gs)
+	}
+}
+
+// SetServingStatus overrides the status reported by the health service,
+// see Health.SetServingStatus.
+func (srv *Server) SetServingStatus(service string, st healthpb.HealthCheckResponse_ServingStatus) {
+	srv.health.SetServingStatus(service, st)
+}
+
+func (srv *Server) GetObject(ctx context.Context, req *pb.GetObjectRequest) (*pb.GetObjectResponse, error) {
+	resp, err := srv.s.GetObject(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (srv *Server) UpdateObject(ctx context.Context, req *pb.UpdateObjectRequest) (*pb.UpdateObjectResponse, error) {
+	resp, err := srv.s.UpdateObject(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (srv *Server) GetMetadata(ctx context.Context, req *pb.GetMetadataRequest) (*pb.GetMetadataResponse, error) {
+	resp, err := srv.s.GetMetadata(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (srv *Server) UpdateMetadata(ctx context.Context, req *pb.UpdateMetadataRequest) (*pb.UpdateMetadataResponse, error) {
+	resp, err := srv.s.UpdateMetadata(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (srv *Server) PatchMetadata(ctx context.Context, req *pb.PatchMetadataRequest) (*pb.PatchMetadataResponse, error) {
+	resp, err := srv.s.PatchMetadata(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (srv *Server) Index(ctx context.Context, req *pb.IndexRequest) (*pb.IndexResponse, error) {
+	resp, err := srv.s.Index(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (srv *Server) Copy(ctx context.Context, req *pb.CopyRequest) (*pb.CopyResponse, error) {
+	resp, err := srv.s.Copy(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (srv *Server) Move(ctx context.Context, req *pb.MoveRequest) (*pb.MoveResponse, error) {
+	resp, err := srv.s.Move(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (srv *Server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	resp, err := srv.s.Delete(ctx, req)
+	return resp, toStatus(err)
+}
+
+// Stat reports on the object and metadata indexed under the id,
+// only failing if the stores do.
+func (srv *Server) Stat(ctx context.Context, req *pb.StatRequest) (*pb.StatResponse, error) {
+	stat, err := srv.s.Stat(ctx, req.Id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &pb.StatResponse{}
+	var lastModified time.Time
+	if info := stat.Object; info != nil {
+		resp.ObjectExists = true
+		resp.ObjectSize = int64(info.Size)
+		lastModified = info.LastModified
+	}
+	if info := stat.Metadata; info != nil {
+		resp.MetadataExists = true
+		resp.MetadataFields = int64(info.Size)
+		if info.LastModified.After(lastModified) {
+			lastModified = info.LastModified
+		}
+	}
+	if !lastModified.IsZero() {
+		resp.LastModified = timestamppb.New(lastModified)
+	}
+	return resp, nil
+}
+
+// PutObjectStream indexes the content of the chunks as it's received,
+// using the index request carried by the first chunk.
+func (srv *Server) PutObjectStream(stream pb.Sakuin_PutObjectStreamServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "missing index request")
+	}
+	if err != nil {
+		return err
+	}
+	if first.Index == nil {
+		return status.Error(codes.InvalidArgument, "first chunk must carry the index request")
+	}
+	if len(first.Index.Object) > 0 {
+		return status.Error(codes.InvalidArgument, "object must be sent as chunks")
+	}
+
+	r := &chunkReader{stream: stream, buf: first.Content}
+	resp, err := srv.s.IndexObjectStream(stream.Context(), first.Index, r)
+	if err != nil {
+		return toStatus(err)
+	}
+	return stream.SendAndClose(resp)
+}
+
+// GetObjectStream sends the object in chunks of the configured size.
+func (srv *Server) GetObjectStream(req *pb.GetObjectRequest, stream pb.Sakuin_GetObjectStreamServer) error {
+	rc, _, err := srv.s.GetObjectStream(stream.Context(), req.Id)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer rc.Close()
+
+	buf := make([]byte, srv.chunkSize)
+	for {
+		n, err := io.ReadFull(rc, buf)
+		if n > 0 {
+			serr := stream.Send(&pb.ObjectChunk{Content: buf[:n]})
+			if serr != nil {
+				return serr
+			}
+		}
+		if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return toStatus(err)
+		}
+	}
+}
+
+// chunkReader reads the content of the chunks received by PutObjectStream.
+type chunkReader struct {
+	stream pb.Sakuin_PutObjectStreamServer
+	buf    []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if chunk.Index != nil {
+			return 0, status.Error(codes.InvalidArgument, "only the first chunk may carry the index request")
+		}
+		r.buf = chunk.Content
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
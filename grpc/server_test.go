@@ -0,0 +1,309 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/mocks"
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func startTestServer(t *testing.T, opts ...Option) pb.SakuinClient {
+	_, cc := startTestServerWithConfig(t, sakuin.Config{
+		ObjectStore:   sakuin.NewInMemoryObjectStore(),
+		DocumentStore: sakuin.NewInMemoryDocumentStore(),
+		RandSrc:       rand.Reader,
+	}, opts...)
+	return pb.NewSakuinClient(cc)
+}
+
+func startTestServerWithConfig(t *testing.T, cfg sakuin.Config, opts ...Option) (*Server, *grpc.ClientConn) {
+	srv := NewServer(sakuin.New(cfg), opts...)
+
+	gs := grpc.NewServer()
+	srv.Register(gs)
+	return srv, dialTestServer(t, gs)
+}
+
+// dialTestServer serves gs over an in-memory listener.
+func dialTestServer(t *testing.T, gs *grpc.Server) *grpc.ClientConn {
+	ls := bufconn.Listen(1024 * 1024)
+	go gs.Serve(ls)
+	t.Cleanup(gs.Stop)
+
+	cc, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ls.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	return cc
+}
+
+func putObject(ctx context.Context, client pb.SakuinClient, req *pb.IndexRequest, content []byte, chunkSize int) (*pb.IndexResponse, error) {
+	stream, err := client.PutObjectStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = stream.Send(&pb.ObjectChunk{Index: req})
+	if err != nil {
+		return nil, err
+	}
+	for len(content) > 0 {
+		n := chunkSize
+		if n > len(content) {
+			n = len(content)
+		}
+		err = stream.Send(&pb.ObjectChunk{Content: content[:n]})
+		if err != nil {
+			return nil, err
+		}
+		content = content[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func getObject(ctx context.Context, client pb.SakuinClient, id string) ([]byte, int, error) {
+	stream, err := client.GetObjectStream(ctx, &pb.GetObjectRequest{Id: id})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		buf    bytes.Buffer
+		chunks int
+	)
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return buf.Bytes(), chunks, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		buf.Write(chunk.Content)
+		chunks++
+	}
+}
+
+func TestObjectStream(t *testing.T) {
+	t.Run("should round trip objects larger than the max message size", func(subT *testing.T) {
+		client := startTestServer(subT)
+
+		content := make([]byte, 6*1024*1024)
+		_, err := rand.Read(content)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		ctx := context.Background()
+		resp, err := putObject(ctx, client, &pb.IndexRequest{}, content, 512*1024)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.NotEmpty(subT, resp.Id) {
+			return
+		}
+
+		got, chunks, err := getObject(ctx, client, resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 6, chunks)
+		assert.True(subT, bytes.Equal(content, got))
+	})
+
+	t.Run("should send chunks of the configured size", func(subT *testing.T) {
+		client := startTestServer(subT, WithChunkSize(4))
+
+		ctx := context.Background()
+		resp, err := putObject(ctx, client, &pb.IndexRequest{Id: "test"}, []byte("hello, world"), 5)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Equal(subT, "test", resp.Id) {
+			return
+		}
+
+		got, chunks, err := getObject(ctx, client, resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 3, chunks)
+		assert.Equal(subT, "hello, world", string(got))
+	})
+
+	t.Run("should fail if the first chunk doesn't carry the index request", func(subT *testing.T) {
+		client := startTestServer(subT)
+
+		stream, err := client.PutObjectStream(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = stream.Send(&pb.ObjectChunk{Content: []byte("hello, world")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = stream.CloseAndRecv()
+		assert.Equal(subT, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("should fail if the object doesn't exist", func(subT *testing.T) {
+		client := startTestServer(subT)
+
+		_, _, err := getObject(context.Background(), client, "test")
+		assert.Equal(subT, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	t.Run("should accept and return metadata as a struct", func(subT *testing.T) {
+		client := startTestServer(subT)
+
+		msg, err := structpb.NewStruct(map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		any, err := anypb.New(msg)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		ctx := context.Background()
+		_, err = putObject(ctx, client, &pb.IndexRequest{Id: "test", Metadata: any}, []byte("hello, world"), 5)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		resp, err := client.GetMetadata(ctx, &pb.GetMetadataRequest{Id: "test", AsStruct: true})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var got structpb.Struct
+		if !assert.Nil(subT, resp.Metadata.UnmarshalTo(&got)) {
+			return
+		}
+		assert.Equal(subT, "test", got.AsMap()["name"])
+	})
+
+	t.Run("should reject metadata of an unknown type", func(subT *testing.T) {
+		client := startTestServer(subT)
+
+		_, err := client.Index(context.Background(), &pb.IndexRequest{
+			Metadata: &anypb.Any{TypeUrl: "type.googleapis.com/unknown.Metadata"},
+			Object:   []byte("hello, world"),
+		})
+		assert.Equal(subT, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestStat(t *testing.T) {
+	docStore := sakuin.NewInMemoryDocumentStore()
+	err := docStore.Upsert(context.Background(), "metadataOnly", map[string]interface{}{"name": "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, cc := startTestServerWithConfig(t, sakuin.Config{
+		ObjectStore:   sakuin.NewInMemoryObjectStore(),
+		DocumentStore: docStore,
+		RandSrc:       rand.Reader,
+	})
+	client := pb.NewSakuinClient(cc)
+
+	ctx := context.Background()
+	any, err := anypb.New(&pb.JSONMetadata{Json: []byte(`{"name":"test","description":"test description"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Index(ctx, &pb.IndexRequest{Id: "both", Metadata: any, Object: []byte("hello, world")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Index(ctx, &pb.IndexRequest{Id: "objectOnly", Object: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should report both the object and metadata", func(subT *testing.T) {
+		resp, err := client.Stat(ctx, &pb.StatRequest{Id: "both"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, resp.ObjectExists)
+		assert.Equal(subT, int64(12), resp.ObjectSize)
+		assert.True(subT, resp.MetadataExists)
+		assert.Equal(subT, int64(2), resp.MetadataFields)
+		assert.NotNil(subT, resp.LastModified)
+	})
+
+	t.Run("should report objects without metadata", func(subT *testing.T) {
+		resp, err := client.Stat(ctx, &pb.StatRequest{Id: "objectOnly"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, resp.ObjectExists)
+		assert.Equal(subT, int64(5), resp.ObjectSize)
+		assert.False(subT, resp.MetadataExists)
+		assert.Zero(subT, resp.MetadataFields)
+	})
+
+	t.Run("should report metadata without an object", func(subT *testing.T) {
+		resp, err := client.Stat(ctx, &pb.StatRequest{Id: "metadataOnly"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, resp.ObjectExists)
+		assert.Zero(subT, resp.ObjectSize)
+		assert.True(subT, resp.MetadataExists)
+		assert.Equal(subT, int64(1), resp.MetadataFields)
+	})
+
+	t.Run("should not fail if neither exist", func(subT *testing.T) {
+		resp, err := client.Stat(ctx, &pb.StatRequest{Id: "missing"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, proto.Equal(&pb.StatResponse{}, resp))
+	})
+
+	t.Run("should fail if a store fails", func(subT *testing.T) {
+		objStore := mocks.ObjectStore{}
+		objStore.On("Stat", mock.Anything, mock.Anything).Return(nil, errors.New("oh no something went wrong"))
+
+		_, cc := startTestServerWithConfig(subT, sakuin.Config{
+			ObjectStore:   &objStore,
+			DocumentStore: sakuin.NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		_, err := pb.NewSakuinClient(cc).Stat(ctx, &pb.StatRequest{Id: "missing"})
+		assert.Equal(subT, codes.Internal, status.Code(err))
+	})
+}
@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/z5labs/sakuin"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus converts errors returned by the Service into gRPC status errors.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	var (
+		objErr        sakuin.ObjectDoesNotExistErr
+		docErr        sakuin.DocumentDoesNotExistErr
+		existsErr     sakuin.ObjectAlreadyExistsErr
+		tooLargeErr   sakuin.ObjectTooLargeErr
+		emptyErr      sakuin.EmptyObjectErr
+		validationErr sakuin.MetadataValidationErr
+		conflictErr   sakuin.PatchConflictErr
+		testErr       sakuin.PatchTestFailedErr
+		patchErr      sakuin.InvalidPatchErr
+		revisionErr   sakuin.RevisionMismatchErr
+		checksumErr   sakuin.ChecksumMismatchErr
+		idemErr       sakuin.IdempotencyKeyInProgressErr
+		timeoutErr    sakuin.StoreTimeoutErr
+		partErr       sakuin.PartTooLargeErr
+		typeErr       sakuin.ContentTypeError
+		metadataErr   sakuin.UnsupportedMetadataTypeErr
+		mergeErr      sakuin.MergeConflictErr
+		idErr         sakuin.ReservedIDErr
+	)
+	switch {
+	case errors.As(err, &objErr), errors.As(err, &docErr):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, &existsErr):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.As(err, &tooLargeErr), errors.As(err, &partErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.As(err, &conflictErr), errors.As(err, &testErr), errors.As(err, &revisionErr), errors.As(err, &checksumErr), errors.As(err, &mergeErr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.As(err, &emptyErr), errors.As(err, &validationErr), errors.As(err, &patchErr), errors.As(err, &typeErr), errors.As(err, &metadataErr), errors.As(err, &idErr), errors.Is(err, sakuin.ErrMissingID), errors.Is(err, sakuin.ErrMissingBoundary):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &idemErr):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.As(err, &timeoutErr):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, sakuin.ErrReadOnly), errors.Is(err, sakuin.ErrServiceClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, sakuin.ErrRevisionsNotSupported), errors.Is(err, sakuin.ErrListNotSupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+
+	zap.L().Error("unexpected error", zap.Error(err))
+	return status.Error(codes.Internal, err.Error())
+}
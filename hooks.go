@@ -0,0 +1,56 @@
+package sakuin
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Hooks are callbacks invoked after an indexed entry has been changed.
+//
+// Hooks run in their own goroutine once the stores have been written to,
+// so they never delay or fail the request which triggered them. Errors
+// returned by hooks are logged and panics are recovered.
+type Hooks struct {
+	OnIndexed         func(id string, summary HookSummary) error
+	OnObjectUpdated   func(id string, summary HookSummary) error
+	OnMetadataUpdated func(id string, summary HookSummary) error
+	OnDeleted         func(id string, summary HookSummary) error
+}
+
+// HookSummary describes the change which triggered a hook.
+// Fields which don't apply to the change are left empty.
+type HookSummary struct {
+	// Checksum is the checksum of the object.
+	Checksum string
+
+	// Size is the size of the object in bytes.
+	Size int
+
+	// Revision is the metadata revision, if the DocumentStore supports revisions.
+	Revision string
+
+	// Time is when the change was committed.
+	Time time.Time
+}
+
+func (s *Service) runHook(name string, hook func(string, HookSummary) error, id string, summary HookSummary) {
+	if hook == nil {
+		return
+	}
+	summary.Time = s.now()
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.log.Error("recovered from panic in hook", zap.String("hook", name), zap.String("id", id), zap.String("panic", fmt.Sprint(r)))
+			}
+		}()
+
+		err := hook(id, summary)
+		if err != nil {
+			s.log.Error("hook failed", zap.String("hook", name), zap.String("id", id), zap.Error(err))
+		}
+	}()
+}
@@ -0,0 +1,208 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type hookCall struct {
+	id      string
+	summary HookSummary
+}
+
+func recordHook(calls chan<- hookCall) func(string, HookSummary) error {
+	return func(id string, summary HookSummary) error {
+		calls <- hookCall{id: id, summary: summary}
+		return nil
+	}
+}
+
+func waitForHook(t *testing.T, calls <-chan hookCall) (hookCall, bool) {
+	select {
+	case call := <-calls:
+		return call, true
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for hook")
+		return hookCall{}, false
+	}
+}
+
+func TestHooks(t *testing.T) {
+	t.Run("should call OnIndexed after both stores are written", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		docStore := NewInMemoryDocumentStore()
+
+		type committed struct {
+			object   bool
+			metadata bool
+		}
+		commits := make(chan committed, 1)
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+			RandSrc:       rand.Reader,
+			Hooks: Hooks{
+				OnIndexed: func(id string, summary HookSummary) error {
+					objStats, _ := objStore.Stat(context.Background(), id)
+					docStats, _ := docStore.Stat(context.Background(), id)
+					commits <- committed{object: objStats.Exists, metadata: docStats.Exists}
+					return nil
+				},
+			},
+		})
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		select {
+		case c := <-commits:
+			assert.True(subT, c.object)
+			assert.True(subT, c.metadata)
+		case <-time.After(time.Second):
+			subT.Error("timed out waiting for hook")
+		}
+	})
+
+	t.Run("should pass a summary of the change", func(subT *testing.T) {
+		calls := make(chan hookCall, 1)
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+			Hooks: Hooks{
+				OnIndexed: recordHook(calls),
+			},
+		})
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		call, ok := waitForHook(subT, calls)
+		if !ok {
+			return
+		}
+		assert.Equal(subT, resp.Id, call.id)
+		assert.Equal(subT, resp.Checksum, call.summary.Checksum)
+		assert.Equal(subT, len("content"), call.summary.Size)
+		assert.False(subT, call.summary.Time.IsZero())
+	})
+
+	t.Run("should not call hooks if the change failed", func(subT *testing.T) {
+		calls := make(chan hookCall, 1)
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: failingDocumentStore{DocumentStore: NewInMemoryDocumentStore(), err: errors.New("failed")},
+			RandSrc:       rand.Reader,
+			Hooks: Hooks{
+				OnIndexed: recordHook(calls),
+			},
+		})
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Error(subT, err) {
+			return
+		}
+
+		select {
+		case <-calls:
+			subT.Error("hook should not have been called")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("should not return hook errors to the caller", func(subT *testing.T) {
+		called := make(chan struct{})
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+			Hooks: Hooks{
+				OnMetadataUpdated: func(id string, summary HookSummary) error {
+					close(called)
+					return errors.New("hook failed")
+				},
+			},
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "updated"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{Id: "test", Metadata: metadata})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		select {
+		case <-called:
+		case <-time.After(time.Second):
+			subT.Error("timed out waiting for hook")
+		}
+	})
+
+	t.Run("should recover from panicking hooks", func(subT *testing.T) {
+		called := make(chan struct{})
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			Hooks: Hooks{
+				OnObjectUpdated: func(id string, summary HookSummary) error {
+					defer close(called)
+					panic("hook panicked")
+				},
+			},
+		})
+
+		_, err := s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{Id: "test", Content: []byte("updated")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		select {
+		case <-called:
+		case <-time.After(time.Second):
+			subT.Error("timed out waiting for hook")
+		}
+	})
+
+	t.Run("should call OnDeleted and OnIndexed when moving", func(subT *testing.T) {
+		deleted := make(chan hookCall, 1)
+		indexed := make(chan hookCall, 1)
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("old", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("old", map[string]interface{}{"name": "test"}),
+			Hooks: Hooks{
+				OnIndexed: recordHook(indexed),
+				OnDeleted: recordHook(deleted),
+			},
+		})
+
+		_, err := s.Move(context.Background(), &pb.MoveRequest{OldId: "old", NewId: "new"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		call, ok := waitForHook(subT, deleted)
+		if !ok {
+			return
+		}
+		assert.Equal(subT, "old", call.id)
+
+		call, ok = waitForHook(subT, indexed)
+		if !ok {
+			return
+		}
+		assert.Equal(subT, "new", call.id)
+	})
+}
@@ -4,17 +4,27 @@ package http
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/z5labs/sakuin"
 	"github.com/z5labs/sakuin/http/middleware/logger"
+	"github.com/z5labs/sakuin/http/middleware/metrics"
+	"github.com/z5labs/sakuin/objectstore/quota"
 	pb "github.com/z5labs/sakuin/proto"
 
 	swagger "github.com/arsmn/fiber-swagger/v2"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/types/known/anypb"
 )
@@ -22,6 +32,10 @@ import (
 // APIError
 type APIError struct {
 	Message string `json:"message"`
+
+	// RetryAfter is how many seconds to wait before retrying, when the
+	// request may succeed later. It matches the Retry-After header.
+	RetryAfter int `json:"retry_after,omitempty"`
 }
 
 func (e APIError) Error() string {
@@ -34,6 +48,40 @@ var (
 	}
 )
 
+// ChecksumHeader carries the checksum recorded for an object.
+const ChecksumHeader = "X-Sakuin-Checksum"
+
+// ObjectContentTypeHeader carries the media type recorded for an object
+// in responses whose Content-Type describes something else.
+const ObjectContentTypeHeader = "X-Sakuin-Content-Type"
+
+// ExistsHeader is "true" or "false" depending on whether a stat-ed object exists.
+const ExistsHeader = "X-Sakuin-Exists"
+
+// SizeHeader carries the size of a stat-ed object, since the Content-Length
+// of a GET describes the response body rather than the object.
+const SizeHeader = "X-Sakuin-Size"
+
+// DefaultListLimit and MaxListLimit are the default and largest
+// number of ids returned per page when listing.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 1000
+)
+
+// ReadOnlyRetryAfter is how many seconds clients are told to wait before
+// retrying writes which were rejected because the stores are read-only.
+const ReadOnlyRetryAfter = 60
+
+func sendReadOnly(c *fiber.Ctx) error {
+	zap.L().Warn("rejected write to read-only store")
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ReadOnlyRetryAfter))
+	return c.Status(fiber.StatusServiceUnavailable).JSON(APIError{
+		Message:    sakuin.ErrReadOnly.Error(),
+		RetryAfter: ReadOnlyRetryAfter,
+	})
+}
+
 // @title           Sakuin RESTful API
 // @version         0.0
 // @description     Sakuin is a REST based service for indexing objects along with metadata.
@@ -49,22 +97,89 @@ var (
 // @BasePath  /
 // @schemes   http https
 
-func NewServer(s *sakuin.Service, cfg ...fiber.Config) *fiber.App {
-	app := fiber.New(cfg...)
+// ServerOption configures the server returned by NewServer.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	fiber          fiber.Config
+	limits         Limits
+	metrics        MetricsRegistry
+	disableMetrics bool
+}
+
+// WithFiberConfig configures the underlying fiber.App.
+func WithFiberConfig(cfg fiber.Config) ServerOption {
+	return func(o *serverOptions) { o.fiber = cfg }
+}
+
+// WithLimits caps the size of request bodies.
+func WithLimits(limits Limits) ServerOption {
+	return func(o *serverOptions) { o.limits = limits }
+}
+
+// NewServer returns the HTTP API for s.
+//
+// NewServer used to take an optional fiber.Config directly. That config is
+// now passed with WithFiberConfig, i.e. NewServer(s, cfg) becomes
+// NewServer(s, WithFiberConfig(cfg)).
+func NewServer(s *sakuin.Service, opts ...ServerOption) *fiber.App {
+	var o serverOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	limits := o.limits
+
+	c := o.fiber
+	// The index handler reads the multipart body itself and pre-parsing
+	// would drop the part headers, e.g. the object Content-Type.
+	c.DisablePreParseMultipartForm = true
+	// Object uploads are streamed to the Service rather than buffered.
+	// Streamed bodies aren't rejected by the BodyLimit, it only bounds how
+	// much is read ahead of the handlers, so the Limits are enforced as
+	// the handlers read the body.
+	c.StreamRequestBody = true
+	c.BodyLimit = int(limits.metadata())
+
+	app := fiber.New(c)
+
+	// Probes are registered ahead of all middleware so they never depend on it
+	app.Get("/healthz", NewHealthHandler())
+	app.Get("/readyz", NewReadyHandler(s, ReadinessTimeout))
+
+	// Metrics are recorded for every route registered after the middleware
+	if !o.disableMetrics {
+		reg := o.metrics
+		if reg == nil {
+			reg = prometheus.NewRegistry()
+		}
+		app.Get("/metrics", NewMetricsHandler(reg))
+		app.Use(metrics.New(reg))
+	}
+
+	app.Use(closeUnreadBodies)
 
 	// Swagger
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
 	// Object
+	// HEAD must be registered first since GET routes also handle HEAD
+	app.Head("/index/:id/object", NewStatObjectHandler(s))
 	app.Get("/index/:id/object", NewGetObjectHandler(s))
-	app.Put("/index/:id/object", NewUpdateObjectHandler(s))
+	app.Get("/index/:id/stat", NewStatObjectHandler(s))
+	app.Put("/index/:id/object", NewUpdateObjectHandler(s, limits.Object))
+	app.Delete("/index/:id/object", NewDeleteObjectHandler(s))
 
 	// Metadata
 	app.Get("/index/:id/metadata", NewGetMetadataHandler(s))
-	app.Put("/index/:id/metadata", NewUpdateMetadataHandler(s))
+	app.Put("/index/:id/metadata", NewUpdateMetadataHandler(s, limits.metadata()))
+	app.Patch("/index/:id/metadata", NewPatchMetadataHandler(s, limits.metadata()))
+	app.Delete("/index/:id/metadata", NewDeleteMetadataHandler(s))
 
 	// Indexing
-	app.Post("/index", NewIndexHandler(s))
+	app.Get("/index", NewListHandler(s))
+	app.Post("/index", NewIndexHandler(s, limits))
+	app.Post("/index/search", NewSearchHandler(s, limits.metadata()))
+	app.Delete("/index/:id", NewDeleteHandler(s))
 
 	app.Use(
 		pprof.New(),
@@ -81,24 +196,39 @@ func NewServer(s *sakuin.Service, cfg ...fiber.Config) *fiber.App {
 // @Summary  Retrieve an object.
 // @Tags     Objects
 // @Accept   json
-// @Produce  application/zip
+// @Produce  */*
 // @Success  200  "Successfully return object contents in response body"
+// @Header   200  {string}  Content-Type         "Content type recorded for the object, defaults to application/octet-stream"
+// @Header   200  {string}  X-Sakuin-Checksum    "Checksum recorded for the object"
+// @Header   200  {string}  ETag                 "Strong entity tag of the object"
+// @Header   200  {string}  Content-Disposition  "Set to attachment when download is true"
+// @Success  304  "The object matches If-None-Match"
 // @Failure  404  "Object not found"
 // @Failure  500  {object}  APIError
-// @Param    id   path      string  true  "Object ID"
+// @Failure  504  {object}  APIError
+// @Param    id             path    string  true   "Object ID"
+// @Param    download       query   bool    false  "Ask clients to download the object rather than display it"
+// @Param    filename       query   string  false  "Filename to download the object as, defaults to the uploaded filename or the id"
+// @Param    If-None-Match  header  string  false  "Entity tags of cached copies"
 // @Router   /index/{id}/object [get]
 func NewGetObjectHandler(s *sakuin.Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		c.AcceptsEncodings("gzip", "compress", "br")
 		id := c.Params("id")
 
-		resp, err := s.GetObject(c.Context(), &pb.GetObjectRequest{
+		resp, err := s.GetObject(c.UserContext(), &pb.GetObjectRequest{
 			Id: id,
 		})
 		if _, ok := err.(sakuin.ObjectDoesNotExistErr); ok {
 			zap.L().Error("object does not exist", zap.String("id", id))
 			return c.SendStatus(fiber.StatusNotFound)
 		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
 		if err != nil {
 			zap.L().Error("unexpected error when retrieving object", zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
@@ -106,31 +236,247 @@ func NewGetObjectHandler(s *sakuin.Service) fiber.Handler {
 			})
 		}
 
+		if resp.Checksum != "" {
+			c.Set(ChecksumHeader, resp.Checksum)
+		}
+		if checkNotModified(c, etag(resp.Checksum, resp.Content)) {
+			return nil
+		}
+
+		contentType := resp.ContentType
+		if contentType == "" {
+			contentType = fiber.MIMEOctetStream
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		if c.Query("download") == "true" {
+			filename := resp.Filename
+			if filename == "" {
+				filename = id
+			}
+			c.Set(fiber.HeaderContentDisposition, attachment(c.Query("filename", filename)))
+		}
+
 		return c.Status(fiber.StatusOK).
 			Send(resp.Content)
 	}
 }
 
+// attachment formats a Content-Disposition telling clients to download
+// the response as filename. Quotes are escaped and non-ASCII names are
+// encoded as RFC 2231 extended parameters by mime.FormatMediaType.
+func attachment(filename string) string {
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	if disposition == "" {
+		// Only happens for names with control characters
+		return "attachment"
+	}
+	return disposition
+}
+
+const bodyReaderKey = "sakuin.body"
+
+// requestBody returns a reader for the request body, which is streamed
+// from the connection when the server streams request bodies.
+func requestBody(c *fiber.Ctx) io.Reader {
+	r := c.Context().RequestBodyStream()
+	if r == nil {
+		return bytes.NewReader(c.Body())
+	}
+	br := &bodyReader{r: r}
+	c.Locals(bodyReaderKey, br)
+	return br
+}
+
+// bodyReader records whether the request body was read to the end.
+type bodyReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (r *bodyReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+// closeUnreadBodies closes the connection if the handler didn't read the
+// streamed request body to the end, e.g. when rejecting it as too large,
+// since the rest of it would otherwise be parsed as the next request.
+func closeUnreadBodies(c *fiber.Ctx) error {
+	err := c.Next()
+	if c.Request().Header.ContentLength() == 0 || c.Context().RequestBodyStream() == nil {
+		return err
+	}
+	br, ok := c.Locals(bodyReaderKey).(*bodyReader)
+	if !ok || !br.eof {
+		c.Context().SetConnectionClose()
+	}
+	return err
+}
+
+// ObjectStat describes an object without its content.
+type ObjectStat struct {
+	Size         int        `json:"size"`
+	Checksum     string     `json:"checksum,omitempty"`
+	ContentType  string     `json:"content_type,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+}
+
+// NewStatObjectHandler godoc
+// @Summary  Check whether an object exists and how large it is, without retrieving it.
+// @Tags     Objects
+// @Produce  json
+// @Success  200  {object}  ObjectStat  "Only returned for GET, HEAD has no body"
+// @Header   200  {string}  X-Sakuin-Exists    "Always true"
+// @Header   200  {int}     X-Sakuin-Size      "Size of the object in bytes"
+// @Header   200  {int}     Content-Length     "Size of the object in bytes, for HEAD"
+// @Header   200  {string}  Last-Modified      "When the object was last modified, if known"
+// @Header   200  {string}  X-Sakuin-Checksum  "Checksum recorded for the object"
+// @Failure  404  "Object not found"
+// @Failure  500  {object}  APIError
+// @Failure  504  {object}  APIError
+// @Param    id   path      string  true  "Object ID"
+// @Router   /index/{id}/object [head]
+// @Router   /index/{id}/stat [get]
+func NewStatObjectHandler(s *sakuin.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		head := c.Method() == fiber.MethodHead
+
+		info, err := s.StatObject(c.UserContext(), id)
+		if _, ok := err.(sakuin.ObjectDoesNotExistErr); ok {
+			zap.L().Info("object does not exist", zap.String("id", id))
+			c.Set(ExistsHeader, "false")
+			if head {
+				c.Status(fiber.StatusNotFound)
+				return nil
+			}
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when stat-ing object", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+
+		c.Set(ExistsHeader, "true")
+		c.Set(SizeHeader, strconv.Itoa(info.Size))
+		if info.Checksum != "" {
+			c.Set(ChecksumHeader, info.Checksum)
+		}
+		if !info.LastModified.IsZero() {
+			c.Response().Header.SetLastModified(info.LastModified)
+		}
+
+		if head {
+			contentType := info.ContentType
+			if contentType == "" {
+				contentType = fiber.MIMEOctetStream
+			}
+			c.Set(fiber.HeaderContentType, contentType)
+			c.Response().Header.SetContentLength(info.Size)
+			c.Status(fiber.StatusOK)
+			return nil
+		}
+
+		stat := ObjectStat{
+			Size:        info.Size,
+			Checksum:    info.Checksum,
+			ContentType: info.ContentType,
+		}
+		if !info.CreatedAt.IsZero() {
+			stat.CreatedAt = &info.CreatedAt
+		}
+		if !info.LastModified.IsZero() {
+			stat.LastModified = &info.LastModified
+		}
+		return c.Status(fiber.StatusOK).
+			JSON(stat)
+	}
+}
+
 // NewUpdateObjectHandler godoc
 // @Summary  Update an object by id. This will completely replace an objects contents.
 // @Tags     Objects
 // @Accept   */*
 // @Success  200  "Successfully updated object to new content."
+// @Header   200  {string}  X-Sakuin-Checksum  "Checksum of the new object content"
+// @Failure  400  {object}  APIError
+// @Failure  404  "The object does not exist"
+// @Failure  412  {object}  APIError
+// @Failure  413  {object}  APIError
 // @Failure  500  {object}  APIError
-// @Param    id   path      string  true  "Object ID"
+// @Failure  503  {object}  APIError
+// @Failure  507  {object}  APIError
+// @Failure  504  {object}  APIError
+// @Param    id           path      string  true   "Object ID"
+// @Param    allow_empty  query     bool    false  "Allow replacing the object with empty content"
+// @Param    If-Match     header    string  false  "Entity tags the current content must match"
 // @Router   /index/{id}/object [put]
-func NewUpdateObjectHandler(s *sakuin.Service) fiber.Handler {
+func NewUpdateObjectHandler(s *sakuin.Service, limit int64) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id := c.Params("id")
 
-		_, err := s.UpdateObject(c.Context(), &pb.UpdateObjectRequest{
-			Id:      id,
-			Content: c.Body(),
-		})
+		req := &pb.UpdateObjectRequest{
+			Id:          id,
+			ContentType: c.Get(fiber.HeaderContentType),
+			AllowEmpty:  c.Query("allow_empty") == "true",
+		}
+		if h := c.Get(fiber.HeaderIfMatch); h != "" {
+			req.ExpectedChecksums = ifMatchChecksums(h)
+		}
+
+		resp, err := s.UpdateObjectStream(c.UserContext(), req, limitBody(c, limit))
+		var berr BodyTooLargeErr
+		if errors.As(err, &berr) {
+			return sendTooLarge(c, berr)
+		}
 		if _, ok := err.(sakuin.ObjectDoesNotExistErr); ok {
 			zap.L().Error("object does not exist", zap.String("id", id))
 			return c.SendStatus(fiber.StatusNotFound)
 		}
+		if merr, ok := err.(sakuin.ChecksumMismatchErr); ok {
+			return sendPreconditionFailed(c, merr.Error())
+		}
+		if eerr, ok := err.(sakuin.EmptyObjectErr); ok {
+			zap.L().Error("object has no content", zap.String("id", id))
+			return c.Status(fiber.StatusBadRequest).JSON(APIError{
+				Message: eerr.Error() + ", set allow_empty=true to replace it anyway",
+			})
+		}
+		var serr sakuin.ObjectTooLargeErr
+		if errors.As(err, &serr) {
+			zap.L().Error("object is too large", zap.String("id", id))
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(APIError{
+				Message: serr.Error(),
+			})
+		}
+		var qerr quota.QuotaExceededErr
+		if errors.As(err, &qerr) {
+			zap.L().Error("storage quota exceeded", zap.String("resource", string(qerr.Resource)))
+			return c.Status(fiber.StatusInsufficientStorage).JSON(APIError{
+				Message: qerr.Error(),
+			})
+		}
+		if errors.Is(err, sakuin.ErrReadOnly) {
+			return sendReadOnly(c)
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
 		if err != nil {
 			zap.L().Error("unexpected error when updating object", zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
@@ -138,6 +484,46 @@ func NewUpdateObjectHandler(s *sakuin.Service) fiber.Handler {
 			})
 		}
 
+		c.Set(ChecksumHeader, resp.Checksum)
+		return c.SendStatus(fiber.StatusOK)
+	}
+}
+
+// NewDeleteObjectHandler godoc
+// @Summary  Delete an object by id, leaving its metadata in place.
+// @Tags     Objects
+// @Success  200  "Successfully deleted object."
+// @Failure  404  "Object not found"
+// @Failure  500  {object}  APIError
+// @Failure  503  {object}  APIError
+// @Failure  504  {object}  APIError
+// @Param    id   path      string  true  "Object ID"
+// @Router   /index/{id}/object [delete]
+func NewDeleteObjectHandler(s *sakuin.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		err := s.DeleteObject(c.UserContext(), id)
+		if _, ok := err.(sakuin.ObjectDoesNotExistErr); ok {
+			zap.L().Error("object does not exist", zap.String("id", id))
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if errors.Is(err, sakuin.ErrReadOnly) {
+			return sendReadOnly(c)
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when deleting object", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+
 		return c.SendStatus(fiber.StatusOK)
 	}
 }
@@ -148,20 +534,32 @@ func NewUpdateObjectHandler(s *sakuin.Service) fiber.Handler {
 // @Accept   json
 // @Produce  json
 // @Success  200  {object}  map[string]interface{}
+// @Header   200  {string}  ETag                   "Strong entity tag of the metadata"
+// @Header   200  {string}  X-Sakuin-Checksum      "Checksum recorded for the object"
+// @Header   200  {string}  X-Sakuin-Content-Type  "Media type recorded for the object"
+// @Success  304  "The metadata matches If-None-Match"
 // @Failure  500  {object}  APIError
-// @Param    id   path      string  true  "Object ID"
+// @Failure  504  {object}  APIError
+// @Param    id             path    string  true   "Object ID"
+// @Param    If-None-Match  header  string  false  "Entity tags of cached copies"
 // @Router   /index/{id}/metdata [get]
 func NewGetMetadataHandler(s *sakuin.Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id := c.Params("id")
 
-		resp, err := s.GetMetadata(c.Context(), &pb.GetMetadataRequest{
+		resp, err := s.GetMetadata(c.UserContext(), &pb.GetMetadataRequest{
 			Id: id,
 		})
 		if _, ok := err.(sakuin.DocumentDoesNotExistErr); ok {
 			zap.L().Error("metadata does not exist", zap.String("id", id))
 			return c.SendStatus(fiber.StatusNotFound)
 		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
 		if err != nil {
 			zap.L().Error("unexpected error when retrieving metadata", zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).
@@ -180,6 +578,16 @@ func NewGetMetadataHandler(s *sakuin.Service) fiber.Handler {
 				})
 		}
 
+		if resp.Checksum != "" {
+			c.Set(ChecksumHeader, resp.Checksum)
+		}
+		if resp.ContentType != "" {
+			c.Set(ObjectContentTypeHeader, resp.ContentType)
+		}
+		if checkNotModified(c, etag("", msg.Json)) {
+			return nil
+		}
+
 		return c.Status(fiber.StatusOK).
 			JSON(json.RawMessage(msg.Json))
 	}
@@ -190,10 +598,17 @@ func NewGetMetadataHandler(s *sakuin.Service) fiber.Handler {
 // @Tags     Metadata
 // @Accept   json
 // @Success  200  "Successfully updated object metadata."
+// @Failure  404  "The metadata does not exist"
+// @Failure  412  {object}  APIError
+// @Failure  413  {object}  APIError
+// @Failure  422  {object}  APIError
 // @Failure  500  {object}  APIError
-// @Param    id   path      string  true  "Object ID"
+// @Failure  503  {object}  APIError
+// @Failure  504  {object}  APIError
+// @Param    id        path      string  true   "Object ID"
+// @Param    If-Match  header    string  false  "Entity tags the current metadata must match"
 // @Router   /index/{id}/metadata [put]
-func NewUpdateMetadataHandler(s *sakuin.Service) fiber.Handler {
+func NewUpdateMetadataHandler(s *sakuin.Service, limit int64) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		if contentType := c.Get("Content-Type"); !strings.Contains(contentType, "application/json") {
 			zap.L().Warn("received invalid content type", zap.String("content-type", contentType))
@@ -204,8 +619,20 @@ func NewUpdateMetadataHandler(s *sakuin.Service) fiber.Handler {
 				})
 		}
 
+		body, err := readBody(c, limit)
+		if berr, ok := err.(BodyTooLargeErr); ok {
+			return sendTooLarge(c, berr)
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when reading request body", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).
+				JSON(APIError{
+					Message: err.Error(),
+				})
+		}
+
 		var metadata json.RawMessage
-		err := c.BodyParser(&metadata)
+		err = json.Unmarshal(body, &metadata)
 		if err != nil {
 			zap.L().Error("unexpected error when unmarshalling request body", zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).
@@ -225,14 +652,70 @@ func NewUpdateMetadataHandler(s *sakuin.Service) fiber.Handler {
 				})
 		}
 
-		_, err = s.UpdateMetadata(c.Context(), &pb.UpdateMetadataRequest{
+		req := &pb.UpdateMetadataRequest{
 			Id:       id,
 			Metadata: any,
-		})
+		}
+		if h := c.Get(fiber.HeaderIfMatch); h != "" {
+			// Compare against the current metadata, then require its revision
+			// so a concurrent update in between is caught by the store. Stores
+			// without revisions can't close that window.
+			current, err := s.GetMetadata(c.UserContext(), &pb.GetMetadataRequest{Id: id})
+			if _, ok := err.(sakuin.DocumentDoesNotExistErr); ok {
+				zap.L().Error("metadata does not exist", zap.String("id", id))
+				return c.SendStatus(fiber.StatusNotFound)
+			}
+			if err != nil {
+				zap.L().Error("unexpected error when retrieving metadata", zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+					Message: err.Error(),
+				})
+			}
+
+			var msg pb.JSONMetadata
+			err = current.Metadata.UnmarshalTo(&msg)
+			if err != nil {
+				zap.L().Error("unexpected error when unmarshalling any proto", zap.Error(err))
+				return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+					Message: err.Error(),
+				})
+			}
+			if !etagMatches(h, etag("", msg.Json), false) {
+				return sendPreconditionFailed(c, "metadata for "+id+" does not match If-Match")
+			}
+			req.ExpectedRevision = current.Revision
+		}
+
+		_, err = s.UpdateMetadata(c.UserContext(), req)
 		if _, ok := err.(sakuin.DocumentDoesNotExistErr); ok {
 			zap.L().Error("metadata does not exist", zap.String("id", id))
 			return c.SendStatus(fiber.StatusNotFound)
 		}
+		if rerr, ok := err.(sakuin.RevisionMismatchErr); ok {
+			return sendPreconditionFailed(c, rerr.Error())
+		}
+		if verr, ok := err.(sakuin.MetadataValidationErr); ok {
+			zap.L().Error("metadata failed validation", zap.String("id", verr.ID))
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(APIError{
+				Message: verr.Err.Error(),
+			})
+		}
+		var merr sakuin.MergeConflictErr
+		if errors.As(err, &merr) {
+			zap.L().Error("metadata can't be merged", zap.String("id", id), zap.String("field", merr.Field))
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(APIError{
+				Message: merr.Error(),
+			})
+		}
+		if errors.Is(err, sakuin.ErrReadOnly) {
+			return sendReadOnly(c)
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
 		if err != nil {
 			zap.L().Error("unexpected error when updating metadata", zap.Error(err))
 			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
@@ -244,20 +727,195 @@ func NewUpdateMetadataHandler(s *sakuin.Service) fiber.Handler {
 	}
 }
 
+// NewPatchMetadataHandler godoc
+// @Summary  Patch object metadata by id using either JSON Merge Patch (RFC 7386) or JSON Patch (RFC 6902).
+// @Tags     Metadata
+// @Accept   application/merge-patch+json
+// @Accept   application/json-patch+json
+// @Success  200  "Successfully patched object metadata."
+// @Failure  400  {object}  APIError
+// @Failure  404  "Metadata not found"
+// @Failure  413  {object}  APIError
+// @Failure  415  {object}  APIError
+// @Failure  422  {object}  APIError
+// @Failure  500  {object}  APIError
+// @Failure  503  {object}  APIError
+// @Failure  504  {object}  APIError
+// @Param    id   path      string  true  "Object ID"
+// @Router   /index/{id}/metadata [patch]
+func NewPatchMetadataHandler(s *sakuin.Service, limit int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		contentType := c.Get("Content-Type")
+		mergePatch := strings.Contains(contentType, "application/merge-patch+json")
+		if !mergePatch && !strings.Contains(contentType, "application/json-patch+json") {
+			zap.L().Warn("received invalid content type", zap.String("content-type", contentType))
+
+			return c.Status(fiber.StatusUnsupportedMediaType).
+				JSON(APIError{
+					Message: "content type must be one of: application/merge-patch+json, application/json-patch+json",
+				})
+		}
+
+		body, err := readBody(c, limit)
+		if berr, ok := err.(BodyTooLargeErr); ok {
+			return sendTooLarge(c, berr)
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when reading request body", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+
+		id := c.Params("id")
+
+		if mergePatch {
+			_, err = s.MergePatchMetadata(c.UserContext(), id, json.RawMessage(body))
+		} else {
+			_, err = s.PatchMetadata(c.UserContext(), &pb.PatchMetadataRequest{
+				Id:    id,
+				Patch: body,
+			})
+		}
+		if _, ok := err.(sakuin.DocumentDoesNotExistErr); ok {
+			zap.L().Error("metadata does not exist", zap.String("id", id))
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if perr, ok := err.(sakuin.PatchConflictErr); ok {
+			zap.L().Error("patch can't be applied", zap.String("id", id), zap.Error(perr.Err))
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(APIError{
+				Message: perr.Error(),
+			})
+		}
+		if terr, ok := err.(sakuin.PatchTestFailedErr); ok {
+			zap.L().Error("patch test operation failed", zap.String("id", id))
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
+		if perr, ok := err.(sakuin.InvalidPatchErr); ok {
+			zap.L().Error("invalid patch", zap.String("id", id), zap.Error(perr.Err))
+			return c.Status(fiber.StatusBadRequest).JSON(APIError{
+				Message: perr.Error(),
+			})
+		}
+		if verr, ok := err.(sakuin.MetadataValidationErr); ok {
+			zap.L().Error("metadata failed validation", zap.String("id", verr.ID))
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(APIError{
+				Message: verr.Err.Error(),
+			})
+		}
+		if errors.Is(err, sakuin.ErrReadOnly) {
+			return sendReadOnly(c)
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when patching metadata", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+
+		return c.SendStatus(fiber.StatusOK)
+	}
+}
+
+// NewDeleteMetadataHandler godoc
+// @Summary  Delete object metadata by id, leaving the object in place.
+// @Tags     Metadata
+// @Success  200  "Successfully deleted object metadata."
+// @Failure  404  "Metadata not found"
+// @Failure  500  {object}  APIError
+// @Failure  503  {object}  APIError
+// @Failure  504  {object}  APIError
+// @Param    id   path      string  true  "Object ID"
+// @Router   /index/{id}/metadata [delete]
+func NewDeleteMetadataHandler(s *sakuin.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		err := s.DeleteMetadata(c.UserContext(), id)
+		if _, ok := err.(sakuin.DocumentDoesNotExistErr); ok {
+			zap.L().Error("metadata does not exist", zap.String("id", id))
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if errors.Is(err, sakuin.ErrReadOnly) {
+			return sendReadOnly(c)
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when deleting metadata", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+
+		return c.SendStatus(fiber.StatusOK)
+	}
+}
+
 // NewIndexHandler godoc
 // @Summary  index a new object along with its metadata
 // @Tags     Index
 // @Accept   multipart/form-data
 // @Produce  json
-// @Param    metadata  body      map[string]interface{}  true  "Object metadata"
+// @Param    metadata          body      map[string]interface{}  true   "Object metadata"
+// @Param    id                query     string                  false  "Caller supplied object ID, may also be sent as an id part"
+// @Param    Idempotency-Key   header    string                  false  "Retries with the same key return the original ID instead of indexing again"
 // @Success  200       {object}  pb.IndexResponse
 // @Failure  400       {object}  APIError
+// @Failure  409       {object}  APIError
+// @Failure  413       {object}  APIError
+// @Failure  422       {object}  APIError
 // @Failure  500       {object}  APIError
+// @Failure  503       {object}  APIError
+// @Failure  507       {object}  APIError
+// @Failure  504       {object}  APIError
 // @Router   /index [post]
-func NewIndexHandler(s *sakuin.Service) fiber.Handler {
+func NewIndexHandler(s *sakuin.Service, limits Limits) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		metadata, object, err := sakuin.ReadParts(bytes.NewReader(c.Body()), c.Get("Content-Type"))
-		if err != nil {
+		// The object is streamed to the Service while the body is read, so
+		// errors from indexing are told apart from errors reading the body.
+		var resp *pb.IndexResponse
+		var indexErr error
+		indexed := false
+		_, err := sakuin.StreamIndexParts(requestBody(c), c.Get("Content-Type"), limits.PartLimits(), func(parts *sakuin.IndexParts, object io.Reader) error {
+			indexed = true
+
+			var any *anypb.Any
+			if parts.Metadata != nil {
+				any, indexErr = anypb.New(&pb.JSONMetadata{Json: parts.Metadata})
+				if indexErr != nil {
+					zap.L().Error("unexpected error when marshalling any proto", zap.Error(indexErr))
+					return indexErr
+				}
+			}
+
+			zap.L().Info("indexing object and metadata")
+			resp, indexErr = s.IndexObjectStream(c.UserContext(), &pb.IndexRequest{
+				Id:             c.Query("id", parts.ID),
+				Metadata:       any,
+				ContentType:    parts.ObjectContentType,
+				Filename:       parts.ObjectFilename,
+				IdempotencyKey: c.Get("Idempotency-Key"),
+			}, object)
+			return indexErr
+		})
+		var perr sakuin.PartTooLargeErr
+		if errors.As(err, &perr) {
+			return sendTooLarge(c, perr)
+		}
+		if err != nil && indexErr == nil {
 			if cerr, ok := err.(sakuin.ContentTypeError); ok {
 				zap.L().Error("invalid content type", zap.String("content-type", cerr.ContentType))
 
@@ -271,28 +929,71 @@ func NewIndexHandler(s *sakuin.Service) fiber.Handler {
 				Message: err.Error(),
 			})
 		}
-		if object == nil {
+		if !indexed {
 			zap.L().Warn("no object provided for indexing")
 			return c.Status(fiber.StatusBadRequest).JSON(ErrMissingObjectPart)
 		}
 
-		var any *anypb.Any
-		if metadata != nil {
-			any, err = anypb.New(&pb.JSONMetadata{Json: metadata})
-			if err != nil {
-				zap.L().Error("unexpected error when marshalling any proto", zap.Error(err))
-				return c.Status(fiber.StatusInternalServerError).
-					JSON(APIError{
-						Message: err.Error(),
-					})
-			}
+		if cerr, ok := err.(sakuin.ObjectAlreadyExistsErr); ok {
+			zap.L().Error("object already exists", zap.String("id", cerr.ID))
+			return c.Status(fiber.StatusConflict).JSON(APIError{
+				Message: cerr.Error(),
+			})
+		}
+		if rerr, ok := err.(sakuin.ReservedIDErr); ok {
+			zap.L().Error("id is reserved", zap.String("id", rerr.ID))
+			return c.Status(fiber.StatusBadRequest).JSON(APIError{
+				Message: rerr.Error(),
+			})
+		}
+		if eerr, ok := err.(sakuin.EmptyObjectErr); ok {
+			zap.L().Error("object part has no content")
+			return c.Status(fiber.StatusBadRequest).JSON(APIError{
+				Message: eerr.Error(),
+			})
+		}
+		if ierr, ok := err.(sakuin.IdempotencyKeyInProgressErr); ok {
+			zap.L().Error("idempotency key is in use", zap.String("key", ierr.Key))
+			return c.Status(fiber.StatusConflict).JSON(APIError{
+				Message: ierr.Error(),
+			})
+		}
+		var serr sakuin.ObjectTooLargeErr
+		if errors.As(err, &serr) {
+			zap.L().Error("object is too large", zap.Int64("size", serr.Size))
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(APIError{
+				Message: serr.Error(),
+			})
+		}
+		if verr, ok := err.(sakuin.MetadataValidationErr); ok {
+			zap.L().Error("metadata failed validation", zap.String("id", verr.ID))
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(APIError{
+				Message: verr.Err.Error(),
+			})
+		}
+		var merr sakuin.MergeConflictErr
+		if errors.As(err, &merr) {
+			zap.L().Error("metadata can't be merged", zap.String("field", merr.Field))
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(APIError{
+				Message: merr.Error(),
+			})
+		}
+		var qerr quota.QuotaExceededErr
+		if errors.As(err, &qerr) {
+			zap.L().Error("storage quota exceeded", zap.String("resource", string(qerr.Resource)))
+			return c.Status(fiber.StatusInsufficientStorage).JSON(APIError{
+				Message: qerr.Error(),
+			})
+		}
+		if errors.Is(err, sakuin.ErrReadOnly) {
+			return sendReadOnly(c)
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
 		}
-
-		zap.L().Info("indexing object and metadata")
-		resp, err := s.Index(c.Context(), &pb.IndexRequest{
-			Metadata: any,
-			Object:   object,
-		})
 		if err != nil {
 			zap.L().Error("unexpected error when indexing", zap.Error(err))
 			return err
@@ -303,3 +1004,220 @@ func NewIndexHandler(s *sakuin.Service) fiber.Handler {
 			JSON(resp)
 	}
 }
+
+// ListResponse is a page of indexed object ids. An empty NextCursor
+// means there are no more pages.
+type ListResponse struct {
+	IDs        []string `json:"ids"`
+	NextCursor string   `json:"next_cursor"`
+}
+
+// NewListHandler godoc
+// @Summary  List the ids of indexed objects, in ascending order.
+// @Tags     Index
+// @Produce  json
+// @Success  200  {object}  ListResponse
+// @Header   200  {string}  Link  "URL of the next page, if there is one"
+// @Failure  400  {object}  APIError
+// @Failure  500  {object}  APIError
+// @Failure  501  {object}  APIError
+// @Failure  504  {object}  APIError
+// @Param    limit   query     int     false  "Maximum number of ids to return, up to 1000"  default(50)
+// @Param    cursor  query     string  false  "Cursor of the page to return, from the previous page"
+// @Param    prefix  query     string  false  "Only list ids starting with the prefix"
+// @Router   /index [get]
+func NewListHandler(s *sakuin.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		limit := DefaultListLimit
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > MaxListLimit {
+				zap.L().Error("invalid list limit", zap.String("limit", v))
+				return c.Status(fiber.StatusBadRequest).JSON(APIError{
+					Message: fmt.Sprintf("limit must be a number from 1 to %d", MaxListLimit),
+				})
+			}
+			limit = n
+		}
+		prefix := c.Query("prefix")
+
+		ids, next, err := s.List(c.UserContext(), prefix, c.Query("cursor"), limit)
+		if errors.Is(err, sakuin.ErrListNotSupported) {
+			zap.L().Error("object store does not support listing")
+			return c.Status(fiber.StatusNotImplemented).JSON(APIError{
+				Message: "listing isn't supported by the configured object store",
+			})
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when listing", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+
+		if next != "" {
+			q := url.Values{}
+			q.Set("limit", strconv.Itoa(limit))
+			q.Set("cursor", next)
+			if prefix != "" {
+				q.Set("prefix", prefix)
+			}
+			c.Set(fiber.HeaderLink, fmt.Sprintf(`<%s%s?%s>; rel="next"`, c.BaseURL(), c.Path(), q.Encode()))
+		}
+
+		return c.Status(fiber.StatusOK).
+			JSON(ListResponse{IDs: ids, NextCursor: next})
+	}
+}
+
+// SearchRequest selects the indexed objects whose metadata matches all of
+// the fields in Equals, keyed by their dotted path, e.g. "author.name".
+type SearchRequest struct {
+	Equals map[string]interface{} `json:"equals"`
+
+	// Limit defaults to DefaultListLimit and can be at most MaxListLimit.
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
+}
+
+// SearchResult is the metadata of an indexed object matching a search.
+type SearchResult struct {
+	ID       string                 `json:"id"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// SearchResponse is a page of search results, ordered by id. An empty
+// NextCursor means there are no more pages.
+type SearchResponse struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor string         `json:"next_cursor"`
+}
+
+// NewSearchHandler godoc
+// @Summary  Search for indexed objects by their metadata.
+// @Tags     Index
+// @Accept   json
+// @Produce  json
+// @Success  200  {object}  SearchResponse
+// @Failure  400  {object}  APIError
+// @Failure  413  {object}  APIError
+// @Failure  500  {object}  APIError
+// @Failure  501  {object}  APIError
+// @Param    query  body  SearchRequest  true  "Fields to match, by dotted path"
+// @Router   /index/search [post]
+func NewSearchHandler(s *sakuin.Service, limit int64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req SearchRequest
+		dec := json.NewDecoder(limitBody(c, limit))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&req)
+		if berr, ok := err.(BodyTooLargeErr); ok {
+			return sendTooLarge(c, berr)
+		}
+		if err != nil {
+			zap.L().Error("unable to decode search request", zap.Error(err))
+			return c.Status(fiber.StatusBadRequest).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+		if req.Limit == 0 {
+			req.Limit = DefaultListLimit
+		}
+		if req.Limit < 0 || req.Limit > MaxListLimit {
+			zap.L().Error("invalid search limit", zap.Int("limit", req.Limit))
+			return c.Status(fiber.StatusBadRequest).JSON(APIError{
+				Message: fmt.Sprintf("limit must be a number from 1 to %d", MaxListLimit),
+			})
+		}
+
+		paths := make([]string, 0, len(req.Equals))
+		for path := range req.Equals {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		q := sakuin.Query{Limit: req.Limit, Cursor: req.Cursor}
+		for _, path := range paths {
+			q.Predicates = append(q.Predicates, sakuin.FieldEquals(path, req.Equals[path]))
+		}
+
+		result, err := s.Search(c.UserContext(), q)
+		if qerr, ok := err.(sakuin.InvalidQueryErr); ok {
+			zap.L().Error("invalid search query", zap.Error(qerr))
+			return c.Status(fiber.StatusBadRequest).JSON(APIError{
+				Message: qerr.Error(),
+			})
+		}
+		if errors.Is(err, sakuin.ErrQueryNotSupported) {
+			zap.L().Error("document store does not support queries")
+			return c.Status(fiber.StatusNotImplemented).JSON(APIError{
+				Message: "searching isn't supported by the configured document store",
+			})
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when searching", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+
+		resp := SearchResponse{
+			Results:    make([]SearchResult, 0, len(result.Documents)),
+			NextCursor: result.NextCursor,
+		}
+		for _, doc := range result.Documents {
+			resp.Results = append(resp.Results, SearchResult{ID: doc.ID, Metadata: doc.Document})
+		}
+		return c.Status(fiber.StatusOK).
+			JSON(resp)
+	}
+}
+
+// NewDeleteHandler godoc
+// @Summary  Delete an object along with its metadata.
+// @Tags     Index
+// @Produce  json
+// @Success  200  {object}  pb.DeleteResponse
+// @Failure  404  "Neither object nor metadata found"
+// @Failure  500  {object}  APIError
+// @Failure  503  {object}  APIError
+// @Failure  504  {object}  APIError
+// @Param    id   path      string  true  "Object ID"
+// @Router   /index/{id} [delete]
+func NewDeleteHandler(s *sakuin.Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		resp, err := s.Delete(c.UserContext(), &pb.DeleteRequest{
+			Id: id,
+		})
+		if _, ok := err.(sakuin.ObjectDoesNotExistErr); ok {
+			zap.L().Error("object does not exist", zap.String("id", id))
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		if errors.Is(err, sakuin.ErrReadOnly) {
+			return sendReadOnly(c)
+		}
+		if terr, ok := err.(sakuin.StoreTimeoutErr); ok {
+			zap.L().Error("store call timed out", zap.String("op", terr.Op))
+			return c.Status(fiber.StatusGatewayTimeout).JSON(APIError{
+				Message: terr.Error(),
+			})
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when deleting", zap.Error(err))
+			return c.Status(fiber.StatusInternalServerError).JSON(APIError{
+				Message: err.Error(),
+			})
+		}
+
+		return c.Status(fiber.StatusOK).
+			JSON(resp)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"testing"
 
 	"github.com/z5labs/sakuin"
@@ -15,9 +16,9 @@ import (
 )
 
 func newTestServer(s *sakuin.Service) *fiber.App {
-	return NewServer(s, fiber.Config{
+	return NewServer(s, WithFiberConfig(fiber.Config{
 		DisableStartupMessage: true,
-	})
+	}))
 }
 
 func withObjectStore(objStore sakuin.ObjectStore) func(*sakuin.Config) {
@@ -28,7 +29,27 @@ func withDocumentStore(docStore sakuin.DocumentStore) func(*sakuin.Config) {
 	return func(cfg *sakuin.Config) { cfg.DocumentStore = docStore }
 }
 
+func withMaxObjectSize(size int64) func(*sakuin.Config) {
+	return func(cfg *sakuin.Config) { cfg.MaxObjectSize = size }
+}
+
+func withMetadataValidator(v sakuin.MetadataValidator) func(*sakuin.Config) {
+	return func(cfg *sakuin.Config) { cfg.MetadataValidator = v }
+}
+
+func withTimeouts(timeouts sakuin.Timeouts) func(*sakuin.Config) {
+	return func(cfg *sakuin.Config) { cfg.Timeouts = timeouts }
+}
+
 func startTestServer(t *testing.T, opts ...func(*sakuin.Config)) (string, error) {
+	return startTestServerWithLimits(t, Limits{}, opts...)
+}
+
+func startTestServerWithLimits(t *testing.T, limits Limits, opts ...func(*sakuin.Config)) (string, error) {
+	return startTestServerWithOptions(t, []ServerOption{WithLimits(limits)}, opts...)
+}
+
+func startTestServerWithOptions(t *testing.T, serverOpts []ServerOption, opts ...func(*sakuin.Config)) (string, error) {
 	cfg := sakuin.Config{
 		ObjectStore:   sakuin.NewInMemoryObjectStore(),
 		DocumentStore: sakuin.NewInMemoryDocumentStore(),
@@ -39,9 +60,10 @@ func startTestServer(t *testing.T, opts ...func(*sakuin.Config)) (string, error)
 	}
 
 	s := sakuin.New(cfg)
-	app := NewServer(s, fiber.Config{
+	serverOpts = append([]ServerOption{WithFiberConfig(fiber.Config{
 		DisableStartupMessage: true,
-	})
+	})}, serverOpts...)
+	app := NewServer(s, serverOpts...)
 
 	ls, err := net.Listen("tcp", ":0")
 	if err != nil {
@@ -59,6 +81,16 @@ func startTestServer(t *testing.T, opts ...func(*sakuin.Config)) (string, error)
 	return ls.Addr().String(), nil
 }
 
+// getIfNoneMatch GETs the url with the If-None-Match header set to tag.
+func getIfNoneMatch(url string, tag string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("If-None-Match", tag)
+	return http.DefaultClient.Do(req)
+}
+
 func readAll(rc io.ReadCloser) ([]byte, error) {
 	defer rc.Close()
 
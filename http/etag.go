@@ -0,0 +1,73 @@
+package http
+
+import (
+	"strings"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// etag returns a strong entity tag for a response, derived from the
+// checksum the Service recorded if there is one, otherwise from the body.
+// Either way the tag holds a checksum the Service can verify content with.
+func etag(checksum string, body []byte) string {
+	if checksum == "" {
+		// SHA256 is always supported
+		checksum, _ = sakuin.SHA256.Checksum(body)
+	}
+	return `"` + checksum + `"`
+}
+
+// etagMatches reports whether any of the entity tags in an If-Match or
+// If-None-Match header match the tag. Weak tags only match when comparing
+// weakly, as RFC 7232 requires for If-None-Match but not If-Match.
+func etagMatches(header string, tag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchChecksums returns the checksums held by the strong entity tags
+// of an If-Match header. A wildcard matches any checksum, so none are
+// returned for it.
+func ifMatchChecksums(header string) []string {
+	var checksums []string
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return nil
+		}
+		// Weak tags are kept as is so they never verify
+		checksums = append(checksums, strings.Trim(candidate, `"`))
+	}
+	return checksums
+}
+
+// checkNotModified sets the ETag header and reports whether the client's
+// copy is current, in which case a 304 without a body has been sent.
+func checkNotModified(c *fiber.Ctx, tag string) bool {
+	c.Set(fiber.HeaderETag, tag)
+
+	header := c.Get(fiber.HeaderIfNoneMatch)
+	if header == "" || !etagMatches(header, tag, true) {
+		return false
+	}
+	c.Status(fiber.StatusNotModified)
+	return true
+}
+
+func sendPreconditionFailed(c *fiber.Ctx, msg string) error {
+	zap.L().Warn("precondition failed", zap.String("reason", msg))
+	return c.Status(fiber.StatusPreconditionFailed).JSON(APIError{
+		Message: msg,
+	})
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"context"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// ReadinessTimeout bounds how long the readiness probe waits on the stores.
+const ReadinessTimeout = 2 * time.Second
+
+// ServiceDependency names the Service itself in a ReadinessResponse,
+// e.g. when it's shutting down.
+const ServiceDependency = "service"
+
+// ReadinessResponse reports which dependencies, if any, failed a readiness check.
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// NewHealthHandler godoc
+// @Summary  Liveness probe, which succeeds as long as the server is running.
+// @Tags     Health
+// @Success  200  "Server is alive."
+// @Router   /healthz [get]
+func NewHealthHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	}
+}
+
+// NewReadyHandler godoc
+// @Summary  Readiness probe, which checks that both stores respond.
+// @Tags     Health
+// @Produce  json
+// @Success  200  {object}  ReadinessResponse
+// @Failure  503  {object}  ReadinessResponse
+// @Router   /readyz [get]
+func NewReadyHandler(s *sakuin.Service, timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+
+		err := s.Ready(ctx)
+		if err == nil {
+			return c.Status(fiber.StatusOK).JSON(ReadinessResponse{Status: "ready"})
+		}
+
+		zap.L().Warn("service is not ready", zap.Error(err))
+		resp := ReadinessResponse{
+			Status: "not ready",
+			Failed: make(map[string]string),
+		}
+		if rerr, ok := err.(sakuin.NotReadyErr); ok {
+			for name, ferr := range rerr.Failed {
+				resp.Failed[name] = ferr.Error()
+			}
+		} else {
+			resp.Failed[ServiceDependency] = err.Error()
+		}
+		return c.Status(fiber.StatusServiceUnavailable).JSON(resp)
+	}
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHealthHandler(t *testing.T) {
+	t.Run("should always succeed", func(subT *testing.T) {
+		mockObjStore := mocks.ObjectStore{}
+		mockObjStore.On("Stat", mock.Anything, mock.Anything).Return(nil, errors.New("oh no something went wrong"))
+
+		addr, err := startTestServer(subT, withObjectStore(&mockObjStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf("http://%s/healthz", addr))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusOK, resp.StatusCode)
+	})
+}
+
+func TestReadyHandler(t *testing.T) {
+	t.Run("should succeed if both stores respond", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf("http://%s/readyz", addr))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+		assert.False(subT, resp.Uncompressed)
+
+		var ready ReadinessResponse
+		if !decodeJSON(subT, resp.Body, &ready) {
+			return
+		}
+		assert.Equal(subT, ReadinessResponse{Status: "ready"}, ready)
+	})
+
+	t.Run("should list the stores which failed", func(subT *testing.T) {
+		mockObjStore := mocks.ObjectStore{}
+		mockObjStore.On("Stat", mock.Anything, mock.Anything).Return(nil, errors.New("oh no something went wrong"))
+
+		addr, err := startTestServer(
+			subT,
+			withObjectStore(&mockObjStore),
+			withDocumentStore(sakuin.NewInMemoryDocumentStore()),
+		)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf("http://%s/readyz", addr))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusServiceUnavailable, resp.StatusCode) {
+			return
+		}
+
+		var ready ReadinessResponse
+		if !decodeJSON(subT, resp.Body, &ready) {
+			return
+		}
+		assert.Equal(subT, ReadinessResponse{
+			Status: "not ready",
+			Failed: map[string]string{
+				sakuin.ObjectStoreDependency: "oh no something went wrong",
+			},
+		}, ready)
+	})
+}
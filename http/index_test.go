@@ -5,10 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/z5labs/sakuin"
 	"github.com/z5labs/sakuin/mocks"
 
 	"github.com/stretchr/testify/assert"
@@ -187,6 +192,183 @@ func TestIndexHandler(t *testing.T) {
 		assert.Equal(subT, ErrMissingObjectPart, apiErr)
 	})
 
+	t.Run("should use id from query parameter", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"`},
+			"Content-Type":        {"application/octet-stream"},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("test object content"))
+
+		w.Close()
+
+		req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr)+"?id=my-id", &b)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, 200, resp.StatusCode) {
+			return
+		}
+
+		var data map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &data) {
+			return
+		}
+
+		assert.Equal(subT, "my-id", data["id"])
+	})
+
+	t.Run("should use id from id part", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		if err = w.WriteField("id", "my-id"); err != nil {
+			subT.Error(err)
+			return
+		}
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"`},
+			"Content-Type":        {"application/octet-stream"},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("test object content"))
+
+		w.Close()
+
+		req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr), &b)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, 200, resp.StatusCode) {
+			return
+		}
+
+		var data map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &data) {
+			return
+		}
+
+		assert.Equal(subT, "my-id", data["id"])
+	})
+
+	t.Run("should fail with conflict if id is already taken", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject("my-id", []byte("original content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"`},
+			"Content-Type":        {"application/octet-stream"},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("test object content"))
+
+		w.Close()
+
+		req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr)+"?id=my-id", &b)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("should fail if object is too large", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore()
+		addr, err := startTestServer(subT, withObjectStore(objStore), withMaxObjectSize(7))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"`},
+			"Content-Type":        {"application/octet-stream"},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("content!"))
+
+		w.Close()
+
+		req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr), &b)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusRequestEntityTooLarge, resp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, 0, objStore.NumOfObects())
+	})
+
 	t.Run("should undo storage actions if one fails", func(subT *testing.T) {
 		mockDocStore := mocks.DocumentStore{}
 		mockDocStore.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("oh no something went wrong"))
@@ -248,4 +430,681 @@ func TestIndexHandler(t *testing.T) {
 			return
 		}
 	})
+	t.Run("should serve the object with the content type of its part", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		testObject := []byte("\x89PNG\r\n\x1a\n")
+
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"`},
+			"Content-Type":        {"image/png"},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write(testObject)
+
+		w.Close()
+
+		req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr), &b)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, 200, resp.StatusCode) {
+			return
+		}
+
+		var data map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &data) {
+			return
+		}
+
+		resp, err = http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, data["id"]))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, 200, resp.StatusCode) {
+			return
+		}
+
+		assert.Equal(subT, "image/png", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("should return the same id when retried with an idempotency key", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		index := func() (string, bool) {
+			var b bytes.Buffer
+			w := multipart.NewWriter(&b)
+			ow, err := w.CreatePart(map[string][]string{
+				"Content-Disposition": {`form-data; name="object"`},
+				"Content-Type":        {"application/octet-stream"},
+			})
+			if err != nil {
+				subT.Error(err)
+				return "", false
+			}
+			ow.Write([]byte("test object content"))
+
+			w.Close()
+
+			req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr), &b)
+			if err != nil {
+				subT.Error(err)
+				return "", false
+			}
+			req.Header.Set("Content-Type", w.FormDataContentType())
+			req.Header.Set("Idempotency-Key", "retry-me")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				subT.Error(err)
+				return "", false
+			}
+
+			if !assert.Equal(subT, 200, resp.StatusCode) {
+				return "", false
+			}
+
+			var data map[string]interface{}
+			if !decodeJSON(subT, resp.Body, &data) {
+				return "", false
+			}
+			id, _ := data["id"].(string)
+			return id, true
+		}
+
+		first, ok := index()
+		if !ok {
+			return
+		}
+		second, ok := index()
+		if !ok {
+			return
+		}
+		assert.Equal(subT, first, second)
+	})
+
+	t.Run("should stream a large object to the object store as it's uploaded", func(subT *testing.T) {
+		chunk := bytes.Repeat([]byte("a"), 1<<20)
+		chunks := 5
+
+		objStore := &countingObjectStore{
+			InMemoryObjectStore: sakuin.NewInMemoryObjectStore(),
+			started:             make(chan struct{}),
+		}
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		pr, pw := io.Pipe()
+		w := multipart.NewWriter(pw)
+		req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr), pr)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		type result struct {
+			resp *http.Response
+			err  error
+		}
+		results := make(chan result, 1)
+		go func() {
+			resp, err := http.DefaultClient.Do(req)
+			results <- result{resp: resp, err: err}
+		}()
+
+		err = w.WriteField("metadata", `{"name": "test"}`)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow, err := w.CreateFormFile("object", "large.bin")
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		_, err = ow.Write(chunk)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		// A buffering handler wouldn't call the store until the upload is done
+		select {
+		case <-objStore.started:
+		case <-time.After(5 * time.Second):
+			pw.CloseWithError(errors.New("timed out"))
+			subT.Error("expected the object store to read the object before the upload finished")
+			return
+		}
+
+		for i := 1; i < chunks; i++ {
+			_, err = ow.Write(chunk)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+		}
+		w.Close()
+		pw.Close()
+
+		res := <-results
+		if res.err != nil {
+			subT.Error(res.err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, res.resp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, int64(chunks*len(chunk)), atomic.LoadInt64(&objStore.read))
+	})
+
+	t.Run("should index the object if the metadata follows it", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"`},
+			"Content-Type":        {"application/octet-stream"},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("test object content"))
+		err = w.WriteField("metadata", `{"name": "test"}`)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		w.Close()
+
+		req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr)+"?id=test", &b)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		resp, err = http.Get(fmt.Sprintf(getMetadataEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		var metadata map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &metadata) {
+			return
+		}
+		assert.Equal(subT, "test", metadata["name"])
+	})
+
+	t.Run("should limit the object and metadata parts independently", func(subT *testing.T) {
+		indexBody := func(metadata string, object string) (*bytes.Buffer, string) {
+			var b bytes.Buffer
+			w := multipart.NewWriter(&b)
+			w.WriteField("metadata", metadata)
+			w.WriteField("object", object)
+			w.Close()
+			return &b, w.FormDataContentType()
+		}
+
+		testCases := []struct {
+			name     string
+			metadata string
+			object   string
+			status   int
+		}{
+			{name: "both at their limits", metadata: `{"a": "b"}`, object: "content", status: http.StatusOK},
+			{name: "object over its limit", metadata: `{"a": "b"}`, object: "content!", status: http.StatusRequestEntityTooLarge},
+			{name: "metadata over its limit", metadata: `{"a": "bc"}`, object: "content", status: http.StatusRequestEntityTooLarge},
+		}
+
+		for _, testCase := range testCases {
+			objStore := sakuin.NewInMemoryObjectStore()
+			addr, err := startTestServerWithLimits(subT, Limits{Object: 7, Metadata: 10}, withObjectStore(objStore))
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+
+			body, contentType := indexBody(testCase.metadata, testCase.object)
+			resp, err := http.Post(fmt.Sprintf(sakuinEndpointFmt, addr), contentType, body)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+			if !assert.Equal(subT, testCase.status, resp.StatusCode, testCase.name) {
+				continue
+			}
+			if testCase.status == http.StatusOK {
+				assert.Equal(subT, 1, objStore.NumOfObects(), testCase.name)
+				continue
+			}
+
+			var apiErr APIError
+			if !decodeJSON(subT, resp.Body, &apiErr) {
+				return
+			}
+			assert.Contains(subT, apiErr.Message, "exceeds limit", testCase.name)
+			assert.Equal(subT, 0, objStore.NumOfObects(), testCase.name)
+		}
+	})
+
+	t.Run("should record the object part's filename and content type", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"; filename="../reports/invoice.pdf"`},
+			"Content-Type":        {"application/pdf"},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("%PDF-1.4"))
+
+		w.Close()
+
+		req, err := http.NewRequest("POST", fmt.Sprintf(sakuinEndpointFmt, addr)+"?id=invoice", &b)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		resp, err = http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, "invoice") + "?download=true")
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, "application/pdf", resp.Header.Get("Content-Type"))
+		assert.Equal(subT, "attachment; filename=invoice.pdf", resp.Header.Get("Content-Disposition"))
+	})
+}
+
+func TestDeleteHandler(t *testing.T) {
+	t.Run("should fail if nothing exists", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(sakuinEndpointFmt+"/%s", addr, "test"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should describe what was deleted", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject("test", []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(sakuinEndpointFmt+"/%s", addr, "test"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		var data map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &data) {
+			return
+		}
+
+		assert.Equal(subT, map[string]interface{}{
+			"object_deleted": true,
+			"object_size":    float64(len("test object content")),
+		}, data)
+	})
+
+	t.Run("should fail with an APIError on unexpected store errors", func(subT *testing.T) {
+		mockObjStore := mocks.ObjectStore{}
+		mockObjStore.On("Stat", mock.Anything, mock.Anything).Return(nil, errors.New("oh no something went wrong"))
+
+		addr, err := startTestServer(subT, withObjectStore(&mockObjStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(sakuinEndpointFmt+"/%s", addr, "test"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusInternalServerError, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.Equal(subT, "oh no something went wrong", apiErr.Message)
+	})
+}
+
+func TestListHandler(t *testing.T) {
+	t.Run("should iterate over every page", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore()
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			objStore.WithObject(id, []byte("content"))
+		}
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		var ids []string
+		pages := 0
+		endpoint := fmt.Sprintf(sakuinEndpointFmt+"?limit=2", addr)
+		for endpoint != "" {
+			resp, err := http.Get(endpoint)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+			if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+				return
+			}
+
+			var page ListResponse
+			if !decodeJSON(subT, resp.Body, &page) {
+				return
+			}
+			ids = append(ids, page.IDs...)
+			pages++
+
+			endpoint = ""
+			if page.NextCursor != "" {
+				link := resp.Header.Get("Link")
+				if !assert.Contains(subT, link, `rel="next"`) {
+					return
+				}
+				endpoint = strings.TrimPrefix(strings.Split(link, ">")[0], "<")
+			}
+		}
+
+		assert.Equal(subT, []string{"a", "b", "c", "d", "e"}, ids)
+		assert.Equal(subT, 3, pages)
+	})
+
+	t.Run("should return an empty page if nothing is indexed", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(sakuinEndpointFmt, addr))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+		assert.Empty(subT, resp.Header.Get("Link"))
+
+		var data map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &data) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"ids": []interface{}{}, "next_cursor": ""}, data)
+	})
+
+	t.Run("should fail with bad request for invalid limits", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		for _, limit := range []string{"abc", "0", "1001"} {
+			resp, err := http.Get(fmt.Sprintf(sakuinEndpointFmt+"?limit=%s", addr, limit))
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+			assert.Equal(subT, http.StatusBadRequest, resp.StatusCode, limit)
+
+			var apiErr APIError
+			if !decodeJSON(subT, resp.Body, &apiErr) {
+				return
+			}
+			assert.NotEmpty(subT, apiErr.Message)
+		}
+	})
+
+	t.Run("should fail with not implemented if the store can't list", func(subT *testing.T) {
+		addr, err := startTestServer(subT, withObjectStore(&mocks.ObjectStore{}))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(sakuinEndpointFmt, addr))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusNotImplemented, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.NotEmpty(subT, apiErr.Message)
+	})
+}
+
+func TestSearchHandler(t *testing.T) {
+	search := func(t *testing.T, addr string, body string) *http.Response {
+		resp, err := http.Post(fmt.Sprintf(sakuinEndpointFmt+"/search", addr), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		return resp
+	}
+
+	docStore := sakuin.NewInMemoryDocumentStore().
+		WithDocument("a", map[string]interface{}{"name": "a", "owner": map[string]interface{}{"team": "x"}}).
+		WithDocument("b", map[string]interface{}{"name": "b", "owner": map[string]interface{}{"team": "y"}}).
+		WithDocument("c", map[string]interface{}{"name": "c", "owner": map[string]interface{}{"team": "x"}}).
+		WithDocument("d", map[string]interface{}{"name": "d", "owner": map[string]interface{}{"team": "x"}})
+
+	t.Run("should match nested fields across pages", func(subT *testing.T) {
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		var ids []string
+		cursor := ""
+		for pages := 0; pages < 2; pages++ {
+			resp := search(subT, addr, fmt.Sprintf(`{"equals": {"owner.team": "x"}, "limit": 2, "cursor": %q}`, cursor))
+			if resp == nil || !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+				return
+			}
+
+			var page SearchResponse
+			if !decodeJSON(subT, resp.Body, &page) {
+				return
+			}
+			for _, result := range page.Results {
+				ids = append(ids, result.ID)
+				assert.Equal(subT, map[string]interface{}{"team": "x"}, result.Metadata["owner"])
+			}
+			cursor = page.NextCursor
+		}
+
+		assert.Equal(subT, []string{"a", "c", "d"}, ids)
+		assert.Empty(subT, cursor)
+	})
+
+	t.Run("should return an empty list if nothing matches", func(subT *testing.T) {
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp := search(subT, addr, `{"equals": {"owner.team": "z"}}`)
+		if resp == nil || !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		var data map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &data) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"results": []interface{}{}, "next_cursor": ""}, data)
+	})
+
+	t.Run("should fail with bad request for malformed queries", func(subT *testing.T) {
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		bodies := []string{
+			`not json`,
+			`{"equals": ["owner.team"]}`,
+			`{"where": {"owner.team": "x"}}`,
+			`{"limit": 1001}`,
+			`{"equals": {"": "x"}}`,
+			`{"equals": {"_sakuin.checksum": "x"}}`,
+		}
+		for _, body := range bodies {
+			resp := search(subT, addr, body)
+			if resp == nil {
+				return
+			}
+			assert.Equal(subT, http.StatusBadRequest, resp.StatusCode, body)
+
+			var apiErr APIError
+			if !decodeJSON(subT, resp.Body, &apiErr) {
+				return
+			}
+			assert.NotEmpty(subT, apiErr.Message)
+		}
+	})
+
+	t.Run("should fail with not implemented if the store can't query", func(subT *testing.T) {
+		addr, err := startTestServer(subT, withDocumentStore(&mocks.DocumentStore{}))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp := search(subT, addr, `{"equals": {"name": "a"}}`)
+		if resp == nil {
+			return
+		}
+		assert.Equal(subT, http.StatusNotImplemented, resp.StatusCode)
+	})
 }
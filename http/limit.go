@@ -0,0 +1,97 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// DefaultMetadataLimit is the cap on metadata bodies when Limits.Metadata isn't positive.
+const DefaultMetadataLimit = 4 * 1024 * 1024
+
+// Limits caps the size in bytes of request bodies. Objects are streamed
+// to the Service so they're uncapped unless Object is positive, but other
+// bodies are read into memory so they're always capped by Metadata, or
+// DefaultMetadataLimit if it isn't positive.
+type Limits struct {
+	// Object caps object uploads and the object part of index requests.
+	Object int64
+
+	// Metadata caps metadata and search bodies, along with the
+	// other parts of index requests.
+	Metadata int64
+}
+
+func (l Limits) metadata() int64 {
+	if l.Metadata <= 0 {
+		return DefaultMetadataLimit
+	}
+	return l.Metadata
+}
+
+// PartLimits caps the parts of multipart index requests.
+func (l Limits) PartLimits() sakuin.PartLimits {
+	return sakuin.PartLimits{Metadata: l.metadata(), Object: l.Object}
+}
+
+// BodyTooLargeErr represents a request body which exceeds its limit.
+type BodyTooLargeErr struct {
+	Limit int64
+}
+
+func (e BodyTooLargeErr) Error() string {
+	return fmt.Sprintf("request body exceeds limit of %d bytes", e.Limit)
+}
+
+// limitBody returns a reader for the request body which fails with a
+// BodyTooLargeErr once more than limit bytes have been read. Bodies which
+// declare a larger Content-Length fail without being read at all.
+func limitBody(c *fiber.Ctx, limit int64) io.Reader {
+	if limit <= 0 {
+		return requestBody(c)
+	}
+	if int64(c.Request().Header.ContentLength()) > limit {
+		return errReader{err: BodyTooLargeErr{Limit: limit}}
+	}
+	return &bodyLimitedReader{r: requestBody(c), limit: limit}
+}
+
+// readBody reads the request body into memory, up to limit bytes.
+func readBody(c *fiber.Ctx, limit int64) ([]byte, error) {
+	return ioutil.ReadAll(limitBody(c, limit))
+}
+
+type bodyLimitedReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (r *bodyLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.limit {
+		return n, BodyTooLargeErr{Limit: r.limit}
+	}
+	return n, err
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func sendTooLarge(c *fiber.Ctx, err error) error {
+	zap.L().Warn("request body is too large", zap.Error(err))
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(APIError{
+		Message: err.Error(),
+	})
+}
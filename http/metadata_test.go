@@ -2,13 +2,18 @@ package http
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/mocks"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 const getMetadataEndpointFmt = "http://%s/index/%s/metadata"
@@ -79,6 +84,128 @@ func TestGetMetadataHandler(t *testing.T) {
 			}
 		}
 	})
+
+	t.Run("should send the reserved metadata as headers", func(subT *testing.T) {
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{
+				"name": "test",
+				sakuin.ReservedMetadataKey: map[string]interface{}{
+					"checksum":    "sha256:abc",
+					"contentType": "text/plain",
+				},
+			})
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(getMetadataEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, "sha256:abc", resp.Header.Get(ChecksumHeader))
+		assert.Equal(subT, "text/plain", resp.Header.Get(ObjectContentTypeHeader))
+
+		var doc map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &doc) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+	})
+
+	t.Run("should honor If-None-Match", func(subT *testing.T) {
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"name": "test"})
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(getMetadataEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		testETag := resp.Header.Get("ETag")
+		if !assert.NotEmpty(subT, testETag) {
+			return
+		}
+
+		testCases := []struct {
+			Name        string
+			IfNoneMatch string
+			Status      int
+		}{
+			{Name: "match", IfNoneMatch: testETag, Status: http.StatusNotModified},
+			{Name: "mismatch", IfNoneMatch: `"stale"`, Status: http.StatusOK},
+			{Name: "wildcard", IfNoneMatch: "*", Status: http.StatusNotModified},
+		}
+
+		for _, testCase := range testCases {
+			resp, err := getIfNoneMatch(fmt.Sprintf(getMetadataEndpointFmt, addr, "test"), testCase.IfNoneMatch)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+
+			assert.Equal(subT, testCase.Status, resp.StatusCode, testCase.Name)
+			assert.Equal(subT, testETag, resp.Header.Get("ETag"), testCase.Name)
+		}
+
+		err = docStore.Upsert(context.Background(), "test", map[string]interface{}{"name": "updated"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		resp, err = getIfNoneMatch(fmt.Sprintf(getMetadataEndpointFmt, addr, "test"), testETag)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Equal(subT, http.StatusOK, resp.StatusCode)
+		assert.NotEqual(subT, testETag, resp.Header.Get("ETag"))
+	})
+
+	t.Run("should fail with gateway timeout if the store is too slow", func(subT *testing.T) {
+		docStore := blockingDocumentStore{
+			DocumentStore: sakuin.NewInMemoryDocumentStore().
+				WithDocument("test", map[string]interface{}{"name": "test"}),
+		}
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore), withTimeouts(sakuin.Timeouts{
+			Document: 10 * time.Millisecond,
+		}))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(getMetadataEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusGatewayTimeout, resp.StatusCode)
+	})
+}
+
+// blockingDocumentStore blocks every Get until the context is done.
+type blockingDocumentStore struct {
+	sakuin.DocumentStore
+}
+
+func (s blockingDocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
 }
 
 func TestUpdateMetadataHandler(t *testing.T) {
@@ -158,4 +285,567 @@ func TestUpdateMetadataHandler(t *testing.T) {
 
 		assert.Equal(subT, http.StatusOK, resp.StatusCode)
 	})
+
+	t.Run("should fail if metadata is invalid", func(subT *testing.T) {
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"name": "test"})
+
+		validator, err := sakuin.NewJSONSchemaValidator([]byte(`{"properties": {"name": {"type": "string"}}}`))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore), withMetadataValidator(validator))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, "test")
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte(`{"name": 1}`)))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusUnprocessableEntity, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.NotEmpty(subT, apiErr.Message)
+	})
+
+	t.Run("should fail with unprocessable entity if the reserved metadata is set", func(subT *testing.T) {
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{
+				"name":                     "test",
+				sakuin.ReservedMetadataKey: map[string]interface{}{"checksum": "sha256:abc"},
+			})
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, "test")
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte(`{"_sakuin": 1}`)))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusUnprocessableEntity, resp.StatusCode) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"checksum": "sha256:abc"}, doc[sakuin.ReservedMetadataKey])
+	})
+
+	t.Run("should accept metadata exactly at the limit", func(subT *testing.T) {
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"hello": "world"})
+
+		body := []byte(`{"good": "bye"}`)
+		addr, err := startTestServerWithLimits(subT, Limits{Metadata: int64(len(body))}, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(getMetadataEndpointFmt, addr, "test"), bytes.NewReader(body))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should fail with request entity too large if the metadata is over the limit", func(subT *testing.T) {
+		testMetadata := map[string]interface{}{"hello": "world"}
+
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", testMetadata)
+
+		body := []byte(`{"good": "bye"}`)
+		addr, err := startTestServerWithLimits(subT, Limits{Metadata: int64(len(body)) - 1}, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(getMetadataEndpointFmt, addr, "test"), bytes.NewReader(body))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusRequestEntityTooLarge, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.Contains(subT, apiErr.Message, fmt.Sprintf("%d bytes", len(body)-1))
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, testMetadata, doc)
+	})
+
+	t.Run("should update the metadata if If-Match matches", func(subT *testing.T) {
+		testDocID := "test"
+
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument(testDocID, map[string]interface{}{"hello": "world"})
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, testDocID)
+		resp, err := http.Get(uri)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		tag := resp.Header.Get("ETag")
+
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte(`{"good": "bye"}`)))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", tag)
+
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), testDocID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"hello": "world", "good": "bye"}, doc)
+	})
+
+	t.Run("should fail with precondition failed if If-Match is stale", func(subT *testing.T) {
+		testDocID := "test"
+		testMetadata := map[string]interface{}{"hello": "world"}
+
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument(testDocID, testMetadata)
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, testDocID)
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte(`{"good": "bye"}`)))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"sha256:stale"`)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusPreconditionFailed, resp.StatusCode) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), testDocID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, testMetadata, doc)
+	})
+
+	t.Run("should fail with not found before checking If-Match", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, "metadataDoesNotExistID")
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("{}")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"sha256:stale"`)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestPatchMetadataHandler(t *testing.T) {
+	t.Run("should fail if req content type isn't merge patch", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, "test")
+		req, err := http.NewRequest(http.MethodPatch, uri, bytes.NewReader([]byte("{}")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+
+	t.Run("should fail if metadata doesn't exist", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, "metadataDoesNotExistID")
+		req, err := http.NewRequest(http.MethodPatch, uri, bytes.NewReader([]byte("{}")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should fail if patch is malformed", func(subT *testing.T) {
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"hello": "world"})
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, "test")
+		req, err := http.NewRequest(http.MethodPatch, uri, bytes.NewReader([]byte("{")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("should remove fields set to null", func(subT *testing.T) {
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"hello": "world", "good": "bye"})
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, "test")
+		req, err := http.NewRequest(http.MethodPatch, uri, bytes.NewReader([]byte(`{"hello": null}`)))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"good": "bye"}, doc)
+	})
+	t.Run("should apply a json patch", func(subT *testing.T) {
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"hello": "world", "good": "bye"})
+
+		addr, err := startTestServer(subT, withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		patch := `[
+			{"op": "test", "path": "/hello", "value": "world"},
+			{"op": "replace", "path": "/hello", "value": "there"},
+			{"op": "remove", "path": "/good"}
+		]`
+
+		uri := fmt.Sprintf(getMetadataEndpointFmt, addr, "test")
+		req, err := http.NewRequest(http.MethodPatch, uri, bytes.NewReader([]byte(patch)))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json-patch+json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"hello": "there"}, doc)
+	})
+
+	t.Run("should fail json patch with the right status", func(subT *testing.T) {
+		testCases := map[string]struct {
+			ID     string
+			Patch  string
+			Status int
+		}{
+			"malformed": {
+				ID:     "test",
+				Patch:  `{"op": "add"}`,
+				Status: http.StatusBadRequest,
+			},
+			"missing path": {
+				ID:     "test",
+				Patch:  `[{"op": "remove", "path": "/missing"}]`,
+				Status: http.StatusUnprocessableEntity,
+			},
+			"failed test": {
+				ID:     "test",
+				Patch:  `[{"op": "test", "path": "/hello", "value": "other"}]`,
+				Status: http.StatusUnprocessableEntity,
+			},
+			"missing metadata": {
+				ID:     "metadataDoesNotExistID",
+				Patch:  `[]`,
+				Status: http.StatusNotFound,
+			},
+		}
+
+		for name, testCase := range testCases {
+			docStore := sakuin.NewInMemoryDocumentStore().
+				WithDocument("test", map[string]interface{}{"hello": "world"})
+
+			addr, err := startTestServer(subT, withDocumentStore(docStore))
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+
+			uri := fmt.Sprintf(getMetadataEndpointFmt, addr, testCase.ID)
+			req, err := http.NewRequest(http.MethodPatch, uri, bytes.NewReader([]byte(testCase.Patch)))
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json-patch+json")
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+			if !assert.Equal(subT, testCase.Status, resp.StatusCode, name) {
+				continue
+			}
+
+			doc, err := docStore.Get(context.Background(), "test")
+			if !assert.Nil(subT, err, name) {
+				continue
+			}
+			assert.Equal(subT, map[string]interface{}{"hello": "world"}, doc, name)
+		}
+	})
+}
+
+func TestDeleteMetadataHandler(t *testing.T) {
+	t.Run("should keep the object", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"ssn": "123-45-6789"})
+
+		addr, err := startTestServer(subT, withObjectStore(objStore), withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(getMetadataEndpointFmt, addr, "test"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		resp, err = http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Equal(subT, http.StatusOK, resp.StatusCode)
+
+		resp, err = http.Get(fmt.Sprintf(getMetadataEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should fail if metadata doesn't exist", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(getMetadataEndpointFmt, addr, "metadataDoesNotExistID"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should fail with an APIError on unexpected store errors", func(subT *testing.T) {
+		mockDocStore := mocks.DocumentStore{}
+		mockDocStore.On("Delete", mock.Anything, mock.Anything).Return(errors.New("oh no something went wrong"))
+
+		addr, err := startTestServer(subT, withDocumentStore(&mockDocStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(getMetadataEndpointFmt, addr, "test"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusInternalServerError, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.Equal(subT, "oh no something went wrong", apiErr.Message)
+	})
 }
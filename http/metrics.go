@@ -0,0 +1,41 @@
+package http
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// MetricsRegistry registers the HTTP metrics and gathers them
+// for the /metrics route, e.g. a *prometheus.Registry.
+type MetricsRegistry interface {
+	prometheus.Registerer
+	prometheus.Gatherer
+}
+
+// WithMetricsRegistry records the HTTP metrics in reg, instead of a registry
+// of their own, so they can be served alongside an embedder's metrics.
+func WithMetricsRegistry(reg MetricsRegistry) ServerOption {
+	return func(o *serverOptions) { o.metrics = reg }
+}
+
+// WithoutMetrics disables recording the HTTP metrics and the /metrics route.
+func WithoutMetrics() ServerOption {
+	return func(o *serverOptions) { o.disableMetrics = true }
+}
+
+// NewMetricsHandler godoc
+// @Summary  Metrics in the Prometheus exposition format.
+// @Tags     Health
+// @Produce  plain
+// @Success  200  "Successfully gathered metrics."
+// @Router   /metrics [get]
+func NewMetricsHandler(g prometheus.Gatherer) fiber.Handler {
+	h := fasthttpadaptor.NewFastHTTPHandler(promhttp.HandlerFor(g, promhttp.HandlerOpts{}))
+
+	return func(c *fiber.Ctx) error {
+		h(c.Context())
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrapeMetrics(t *testing.T, addr string) (string, bool) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/metrics", addr))
+	if err != nil {
+		t.Error(err)
+		return "", false
+	}
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode) {
+		return "", false
+	}
+
+	b, err := readAll(resp.Body)
+	if err != nil {
+		t.Error(err)
+		return "", false
+	}
+	return string(b), true
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("should label requests by route template", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		for _, uri := range []string{
+			fmt.Sprintf(getObjectEndpointFmt, addr, "first"),
+			fmt.Sprintf(getObjectEndpointFmt, addr, "second"),
+			fmt.Sprintf(getMetadataEndpointFmt, addr, "first"),
+			fmt.Sprintf("http://%s/does/not/exist", addr),
+		} {
+			resp, err := http.Get(uri)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+			readAll(resp.Body)
+		}
+
+		metrics, ok := scrapeMetrics(subT, addr)
+		if !ok {
+			return
+		}
+		assert.Contains(subT, metrics, `sakuin_http_requests_total{method="GET",route="/index/:id/object",status="4xx"} 2`)
+		assert.Contains(subT, metrics, `sakuin_http_requests_total{method="GET",route="/index/:id/metadata",status="4xx"} 1`)
+		assert.Contains(subT, metrics, `sakuin_http_requests_total{method="GET",route="unmatched",status="2xx"} 1`)
+		assert.Contains(subT, metrics, `sakuin_http_request_duration_seconds_count{method="GET",route="/index/:id/object",status="4xx"} 2`)
+		assert.Contains(subT, metrics, `sakuin_http_response_size_bytes_count{method="GET",route="/index/:id/object"} 2`)
+		assert.Contains(subT, metrics, `sakuin_http_requests_in_flight 0`)
+		assert.NotContains(subT, metrics, "first")
+		assert.NotContains(subT, metrics, "/metrics")
+	})
+
+	t.Run("should record in the given registry", func(subT *testing.T) {
+		reg := prometheus.NewRegistry()
+
+		addr, err := startTestServerWithOptions(subT, []ServerOption{WithMetricsRegistry(reg)})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		readAll(resp.Body)
+
+		families, err := reg.Gather()
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var names []string
+		for _, family := range families {
+			names = append(names, family.GetName())
+		}
+		assert.Contains(subT, names, "sakuin_http_requests_total")
+	})
+
+	t.Run("should not serve metrics when disabled", func(subT *testing.T) {
+		addr, err := startTestServerWithOptions(subT, []ServerOption{WithoutMetrics()})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf("http://%s/metrics", addr))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		b, err := readAll(resp.Body)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.False(subT, strings.Contains(string(b), "sakuin_http"))
+	})
+}
@@ -0,0 +1,111 @@
+// Package metrics
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UnmatchedRoute labels requests which didn't match any route, so
+// arbitrary paths can't blow up the number of series.
+const UnmatchedRoute = "unmatched"
+
+var sizeBuckets = prometheus.ExponentialBuckets(256, 4, 8)
+
+// New returns a middleware which records the requests handled by the routes
+// registered after it, labeled by route template rather than raw path.
+// Requests to the root path are labeled as UnmatchedRoute.
+// The metrics are registered with reg, which panics if they already are.
+func New(reg prometheus.Registerer) fiber.Handler {
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sakuin",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests handled.",
+	}, []string{"method", "route", "status"})
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sakuin",
+		Subsystem: "http",
+		Name:      "requests_in_flight",
+		Help:      "Number of HTTP requests currently being handled.",
+	})
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "sakuin",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	requestSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "sakuin",
+		Subsystem: "http",
+		Name:      "request_size_bytes",
+		Help:      "Size of HTTP request bodies, when declared by the Content-Length.",
+		Buckets:   sizeBuckets,
+	}, []string{"method", "route"})
+	responseSize := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "sakuin",
+		Subsystem: "http",
+		Name:      "response_size_bytes",
+		Help:      "Size of HTTP response bodies.",
+		Buckets:   sizeBuckets,
+	}, []string{"method", "route"})
+	reg.MustRegister(requests, inFlight, duration, requestSize, responseSize)
+
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		err := c.Next()
+
+		// Requests which only matched middleware, which is all mounted at
+		// the root, are left on the root route, which isn't otherwise used
+		route := UnmatchedRoute
+		if r := c.Route(); r.Path != "/" {
+			route = r.Path
+		}
+		method := c.Method()
+		status := statusClass(statusCode(c, err))
+
+		requests.WithLabelValues(method, route, status).Inc()
+		duration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+		if n := c.Request().Header.ContentLength(); n >= 0 {
+			requestSize.WithLabelValues(method, route).Observe(float64(n))
+		}
+		if n := responseLength(c); n >= 0 {
+			responseSize.WithLabelValues(method, route).Observe(float64(n))
+		}
+		return err
+	}
+}
+
+// statusCode is the status which will be sent, taking into account
+// errors which are yet to be handled by the fiber.ErrorHandler.
+func statusCode(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	if ferr, ok := err.(*fiber.Error); ok {
+		return ferr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+func statusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// responseLength avoids reading streamed responses, which would buffer
+// them, and relies on their Content-Length instead, if known.
+func responseLength(c *fiber.Ctx) int {
+	resp := c.Response()
+	if resp.IsBodyStream() {
+		return resp.Header.ContentLength()
+	}
+	return len(resp.Body())
+}
@@ -2,13 +2,24 @@ package http
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/mocks"
+	"github.com/z5labs/sakuin/objectstore/quota"
+	"github.com/z5labs/sakuin/storage/readonly"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 const getObjectEndpointFmt = "http://%s/index/%s/object"
@@ -61,18 +72,633 @@ func TestGetObjectHandler(t *testing.T) {
 
 		assert.Equal(subT, testObject, obj)
 	})
+
+	t.Run("should return the recorded checksum", func(subT *testing.T) {
+		testObjectID := "test"
+		testObject := []byte("test object content")
+		testChecksum, err := sakuin.SHA256.Checksum(testObject)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, testObject)
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument(testObjectID, map[string]interface{}{
+				sakuin.ReservedMetadataKey: map[string]interface{}{
+					"checksum": testChecksum,
+				},
+			})
+
+		addr, err := startTestServer(subT, withObjectStore(objStore), withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		assert.Equal(subT, testChecksum, resp.Header.Get(ChecksumHeader))
+	})
+
+	t.Run("should honor If-None-Match with the checksum as the ETag", func(subT *testing.T) {
+		testObjectID := "test"
+		testObject := []byte("test object content")
+		testChecksum, err := sakuin.SHA256.Checksum(testObject)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		testETag := `"` + testChecksum + `"`
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, testObject)
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument(testObjectID, map[string]interface{}{
+				sakuin.ReservedMetadataKey: map[string]interface{}{
+					"checksum": testChecksum,
+				},
+			})
+
+		addr, err := startTestServer(subT, withObjectStore(objStore), withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		testCases := []struct {
+			Name        string
+			IfNoneMatch string
+			Status      int
+			Body        []byte
+		}{
+			{Name: "match", IfNoneMatch: testETag, Status: http.StatusNotModified, Body: []byte{}},
+			{Name: "weak match", IfNoneMatch: `"stale", W/` + testETag, Status: http.StatusNotModified, Body: []byte{}},
+			{Name: "mismatch", IfNoneMatch: `"stale"`, Status: http.StatusOK, Body: testObject},
+			{Name: "wildcard", IfNoneMatch: "*", Status: http.StatusNotModified, Body: []byte{}},
+		}
+
+		for _, testCase := range testCases {
+			resp, err := getIfNoneMatch(fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID), testCase.IfNoneMatch)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+
+			assert.Equal(subT, testCase.Status, resp.StatusCode, testCase.Name)
+			assert.Equal(subT, testETag, resp.Header.Get("ETag"), testCase.Name)
+
+			body, err := readAll(resp.Body)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+			assert.Equal(subT, testCase.Body, body, testCase.Name)
+		}
+	})
+
+	t.Run("should hash the object for the ETag if there's no checksum", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject("a", []byte("a")).
+			WithObject("b", []byte("b"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, "a"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		tag := resp.Header.Get("ETag")
+		if !assert.NotEmpty(subT, tag) {
+			return
+		}
+
+		resp, err = getIfNoneMatch(fmt.Sprintf(getObjectEndpointFmt, addr, "a"), tag)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Equal(subT, http.StatusNotModified, resp.StatusCode)
+
+		resp, err = getIfNoneMatch(fmt.Sprintf(getObjectEndpointFmt, addr, "b"), tag)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Equal(subT, http.StatusOK, resp.StatusCode)
+		assert.NotEqual(subT, tag, resp.Header.Get("ETag"))
+	})
+
+	t.Run("should default the content type to octet-stream", func(subT *testing.T) {
+		testObjectID := "test"
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		assert.Equal(subT, "application/octet-stream", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("should serve the stored content type inline", func(subT *testing.T) {
+		testObjectID := "test"
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("%PDF-1.4")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/pdf")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		resp, err = http.Get(uri)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		assert.Equal(subT, "application/pdf", resp.Header.Get("Content-Type"))
+		assert.Empty(subT, resp.Header.Get("Content-Disposition"))
+	})
+
+	t.Run("should serve the object as an attachment when downloading", func(subT *testing.T) {
+		testObjectID := "test"
+		testFilename := `my "report" – final.pdf`
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID) +
+			"?download=true&filename=" + url.QueryEscape(testFilename)
+		resp, err := http.Get(uri)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		disposition, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "attachment", disposition)
+		assert.Equal(subT, testFilename, params["filename"])
+	})
+
+	t.Run("should default the download filename to the id", func(subT *testing.T) {
+		testObjectID := "test"
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID) + "?download=true")
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		assert.Equal(subT, `attachment; filename=test`, resp.Header.Get("Content-Disposition"))
+	})
+}
+
+// countingObjectStore counts the bytes read by PutStream as they arrive,
+// closing started once the first of them have been read.
+type countingObjectStore struct {
+	*sakuin.InMemoryObjectStore
+	started chan struct{}
+	read    int64
+}
+
+func (s *countingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.InMemoryObjectStore.PutStream(ctx, id, &countingReader{r: r, s: s}, size)
+}
+
+type countingReader struct {
+	r io.Reader
+	s *countingObjectStore
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if atomic.AddInt64(&r.s.read, int64(n)) == int64(n) && n > 0 {
+		close(r.s.started)
+	}
+	return n, err
 }
 
-func TestUpdateObjectHandler(t *testing.T) {
-	t.Run("should fail if object doesn't exist", func(subT *testing.T) {
-		addr, err := startTestServer(subT)
+const statObjectEndpointFmt = "http://%s/index/%s/stat"
+
+func TestStatObjectHandler(t *testing.T) {
+	t.Run("should report the object on HEAD without a body", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject("test", []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Head(fmt.Sprintf(getObjectEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, int64(len("test object content")), resp.ContentLength)
+		assert.Equal(subT, "true", resp.Header.Get(ExistsHeader))
+		assert.Equal(subT, fmt.Sprint(len("test object content")), resp.Header.Get(SizeHeader))
+		assert.NotEmpty(subT, resp.Header.Get("Last-Modified"))
+
+		body, err := readAll(resp.Body)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Empty(subT, body)
+	})
+
+	t.Run("should describe the object on GET", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject("test", []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(statObjectEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, "true", resp.Header.Get(ExistsHeader))
+
+		var stat ObjectStat
+		if !decodeJSON(subT, resp.Body, &stat) {
+			return
+		}
+		assert.Equal(subT, len("test object content"), stat.Size)
+		assert.NotNil(subT, stat.LastModified)
+	})
+
+	t.Run("should fail if object doesn't exist", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		for _, do := range []func(string) (*http.Response, error){http.Head, http.Get} {
+			resp, err := do(fmt.Sprintf(statObjectEndpointFmt, addr, "objectDoesNotExistID"))
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+
+			assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+			assert.Equal(subT, "false", resp.Header.Get(ExistsHeader))
+		}
+	})
+
+	t.Run("should fail with an APIError on unexpected store errors", func(subT *testing.T) {
+		mockObjStore := mocks.ObjectStore{}
+		mockObjStore.On("Stat", mock.Anything, mock.Anything).Return(nil, errors.New("oh no something went wrong"))
+
+		addr, err := startTestServer(subT, withObjectStore(&mockObjStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf(statObjectEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusInternalServerError, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.Equal(subT, "oh no something went wrong", apiErr.Message)
+	})
+}
+
+func TestUpdateObjectHandler(t *testing.T) {
+	t.Run("should fail if object doesn't exist", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, "objectDoesNotExistID")
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("content")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should succeed if object does exist", func(subT *testing.T) {
+		testObjectID := "test"
+		testObject := []byte("test object content")
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, testObject)
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("content")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should fail with bad request if content is empty", func(subT *testing.T) {
+		testObjectID := "test"
+		testObject := []byte("test object content")
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, testObject)
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader(nil))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusBadRequest, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.Contains(subT, apiErr.Message, "allow_empty")
+	})
+
+	t.Run("should fail if object is too large", func(subT *testing.T) {
+		testObjectID := "test"
+		testObject := []byte("test object content")
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, testObject)
+
+		addr, err := startTestServer(subT, withObjectStore(objStore), withMaxObjectSize(7))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("content!")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusRequestEntityTooLarge, resp.StatusCode) {
+			return
+		}
+
+		obj, err := objStore.Get(context.Background(), testObjectID)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Equal(subT, testObject, obj)
+	})
+	t.Run("should record the content type", func(subT *testing.T) {
+		testObjectID := "test"
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("<p>content</p>")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("Content-Type", "text/html")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		resp, err = http.Get(uri)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		assert.Equal(subT, "text/html", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("should fail with service unavailable if the stores are read-only", func(subT *testing.T) {
+		testObjectID := "test"
+		testObject := []byte("test object content")
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, testObject)
+
+		addr, err := startTestServer(subT, withObjectStore(readonly.NewObjectStore(objStore, readonly.NewSwitch(true))))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("content")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		if !assert.Equal(subT, http.StatusServiceUnavailable, resp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, "60", resp.Header.Get("Retry-After"))
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.Equal(subT, ReadOnlyRetryAfter, apiErr.RetryAfter)
+
+		obj, err := objStore.Get(context.Background(), testObjectID)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Equal(subT, testObject, obj)
+	})
+
+	t.Run("should fail with insufficient storage if the quota is exceeded", func(subT *testing.T) {
+		testObjectID := "test"
+		testObject := []byte("test object content")
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, testObject)
+		quotaStore := quota.New(objStore, quota.Limits{MaxBytes: int64(len(testObject))})
+		err := quotaStore.Rebuild(context.Background())
 		if err != nil {
 			subT.Error(err)
 			return
 		}
 
-		uri := fmt.Sprintf(getObjectEndpointFmt, addr, "objectDoesNotExistID")
-		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("content")))
+		addr, err := startTestServer(subT, withObjectStore(quotaStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("test object content!")))
 		if err != nil {
 			subT.Error(err)
 			return
@@ -84,10 +710,189 @@ func TestUpdateObjectHandler(t *testing.T) {
 			return
 		}
 
-		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(subT, http.StatusInsufficientStorage, resp.StatusCode)
 	})
 
-	t.Run("should succeed if object does exist", func(subT *testing.T) {
+	t.Run("should stream the body to the object store as it's uploaded", func(subT *testing.T) {
+		testObjectID := "test"
+		chunk := bytes.Repeat([]byte("a"), 1<<20)
+		chunks := 5
+
+		objStore := &countingObjectStore{
+			InMemoryObjectStore: sakuin.NewInMemoryObjectStore().
+				WithObject(testObjectID, []byte("test object content")),
+			started: make(chan struct{}),
+		}
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		pr, pw := io.Pipe()
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID), pr)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		type result struct {
+			resp *http.Response
+			err  error
+		}
+		results := make(chan result, 1)
+		go func() {
+			resp, err := http.DefaultClient.Do(req)
+			results <- result{resp: resp, err: err}
+		}()
+
+		_, err = pw.Write(chunk)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		// A buffering handler wouldn't call the store until the upload is done
+		select {
+		case <-objStore.started:
+		case <-time.After(5 * time.Second):
+			pw.CloseWithError(errors.New("timed out"))
+			subT.Error("expected the object store to read the body before the upload finished")
+			return
+		}
+
+		for i := 1; i < chunks; i++ {
+			_, err = pw.Write(chunk)
+			if err != nil {
+				subT.Error(err)
+				return
+			}
+		}
+		pw.Close()
+
+		res := <-results
+		if res.err != nil {
+			subT.Error(res.err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, res.resp.StatusCode) {
+			return
+		}
+		assert.Equal(subT, int64(chunks*len(chunk)), atomic.LoadInt64(&objStore.read))
+	})
+
+	t.Run("should accept an object exactly at the limit", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject("test", []byte("test object content"))
+
+		addr, err := startTestServerWithLimits(subT, Limits{Object: 7}, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(getObjectEndpointFmt, addr, "test"), bytes.NewReader([]byte("content")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("should fail with request entity too large if the object is over the limit", func(subT *testing.T) {
+		testObject := []byte("test object content")
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject("test", testObject)
+
+		addr, err := startTestServerWithLimits(subT, Limits{Object: 6}, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		// Hide the length so the body is sent chunked and only caught while reading it
+		body := io.MultiReader(bytes.NewReader([]byte("content")))
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf(getObjectEndpointFmt, addr, "test"), body)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusRequestEntityTooLarge, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.Contains(subT, apiErr.Message, "6 bytes")
+
+		b, err := objStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, testObject, b)
+	})
+
+	t.Run("should update the object if If-Match matches", func(subT *testing.T) {
+		testObjectID := "test"
+
+		objStore := sakuin.NewInMemoryObjectStore().
+			WithObject(testObjectID, []byte("test object content"))
+
+		addr, err := startTestServer(subT, withObjectStore(objStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
+		resp, err := http.Get(uri)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		tag := resp.Header.Get("ETag")
+
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("content")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("If-Match", tag)
+
+		resp, err = http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		b, err := objStore.Get(context.Background(), testObjectID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+	})
+
+	t.Run("should fail with precondition failed if If-Match is stale", func(subT *testing.T) {
 		testObjectID := "test"
 		testObject := []byte("test object content")
 
@@ -100,19 +905,168 @@ func TestUpdateObjectHandler(t *testing.T) {
 			return
 		}
 
+		staleTag, err := sakuin.SHA256.Checksum([]byte("stale content"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
 		uri := fmt.Sprintf(getObjectEndpointFmt, addr, testObjectID)
 		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("content")))
 		if err != nil {
 			subT.Error(err)
 			return
 		}
+		req.Header.Set("If-Match", `"`+staleTag+`"`)
 
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			subT.Error(err)
 			return
 		}
+		if !assert.Equal(subT, http.StatusPreconditionFailed, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.NotEmpty(subT, apiErr.Message)
+
+		b, err := objStore.Get(context.Background(), testObjectID)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, testObject, b)
+	})
+
+	t.Run("should fail with not found before checking If-Match", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
 
-		assert.Equal(subT, http.StatusOK, resp.StatusCode)
+		uri := fmt.Sprintf(getObjectEndpointFmt, addr, "objectDoesNotExistID")
+		req, err := http.NewRequest(http.MethodPut, uri, bytes.NewReader([]byte("content")))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		req.Header.Set("If-Match", `"sha256:stale"`)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestDeleteObjectHandler(t *testing.T) {
+	t.Run("should keep the metadata", func(subT *testing.T) {
+		objStore := sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		docStore := sakuin.NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"name": "test"})
+
+		addr, err := startTestServer(subT, withObjectStore(objStore), withDocumentStore(docStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(getObjectEndpointFmt, addr, "test"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		resp, err = http.Get(fmt.Sprintf(getObjectEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = http.Get(fmt.Sprintf(getMetadataEndpointFmt, addr, "test"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusOK, resp.StatusCode) {
+			return
+		}
+
+		var metadata map[string]interface{}
+		if !decodeJSON(subT, resp.Body, &metadata) {
+			return
+		}
+		assert.Equal(subT, "test", metadata["name"])
+	})
+
+	t.Run("should fail if object doesn't exist", func(subT *testing.T) {
+		addr, err := startTestServer(subT)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(getObjectEndpointFmt, addr, "objectDoesNotExistID"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		assert.Equal(subT, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("should fail with an APIError on unexpected store errors", func(subT *testing.T) {
+		mockObjStore := mocks.ObjectStore{}
+		mockObjStore.On("Delete", mock.Anything, mock.Anything).Return(errors.New("oh no something went wrong"))
+
+		addr, err := startTestServer(subT, withObjectStore(&mockObjStore))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(getObjectEndpointFmt, addr, "test"), nil)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !assert.Equal(subT, http.StatusInternalServerError, resp.StatusCode) {
+			return
+		}
+
+		var apiErr APIError
+		if !decodeJSON(subT, resp.Body, &apiErr) {
+			return
+		}
+		assert.Equal(subT, "oh no something went wrong", apiErr.Message)
 	})
 }
@@ -0,0 +1,160 @@
+package sakuin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+	"go.uber.org/zap"
+)
+
+// IDGenerator generates ids for newly indexed objects.
+type IDGenerator interface {
+	NewID(ctx context.Context) (string, error)
+}
+
+// UUIDGenerator generates random (version 4) UUIDs.
+type UUIDGenerator struct {
+	// RandSrc is the source of randomness for the UUIDs.
+	RandSrc io.Reader
+}
+
+func (g UUIDGenerator) NewID(ctx context.Context) (string, error) {
+	id, err := uuid.NewRandomFromReader(g.RandSrc)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// ULIDGenerator generates lexicographically sortable ULIDs.
+type ULIDGenerator struct {
+	// RandSrc is the source of entropy for the ULIDs.
+	RandSrc io.Reader
+
+	// Now returns the timestamp component of the ULIDs.
+	// Defaults to time.Now.
+	Now func() time.Time
+}
+
+func (g ULIDGenerator) NewID(ctx context.Context) (string, error) {
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+
+	id, err := ulid.New(ulid.Timestamp(now()), g.RandSrc)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// PrefixedGenerator prepends a static prefix to the ids of another IDGenerator.
+type PrefixedGenerator struct {
+	Prefix    string
+	Generator IDGenerator
+}
+
+func (g PrefixedGenerator) NewID(ctx context.Context) (string, error) {
+	id, err := g.Generator.NewID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return g.Prefix + id, nil
+}
+
+// DefaultMaxIDAttempts is how many ids are generated, when Config.MaxIDAttempts
+// isn't set, before giving up on finding one which isn't already used.
+const DefaultMaxIDAttempts = 5
+
+// IDGenerationErr represents failing to generate an id which isn't already used.
+type IDGenerationErr struct {
+	// Collisions is how many generated ids were already used.
+	Collisions int
+}
+
+func (e IDGenerationErr) Error() string {
+	return fmt.Sprintf("unable to generate an unused id after %d collisions", e.Collisions)
+}
+
+// generateID generates ids until it finds one which isn't already used by
+// an object in the object store, giving up after s.maxIDAttempts collisions.
+func (s *Service) generateID(ctx context.Context) (string, error) {
+	for attempt := 0; attempt < s.maxIDAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		id, err := s.idGen.NewID(ctx)
+		if err != nil {
+			s.log.Error("unexpected error when generating id", zap.Error(err))
+			return "", err
+		}
+
+		stats, err := s.objDB.Stat(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if !stats.Exists {
+			return id, nil
+		}
+		s.log.Warn("generated id already exists", zap.String("id", id), zap.Int("attempt", attempt+1))
+	}
+
+	s.log.Error("unable to generate an unused id", zap.Int("attempts", s.maxIDAttempts))
+	return "", IDGenerationErr{Collisions: s.maxIDAttempts}
+}
+
+// ReservedIDErr represents a caller supplied id which starts with one of the
+// prefixes the Service keeps its own entries under, e.g. the trash.
+type ReservedIDErr struct {
+	ID     string
+	Prefix string
+}
+
+func (e ReservedIDErr) Error() string {
+	return fmt.Sprintf("id %s uses the reserved prefix %s", e.ID, e.Prefix)
+}
+
+// reservedIDPrefixes are the prefixes of the ids the Service uses for its
+// own entries, which callers can't index, copy or move objects to.
+var reservedIDPrefixes = []string{trashIDPrefix, UploadChunkPrefix}
+
+func checkID(id string) error {
+	for _, prefix := range reservedIDPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return ReservedIDErr{ID: id, Prefix: prefix}
+		}
+	}
+	return nil
+}
+
+// indexID returns the caller supplied id, as long as it isn't already taken
+// or reserved, or generates a new one if no id was supplied.
+//
+// The existence check isn't atomic with the subsequent write, so two
+// concurrent requests supplying the same id may both succeed.
+func (s *Service) indexID(ctx context.Context, id string) (string, error) {
+	if id == "" {
+		return s.generateID(ctx)
+	}
+	if err := checkID(id); err != nil {
+		s.log.Error("id is reserved", zap.String("id", id))
+		return "", err
+	}
+
+	stats, err := s.objDB.Stat(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if stats.Exists {
+		s.log.Error("object already exists", zap.String("id", id))
+		return "", ObjectAlreadyExistsErr{ID: id}
+	}
+	return id, nil
+}
@@ -0,0 +1,185 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// sequenceGenerator returns the given ids in order.
+type sequenceGenerator struct {
+	ids []string
+}
+
+func (g *sequenceGenerator) NewID(ctx context.Context) (string, error) {
+	if len(g.ids) == 0 {
+		return "", errors.New("out of ids")
+	}
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id, nil
+}
+
+// constantReader always yields the same byte.
+type constantReader byte
+
+func (r constantReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestUUIDGenerator(t *testing.T) {
+	t.Run("should generate a valid uuid", func(subT *testing.T) {
+		id, err := UUIDGenerator{RandSrc: rand.Reader}.NewID(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = uuid.Parse(id)
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should fail if rand source is exhausted", func(subT *testing.T) {
+		_, err := UUIDGenerator{RandSrc: strings.NewReader("")}.NewID(context.Background())
+		assert.Error(subT, err)
+	})
+}
+
+func TestULIDGenerator(t *testing.T) {
+	t.Run("should generate time sortable ids", func(subT *testing.T) {
+		now := time.Now()
+		gen := ULIDGenerator{
+			RandSrc: rand.Reader,
+			Now:     func() time.Time { return now },
+		}
+
+		first, err := gen.NewID(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		now = now.Add(time.Millisecond)
+		second, err := gen.NewID(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.Less(subT, first, second)
+	})
+}
+
+func TestPrefixedGenerator(t *testing.T) {
+	t.Run("should prefix generated ids", func(subT *testing.T) {
+		gen := PrefixedGenerator{
+			Prefix:    "invoice-",
+			Generator: UUIDGenerator{RandSrc: rand.Reader},
+		}
+
+		id, err := gen.NewID(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		if !assert.True(subT, strings.HasPrefix(id, "invoice-")) {
+			return
+		}
+
+		_, err = uuid.Parse(strings.TrimPrefix(id, "invoice-"))
+		assert.Nil(subT, err)
+	})
+}
+
+func TestGenerateID(t *testing.T) {
+	t.Run("should produce ulids when configured", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			IDGenerator:   ULIDGenerator{RandSrc: rand.Reader},
+		})
+
+		id, err := s.generateID(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = ulid.ParseStrict(id)
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should skip ids which already exist in the object store", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("taken", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			IDGenerator:   &sequenceGenerator{ids: []string{"taken", "free"}},
+		})
+
+		id, err := s.generateID(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "free", id)
+	})
+
+	t.Run("should fail if generator fails", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			IDGenerator:   &sequenceGenerator{},
+		})
+
+		_, err := s.generateID(context.Background())
+		assert.Error(subT, err)
+	})
+	t.Run("should give up if every generated id already exists", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       constantReader(7),
+		})
+
+		id, err := s.generateID(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		objStore.WithObject(id, []byte("content"))
+
+		_, err = s.generateID(context.Background())
+		assert.Equal(subT, IDGenerationErr{Collisions: DefaultMaxIDAttempts}, err)
+	})
+
+	t.Run("should respect the configured max attempts", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("taken", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			IDGenerator:   &sequenceGenerator{ids: []string{"taken", "taken", "free"}},
+			MaxIDAttempts: 2,
+		})
+
+		_, err := s.generateID(context.Background())
+		assert.Equal(subT, IDGenerationErr{Collisions: 2}, err)
+	})
+
+	t.Run("should stop if the context is cancelled", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := s.generateID(ctx)
+		assert.Equal(subT, context.Canceled, err)
+	})
+}
@@ -0,0 +1,124 @@
+package sakuin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"go.uber.org/zap"
+)
+
+// DefaultIdempotencyWindow is how long idempotency keys are remembered
+// for when Config.IdempotencyWindow isn't set.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// IdempotencyKeyInProgressErr represents a request reusing the idempotency
+// key of another request which hasn't finished yet.
+type IdempotencyKeyInProgressErr struct {
+	Key string
+}
+
+func (e IdempotencyKeyInProgressErr) Error() string {
+	return fmt.Sprintf("request with idempotency key is still in progress: %s", e.Key)
+}
+
+// IdempotencyStore maps idempotency keys to the ids they were assigned.
+type IdempotencyStore interface {
+	// Reserve claims the key until ttl after now, unless it's already
+	// claimed, in which case the id recorded for it is returned instead.
+	// The id is empty while the request which claimed it is in progress.
+	Reserve(ctx context.Context, key string, now time.Time, ttl time.Duration) (id string, reserved bool, err error)
+
+	// Commit records the id assigned to a key claimed by Reserve.
+	Commit(ctx context.Context, key, id string) error
+
+	// Release forgets a key claimed by Reserve, so it can be claimed again.
+	Release(ctx context.Context, key string) error
+}
+
+type idempotencyEntry struct {
+	id        string
+	expiresAt time.Time
+}
+
+type InMemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+}
+
+func NewInMemoryIdempotencyStore() *InMemoryIdempotencyStore {
+	return &InMemoryIdempotencyStore{
+		entries: make(map[string]idempotencyEntry),
+	}
+}
+
+func (st *InMemoryIdempotencyStore) Reserve(ctx context.Context, key string, now time.Time, ttl time.Duration) (string, bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	entry, ok := st.entries[key]
+	if ok && entry.expiresAt.After(now) {
+		return entry.id, false, nil
+	}
+
+	st.entries[key] = idempotencyEntry{expiresAt: now.Add(ttl)}
+	return "", true, nil
+}
+
+func (st *InMemoryIdempotencyStore) Commit(ctx context.Context, key, id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	entry := st.entries[key]
+	entry.id = id
+	st.entries[key] = entry
+	return nil
+}
+
+func (st *InMemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	st.mu.Lock()
+	delete(st.entries, key)
+	st.mu.Unlock()
+
+	return nil
+}
+
+// reserveIdempotencyKey claims the key for the current request or, if an
+// earlier request already completed with it, returns the id it was assigned.
+func (s *Service) reserveIdempotencyKey(ctx context.Context, key string) (string, bool, error) {
+	id, reserved, err := s.idempotency.Reserve(ctx, key, s.now(), s.idemWindow)
+	if err != nil {
+		s.log.Error("unable to reserve idempotency key", zap.Error(err))
+		return "", false, err
+	}
+	if reserved {
+		return "", false, nil
+	}
+	if id == "" {
+		s.log.Warn("idempotency key is in use by a request in progress")
+		return "", false, IdempotencyKeyInProgressErr{Key: key}
+	}
+
+	s.logger(id).Info("replaying idempotent request")
+	return id, true, nil
+}
+
+// settleIdempotencyKey records the outcome of the request which reserved the key.
+// Failed requests release the key so they can be retried.
+func (s *Service) settleIdempotencyKey(ctx context.Context, key string, resp *pb.IndexResponse, err error) {
+	if err != nil {
+		rerr := s.idempotency.Release(ctx, key)
+		if rerr != nil {
+			s.log.Error("unable to release idempotency key", zap.Error(rerr))
+		}
+		return
+	}
+
+	err = s.idempotency.Commit(ctx, key, resp.Id)
+	if err != nil {
+		s.logger(resp.Id).Error("unable to commit idempotency key", zap.Error(err))
+	}
+}
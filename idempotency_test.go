@@ -0,0 +1,112 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexIdempotency(t *testing.T) {
+	t.Run("should replay the original id without indexing again", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		req := &pb.IndexRequest{Object: []byte("content"), IdempotencyKey: "key"}
+		first, err := s.Index(context.Background(), req)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		second, err := s.Index(context.Background(), req)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Equal(subT, first.Id, second.Id) {
+			return
+		}
+		assert.Equal(subT, first.Checksum, second.Checksum)
+		assert.Len(subT, objStore.objects, 1)
+	})
+
+	t.Run("should only index once for concurrent requests", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content"), IdempotencyKey: "key"})
+			}(i)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				assert.IsType(subT, IdempotencyKeyInProgressErr{}, err)
+			}
+		}
+		assert.Len(subT, objStore.objects, 1)
+	})
+
+	t.Run("should index again once the window has passed", func(subT *testing.T) {
+		now := time.Now()
+		s := New(Config{
+			ObjectStore:       NewInMemoryObjectStore(),
+			DocumentStore:     NewInMemoryDocumentStore(),
+			Now:               func() time.Time { return now },
+			RandSrc:           rand.Reader,
+			IdempotencyWindow: time.Hour,
+		})
+
+		req := &pb.IndexRequest{Object: []byte("content"), IdempotencyKey: "key"}
+		first, err := s.Index(context.Background(), req)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		now = now.Add(2 * time.Hour)
+		second, err := s.Index(context.Background(), req)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.NotEqual(subT, first.Id, second.Id)
+	})
+
+	t.Run("should release the key if indexing fails", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		req := &pb.IndexRequest{Id: "test", Object: []byte("content"), IdempotencyKey: "key"}
+		_, err := s.Index(context.Background(), req)
+		if !assert.IsType(subT, ObjectAlreadyExistsErr{}, err) {
+			return
+		}
+
+		req.Id = "other"
+		resp, err := s.Index(context.Background(), req)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "other", resp.Id)
+	})
+}
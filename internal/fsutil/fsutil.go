@@ -0,0 +1,105 @@
+// Package fsutil holds the on-disk layout shared by the filesystem stores.
+package fsutil
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSegmentLen is the longest file or directory name Path creates, which
+// leaves room for the extension within the 255 byte limit most filesystems
+// place on names.
+const maxSegmentLen = 200
+
+// Path returns where the entry for the given id is stored under root.
+//
+// Entries are spread across two levels of fan-out directories, derived
+// from a hash of the id, so no single directory grows too large. File
+// names are the base64url encoded id, so ids can never escape the root.
+// Encoded ids too long for a single name are split into nested
+// directories of at most maxSegmentLen bytes each.
+func Path(root, id, ext string) string {
+	sum := sha256.Sum256([]byte(id))
+	fanout := hex.EncodeToString(sum[:2])
+	name := base64.RawURLEncoding.EncodeToString([]byte(id))
+
+	elems := []string{root, fanout[:2], fanout[2:]}
+	for len(name) > maxSegmentLen {
+		elems = append(elems, name[:maxSegmentLen])
+		name = name[maxSegmentLen:]
+	}
+	return filepath.Join(append(elems, name+ext)...)
+}
+
+// IDs returns the ids of every entry with the given extension under root, in no particular order.
+func IDs(root, ext string) ([]string, error) {
+	var ids []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ext) {
+			return nil
+		}
+
+		// Skip the fan-out directories and rejoin any segments of the name.
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		segments := strings.Split(filepath.ToSlash(rel), "/")
+		if len(segments) < 3 {
+			return nil
+		}
+		name := strings.TrimSuffix(strings.Join(segments[2:], ""), ext)
+
+		id, err := base64.RawURLEncoding.DecodeString(name)
+		if err != nil {
+			return nil
+		}
+		ids = append(ids, string(id))
+		return nil
+	})
+	return ids, err
+}
+
+// WriteFile atomically replaces the file at path with whatever is written
+// by f, by writing to a temporary file and renaming it over path.
+// If f fails, the file is left untouched.
+func WriteFile(path string, f func(io.Writer) error) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = f(tmp)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
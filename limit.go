@@ -0,0 +1,188 @@
+package sakuin
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// storeLimit bounds how many store calls may be in flight at once,
+// shared across the ObjectStore and DocumentStore.
+type storeLimit struct {
+	sem *semaphore.Weighted
+}
+
+func newStoreLimit(n int) storeLimit {
+	if n <= 0 {
+		return storeLimit{}
+	}
+	return storeLimit{sem: semaphore.NewWeighted(int64(n))}
+}
+
+// do waits for a free slot, or for the context to be done, before calling f.
+func (l storeLimit) do(ctx context.Context, f func() error) error {
+	err := l.sem.Acquire(ctx, 1)
+	if err != nil {
+		return err
+	}
+	defer l.sem.Release(1)
+
+	return f()
+}
+
+// wrapObjectStore applies the limit to every call of the given store,
+// preserving whether it implements StreamingObjectStore.
+func (l storeLimit) wrapObjectStore(objDB ObjectStore) ObjectStore {
+	if objDB == nil || l.sem == nil {
+		return objDB
+	}
+
+	s := limitObjectStore{objDB: objDB, limit: l}
+	if streamDB, ok := objDB.(StreamingObjectStore); ok {
+		return limitStreamingObjectStore{limitObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// wrapDocumentStore applies the limit to every call of the given store,
+// preserving whether it implements RevisionedDocumentStore.
+func (l storeLimit) wrapDocumentStore(docDB DocumentStore) DocumentStore {
+	if docDB == nil || l.sem == nil {
+		return docDB
+	}
+
+	s := limitDocumentStore{docDB: docDB, limit: l}
+	if revDB, ok := docDB.(RevisionedDocumentStore); ok {
+		return limitRevisionedDocumentStore{limitDocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+type limitObjectStore struct {
+	objDB ObjectStore
+	limit storeLimit
+}
+
+func (s limitObjectStore) Stat(ctx context.Context, id string) (info *StatInfo, err error) {
+	err = s.limit.do(ctx, func() error {
+		info, err = s.objDB.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s limitObjectStore) Get(ctx context.Context, id string) (b []byte, err error) {
+	err = s.limit.do(ctx, func() error {
+		b, err = s.objDB.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s limitObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.limit.do(ctx, func() error {
+		return s.objDB.Put(ctx, id, b)
+	})
+}
+
+func (s limitObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	return s.limit.do(ctx, func() error {
+		return s.objDB.Update(ctx, id, b)
+	})
+}
+
+func (s limitObjectStore) Delete(ctx context.Context, id string) error {
+	return s.limit.do(ctx, func() error {
+		return s.objDB.Delete(ctx, id)
+	})
+}
+
+// limitStreamingObjectStore only holds a slot while GetStream opens the
+// object, since how long the returned reader is held depends on the caller.
+type limitStreamingObjectStore struct {
+	limitObjectStore
+	streamDB StreamingObjectStore
+}
+
+func (s limitStreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.limit.do(ctx, func() error {
+		return s.streamDB.PutStream(ctx, id, r, size)
+	})
+}
+
+func (s limitStreamingObjectStore) GetStream(ctx context.Context, id string) (rc io.ReadCloser, size int64, err error) {
+	err = s.limit.do(ctx, func() error {
+		rc, size, err = s.streamDB.GetStream(ctx, id)
+		return err
+	})
+	return
+}
+
+type limitDocumentStore struct {
+	docDB DocumentStore
+	limit storeLimit
+}
+
+func (s limitDocumentStore) Stat(ctx context.Context, id string) (info *StatInfo, err error) {
+	err = s.limit.do(ctx, func() error {
+		info, err = s.docDB.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s limitDocumentStore) Get(ctx context.Context, id string) (doc map[string]interface{}, err error) {
+	err = s.limit.do(ctx, func() error {
+		doc, err = s.docDB.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s limitDocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.limit.do(ctx, func() error {
+		return s.docDB.Upsert(ctx, id, doc)
+	})
+}
+
+func (s limitDocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.limit.do(ctx, func() error {
+		return s.docDB.Replace(ctx, id, doc)
+	})
+}
+
+func (s limitDocumentStore) Delete(ctx context.Context, id string) error {
+	return s.limit.do(ctx, func() error {
+		return s.docDB.Delete(ctx, id)
+	})
+}
+
+type limitRevisionedDocumentStore struct {
+	limitDocumentStore
+	revDB RevisionedDocumentStore
+}
+
+func (s limitRevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (doc map[string]interface{}, rev string, err error) {
+	err = s.limit.do(ctx, func() error {
+		doc, rev, err = s.revDB.GetWithRevision(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s limitRevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.limit.do(ctx, func() error {
+		rev, err = s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
+
+func (s limitRevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.limit.do(ctx, func() error {
+		rev, err = s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
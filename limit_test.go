@@ -0,0 +1,104 @@
+package sakuin
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// inflightDocumentStore records the most Get calls which were ever in flight at once.
+type inflightDocumentStore struct {
+	DocumentStore
+	delay    time.Duration
+	inflight int32
+	max      int32
+}
+
+func (s *inflightDocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	n := atomic.AddInt32(&s.inflight, 1)
+	defer atomic.AddInt32(&s.inflight, -1)
+
+	for {
+		max := atomic.LoadInt32(&s.max)
+		if n <= max || atomic.CompareAndSwapInt32(&s.max, max, n) {
+			break
+		}
+	}
+
+	time.Sleep(s.delay)
+	return s.DocumentStore.Get(ctx, id)
+}
+
+func TestMaxConcurrentStoreOps(t *testing.T) {
+	getConcurrently := func(s *Service, n int) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+			}()
+		}
+		wg.Wait()
+	}
+
+	t.Run("should not exceed the limit", func(subT *testing.T) {
+		docStore := &inflightDocumentStore{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+			delay:         10 * time.Millisecond,
+		}
+
+		s := New(Config{
+			DocumentStore:         docStore,
+			MaxConcurrentStoreOps: 2,
+		})
+
+		getConcurrently(s, 10)
+
+		assert.Equal(subT, int32(2), docStore.max)
+	})
+
+	t.Run("should be unlimited if unset", func(subT *testing.T) {
+		docStore := &inflightDocumentStore{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+			delay:         50 * time.Millisecond,
+		}
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		getConcurrently(s, 10)
+
+		assert.Greater(subT, docStore.max, int32(2))
+	})
+
+	t.Run("should stop waiting if the context is done", func(subT *testing.T) {
+		docStore := &inflightDocumentStore{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+			delay:         time.Second,
+		}
+
+		s := New(Config{
+			DocumentStore:         docStore,
+			MaxConcurrentStoreOps: 1,
+		})
+
+		go s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		for atomic.LoadInt32(&docStore.inflight) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := s.GetMetadata(ctx, &pb.GetMetadataRequest{Id: "test"})
+		assert.Equal(subT, context.DeadlineExceeded, err)
+	})
+}
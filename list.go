@@ -0,0 +1,46 @@
+package sakuin
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// List returns the ids of indexed objects starting with prefix, with the
+// same paging as ListableObjectStore.List. Soft deleted objects and the
+// chunks of uploads in progress are left out, so pages may hold fewer ids
+// than the limit even when there are more pages.
+//
+// Listing goes straight to the configured ObjectStore, without
+// the timeouts, concurrency limit or retries of other calls.
+func (s *Service) List(ctx context.Context, prefix string, cursor string, limit int) (ids []string, next string, err error) {
+	defer s.observe("List", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, "", err
+	}
+	defer s.exit()
+
+	listDB, ok := s.rawObjDB.(ListableObjectStore)
+	if !ok {
+		return nil, "", ErrListNotSupported
+	}
+
+	page, next, err := listDB.List(ctx, prefix, cursor, limit)
+	if err != nil {
+		s.log.Error("unable to list objects", zap.Error(err))
+		return nil, "", err
+	}
+
+	ids = make([]string, 0, len(page))
+	for _, id := range page {
+		if strings.HasPrefix(id, trashIDPrefix) || strings.HasPrefix(id, UploadChunkPrefix) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, next, nil
+}
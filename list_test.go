@@ -0,0 +1,64 @@
+package sakuin
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList(t *testing.T) {
+	t.Run("should page through the indexed ids", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore: NewInMemoryObjectStore().
+				WithObject("a", []byte("a")).
+				WithObject("b", []byte("b")).
+				WithObject("c", []byte("c")),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		ids, next, err := s.List(context.Background(), "", "", 2)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"a", "b"}, ids)
+
+		ids, next, err = s.List(context.Background(), "", next, 2)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"c"}, ids)
+		assert.Empty(subT, next)
+	})
+
+	t.Run("should leave out soft deleted objects", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("a", []byte("a")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			SoftDelete:    true,
+		})
+
+		_, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "a"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		ids, _, err := s.List(context.Background(), "", "", 0)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, ids)
+	})
+
+	t.Run("should fail if the object store can't list", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   nonStreamingObjectStore{NewInMemoryObjectStore()},
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, _, err := s.List(context.Background(), "", "", 0)
+		assert.Equal(subT, ErrListNotSupported, err)
+	})
+}
@@ -0,0 +1,75 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	t.Run("should not write to the global logger", func(subT *testing.T) {
+		core, globalLogs := observer.New(zap.DebugLevel)
+		defer zap.ReplaceGlobals(zap.New(core))()
+
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+			Logger:        zaptest.NewLogger(subT),
+			RetryPolicy:   RetryPolicy{MaxAttempts: 2},
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("hello"), Metadata: metadata})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: resp.Id})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{Id: "missing", Metadata: metadata})
+		if !assert.Error(subT, err) {
+			return
+		}
+
+		assert.Equal(subT, 0, globalLogs.Len())
+	})
+
+	t.Run("should attach the id to request logs", func(subT *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+			Logger:        zap.New(core),
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{Id: "missing", Metadata: metadata})
+		if !assert.Error(subT, err) {
+			return
+		}
+
+		entries := logs.FilterMessage("metadata doesn't exist").FilterField(zap.String("id", "missing"))
+		assert.Equal(subT, 1, entries.Len())
+	})
+}
@@ -0,0 +1,79 @@
+package sakuin
+
+import "container/list"
+
+// lruIndex tracks how recently the entries of a bounded in-memory store
+// were used, picking the least recently used ones to evict once the store
+// is past its limits. It isn't safe for concurrent use.
+type lruIndex struct {
+	// A limit of zero or less is unlimited.
+	maxBytes   int64
+	maxEntries int
+
+	bytes int64
+	order *list.List
+	elems map[string]*list.Element
+}
+
+type lruEntry struct {
+	id   string
+	size int64
+}
+
+func newLRUIndex(maxBytes int64, maxEntries int) *lruIndex {
+	return &lruIndex{
+		maxBytes:   maxBytes,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		elems:      make(map[string]*list.Element),
+	}
+}
+
+// fits reports whether an entry of the given size can be held at all.
+func (l *lruIndex) fits(size int64) bool {
+	return l.maxBytes <= 0 || size <= l.maxBytes
+}
+
+// touch marks the entry as the most recently used.
+func (l *lruIndex) touch(id string) {
+	if el, ok := l.elems[id]; ok {
+		l.order.MoveToFront(el)
+	}
+}
+
+// set adds or resizes the entry, marking it as the most recently used,
+// and returns the ids which must be evicted to get back within the
+// limits. The entry itself is never evicted.
+func (l *lruIndex) set(id string, size int64) []string {
+	if el, ok := l.elems[id]; ok {
+		e := el.Value.(*lruEntry)
+		l.bytes += size - e.size
+		e.size = size
+		l.order.MoveToFront(el)
+	} else {
+		l.elems[id] = l.order.PushFront(&lruEntry{id: id, size: size})
+		l.bytes += size
+	}
+
+	var evicted []string
+	for l.order.Len() > 1 && l.over() {
+		e := l.order.Back().Value.(*lruEntry)
+		l.remove(e.id)
+		evicted = append(evicted, e.id)
+	}
+	return evicted
+}
+
+func (l *lruIndex) over() bool {
+	return (l.maxBytes > 0 && l.bytes > l.maxBytes) || (l.maxEntries > 0 && l.order.Len() > l.maxEntries)
+}
+
+func (l *lruIndex) remove(id string) {
+	el, ok := l.elems[id]
+	if !ok {
+		return
+	}
+	l.order.Remove(el)
+	delete(l.elems, id)
+	l.bytes -= el.Value.(*lruEntry).size
+}
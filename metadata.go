@@ -0,0 +1,111 @@
+package sakuin
+
+import "fmt"
+
+// ReservedMetadataKey is the top level metadata key under which
+// the Service records its own bookkeeping about an indexed object.
+const ReservedMetadataKey = "_sakuin"
+
+// UnsupportedMetadataTypeErr represents metadata sent as a message
+// which can't be converted to JSON, e.g. since its type isn't known.
+type UnsupportedMetadataTypeErr struct {
+	TypeURL string
+	Err     error
+}
+
+func (e UnsupportedMetadataTypeErr) Error() string {
+	return fmt.Sprintf("unsupported metadata type %s: %s", e.TypeURL, e.Err)
+}
+
+func (e UnsupportedMetadataTypeErr) Unwrap() error {
+	return e.Err
+}
+
+const (
+	checksumMetadataKey    = "checksum"
+	contentTypeMetadataKey = "contentType"
+	filenameMetadataKey    = "filename"
+)
+
+func setReservedMetadata(doc map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+
+	reserved, ok := doc[ReservedMetadataKey].(map[string]interface{})
+	if !ok {
+		reserved = make(map[string]interface{})
+		doc[ReservedMetadataKey] = reserved
+	}
+	reserved[key] = value
+
+	return doc
+}
+
+func deleteReservedMetadata(doc map[string]interface{}, key string) {
+	reserved, ok := doc[ReservedMetadataKey].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	delete(reserved, key)
+	if len(reserved) == 0 {
+		delete(doc, ReservedMetadataKey)
+	}
+}
+
+func getReservedMetadata(doc map[string]interface{}, key string) (interface{}, bool) {
+	reserved, ok := doc[ReservedMetadataKey].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	v, ok := reserved[key]
+	return v, ok
+}
+
+func getReservedString(doc map[string]interface{}, key string) string {
+	v, _ := getReservedMetadata(doc, key)
+	s, _ := v.(string)
+	return s
+}
+
+// withoutReserved returns a shallow copy of the document without the
+// reserved metadata, which is how callers see it.
+func withoutReserved(doc map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if k != ReservedMetadataKey {
+			cp[k] = v
+		}
+	}
+	return cp
+}
+
+// CopyDoc returns a deep copy of the given document.
+func CopyDoc(doc map[string]interface{}) map[string]interface{} {
+	if doc == nil {
+		return nil
+	}
+
+	cp := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		cp[k] = copyValue(v)
+	}
+	return cp
+}
+
+func copyValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		return CopyDoc(x)
+	case []interface{}:
+		cp := make([]interface{}, len(x))
+		for i, e := range x {
+			cp[i] = copyValue(e)
+		}
+		return cp
+	default:
+		return v
+	}
+}
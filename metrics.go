@@ -0,0 +1,101 @@
+package sakuin
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives measurements from every Service operation.
+type Metrics interface {
+	// ObserveOperation is called once a Service operation returns.
+	ObserveOperation(name string, duration time.Duration, err error)
+
+	// ObserveObjectSize is called with the size of every object written.
+	ObserveObjectSize(bytes int)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveOperation(string, time.Duration, error) {}
+
+func (noopMetrics) ObserveObjectSize(int) {}
+
+// CounterMetrics is a Metrics implementation which simply counts
+// operations and object sizes.
+type CounterMetrics struct {
+	ops sync.Map // map[string]*operationCounters
+
+	objects     uint64
+	objectBytes uint64
+}
+
+type operationCounters struct {
+	succeeded uint64
+	failed    uint64
+	duration  int64
+}
+
+// OperationCounts are the counts recorded for a single operation.
+type OperationCounts struct {
+	Succeeded uint64
+	Failed    uint64
+
+	// Duration is the total time spent in the operation.
+	Duration time.Duration
+}
+
+// MetricsSnapshot is a point in time copy of the counts recorded by CounterMetrics.
+type MetricsSnapshot struct {
+	Operations map[string]OperationCounts
+
+	Objects     uint64
+	ObjectBytes uint64
+}
+
+func NewCounterMetrics() *CounterMetrics {
+	return &CounterMetrics{}
+}
+
+func (m *CounterMetrics) ObserveOperation(name string, duration time.Duration, err error) {
+	v, _ := m.ops.LoadOrStore(name, new(operationCounters))
+	c := v.(*operationCounters)
+
+	if err != nil {
+		atomic.AddUint64(&c.failed, 1)
+	} else {
+		atomic.AddUint64(&c.succeeded, 1)
+	}
+	atomic.AddInt64(&c.duration, int64(duration))
+}
+
+func (m *CounterMetrics) ObserveObjectSize(bytes int) {
+	atomic.AddUint64(&m.objects, 1)
+	atomic.AddUint64(&m.objectBytes, uint64(bytes))
+}
+
+// Snapshot returns the counts recorded so far.
+func (m *CounterMetrics) Snapshot() MetricsSnapshot {
+	snapshot := MetricsSnapshot{
+		Operations:  make(map[string]OperationCounts),
+		Objects:     atomic.LoadUint64(&m.objects),
+		ObjectBytes: atomic.LoadUint64(&m.objectBytes),
+	}
+
+	m.ops.Range(func(k, v interface{}) bool {
+		c := v.(*operationCounters)
+		snapshot.Operations[k.(string)] = OperationCounts{
+			Succeeded: atomic.LoadUint64(&c.succeeded),
+			Failed:    atomic.LoadUint64(&c.failed),
+			Duration:  time.Duration(atomic.LoadInt64(&c.duration)),
+		}
+		return true
+	})
+	return snapshot
+}
+
+// observe reports an operation which started at the given time. It's meant
+// to be deferred with a pointer to the operation's named error result.
+func (s *Service) observe(name string, start time.Time, err *error) {
+	s.metrics.ObserveOperation(name, time.Since(start), *err)
+}
@@ -0,0 +1,86 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterMetrics(t *testing.T) {
+	t.Run("should count concurrent observations", func(subT *testing.T) {
+		m := NewCounterMetrics()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				var err error
+				if i%2 == 0 {
+					err = errors.New("failed")
+				}
+				m.ObserveOperation("test", time.Millisecond, err)
+				m.ObserveObjectSize(10)
+			}(i)
+		}
+		wg.Wait()
+
+		snapshot := m.Snapshot()
+		assert.Equal(subT, OperationCounts{Succeeded: 5, Failed: 5, Duration: 10 * time.Millisecond}, snapshot.Operations["test"])
+		assert.Equal(subT, uint64(10), snapshot.Objects)
+		assert.Equal(subT, uint64(100), snapshot.ObjectBytes)
+	})
+}
+
+func TestServiceMetrics(t *testing.T) {
+	t.Run("should observe successful and failed operations", func(subT *testing.T) {
+		m := NewCounterMetrics()
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			Metrics:       m,
+		})
+
+		_, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "objectDoesNotExistID"})
+		if !assert.Error(subT, err) {
+			return
+		}
+
+		counts := m.Snapshot().Operations["GetObject"]
+		assert.Equal(subT, uint64(1), counts.Succeeded)
+		assert.Equal(subT, uint64(1), counts.Failed)
+	})
+
+	t.Run("should observe indexed object sizes", func(subT *testing.T) {
+		m := NewCounterMetrics()
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+			Metrics:       m,
+		})
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{Object: []byte("content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		snapshot := m.Snapshot()
+		assert.Equal(subT, uint64(1), snapshot.Operations["Index"].Succeeded)
+		assert.Equal(subT, uint64(1), snapshot.Objects)
+		assert.Equal(subT, uint64(len("content")), snapshot.ObjectBytes)
+	})
+}
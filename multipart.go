@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
+	"os"
 	"strings"
 
 	"go.uber.org/zap"
@@ -24,54 +25,264 @@ func (e ContentTypeError) Error() string {
 	return fmt.Sprintf("invalid content type: %s", e.ContentType)
 }
 
+// PartTooLargeErr represents a part of a multipart/form-data body
+// which exceeds its limit.
+type PartTooLargeErr struct {
+	Name  string
+	Limit int64
+}
+
+func (e PartTooLargeErr) Error() string {
+	return fmt.Sprintf("%s part exceeds limit of %d bytes", e.Name, e.Limit)
+}
+
+// PartLimits caps the size in bytes of the parts of a multipart/form-data
+// body, with Metadata capping every part other than the object. Parts are
+// uncapped if their limit isn't positive.
+type PartLimits struct {
+	Metadata int64
+	Object   int64
+}
+
+// IndexParts represents the parts of a multipart/form-data index request.
+type IndexParts struct {
+	// ID is the optional caller supplied id for the object.
+	ID       string
+	Metadata json.RawMessage
+	Object   []byte
+
+	// ObjectContentType is the Content-Type header of the object part, if any.
+	ObjectContentType string
+
+	// ObjectFilename is the filename of the object part, if any, without
+	// any directories.
+	ObjectFilename string
+}
+
 // ReadParts
 func ReadParts(r io.Reader, contentType string) (metadata json.RawMessage, object []byte, err error) {
-	mediaType, params, err := mime.ParseMediaType(contentType)
+	parts, err := ReadIndexParts(r, contentType)
 	if err != nil {
-		zap.L().Error("", zap.Error(err))
 		return nil, nil, err
 	}
-	if !strings.HasPrefix(mediaType, "multipart/form-data") {
-		zap.L().Error("unexpected media type", zap.String("content-type", mediaType))
-		return nil, nil, ContentTypeError{ContentType: mediaType}
+	return parts.Metadata, parts.Object, nil
+}
+
+// ReadIndexParts reads the id, metadata and object parts from a multipart/form-data body.
+func ReadIndexParts(r io.Reader, contentType string) (*IndexParts, error) {
+	mr, err := newMultipartReader(r, contentType)
+	if err != nil {
+		return nil, err
 	}
-	zap.L().Debug("parsed media type", zap.String("media-type", mediaType), zap.Any("params", params))
 
-	boundary, ok := params["boundary"]
-	if !ok {
-		zap.L().Error("missing boundary")
-		return nil, nil, ErrMissingBoundary
+	var parts IndexParts
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return &parts, nil
+		}
+		if err != nil {
+			zap.L().Error("unexpected error when getting next part", zap.Error(err))
+			return nil, err
+		}
+
+		err = readIndexPart(p, p, &parts)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// StreamIndexParts reads the parts of a multipart/form-data body like
+// ReadIndexParts, except the object part is handed to index as a stream
+// instead of being read into memory, so the IndexParts never hold the
+// Object. If the metadata part precedes the object part, the object is
+// streamed straight from r and any id or metadata parts following it are
+// ignored. Otherwise the object is spilled to a temporary file until the
+// remaining parts have been read. index isn't called without an object part.
+// Parts exceeding their limit fail with a PartTooLargeErr, which for the
+// object may be returned by index when it's streamed.
+func StreamIndexParts(r io.Reader, contentType string, limits PartLimits, index func(parts *IndexParts, object io.Reader) error) (*IndexParts, error) {
+	mr, err := newMultipartReader(r, contentType)
+	if err != nil {
+		return nil, err
 	}
 
-	var p *multipart.Part
-	mr := multipart.NewReader(r, boundary)
+	var parts IndexParts
+	var spilled *os.File
+	defer func() {
+		if spilled != nil {
+			spilled.Close()
+			os.Remove(spilled.Name())
+		}
+	}()
+	indexed := false
 	for {
-		p, err = mr.NextPart()
+		p, err := mr.NextPart()
 		if err == io.EOF {
-			err = nil
-			return
+			break
 		}
 		if err != nil {
 			zap.L().Error("unexpected error when getting next part", zap.Error(err))
-			return
+			return nil, err
 		}
 
 		pName := p.FormName()
-		zap.L().Debug("read part", zap.String("name", pName))
-		switch pName {
-		case "metadata":
-			dec := json.NewDecoder(p)
-			err = dec.Decode(&metadata)
+		if indexed || (spilled != nil && pName == "object") {
+			zap.L().Warn("ignoring part after the object", zap.String("name", pName))
+			continue
+		}
+		if pName != "object" {
+			err = readIndexPart(limitPart(p, pName, limits.Metadata), p, &parts)
 			if err != nil {
-				zap.L().Error("unexpected error when decoding metadata part", zap.Error(err))
-				return
+				return nil, err
 			}
-		case "object":
-			object, err = ioutil.ReadAll(p)
+			continue
+		}
+
+		parts.ObjectContentType = p.Header.Get("Content-Type")
+		parts.ObjectFilename = SanitizeFilename(p.FileName())
+		object := limitPart(p, pName, limits.Object)
+		if parts.Metadata != nil {
+			err = index(&parts, object)
 			if err != nil {
-				zap.L().Error("unexpected error when reading object content", zap.Error(err))
-				return
+				return nil, err
 			}
+			indexed = true
+			continue
+		}
+
+		spilled, err = spillPart(object)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if spilled == nil {
+		return &parts, nil
+	}
+
+	_, err = spilled.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	err = index(&parts, spilled)
+	if err != nil {
+		return nil, err
+	}
+	return &parts, nil
+}
+
+func newMultipartReader(r io.Reader, contentType string) (*multipart.Reader, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		zap.L().Error("", zap.Error(err))
+		return nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/form-data") {
+		zap.L().Error("unexpected media type", zap.String("content-type", mediaType))
+		return nil, ContentTypeError{ContentType: mediaType}
+	}
+	zap.L().Debug("parsed media type", zap.String("media-type", mediaType), zap.Any("params", params))
+
+	boundary, ok := params["boundary"]
+	if !ok {
+		zap.L().Error("missing boundary")
+		return nil, ErrMissingBoundary
+	}
+	return multipart.NewReader(r, boundary), nil
+}
+
+// readIndexPart reads the content of the part p from r.
+func readIndexPart(r io.Reader, p *multipart.Part, parts *IndexParts) error {
+	pName := p.FormName()
+	zap.L().Debug("read part", zap.String("name", pName))
+	switch pName {
+	case "id":
+		id, err := ioutil.ReadAll(r)
+		if err != nil {
+			zap.L().Error("unexpected error when reading id part", zap.Error(err))
+			return err
+		}
+		parts.ID = strings.TrimSpace(string(id))
+	case "metadata":
+		dec := json.NewDecoder(r)
+		err := dec.Decode(&parts.Metadata)
+		if err != nil {
+			zap.L().Error("unexpected error when decoding metadata part", zap.Error(err))
+			return err
 		}
+		// The decoder stops at the end of the value, so the rest of the part
+		// is read for the reader to fail if the part is over its limit.
+		_, err = io.Copy(ioutil.Discard, r)
+		if err != nil {
+			zap.L().Error("unexpected error when reading metadata part", zap.Error(err))
+			return err
+		}
+	case "object":
+		var err error
+		parts.ObjectContentType = p.Header.Get("Content-Type")
+		parts.ObjectFilename = SanitizeFilename(p.FileName())
+		parts.Object, err = ioutil.ReadAll(r)
+		if err != nil {
+			zap.L().Error("unexpected error when reading object content", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+// limitPart fails reads of a part once more than limit bytes have been read.
+func limitPart(p *multipart.Part, name string, limit int64) io.Reader {
+	if limit <= 0 {
+		return p
+	}
+	return &partLimitedReader{r: p, name: name, limit: limit}
+}
+
+type partLimitedReader struct {
+	r     io.Reader
+	name  string
+	limit int64
+	n     int64
+}
+
+func (r *partLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.limit {
+		return n, PartTooLargeErr{Name: r.name, Limit: r.limit}
+	}
+	return n, err
+}
+
+// spillPart copies a part to a temporary file, which the caller must remove.
+func spillPart(p io.Reader) (*os.File, error) {
+	f, err := ioutil.TempFile("", "sakuin-object-*")
+	if err != nil {
+		zap.L().Error("unable to create temporary file for object", zap.Error(err))
+		return nil, err
+	}
+
+	_, err = io.Copy(f, p)
+	if err != nil {
+		zap.L().Error("unexpected error when spilling object content", zap.Error(err))
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// SanitizeFilename strips any directories from a client supplied filename,
+// whichever path separator they use, so it can't be used to traverse
+// paths when the object is downloaded.
+func SanitizeFilename(filename string) string {
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+	filename = strings.TrimSpace(filename)
+	if filename == "." || filename == ".." {
+		return ""
 	}
+	return filename
 }
@@ -3,9 +3,12 @@ package sakuin
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"mime/multipart"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -260,11 +263,271 @@ func TestReadParts(t *testing.T) {
 	})
 }
 
+func TestReadIndexParts(t *testing.T) {
+	t.Run("should read the id part", func(subT *testing.T) {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		if err := w.WriteField("id", "my-id"); err != nil {
+			subT.Error(err)
+			return
+		}
+
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"`},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("test object content"))
+
+		w.Close()
+
+		parts, err := ReadIndexParts(&b, w.FormDataContentType())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.Equal(subT, "my-id", parts.ID)
+		assert.Equal(subT, []byte("test object content"), parts.Object)
+		assert.Nil(subT, parts.Metadata)
+	})
+
+	t.Run("should read the object content type", func(subT *testing.T) {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"`},
+			"Content-Type":        {"image/png"},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("test object content"))
+
+		w.Close()
+
+		parts, err := ReadIndexParts(&b, w.FormDataContentType())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.Equal(subT, "image/png", parts.ObjectContentType)
+	})
+
+	t.Run("should read the object filename without directories", func(subT *testing.T) {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		ow, err := w.CreatePart(map[string][]string{
+			"Content-Disposition": {`form-data; name="object"; filename="C:\\Users\\test\\invoice.pdf"`},
+		})
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		ow.Write([]byte("test object content"))
+
+		w.Close()
+
+		parts, err := ReadIndexParts(&b, w.FormDataContentType())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.Equal(subT, "invoice.pdf", parts.ObjectFilename)
+	})
+}
+
+func TestStreamIndexParts(t *testing.T) {
+	t.Run("should stream the object straight from the body if metadata precedes it", func(subT *testing.T) {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		if err := w.WriteField("metadata", `{"name": "test"}`); err != nil {
+			subT.Error(err)
+			return
+		}
+		if err := w.WriteField("object", "test object content"); err != nil {
+			subT.Error(err)
+			return
+		}
+		w.Close()
+
+		var object []byte
+		parts, err := StreamIndexParts(&b, w.FormDataContentType(), PartLimits{}, func(parts *IndexParts, r io.Reader) error {
+			_, ok := r.(*multipart.Part)
+			assert.True(subT, ok, "expected the object part itself")
+			assert.JSONEq(subT, `{"name": "test"}`, string(parts.Metadata))
+
+			var err error
+			object, err = ioutil.ReadAll(r)
+			return err
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Nil(subT, parts.Object)
+		assert.Equal(subT, []byte("test object content"), object)
+	})
+
+	t.Run("should spill the object to a temporary file if metadata follows it", func(subT *testing.T) {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		if err := w.WriteField("object", "test object content"); err != nil {
+			subT.Error(err)
+			return
+		}
+		if err := w.WriteField("metadata", `{"name": "test"}`); err != nil {
+			subT.Error(err)
+			return
+		}
+		w.Close()
+
+		var spilled string
+		var object []byte
+		_, err := StreamIndexParts(&b, w.FormDataContentType(), PartLimits{}, func(parts *IndexParts, r io.Reader) error {
+			f, ok := r.(*os.File)
+			if !assert.True(subT, ok, "expected a temporary file") {
+				return nil
+			}
+			spilled = f.Name()
+			assert.JSONEq(subT, `{"name": "test"}`, string(parts.Metadata))
+
+			var err error
+			object, err = ioutil.ReadAll(r)
+			return err
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("test object content"), object)
+
+		_, err = os.Stat(spilled)
+		assert.True(subT, os.IsNotExist(err), "expected the temporary file to be removed")
+	})
+
+	t.Run("should not index without an object part", func(subT *testing.T) {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		if err := w.WriteField("metadata", `{"name": "test"}`); err != nil {
+			subT.Error(err)
+			return
+		}
+		w.Close()
+
+		_, err := StreamIndexParts(&b, w.FormDataContentType(), PartLimits{}, func(parts *IndexParts, r io.Reader) error {
+			subT.Error("expected index not to be called")
+			return nil
+		})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should fail with PartTooLargeErr if a part is over its limit", func(subT *testing.T) {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		if err := w.WriteField("metadata", `{"name": "test"}`); err != nil {
+			subT.Error(err)
+			return
+		}
+		if err := w.WriteField("object", "test object content"); err != nil {
+			subT.Error(err)
+			return
+		}
+		w.Close()
+
+		_, err := StreamIndexParts(&b, w.FormDataContentType(), PartLimits{Object: 4}, func(parts *IndexParts, r io.Reader) error {
+			_, err := ioutil.ReadAll(r)
+			return err
+		})
+
+		var partErr PartTooLargeErr
+		if !assert.ErrorAs(subT, err, &partErr) {
+			return
+		}
+		assert.Equal(subT, PartTooLargeErr{Name: "object", Limit: 4}, partErr)
+	})
+
+	t.Run("should return the error from index", func(subT *testing.T) {
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		if err := w.WriteField("object", "test object content"); err != nil {
+			subT.Error(err)
+			return
+		}
+		w.Close()
+
+		indexErr := errors.New("index failed")
+		_, err := StreamIndexParts(&b, w.FormDataContentType(), PartLimits{}, func(parts *IndexParts, r io.Reader) error {
+			return indexErr
+		})
+		assert.Equal(subT, indexErr, err)
+	})
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	t.Run("should strip directories", func(subT *testing.T) {
+		assert.Equal(subT, "invoice.pdf", SanitizeFilename("../../etc/invoice.pdf"))
+		assert.Equal(subT, "invoice.pdf", SanitizeFilename(`..\invoice.pdf`))
+	})
+
+	t.Run("should reject relative directory names", func(subT *testing.T) {
+		assert.Empty(subT, SanitizeFilename("reports/.."))
+		assert.Empty(subT, SanitizeFilename("."))
+	})
+
+	t.Run("should keep plain filenames", func(subT *testing.T) {
+		assert.Equal(subT, "my report.pdf", SanitizeFilename("my report.pdf"))
+	})
+}
+
 // BenchmarkReadParts
 // metadata has 3 fields
 // object size is 10MB
 //
 func BenchmarkReadParts(b *testing.B) {
+	body, contentType, err := newBenchmarkIndexBody()
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	r := bytes.NewReader(body)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, err := ReadParts(r, contentType)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		r.Seek(0, io.SeekStart)
+	}
+}
+
+// BenchmarkStreamIndexParts is BenchmarkReadParts with the object
+// streamed rather than read into memory, for comparing allocations.
+func BenchmarkStreamIndexParts(b *testing.B) {
+	body, contentType, err := newBenchmarkIndexBody()
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	r := bytes.NewReader(body)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := StreamIndexParts(r, contentType, PartLimits{}, func(parts *IndexParts, object io.Reader) error {
+			_, err := io.Copy(ioutil.Discard, object)
+			return err
+		})
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		r.Seek(0, io.SeekStart)
+	}
+}
+
+func newBenchmarkIndexBody() ([]byte, string, error) {
 	testMetadata := map[string]interface{}{
 		"name":  "test",
 		"id":    "test",
@@ -274,8 +537,7 @@ func BenchmarkReadParts(b *testing.B) {
 	testObject := make([]byte, 10000000)
 	_, err := rand.Read(testObject)
 	if err != nil {
-		b.Error(err)
-		return
+		return nil, "", err
 	}
 
 	var buf bytes.Buffer
@@ -285,13 +547,11 @@ func BenchmarkReadParts(b *testing.B) {
 		"Content-Type":        {"application/json"},
 	})
 	if err != nil {
-		b.Error(err)
-		return
+		return nil, "", err
 	}
 	enc := json.NewEncoder(mw)
 	if err = enc.Encode(testMetadata); err != nil {
-		b.Error(err)
-		return
+		return nil, "", err
 	}
 
 	ow, err := w.CreatePart(map[string][]string{
@@ -299,22 +559,11 @@ func BenchmarkReadParts(b *testing.B) {
 		"Content-Type":        {"application/octet-stream"},
 	})
 	if err != nil {
-		b.Error(err)
-		return
+		return nil, "", err
 	}
 	ow.Write(testObject)
 
 	w.Close()
 
-	r := bytes.NewReader(buf.Bytes())
-	contentType := w.FormDataContentType()
-
-	for i := 0; i < b.N; i++ {
-		_, _, err := ReadParts(r, contentType)
-		if err != nil {
-			b.Error(err)
-			return
-		}
-		r.Seek(0, io.SeekStart)
-	}
+	return buf.Bytes(), w.FormDataContentType(), nil
 }
@@ -0,0 +1,190 @@
+// Package badger provides an ObjectStore backed by a Badger database.
+package badger
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// keyPrefix is prepended to every id, which keeps objects apart from
+// anything else in a shared database.
+const keyPrefix = "sakuin/objects/"
+
+// ObjectStore stores objects as values in a Badger database.
+//
+// Badger transactions are optimistic, so Updates and Deletes, which read
+// the object before writing it, are retried when they conflict with a
+// concurrent write of the same id.
+//
+// Badger limits the size of a single transaction by its memtable size,
+// so with the default options objects can't be much larger than 10MB.
+// In memory databases also can't hold objects larger than their
+// ValueThreshold, which is 1MB by default.
+type ObjectStore struct {
+	db     *badger.DB
+	closer func() error
+}
+
+// New opens a Badger database with opts and returns an ObjectStore
+// backed by it. Close closes the database.
+func New(opts badger.Options) (*ObjectStore, error) {
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectStore{db: db, closer: db.Close}, nil
+}
+
+// NewWithDB returns an ObjectStore backed by an already open database,
+// which the caller remains responsible for closing.
+func NewWithDB(db *badger.DB) *ObjectStore {
+	return &ObjectStore{db: db, closer: func() error { return nil }}
+}
+
+// Close closes the database if it was opened by New.
+func (s *ObjectStore) Close() error {
+	return s.closer()
+}
+
+func key(id string) []byte {
+	return []byte(keyPrefix + id)
+}
+
+// Stat reads the object to find its size, since Badger only estimates
+// the size of values it keeps outside of its LSM tree.
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	info := &sakuin.StatInfo{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key(id))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			info = &sakuin.StatInfo{Exists: true, Size: len(v)}
+			return nil
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	var b []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key(id))
+		if err != nil {
+			return err
+		}
+		b, err = item.ValueCopy(nil)
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.PutWithTTL(ctx, id, b, 0)
+}
+
+// PutWithTTL stores the object, which Badger expires once ttl has passed.
+// A ttl of zero or less never expires.
+func (s *ObjectStore) PutWithTTL(ctx context.Context, id string, b []byte, ttl time.Duration) error {
+	e := badger.NewEntry(key(id), b)
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
+	}
+	return s.update(func(txn *badger.Txn) error {
+		return txn.SetEntry(e)
+	})
+}
+
+// Update keeps any TTL the object was put with.
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	err := s.update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key(id))
+		if err != nil {
+			return err
+		}
+		e := badger.NewEntry(key(id), b)
+		e.ExpiresAt = item.ExpiresAt()
+		return txn.SetEntry(e)
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return err
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	err := s.update(func(txn *badger.Txn) error {
+		_, err := txn.Get(key(id))
+		if err != nil {
+			return err
+		}
+		return txn.Delete(key(id))
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return err
+}
+
+// update runs f in a read-write transaction, retrying it for as long
+// as it conflicts with another transaction.
+func (s *ObjectStore) update(f func(*badger.Txn) error) error {
+	for {
+		err := s.db.Update(f)
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+	}
+}
+
+// List iterates over keys alone, without reading any objects.
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	var ids []string
+	var next string
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = key(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		start := key(prefix)
+		if cursor > prefix {
+			start = key(cursor)
+		}
+		for it.Seek(start); it.Valid(); it.Next() {
+			id := string(it.Item().Key()[len(keyPrefix):])
+			if cursor != "" && id == cursor {
+				continue
+			}
+			if limit > 0 && len(ids) == limit {
+				next = ids[len(ids)-1]
+				return nil
+			}
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return ids, next, nil
+}
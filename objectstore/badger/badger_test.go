@@ -0,0 +1,181 @@
+package badger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(t testing.TB) *ObjectStore {
+	s, err := New(badger.DefaultOptions(t.TempDir()).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), newStore(t))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), newStore(t))
+
+	t.Run("should keep objects once reopened", func(subT *testing.T) {
+		opts := badger.DefaultOptions(subT.TempDir()).WithLogger(nil)
+		s, err := New(opts)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Close()
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		s, err = New(opts)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer s.Close()
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+	})
+
+	t.Run("should leave an existing database open on close", func(subT *testing.T) {
+		db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer db.Close()
+
+		err = NewWithDB(db).Close()
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, db.IsClosed())
+	})
+
+	t.Run("should expire objects put with a ttl", func(subT *testing.T) {
+		s := newStore(subT)
+
+		err := s.PutWithTTL(context.Background(), "test", []byte("content"), time.Second)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+
+		// Badger expires entries with a granularity of a second.
+		time.Sleep(2 * time.Second)
+
+		var objErr sakuin.ObjectDoesNotExistErr
+		_, err = s.Get(context.Background(), "test")
+		assert.ErrorAs(subT, err, &objErr)
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, stats.Exists)
+	})
+
+	t.Run("should keep the ttl of updated objects", func(subT *testing.T) {
+		s := newStore(subT)
+
+		err := s.PutWithTTL(context.Background(), "test", []byte("content"), time.Hour)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Update(context.Background(), "test", []byte("updated"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.db.View(func(txn *badger.Txn) error {
+			item, err := txn.Get(key("test"))
+			if err != nil {
+				return err
+			}
+			assert.NotZero(subT, item.ExpiresAt())
+			return nil
+		})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should report the exact size of large objects", func(subT *testing.T) {
+		s := newStore(subT)
+		obj := make([]byte, 2<<20)
+
+		err := s.Put(context.Background(), "test", obj)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: len(obj)}, stats)
+	})
+}
+
+// BenchmarkObjectStore1MB puts and gets 1MB objects, comparing the
+// store with the InMemoryObjectStore.
+func BenchmarkObjectStore1MB(b *testing.B) {
+	ctx := context.Background()
+	obj := make([]byte, 1<<20)
+
+	stores := []struct {
+		Name  string
+		Store sakuin.ObjectStore
+	}{
+		{Name: "badger", Store: newStore(b)},
+		{Name: "memory", Store: sakuin.NewInMemoryObjectStore()},
+	}
+	for _, store := range stores {
+		s := store.Store
+
+		b.Run(store.Name+"/Put", func(b *testing.B) {
+			b.SetBytes(int64(len(obj)))
+			for i := 0; i < b.N; i++ {
+				err := s.Put(ctx, "bench", obj)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(store.Name+"/Get", func(b *testing.B) {
+			err := s.Put(ctx, "bench", obj)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(int64(len(obj)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := s.Get(ctx, "bench")
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Package bolt provides an ObjectStore which keeps every object in a
+// single bbolt database file.
+package bolt
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/z5labs/sakuin"
+
+	bbolt "go.etcd.io/bbolt"
+)
+
+// bucket holds every object, keyed by id.
+var bucket = []byte("objects")
+
+// ObjectStore stores objects in a single bucket of a bbolt database.
+//
+// bbolt allows any number of concurrent readers but only one writer at a
+// time, and every write is its own transaction which is synced to disk
+// before it returns. Puts, Updates and Deletes are therefore serialized
+// and bounded by the latency of an fsync, while reads never block each
+// other or wait on writes. Update and Delete check the object exists in
+// the same transaction as they write, so they can't race with a
+// concurrent Delete.
+//
+// bbolt locks the database file, so it can only be opened by one process,
+// or one ObjectStore, at a time.
+type ObjectStore struct {
+	db *bbolt.DB
+}
+
+// New opens, or creates, the bbolt database at path and returns an
+// ObjectStore backed by it. opts may be nil for bbolt's defaults.
+// The store should be closed once it's no longer needed.
+func New(path string, opts *bbolt.Options) (*ObjectStore, error) {
+	db, err := bbolt.Open(path, 0o600, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &ObjectStore{db: db}, nil
+}
+
+// Close closes the underlying database, waiting for any open
+// transactions to finish.
+func (s *ObjectStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	var info sakuin.StatInfo
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(bucket).Get([]byte(id))
+		info = sakuin.StatInfo{Exists: v != nil, Size: len(v)}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	var b []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(bucket).Get([]byte(id))
+		if v == nil {
+			return sakuin.ObjectDoesNotExistErr{ID: id}
+		}
+		// v is only valid for the life of the transaction.
+		b = append([]byte{}, v...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(id), b)
+	})
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(bucket)
+		if bkt.Get([]byte(id)) == nil {
+			return sakuin.ObjectDoesNotExistErr{ID: id}
+		}
+		return bkt.Put([]byte(id), b)
+	})
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(bucket)
+		if bkt.Get([]byte(id)) == nil {
+			return sakuin.ObjectDoesNotExistErr{ID: id}
+		}
+		return bkt.Delete([]byte(id))
+	})
+}
+
+// List seeks straight to the first id after the cursor, since bbolt
+// keeps keys in byte order.
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	start := []byte(prefix)
+	if cursor > prefix {
+		start = []byte(cursor)
+	}
+
+	var ids []string
+	var next string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, _ := c.Seek(start); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			if cursor != "" && string(k) == cursor {
+				continue
+			}
+			if limit > 0 && len(ids) == limit {
+				next = ids[len(ids)-1]
+				return nil
+			}
+			ids = append(ids, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return ids, next, nil
+}
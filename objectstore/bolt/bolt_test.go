@@ -0,0 +1,105 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(t testing.TB) *ObjectStore {
+	s, err := New(filepath.Join(t.TempDir(), "sakuin.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), newStore(t))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), newStore(t))
+
+	t.Run("should keep objects once reopened", func(subT *testing.T) {
+		path := filepath.Join(subT.TempDir(), "sakuin.db")
+		s, err := New(path, nil)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Close()
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		s, err = New(path, nil)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer s.Close()
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+	})
+
+	t.Run("should report the size of stored objects", func(subT *testing.T) {
+		s := newStore(subT)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: len("content")}, stats)
+	})
+
+	t.Run("should only list ids with the prefix", func(subT *testing.T) {
+		s := newStore(subT)
+
+		for _, id := range []string{"a", "b/1", "b/2", "b/3", "c"} {
+			err := s.Put(context.Background(), id, []byte(id))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		ids, next, err := s.List(context.Background(), "b/", "", 2)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"b/1", "b/2"}, ids)
+		assert.Equal(subT, "b/2", next)
+
+		ids, next, err = s.List(context.Background(), "b/", next, 2)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"b/3"}, ids)
+		assert.Equal(subT, "", next)
+	})
+}
+
+// BenchmarkObjectStore compares the store with the InMemoryObjectStore.
+func BenchmarkObjectStore(b *testing.B) {
+	b.Run("bolt", func(b *testing.B) {
+		storagetest.RunObjectStorageBenchmarks(b, newStore(b))
+	})
+	b.Run("memory", func(b *testing.B) {
+		storagetest.RunObjectStorageBenchmarks(b, sakuin.NewInMemoryObjectStore())
+	})
+}
@@ -0,0 +1,199 @@
+// Package cache provides an ObjectStore which caches the objects
+// of another ObjectStore in memory.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/z5labs/sakuin"
+)
+
+// CacheOptions bounds how much is cached. Zero values mean no bound.
+type CacheOptions struct {
+	// MaxEntries is the maximum number of cached objects.
+	MaxEntries int
+
+	// MaxBytes is the maximum total size of the cached objects.
+	// Objects larger than this are never cached.
+	MaxBytes int64
+
+	// TTL is how long an object stays cached after being read.
+	TTL time.Duration
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// CacheStats counts how the cache has been used.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Entries   int
+	Bytes     int64
+}
+
+// ObjectStore caches objects read from the inner store, evicting the
+// least recently used objects once either bound is reached.
+//
+// Put, Update and Delete always go to the inner store and drop the
+// object from the cache. Objects read while one of them is in flight
+// aren't cached, so the cache never holds an object which has since
+// been replaced. Stat is answered from the cache when possible.
+type ObjectStore struct {
+	inner sakuin.ObjectStore
+	opts  CacheOptions
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	bytes   int64
+	writes  uint64
+	stats   CacheStats
+}
+
+type entry struct {
+	id        string
+	obj       []byte
+	expiresAt time.Time
+}
+
+// NewCached returns an ObjectStore caching the objects of inner.
+func NewCached(inner sakuin.ObjectStore, opts CacheOptions) *ObjectStore {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &ObjectStore{
+		inner:   inner,
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Stats returns how the cache has been used so far.
+func (s *ObjectStore) Stats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Entries = s.lru.Len()
+	stats.Bytes = s.bytes
+	return stats
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	s.mu.Lock()
+	e, ok := s.lookup(id)
+	s.mu.Unlock()
+	if ok {
+		return &sakuin.StatInfo{Exists: true, Size: len(e.obj)}, nil
+	}
+	return s.inner.Stat(ctx, id)
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	e, ok := s.lookup(id)
+	if ok {
+		s.stats.Hits++
+		s.mu.Unlock()
+		return copyBytes(e.obj), nil
+	}
+	s.stats.Misses++
+	writes := s.writes
+	s.mu.Unlock()
+
+	obj, err := s.inner.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.writes == writes {
+		s.add(id, copyBytes(obj))
+	}
+	s.mu.Unlock()
+	return obj, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	defer s.invalidate(id)
+	return s.inner.Put(ctx, id, b)
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	defer s.invalidate(id)
+	return s.inner.Update(ctx, id, b)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	defer s.invalidate(id)
+	return s.inner.Delete(ctx, id)
+}
+
+// invalidate drops the object from the cache once the inner store has been written to.
+// It also stops any reads which started before then from caching what they read.
+func (s *ObjectStore) invalidate(id string) {
+	s.mu.Lock()
+	s.writes++
+	if el, ok := s.entries[id]; ok {
+		s.remove(el)
+	}
+	s.mu.Unlock()
+}
+
+// lookup must be called with the lock held.
+func (s *ObjectStore) lookup(id string) (*entry, bool) {
+	el, ok := s.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if s.opts.TTL > 0 && !s.opts.Now().Before(e.expiresAt) {
+		s.remove(el)
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return e, true
+}
+
+// add must be called with the lock held.
+func (s *ObjectStore) add(id string, obj []byte) {
+	size := int64(len(obj))
+	if s.opts.MaxBytes > 0 && size > s.opts.MaxBytes {
+		return
+	}
+	if el, ok := s.entries[id]; ok {
+		s.remove(el)
+	}
+
+	e := &entry{id: id, obj: obj}
+	if s.opts.TTL > 0 {
+		e.expiresAt = s.opts.Now().Add(s.opts.TTL)
+	}
+	s.entries[id] = s.lru.PushFront(e)
+	s.bytes += size
+
+	for (s.opts.MaxEntries > 0 && s.lru.Len() > s.opts.MaxEntries) || (s.opts.MaxBytes > 0 && s.bytes > s.opts.MaxBytes) {
+		s.remove(s.lru.Back())
+		s.stats.Evictions++
+	}
+}
+
+// remove must be called with the lock held.
+func (s *ObjectStore) remove(el *list.Element) {
+	e := s.lru.Remove(el).(*entry)
+	delete(s.entries, e.id)
+	s.bytes -= int64(len(e.obj))
+}
+
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingObjectStore counts the calls which reach the inner store.
+type countingObjectStore struct {
+	*sakuin.InMemoryObjectStore
+	gets  int32
+	stats int32
+}
+
+func (s *countingObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	atomic.AddInt32(&s.gets, 1)
+	return s.InMemoryObjectStore.Get(ctx, id)
+}
+
+func (s *countingObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	atomic.AddInt32(&s.stats, 1)
+	return s.InMemoryObjectStore.Stat(ctx, id)
+}
+
+// blockingObjectStore blocks Gets until they're released.
+type blockingObjectStore struct {
+	*sakuin.InMemoryObjectStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.InMemoryObjectStore.Get(ctx, id)
+	s.started <- struct{}{}
+	<-s.release
+	return b, err
+}
+
+func TestCachedObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), NewCached(sakuin.NewInMemoryObjectStore(), CacheOptions{}))
+
+	t.Run("should serve repeated reads from the cache", func(subT *testing.T) {
+		inner := &countingObjectStore{InMemoryObjectStore: sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))}
+		s := NewCached(inner, CacheOptions{})
+
+		for i := 0; i < 3; i++ {
+			b, err := s.Get(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, []byte("content"), b)
+		}
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: len("content")}, stats)
+
+		assert.Equal(subT, int32(1), inner.gets)
+		assert.Equal(subT, int32(0), inner.stats)
+		assert.Equal(subT, CacheStats{Hits: 2, Misses: 1, Entries: 1, Bytes: int64(len("content"))}, s.Stats())
+	})
+
+	t.Run("should not let callers modify cached objects", func(subT *testing.T) {
+		s := NewCached(sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content")), CacheOptions{})
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		b[0] = 'C'
+
+		b, err = s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+	})
+
+	writes := map[string]func(s *ObjectStore) error{
+		"put": func(s *ObjectStore) error {
+			return s.Put(context.Background(), "test", []byte("new content"))
+		},
+		"update": func(s *ObjectStore) error {
+			return s.Update(context.Background(), "test", []byte("new content"))
+		},
+		"delete": func(s *ObjectStore) error {
+			return s.Delete(context.Background(), "test")
+		},
+	}
+	for name, write := range writes {
+		write := write
+		t.Run("should invalidate the cached object on "+name, func(subT *testing.T) {
+			inner := sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))
+			s := NewCached(inner, CacheOptions{})
+
+			_, err := s.Get(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			err = write(s)
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			want, wantErr := inner.Get(context.Background(), "test")
+			got, err := s.Get(context.Background(), "test")
+			assert.Equal(subT, wantErr, err)
+			assert.Equal(subT, want, got)
+		})
+	}
+
+	t.Run("should evict the least recently used objects", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryObjectStore()
+		for _, id := range []string{"a", "b", "c"} {
+			inner.WithObject(id, []byte("12345"))
+		}
+		s := NewCached(inner, CacheOptions{MaxEntries: 2, MaxBytes: 10})
+
+		for _, id := range []string{"a", "b", "a", "c"} {
+			_, err := s.Get(context.Background(), id)
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		stats := s.Stats()
+		assert.Equal(subT, int64(1), stats.Evictions)
+		assert.Equal(subT, 2, stats.Entries)
+		assert.Contains(subT, s.entries, "a")
+		assert.Contains(subT, s.entries, "c")
+	})
+
+	t.Run("should not cache objects larger than the byte limit", func(subT *testing.T) {
+		s := NewCached(sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content")), CacheOptions{MaxBytes: 3})
+
+		_, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 0, s.Stats().Entries)
+	})
+
+	t.Run("should expire cached objects after the ttl", func(subT *testing.T) {
+		now := time.Now()
+		inner := &countingObjectStore{InMemoryObjectStore: sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))}
+		s := NewCached(inner, CacheOptions{
+			TTL: time.Minute,
+			Now: func() time.Time { return now },
+		})
+
+		_, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		now = now.Add(time.Minute)
+		_, err = s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, int32(2), inner.gets)
+	})
+
+	t.Run("should not cache an object replaced while it was being read", func(subT *testing.T) {
+		inner := &blockingObjectStore{
+			InMemoryObjectStore: sakuin.NewInMemoryObjectStore().WithObject("test", []byte("old")),
+			started:             make(chan struct{}),
+			release:             make(chan struct{}),
+		}
+		s := NewCached(inner, CacheOptions{})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.Get(context.Background(), "test")
+		}()
+		<-inner.started
+
+		err := s.Update(context.Background(), "test", []byte("new"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		close(inner.release)
+		<-done
+
+		go func() {
+			for range inner.started {
+			}
+		}()
+		b, err := s.Get(context.Background(), "test")
+		close(inner.started)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("new"), b)
+	})
+
+	t.Run("should always read the latest write under concurrent access", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryObjectStore().WithObject("test", []byte("0"))
+		s := NewCached(inner, CacheOptions{MaxEntries: 1})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					s.Get(context.Background(), "test")
+				}
+			}()
+		}
+		for i := 1; i <= 100; i++ {
+			err := s.Update(context.Background(), "test", []byte(fmt.Sprint(i)))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+		wg.Wait()
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("100"), b)
+	})
+}
+
+// slowObjectStore simulates the latency of a remote store.
+type slowObjectStore struct {
+	*sakuin.InMemoryObjectStore
+}
+
+func (s slowObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	time.Sleep(100 * time.Microsecond)
+	return s.InMemoryObjectStore.Get(ctx, id)
+}
+
+func BenchmarkGet(b *testing.B) {
+	stores := map[string]func(sakuin.ObjectStore) sakuin.ObjectStore{
+		"uncached": func(inner sakuin.ObjectStore) sakuin.ObjectStore {
+			return inner
+		},
+		"cached": func(inner sakuin.ObjectStore) sakuin.ObjectStore {
+			return NewCached(inner, CacheOptions{})
+		},
+	}
+
+	for name, wrap := range stores {
+		wrap := wrap
+		b.Run(name, func(b *testing.B) {
+			s := wrap(slowObjectStore{sakuin.NewInMemoryObjectStore().WithObject("test", make([]byte, 1<<10))})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := s.Get(context.Background(), "test")
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package compressed provides an ObjectStore which compresses the objects
+// it writes to another ObjectStore.
+package compressed
+
+import (
+	"context"
+
+	"github.com/z5labs/sakuin"
+)
+
+// Options configures how objects are compressed.
+type Options struct {
+	// Compression is the algorithm objects are written with.
+	// Objects are written as they are when it's sakuin.CompressionNone.
+	Compression sakuin.Compression
+
+	// MinSavings is the percentage, from 0 to 100, by which compression
+	// must shrink an object for it to be stored compressed. Objects which
+	// don't shrink enough, such as images, are stored as they are.
+	MinSavings int
+}
+
+// ObjectStore compresses objects on Put and Update and decompresses them
+// on Get. Objects are stored in the same format as with
+// sakuin.Config.CompressObjects: a header marking them as compressed,
+// ending in a byte identifying the algorithm, followed by the compressed
+// bytes. Objects without the header are read back as they were stored,
+// so objects written before the wrapper was introduced, with compression
+// disabled or skipped as incompressible, stay readable.
+//
+// Stat reports the size of the stored, possibly compressed, object.
+type ObjectStore struct {
+	inner sakuin.ObjectStore
+	opts  Options
+}
+
+// New returns an ObjectStore compressing the objects written to inner.
+// Writes fail with a sakuin.UnsupportedCompressionErr if the compression
+// isn't known.
+func New(inner sakuin.ObjectStore, opts Options) *ObjectStore {
+	return &ObjectStore{inner: inner, opts: opts}
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	return s.inner.Stat(ctx, id)
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.inner.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return sakuin.DecompressObject(b)
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	b, err := sakuin.CompressObject(s.opts.Compression, b, s.opts.MinSavings)
+	if err != nil {
+		return err
+	}
+	return s.inner.Put(ctx, id, b)
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	b, err := sakuin.CompressObject(s.opts.Compression, b, s.opts.MinSavings)
+	if err != nil {
+		return err
+	}
+	return s.inner.Update(ctx, id, b)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	return s.inner.Delete(ctx, id)
+}
@@ -0,0 +1,157 @@
+package compressed
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// textObject is representative of the text objects which are commonly stored.
+var textObject = []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 1<<10))
+
+func TestObjectStore(t *testing.T) {
+	for _, compression := range []sakuin.Compression{sakuin.CompressionNone, sakuin.CompressionGzip, sakuin.CompressionZstd} {
+		sakuin.RunObjectStorageTests(storagetest.Lift(t), New(sakuin.NewInMemoryObjectStore(), Options{Compression: compression}))
+	}
+
+	for _, compression := range []sakuin.Compression{sakuin.CompressionGzip, sakuin.CompressionZstd} {
+		c := compression
+		t.Run("should store text compressed with "+string(c), func(subT *testing.T) {
+			inner := sakuin.NewInMemoryObjectStore()
+			s := New(inner, Options{Compression: c})
+
+			err := s.Put(context.Background(), "test", textObject)
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			stored, err := inner.Get(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Less(subT, len(stored), len(textObject))
+
+			b, err := s.Get(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, textObject, b)
+		})
+	}
+
+	t.Run("should read objects stored before compression was enabled", func(subT *testing.T) {
+		s := New(sakuin.NewInMemoryObjectStore().WithObject("test", textObject), Options{Compression: sakuin.CompressionZstd})
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, textObject, b)
+	})
+
+	t.Run("should read compressed objects after compression was disabled", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryObjectStore()
+		err := New(inner, Options{Compression: sakuin.CompressionGzip}).Put(context.Background(), "test", textObject)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := New(inner, Options{}).Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, textObject, b)
+	})
+
+	t.Run("should store objects raw if compression doesn't save enough", func(subT *testing.T) {
+		random := make([]byte, 1<<10)
+		_, err := rand.Read(random)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		testCases := map[string]struct {
+			Object     []byte
+			MinSavings int
+		}{
+			"incompressible": {Object: random},
+			"below minimum":  {Object: textObject, MinSavings: 100},
+		}
+		for name, testCase := range testCases {
+			tc := testCase
+			subT.Run(name, func(subT *testing.T) {
+				inner := sakuin.NewInMemoryObjectStore()
+				s := New(inner, Options{Compression: sakuin.CompressionGzip, MinSavings: tc.MinSavings})
+
+				err := s.Put(context.Background(), "test", tc.Object)
+				if !assert.Nil(subT, err) {
+					return
+				}
+
+				stored, err := inner.Get(context.Background(), "test")
+				if !assert.Nil(subT, err) {
+					return
+				}
+				assert.Equal(subT, tc.Object, stored)
+			})
+		}
+	})
+
+	t.Run("should fail with UnsupportedCompressionErr for unknown compressions", func(subT *testing.T) {
+		s := New(sakuin.NewInMemoryObjectStore(), Options{Compression: "lz4"})
+
+		err := s.Put(context.Background(), "test", textObject)
+
+		var cerr sakuin.UnsupportedCompressionErr
+		assert.ErrorAs(subT, err, &cerr)
+	})
+}
+
+// BenchmarkPut writes a text object with each compression, reporting
+// how many bytes the store had to hold for it.
+func BenchmarkPut(b *testing.B) {
+	for _, compression := range []sakuin.Compression{sakuin.CompressionNone, sakuin.CompressionGzip, sakuin.CompressionZstd} {
+		c := compression
+		name := string(c)
+		if c == sakuin.CompressionNone {
+			name = "none"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			inner := sakuin.NewInMemoryObjectStore()
+			s := New(inner, Options{Compression: c})
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(textObject)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := s.Put(context.Background(), "test", textObject)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+			}
+			b.StopTimer()
+
+			stored, err := inner.Get(context.Background(), "test")
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			b.ReportMetric(float64(len(stored)), "stored-bytes")
+			b.ReportMetric(100*(1-float64(len(stored))/float64(len(textObject))), "%saved")
+
+			got, err := s.Get(context.Background(), "test")
+			if err != nil || !bytes.Equal(textObject, got) {
+				b.Error("object was corrupted")
+			}
+		})
+	}
+}
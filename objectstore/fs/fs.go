@@ -0,0 +1,183 @@
+// Package fs provides an ObjectStore which keeps each object in its own
+// file on the local filesystem.
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	iofs "io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/internal/fsutil"
+
+	"go.uber.org/zap"
+)
+
+// objectExt is appended to the file name of every object,
+// which keeps them apart from in progress temporary files.
+const objectExt = ".obj"
+
+// ObjectStore stores objects as files under a root directory.
+//
+// Objects are laid out as described by fsutil.Path, so ids can never
+// escape the root.
+//
+// Writes go to a temporary file which is then renamed over the object,
+// so readers only ever see complete objects. Update checks the object
+// exists before writing it, so an Update racing with a Delete of the
+// same id may recreate the object.
+type ObjectStore struct {
+	root string
+	log  *zap.Logger
+}
+
+// New returns an ObjectStore rooted at the given directory, creating it if needed.
+func New(root string) (*ObjectStore, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectStore{root: root, log: zap.NewNop()}, nil
+}
+
+// WithLogger sets the logger, which defaults to discarding logs.
+func (s *ObjectStore) WithLogger(log *zap.Logger) *ObjectStore {
+	s.log = log
+	return s
+}
+
+func (s *ObjectStore) path(id string) string {
+	return fsutil.Path(s.root, id, objectExt)
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	info, err := os.Stat(s.path(id))
+	if errors.Is(err, iofs.ErrNotExist) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{Exists: true, Size: int(info.Size()), LastModified: info.ModTime()}, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, iofs.ErrNotExist) {
+		s.log.Warn("unable to find object on disk", zap.String("id", id))
+		return nil, sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.write(id, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	stats, err := s.Stat(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !stats.Exists {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return s.Put(ctx, id, b)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, iofs.ErrNotExist) {
+		s.log.Warn("unable to find object on disk", zap.String("id", id))
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return err
+}
+
+// List walks every directory under the root, so it gets slower as the store grows.
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	all, err := fsutil.IDs(s.root, objectExt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var ids []string
+	for _, id := range all {
+		if strings.HasPrefix(id, prefix) && (cursor == "" || id > cursor) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	if limit <= 0 || len(ids) <= limit {
+		return ids, "", nil
+	}
+	return ids[:limit], ids[limit-1], nil
+}
+
+func (s *ObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.write(id, func(w io.Writer) error {
+		_, err := io.Copy(w, contextReader{ctx: ctx, r: r})
+		return err
+	})
+}
+
+func (s *ObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, iofs.ErrNotExist) {
+		s.log.Warn("unable to find object on disk", zap.String("id", id))
+		return nil, 0, sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	rc := struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: contextReader{ctx: ctx, r: f},
+		Closer: f,
+	}
+	return rc, info.Size(), nil
+}
+
+// contextReader fails reads once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	err := r.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// write atomically replaces the object with whatever is written by f.
+// If f fails, the object is left untouched.
+func (s *ObjectStore) write(id string, f func(io.Writer) error) error {
+	err := fsutil.WriteFile(s.path(id), f)
+	if err != nil {
+		return err
+	}
+	s.log.Debug("successfully stored object on disk", zap.String("id", id))
+	return nil
+}
@@ -0,0 +1,162 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(t *testing.T) *ObjectStore {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), newStore(t))
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), newStore(t))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), newStore(t))
+
+	t.Run("should report the size of stored objects", func(subT *testing.T) {
+		s := newStore(subT)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, stats.Exists)
+		assert.Equal(subT, len("content"), stats.Size)
+		assert.False(subT, stats.LastModified.IsZero())
+	})
+
+	t.Run("should keep ids from escaping the root", func(subT *testing.T) {
+		parent := subT.TempDir()
+		root := filepath.Join(parent, "root")
+		s, err := New(root)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		for _, id := range []string{"../escape", "../../escape", "/etc/escape", "a/../../escape"} {
+			err = s.Put(context.Background(), id, []byte("content"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			b, err := s.Get(context.Background(), id)
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, []byte("content"), b)
+		}
+
+		entries, err := os.ReadDir(parent)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Len(subT, entries, 1) {
+			return
+		}
+
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.Contains(info.Name(), "escape") {
+				return errors.New("id was used as a path: " + path)
+			}
+			return nil
+		})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should store ids too long for a single file name", func(subT *testing.T) {
+		s := newStore(subT)
+		id := strings.Repeat("a", 300)
+
+		err := s.Put(context.Background(), id, []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := s.Get(context.Background(), id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+
+		ids, _, err := s.List(context.Background(), "", "", 10)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{id}, ids)
+
+		err = s.Delete(context.Background(), id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		stats, err := s.Stat(context.Background(), id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, stats.Exists)
+	})
+
+	t.Run("should leave the object untouched if a streamed write fails", func(subT *testing.T) {
+		s := newStore(subT)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.PutStream(context.Background(), "test", errReader{}, -1)
+		if !assert.NotNil(subT, err) {
+			return
+		}
+
+		rc, size, err := s.GetStream(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer rc.Close()
+
+		b, err := ioutil.ReadAll(rc)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+		assert.Equal(subT, int64(len("content")), size)
+	})
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func BenchmarkObjectStore(b *testing.B) {
+	s, err := New(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	storagetest.RunObjectStorageBenchmarks(b, s)
+}
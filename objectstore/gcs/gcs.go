@@ -0,0 +1,174 @@
+// Package gcs provides an ObjectStore which keeps each object in a
+// Google Cloud Storage bucket.
+package gcs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/z5labs/sakuin"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+// Options configures the ObjectStore.
+type Options struct {
+	// Prefix is prepended to the id of every object to form its name,
+	// e.g. "sakuin/objects/", so objects can share a bucket.
+	Prefix string
+}
+
+// ObjectStore stores objects in a bucket, with the id of every object,
+// after an optional prefix, as its name.
+//
+// Update reads the generation of the object and only overwrites that
+// generation, retrying if the object is written in between, so it can't
+// recreate an object deleted by a concurrent Delete.
+type ObjectStore struct {
+	bucket *storage.BucketHandle
+	prefix string
+}
+
+// New returns an ObjectStore which stores objects in the given bucket,
+// which must exist, using client. storage.NewClient points the client at
+// the emulator named by STORAGE_EMULATOR_HOST, e.g. fake-gcs-server, if
+// it's set.
+func New(client *storage.Client, bucket string, opts Options) *ObjectStore {
+	return &ObjectStore{
+		bucket: client.Bucket(bucket),
+		prefix: opts.Prefix,
+	}
+}
+
+func (s *ObjectStore) object(id string) *storage.ObjectHandle {
+	return s.bucket.Object(s.prefix + id)
+}
+
+// Stat leaves CreatedAt unset, since every write creates a new generation
+// of the object, with its own creation time.
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	attrs, err := s.object(id).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &sakuin.StatInfo{
+		Exists:       true,
+		Size:         int(attrs.Size),
+		ContentType:  attrs.ContentType,
+		LastModified: attrs.Updated,
+	}, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	r, err := s.object(id).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return write(ctx, s.object(id), b)
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	for {
+		attrs, err := s.object(id).Attrs(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return sakuin.ObjectDoesNotExistErr{ID: id}
+		}
+		if err != nil {
+			return err
+		}
+
+		obj := s.object(id).If(storage.Conditions{GenerationMatch: attrs.Generation})
+		err = write(ctx, obj, b)
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			// The object was written or deleted since it was read.
+			continue
+		}
+		return err
+	}
+}
+
+// write uploads b as the content of obj in a single request.
+func write(ctx context.Context, obj *storage.ObjectHandle, b []byte) error {
+	// Cancelling the context is how an upload is abandoned, so a failed
+	// write doesn't leave a partial object behind.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := obj.NewWriter(ctx)
+	w.ContentType = "application/octet-stream"
+	w.ChunkSize = 0
+	_, err := w.Write(b)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	err := s.object(id).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return err
+}
+
+// List relies on GCS listing names in ascending order. The cursor is
+// passed as the inclusive start offset of the listing and skipped.
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	query := &storage.Query{Prefix: s.prefix + prefix}
+	if cursor != "" {
+		query.StartOffset = s.prefix + cursor
+	}
+	err := query.SetAttrSelection([]string{"Name"})
+	if err != nil {
+		return nil, "", err
+	}
+
+	it := s.bucket.Objects(ctx, query)
+	if limit > 0 {
+		// One extra name makes up for the cursor, and another tells
+		// whether there's a next page.
+		it.PageInfo().MaxSize = limit + 2
+	}
+
+	var ids []string
+	for limit <= 0 || len(ids) <= limit {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		id := strings.TrimPrefix(attrs.Name, s.prefix)
+		if cursor != "" && id == cursor {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	if limit > 0 && len(ids) > limit {
+		return ids[:limit], ids[limit-1], nil
+	}
+	return ids, "", nil
+}
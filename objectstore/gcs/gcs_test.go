@@ -0,0 +1,171 @@
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"cloud.google.com/go/storage"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+)
+
+// uploadHook calls before, if it's set, before sending an upload.
+type uploadHook struct {
+	rt     http.RoundTripper
+	before *func()
+}
+
+func (h uploadHook) RoundTrip(req *http.Request) (*http.Response, error) {
+	if *h.before != nil && strings.HasPrefix(req.URL.Path, "/upload/") {
+		(*h.before)()
+	}
+	return h.rt.RoundTrip(req)
+}
+
+// newStore returns a store for a bucket of a fake server, along with a
+// hook which is called before every upload.
+func newStore(t *testing.T) (*fakestorage.Server, *ObjectStore, *func()) {
+	f, err := fakestorage.NewServerWithOptions(fakestorage.Options{NoListener: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(f.Stop)
+	f.CreateBucket("bucket")
+
+	beforeUpload := new(func())
+	client, err := storage.NewClient(
+		context.Background(),
+		option.WithHTTPClient(&http.Client{
+			Transport: uploadHook{rt: f.HTTPClient().Transport, before: beforeUpload},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return f, New(client, "bucket", Options{Prefix: "objects/"}), beforeUpload
+}
+
+func TestObjectStore(t *testing.T) {
+	_, s, _ := newStore(t)
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), s)
+	_, s, _ = newStore(t)
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), s)
+
+	t.Run("should store objects under the prefix", func(subT *testing.T) {
+		f, s, _ := newStore(subT)
+
+		err := s.Put(context.Background(), "a/b", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		obj, err := f.GetObject("bucket", "objects/a/b")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj.Content)
+	})
+
+	t.Run("should fill in the stats from the object attributes", func(subT *testing.T) {
+		f, s, _ := newStore(subT)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		obj, err := f.GetObject("bucket", "objects/test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, stats.Exists)
+		assert.Equal(subT, len("content"), stats.Size)
+		assert.Equal(subT, "application/octet-stream", stats.ContentType)
+		assert.WithinDuration(subT, obj.Updated, stats.LastModified, time.Millisecond)
+	})
+
+	t.Run("should not recreate an object deleted during an update", func(subT *testing.T) {
+		f, s, beforeUpload := newStore(subT)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		*beforeUpload = func() {
+			f.Client().Bucket("bucket").Object("objects/test").Delete(context.Background())
+		}
+
+		err = s.Update(context.Background(), "test", []byte("updated"))
+		assert.ErrorAs(subT, err, &sakuin.ObjectDoesNotExistErr{})
+		_, err = f.GetObject("bucket", "objects/test")
+		assert.NotNil(subT, err)
+	})
+
+	t.Run("should redo updates which lose a race", func(subT *testing.T) {
+		f, s, beforeUpload := newStore(subT)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		written := false
+		*beforeUpload = func() {
+			if written {
+				return
+			}
+			written = true
+			f.CreateObject(fakestorage.Object{
+				ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "bucket", Name: "objects/test"},
+				Content:     []byte("concurrent"),
+			})
+		}
+
+		err = s.Update(context.Background(), "test", []byte("updated"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		obj, err := f.GetObject("bucket", "objects/test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("updated"), obj.Content)
+	})
+}
+
+// TestEmulator runs the storage tests against the emulator named by
+// STORAGE_EMULATOR_HOST, e.g. fake-gcs-server, creating the bucket.
+func TestEmulator(t *testing.T) {
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("STORAGE_EMULATOR_HOST isn't set")
+	}
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	bucket := fmt.Sprintf("sakuin-test-%d", time.Now().UnixNano())
+	err = client.Bucket(bucket).Create(ctx, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), New(client, bucket, Options{Prefix: "objects/"}))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), New(client, bucket, Options{Prefix: "listable/"}))
+}
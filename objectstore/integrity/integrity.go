@@ -0,0 +1,163 @@
+// Package integrity provides an ObjectStore which checksums the objects
+// it writes to another ObjectStore and verifies them when they're read,
+// so corruption in the backing store is caught instead of being served.
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/z5labs/sakuin"
+)
+
+// ObjectCorruptedErr represents an object which no longer matches
+// the checksum it was stored with.
+type ObjectCorruptedErr struct {
+	ID       string
+	Expected string
+	Actual   string
+}
+
+func (e ObjectCorruptedErr) Error() string {
+	return fmt.Sprintf("object is corrupted: %s: expected checksum %s but got %s", e.ID, e.Expected, e.Actual)
+}
+
+// frameMagic starts the frame in front of every checksummed object. It's
+// followed by a byte holding the length of the checksum, the checksum as
+// formatted by sakuin.ChecksumAlgorithm.Checksum and then the object.
+var frameMagic = []byte("\x00SKI")
+
+// ObjectStore checksums objects on Put and Update and verifies them on Get,
+// failing with an ObjectCorruptedErr if they don't match. Checksums are
+// stored in a frame in front of the object, so they can't be lost or go
+// stale separately from it.
+//
+// Objects stored without a frame, e.g. before the wrapper was introduced,
+// are read back as they are without being verified. Stat reports the
+// checksum an object will be verified against, if any, and the size of
+// the stored object including its frame.
+type ObjectStore struct {
+	inner sakuin.ObjectStore
+	alg   sakuin.ChecksumAlgorithm
+}
+
+// New returns an ObjectStore checksumming the objects written to inner with
+// the given algorithm. Writes fail with a sakuin.UnsupportedChecksumAlgorithmErr
+// if the algorithm isn't known.
+func New(inner sakuin.ObjectStore, alg sakuin.ChecksumAlgorithm) *ObjectStore {
+	return &ObjectStore{inner: inner, alg: alg}
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	info, err := s.inner.Stat(ctx, id)
+	if err != nil || !info.Exists {
+		return info, err
+	}
+
+	header, err := s.readHeader(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	checksum, _, framed, err := unframe(id, header)
+	if err != nil {
+		return nil, err
+	}
+	if framed {
+		info.Checksum = checksum
+	}
+	return info, nil
+}
+
+// readHeader reads enough of the object to hold its frame, without
+// reading the rest of it when the inner store supports streaming.
+func (s *ObjectStore) readHeader(ctx context.Context, id string) ([]byte, error) {
+	streamDB, ok := s.inner.(sakuin.StreamingObjectStore)
+	if !ok {
+		return s.inner.Get(ctx, id)
+	}
+
+	rc, _, err := streamDB.GetStream(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return ioutil.ReadAll(io.LimitReader(rc, int64(len(frameMagic)+1+255)))
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.inner.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, obj, framed, err := unframe(id, b)
+	if err != nil || !framed {
+		return obj, err
+	}
+
+	alg, _, _ := strings.Cut(expected, ":")
+	actual, err := sakuin.ChecksumAlgorithm(alg).Checksum(obj)
+	if err != nil {
+		return nil, err
+	}
+	if actual != expected {
+		return nil, ObjectCorruptedErr{ID: id, Expected: expected, Actual: actual}
+	}
+	return obj, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	framed, err := s.frame(b)
+	if err != nil {
+		return err
+	}
+	return s.inner.Put(ctx, id, framed)
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	framed, err := s.frame(b)
+	if err != nil {
+		return err
+	}
+	return s.inner.Update(ctx, id, framed)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	return s.inner.Delete(ctx, id)
+}
+
+func (s *ObjectStore) frame(b []byte) ([]byte, error) {
+	checksum, err := s.alg.Checksum(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(frameMagic) + 1 + len(checksum) + len(b))
+	buf.Write(frameMagic)
+	buf.WriteByte(byte(len(checksum)))
+	buf.WriteString(checksum)
+	buf.Write(b)
+	return buf.Bytes(), nil
+}
+
+// unframe splits a stored object into its checksum and content. Objects
+// without a frame are returned as they are. A frame which is cut short
+// is reported as corruption.
+func unframe(id string, b []byte) (checksum string, obj []byte, framed bool, err error) {
+	n := len(frameMagic)
+	if len(b) <= n || !bytes.Equal(b[:n], frameMagic) {
+		return "", b, false, nil
+	}
+
+	size := int(b[n])
+	if len(b) < n+1+size {
+		return "", nil, true, ObjectCorruptedErr{ID: id, Expected: "a complete checksum frame", Actual: fmt.Sprintf("%d bytes", len(b))}
+	}
+	return string(b[n+1 : n+1+size]), b[n+1+size:], true, nil
+}
@@ -0,0 +1,117 @@
+package integrity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// plainObjectStore hides the optional interfaces of the store it embeds.
+type plainObjectStore struct {
+	sakuin.ObjectStore
+}
+
+func TestObjectStore(t *testing.T) {
+	for _, alg := range []sakuin.ChecksumAlgorithm{sakuin.CRC32C, sakuin.SHA256} {
+		sakuin.RunObjectStorageTests(storagetest.Lift(t), New(sakuin.NewInMemoryObjectStore(), alg))
+	}
+
+	for _, algorithm := range []sakuin.ChecksumAlgorithm{sakuin.CRC32C, sakuin.SHA256} {
+		alg := algorithm
+		t.Run("should fail with ObjectCorruptedErr if the stored bytes change with "+string(alg), func(subT *testing.T) {
+			inner := sakuin.NewInMemoryObjectStore()
+			s := New(inner, alg)
+
+			err := s.Put(context.Background(), "test", []byte("content"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			stored, err := inner.Get(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+			stored[len(stored)-1] ^= 0xff
+			err = inner.Update(context.Background(), "test", stored)
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			_, err = s.Get(context.Background(), "test")
+
+			var cerr ObjectCorruptedErr
+			if !assert.ErrorAs(subT, err, &cerr) {
+				return
+			}
+			expected, _ := alg.Checksum([]byte("content"))
+			actual, _ := alg.Checksum([]byte("conten\x8b"))
+			assert.Equal(subT, ObjectCorruptedErr{ID: "test", Expected: expected, Actual: actual}, cerr)
+		})
+	}
+
+	t.Run("should fail with ObjectCorruptedErr if the frame is cut short", func(subT *testing.T) {
+		s := New(sakuin.NewInMemoryObjectStore().WithObject("test", []byte("\x00SKI\x10crc32c")), sakuin.CRC32C)
+
+		_, err := s.Get(context.Background(), "test")
+
+		var cerr ObjectCorruptedErr
+		assert.ErrorAs(subT, err, &cerr)
+	})
+
+	t.Run("should read objects stored without a checksum", func(subT *testing.T) {
+		s := New(sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content")), sakuin.CRC32C)
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+
+		info, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, info.Checksum)
+	})
+
+	stores := map[string]func() sakuin.ObjectStore{
+		"streaming": func() sakuin.ObjectStore {
+			return sakuin.NewInMemoryObjectStore()
+		},
+		"non-streaming": func() sakuin.ObjectStore {
+			return plainObjectStore{sakuin.NewInMemoryObjectStore()}
+		},
+	}
+	for name, newStore := range stores {
+		newStore := newStore
+		t.Run("should report the checksum in stats with a "+name+" store", func(subT *testing.T) {
+			s := New(newStore(), sakuin.SHA256)
+
+			err := s.Put(context.Background(), "test", []byte("content"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			info, err := s.Stat(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+			expected, _ := sakuin.SHA256.Checksum([]byte("content"))
+			assert.True(subT, info.Exists)
+			assert.Equal(subT, expected, info.Checksum)
+		})
+	}
+
+	t.Run("should fail with UnsupportedChecksumAlgorithmErr for unknown algorithms", func(subT *testing.T) {
+		s := New(sakuin.NewInMemoryObjectStore(), "md5")
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+
+		var aerr sakuin.UnsupportedChecksumAlgorithmErr
+		assert.ErrorAs(subT, err, &aerr)
+	})
+}
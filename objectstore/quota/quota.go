@@ -0,0 +1,247 @@
+// Package quota provides an ObjectStore which limits how many bytes and
+// objects can be stored in another ObjectStore.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/z5labs/sakuin"
+)
+
+// Resource names a quota limit.
+type Resource string
+
+const (
+	Bytes   Resource = "bytes"
+	Objects Resource = "objects"
+)
+
+// QuotaExceededErr represents a write which would have taken usage past a limit.
+type QuotaExceededErr struct {
+	Resource Resource
+
+	// Usage is the usage before the rejected write.
+	Usage int64
+	Limit int64
+}
+
+func (e QuotaExceededErr) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d of %d used", e.Resource, e.Usage, e.Limit)
+}
+
+// Limits configures an ObjectStore. A limit of zero or less is unlimited.
+type Limits struct {
+	MaxBytes   int64
+	MaxObjects int64
+}
+
+// Usage is the total size and number of objects in an ObjectStore.
+type Usage struct {
+	Bytes   int64
+	Objects int64
+}
+
+// numLocks is how many locks ids are striped across.
+const numLocks = 64
+
+// ObjectStore rejects writes to the wrapped ObjectStore which would take
+// its usage past the limits with a QuotaExceededErr.
+//
+// Usage is tracked from the writes going through the ObjectStore, so it
+// starts at zero unless Rebuild is called, and it drifts if the wrapped
+// store is written to directly. Writes reserve their usage before calling
+// the wrapped store and release it again if the call fails, so concurrent
+// writes can't overshoot the limits together. Writes to the same id are
+// serialized, since the size they replace must be looked up first.
+type ObjectStore struct {
+	inner  sakuin.ObjectStore
+	limits Limits
+
+	bytes   int64
+	objects int64
+
+	locks [numLocks]sync.Mutex
+}
+
+// New returns an ObjectStore enforcing the limits on inner.
+func New(inner sakuin.ObjectStore, limits Limits) *ObjectStore {
+	return &ObjectStore{inner: inner, limits: limits}
+}
+
+// Usage returns the current usage.
+func (s *ObjectStore) Usage() Usage {
+	return Usage{
+		Bytes:   atomic.LoadInt64(&s.bytes),
+		Objects: atomic.LoadInt64(&s.objects),
+	}
+}
+
+// Rebuild resets the usage to what's stored in the wrapped store, by
+// listing it and summing the size of every object. It fails with
+// sakuin.ErrListNotSupported if the wrapped store can't be listed.
+// Writes made while rebuilding may not be counted, so it should be
+// called before the ObjectStore starts taking writes.
+func (s *ObjectStore) Rebuild(ctx context.Context) error {
+	listDB, ok := s.inner.(sakuin.ListableObjectStore)
+	if !ok {
+		return sakuin.ErrListNotSupported
+	}
+
+	var usage Usage
+	cursor := ""
+	for {
+		ids, next, err := listDB.List(ctx, "", cursor, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			info, err := s.inner.Stat(ctx, id)
+			if err != nil {
+				return err
+			}
+			if !info.Exists {
+				continue
+			}
+			usage.Bytes += int64(info.Size)
+			usage.Objects++
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	atomic.StoreInt64(&s.bytes, usage.Bytes)
+	atomic.StoreInt64(&s.objects, usage.Objects)
+	return nil
+}
+
+func (s *ObjectStore) lock(id string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	mu := &s.locks[h.Sum32()%numLocks]
+	mu.Lock()
+	return mu
+}
+
+// reserve adds the deltas to the usage, unless that takes it past a
+// limit. Only increases are checked, so shrinking is always allowed.
+func (s *ObjectStore) reserve(bytes, objects int64) error {
+	err := reserveOne(&s.bytes, bytes, s.limits.MaxBytes, Bytes)
+	if err != nil {
+		return err
+	}
+
+	err = reserveOne(&s.objects, objects, s.limits.MaxObjects, Objects)
+	if err != nil {
+		atomic.AddInt64(&s.bytes, -bytes)
+		return err
+	}
+	return nil
+}
+
+func reserveOne(usage *int64, delta, limit int64, resource Resource) error {
+	n := atomic.AddInt64(usage, delta)
+	if delta <= 0 || limit <= 0 || n <= limit {
+		return nil
+	}
+	atomic.AddInt64(usage, -delta)
+	return QuotaExceededErr{Resource: resource, Usage: n - delta, Limit: limit}
+}
+
+func (s *ObjectStore) release(bytes, objects int64) {
+	atomic.AddInt64(&s.bytes, -bytes)
+	atomic.AddInt64(&s.objects, -objects)
+}
+
+// size returns the size of the stored object, if it exists.
+func (s *ObjectStore) size(ctx context.Context, id string) (int64, bool, error) {
+	info, err := s.inner.Stat(ctx, id)
+	if err != nil {
+		return 0, false, err
+	}
+	return int64(info.Size), info.Exists, nil
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	return s.inner.Stat(ctx, id)
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	return s.inner.Get(ctx, id)
+}
+
+// Put counts an overwritten object as replaced, rather than as a new one.
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	defer s.lock(id).Unlock()
+
+	prev, exists, err := s.size(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	bytes, objects := int64(len(b))-prev, int64(1)
+	if exists {
+		objects = 0
+	}
+	err = s.reserve(bytes, objects)
+	if err != nil {
+		return err
+	}
+
+	err = s.inner.Put(ctx, id, b)
+	if err != nil {
+		s.release(bytes, objects)
+		return err
+	}
+	return nil
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	defer s.lock(id).Unlock()
+
+	prev, exists, err := s.size(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+
+	bytes := int64(len(b)) - prev
+	err = s.reserve(bytes, 0)
+	if err != nil {
+		return err
+	}
+
+	err = s.inner.Update(ctx, id, b)
+	if err != nil {
+		s.release(bytes, 0)
+		return err
+	}
+	return nil
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	defer s.lock(id).Unlock()
+
+	prev, exists, err := s.size(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.inner.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		s.release(prev, 1)
+	}
+	return nil
+}
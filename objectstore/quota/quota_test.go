@@ -0,0 +1,155 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errStoreDown = errors.New("store is down")
+
+// plainObjectStore hides the optional interfaces of the store it embeds.
+type plainObjectStore struct {
+	sakuin.ObjectStore
+}
+
+// failingPutObjectStore fails every Put with errStoreDown.
+type failingPutObjectStore struct {
+	sakuin.ObjectStore
+}
+
+func (s failingPutObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return errStoreDown
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), New(sakuin.NewInMemoryObjectStore(), Limits{}))
+
+	t.Run("should track usage across writes", func(subT *testing.T) {
+		s := New(sakuin.NewInMemoryObjectStore(), Limits{})
+
+		err := s.Put(context.Background(), "a", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Put(context.Background(), "b", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, Usage{Bytes: 14, Objects: 2}, s.Usage())
+
+		err = s.Put(context.Background(), "a", []byte("replaced content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, Usage{Bytes: 23, Objects: 2}, s.Usage())
+
+		err = s.Update(context.Background(), "b", []byte("b"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, Usage{Bytes: 17, Objects: 2}, s.Usage())
+
+		err = s.Delete(context.Background(), "a")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, Usage{Bytes: 1, Objects: 1}, s.Usage())
+	})
+
+	t.Run("should fail with QuotaExceededErr past the byte limit", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryObjectStore()
+		s := New(inner, Limits{MaxBytes: 10})
+
+		err := s.Put(context.Background(), "a", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Put(context.Background(), "b", []byte("content"))
+		assert.Equal(subT, QuotaExceededErr{Resource: Bytes, Usage: 7, Limit: 10}, err)
+
+		err = s.Update(context.Background(), "a", []byte("more content"))
+		assert.Equal(subT, QuotaExceededErr{Resource: Bytes, Usage: 7, Limit: 10}, err)
+
+		assert.Equal(subT, 1, inner.NumOfObects())
+		assert.Equal(subT, Usage{Bytes: 7, Objects: 1}, s.Usage())
+	})
+
+	t.Run("should fail with QuotaExceededErr past the object limit", func(subT *testing.T) {
+		s := New(sakuin.NewInMemoryObjectStore(), Limits{MaxObjects: 1})
+
+		err := s.Put(context.Background(), "a", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Put(context.Background(), "b", []byte("content"))
+		assert.Equal(subT, QuotaExceededErr{Resource: Objects, Usage: 1, Limit: 1}, err)
+
+		err = s.Put(context.Background(), "a", []byte("replaced content"))
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should release usage if the write fails", func(subT *testing.T) {
+		s := New(failingPutObjectStore{sakuin.NewInMemoryObjectStore()}, Limits{MaxObjects: 1})
+
+		err := s.Put(context.Background(), "a", []byte("content"))
+		assert.Equal(subT, errStoreDown, err)
+		assert.Equal(subT, Usage{}, s.Usage())
+	})
+
+	t.Run("should rebuild usage from the stored objects", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryObjectStore().
+			WithObject("a", []byte("content")).
+			WithObject("b", []byte("more content"))
+		s := New(inner, Limits{})
+
+		err := s.Rebuild(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, Usage{Bytes: 19, Objects: 2}, s.Usage())
+	})
+
+	t.Run("should fail to rebuild if the store can't be listed", func(subT *testing.T) {
+		s := New(plainObjectStore{sakuin.NewInMemoryObjectStore()}, Limits{})
+
+		err := s.Rebuild(context.Background())
+		assert.Equal(subT, sakuin.ErrListNotSupported, err)
+	})
+
+	t.Run("should enforce limits under concurrent writes", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryObjectStore()
+		s := New(inner, Limits{MaxObjects: 50, MaxBytes: 1000})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 200; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				id := fmt.Sprint("id-", i%100)
+				s.Put(context.Background(), id, []byte("content"))
+				if i%3 == 0 {
+					s.Delete(context.Background(), id)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		stats, err := inner.Stats(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.LessOrEqual(subT, stats.Count, int64(50))
+		assert.Equal(subT, Usage{Bytes: stats.Bytes, Objects: stats.Count}, s.Usage())
+	})
+}
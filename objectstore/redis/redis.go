@@ -0,0 +1,149 @@
+// Package redis provides an ObjectStore which keeps each object in a
+// Redis string.
+package redis
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Options configures the ObjectStore.
+type Options struct {
+	// Prefix is prepended to the id of every object to form its key,
+	// e.g. "sakuin:objects:", so objects can share a database.
+	Prefix string
+
+	// TTL expires objects once it has passed since they were last
+	// written. Zero never expires them.
+	TTL time.Duration
+}
+
+// ObjectStore stores objects as Redis strings, one per key.
+//
+// Every call is a single command, or a pipeline of reads for Stat, so
+// calls are atomic with respect to each other, e.g. Update uses SET XX
+// and can't recreate an object deleted by a concurrent Delete.
+type ObjectStore struct {
+	client redis.UniversalClient
+	opts   Options
+}
+
+// New returns an ObjectStore which stores objects with the given client.
+func New(client redis.UniversalClient, opts Options) *ObjectStore {
+	return &ObjectStore{client: client, opts: opts}
+}
+
+func (s *ObjectStore) key(id string) string {
+	return s.opts.Prefix + id
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	var exists *redis.IntCmd
+	var size *redis.IntCmd
+	_, err := s.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		exists = p.Exists(ctx, s.key(id))
+		size = p.StrLen(ctx, s.key(id))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if exists.Val() == 0 {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	return &sakuin.StatInfo{Exists: true, Size: int(size.Val())}, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.client.Get(ctx, s.key(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.client.Set(ctx, s.key(id), b, s.opts.TTL).Err()
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	err := s.client.SetArgs(ctx, s.key(id), b, redis.SetArgs{Mode: "XX", TTL: s.opts.TTL}).Err()
+	if errors.Is(err, redis.Nil) {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return err
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	n, err := s.client.Del(ctx, s.key(id)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return nil
+}
+
+// List scans every key under the prefix, since SCAN returns keys in no
+// particular order, so it gets slower as the store grows. Cluster clients
+// scan every master.
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	var mu sync.Mutex
+	var ids []string
+	scan := func(ctx context.Context, client redis.Cmdable) error {
+		iter := client.Scan(ctx, 0, escapeGlob(s.key(prefix))+"*", 0).Iterator()
+		for iter.Next(ctx) {
+			id := strings.TrimPrefix(iter.Val(), s.opts.Prefix)
+			if cursor != "" && id <= cursor {
+				continue
+			}
+			mu.Lock()
+			ids = append(ids, id)
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
+
+	var err error
+	if cluster, ok := s.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
+	} else {
+		err = scan(ctx, s.client)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(ids)
+
+	if limit <= 0 || len(ids) <= limit {
+		return ids, "", nil
+	}
+	return ids[:limit], ids[limit-1], nil
+}
+
+// escapeGlob escapes the characters which are special in a MATCH pattern.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
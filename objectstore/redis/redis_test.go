@@ -0,0 +1,104 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(t *testing.T, opts Options) (*ObjectStore, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, opts), mr
+}
+
+func TestObjectStore(t *testing.T) {
+	s, _ := newStore(t, Options{})
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), s)
+	s, _ = newStore(t, Options{Prefix: "sakuin:objects:"})
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), s)
+
+	t.Run("should store objects under the prefix", func(subT *testing.T) {
+		s, mr := newStore(subT, Options{Prefix: "sakuin:objects:"})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"sakuin:objects:test"}, mr.Keys())
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: len("content")}, stats)
+	})
+
+	t.Run("should tell empty objects apart from missing ones", func(subT *testing.T) {
+		s, _ := newStore(subT, Options{})
+
+		err := s.Put(context.Background(), "empty", []byte{})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		stats, err := s.Stat(context.Background(), "empty")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: 0}, stats)
+
+		stats, err = s.Stat(context.Background(), "missing")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, stats.Exists)
+	})
+
+	t.Run("should expire objects after the ttl", func(subT *testing.T) {
+		s, mr := newStore(subT, Options{TTL: time.Minute})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, time.Minute, mr.TTL("test"))
+
+		mr.FastForward(30 * time.Second)
+		err = s.Update(context.Background(), "test", []byte("updated"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, time.Minute, mr.TTL("test"))
+
+		mr.FastForward(time.Minute)
+		var objErr sakuin.ObjectDoesNotExistErr
+		_, err = s.Get(context.Background(), "test")
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should not match glob characters in the list prefix", func(subT *testing.T) {
+		s, _ := newStore(subT, Options{})
+
+		for _, id := range []string{"a*", "ab", "a*b"} {
+			err := s.Put(context.Background(), id, []byte(id))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		ids, _, err := s.List(context.Background(), "a*", "", 0)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"a*", "a*b"}, ids)
+	})
+}
@@ -0,0 +1,176 @@
+// Package s3 provides an ObjectStore which keeps each object in an
+// Amazon S3 bucket, or any service compatible with its API.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Client is the subset of *s3.Client used by the ObjectStore.
+type Client interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// ObjectStore stores objects in a bucket, with the id of every object,
+// after an optional prefix, as its key.
+//
+// S3 has no conditional writes, so Update and Delete check the object
+// exists with HeadObject before writing it. An Update racing with a
+// Delete of the same id may therefore recreate the object.
+type ObjectStore struct {
+	client Client
+	bucket string
+	prefix string
+}
+
+// New returns an ObjectStore which stores objects in the given bucket,
+// under keys starting with prefix, using client. client is usually an
+// *s3.Client, which may be pointed at localstack or minio for tests.
+func New(client Client, bucket string, prefix string) *ObjectStore {
+	return &ObjectStore{client: client, bucket: bucket, prefix: prefix}
+}
+
+func (s *ObjectStore) key(id string) *string {
+	return aws.String(s.prefix + id)
+}
+
+// isNotFound reports whether err is S3's way of saying the key doesn't
+// exist. HeadObject responses have no body, so they fail with NotFound
+// rather than NoSuchKey.
+func isNotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return true
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &s.bucket, Key: s.key(id)})
+	if isNotFound(err) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := &sakuin.StatInfo{
+		Exists:      true,
+		Size:        int(out.ContentLength),
+		ContentType: aws.ToString(out.ContentType),
+	}
+	if out.LastModified != nil {
+		info.LastModified = *out.LastModified
+	}
+	return info, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &s.bucket, Key: s.key(id)})
+	if isNotFound(err) {
+		return nil, sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	return io.ReadAll(out.Body)
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &s.bucket,
+		Key:           s.key(id),
+		Body:          bytes.NewReader(b),
+		ContentLength: int64(len(b)),
+	})
+	return err
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	err := s.mustExist(ctx, id)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, id, b)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	err := s.mustExist(ctx, id)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: &s.bucket, Key: s.key(id)})
+	return err
+}
+
+// mustExist fails with an ObjectDoesNotExistErr if the object doesn't exist.
+func (s *ObjectStore) mustExist(ctx context.Context, id string) error {
+	stats, err := s.Stat(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !stats.Exists {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return nil
+}
+
+// List relies on S3 listing keys in ascending order, and starts listing
+// straight after the cursor.
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	in := &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: s.key(prefix),
+	}
+	if cursor != "" {
+		in.StartAfter = s.key(cursor)
+	}
+
+	var ids []string
+	for {
+		if limit > 0 {
+			in.MaxKeys = int32(limit - len(ids))
+		}
+		out, err := s.client.ListObjectsV2(ctx, in)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, obj := range out.Contents {
+			ids = append(ids, strings.TrimPrefix(aws.ToString(obj.Key), s.prefix))
+		}
+
+		if !out.IsTruncated {
+			return ids, "", nil
+		}
+		if limit > 0 && len(ids) >= limit {
+			return ids, ids[len(ids)-1], nil
+		}
+		in.ContinuationToken = out.NextContinuationToken
+	}
+}
@@ -0,0 +1,185 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient is an in memory bucket which fails like S3 does for missing keys.
+type fakeClient struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{objects: make(map[string][]byte)}
+}
+
+func (c *fakeClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+	return &s3.HeadObjectOutput{ContentLength: int64(len(b))}, nil
+}
+
+func (c *fakeClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (c *fakeClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	b, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[aws.ToString(params.Key)] = b
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *fakeClient) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// ListObjectsV2 uses the last key of a page as its continuation token.
+func (c *fakeClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	after := aws.ToString(params.StartAfter)
+	if params.ContinuationToken != nil {
+		after = *params.ContinuationToken
+	}
+	maxKeys := int(params.MaxKeys)
+	if maxKeys == 0 {
+		maxKeys = 1000
+	}
+
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3.ListObjectsV2Output{}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		out.IsTruncated = true
+		out.NextContinuationToken = aws.String(keys[len(keys)-1])
+	}
+	for _, key := range keys {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+	}
+	return out, nil
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), New(newFakeClient(), "bucket", "objects/"))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), New(newFakeClient(), "bucket", "objects/"))
+
+	t.Run("should store objects under the prefix", func(subT *testing.T) {
+		client := newFakeClient()
+		s := New(client, "bucket", "objects/")
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string][]byte{"objects/test": []byte("content")}, client.objects)
+	})
+
+	t.Run("should list every page if there's no limit", func(subT *testing.T) {
+		client := newFakeClient()
+		s := New(client, "bucket", "")
+		for i := 0; i < 1500; i++ {
+			client.objects[strings.Repeat("a", i+1)] = nil
+		}
+
+		ids, next, err := s.List(context.Background(), "", "", 0)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Len(subT, ids, 1500)
+		assert.Equal(subT, "", next)
+	})
+}
+
+// TestNotFound checks the errors of the real client for missing keys are
+// recognised, since HeadObject and GetObject fail differently.
+func TestNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:           "us-east-1",
+		Credentials:      aws.AnonymousCredentials{},
+		EndpointResolver: s3.EndpointResolverFromURL(srv.URL),
+		UsePathStyle:     true,
+	})
+	s := New(client, "bucket", "")
+
+	t.Run("should report missing objects as not existing", func(subT *testing.T) {
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, stats.Exists)
+	})
+
+	t.Run("should fail to get missing objects", func(subT *testing.T) {
+		_, err := s.Get(context.Background(), "test")
+		assert.ErrorAs(subT, err, &sakuin.ObjectDoesNotExistErr{})
+	})
+
+	t.Run("should fail to update missing objects", func(subT *testing.T) {
+		err := s.Update(context.Background(), "test", []byte("content"))
+		assert.ErrorAs(subT, err, &sakuin.ObjectDoesNotExistErr{})
+	})
+
+	t.Run("should fail to delete missing objects", func(subT *testing.T) {
+		err := s.Delete(context.Background(), "test")
+		assert.ErrorAs(subT, err, &sakuin.ObjectDoesNotExistErr{})
+	})
+}
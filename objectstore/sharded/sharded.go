@@ -0,0 +1,149 @@
+// Package sharded provides an ObjectStore which spreads objects
+// across several other ObjectStores by the hash of their id.
+package sharded
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"sort"
+
+	"github.com/z5labs/sakuin"
+
+	"go.uber.org/multierr"
+)
+
+// ErrNoShards is returned when creating an ObjectStore without any shards.
+var ErrNoShards = errors.New("sharded object store needs at least one shard")
+
+// Shard returns the index of the shard, out of n, which holds the given id.
+//
+// The id is hashed with 64-bit FNV-1a, which is then mapped onto the shards
+// with jump consistent hashing (Lamping and Veach, 2014). Both are fixed,
+// so ids land on the same shard across processes and releases. Adding an
+// nth shard moves about 1/n of the ids onto it, and only onto it, but those
+// objects must still be copied over before the new shard is put into
+// service, otherwise they'll appear to be missing. Removing any shard but
+// the last moves most ids, so shards should only ever be appended.
+func Shard(id string, n int) int {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	key := h.Sum64()
+
+	var b, j int64 = -1, 0
+	for j < int64(n) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// ObjectStore routes every call for an id to the shard returned by Shard.
+// Errors from the shards, including the typed not found errors, are
+// returned unchanged.
+//
+// ObjectStore implements sakuin.StreamingObjectStore, streaming from
+// shards which support it, and sakuin.ListableObjectStore and
+// sakuin.StoreStats, which need every shard to support them.
+type ObjectStore struct {
+	shards []sakuin.ObjectStore
+}
+
+// New returns an ObjectStore over the given shards. Their order decides
+// which ids each shard holds, so it must never change.
+func New(shards []sakuin.ObjectStore) (*ObjectStore, error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+	return &ObjectStore{shards: append([]sakuin.ObjectStore(nil), shards...)}, nil
+}
+
+func (s *ObjectStore) shard(id string) sakuin.ObjectStore {
+	return s.shards[Shard(id, len(s.shards))]
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	return s.shard(id).Stat(ctx, id)
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	return s.shard(id).Get(ctx, id)
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.shard(id).Put(ctx, id, b)
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	return s.shard(id).Update(ctx, id, b)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	return s.shard(id).Delete(ctx, id)
+}
+
+func (s *ObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return sakuin.AsStreaming(s.shard(id)).PutStream(ctx, id, r, size)
+}
+
+func (s *ObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	return sakuin.AsStreaming(s.shard(id)).GetStream(ctx, id)
+}
+
+// List merges a page from every shard. Since cursors are the last id of
+// the previous page, the same cursor continues the listing on every shard.
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	var ids []string
+	more := false
+	for _, shard := range s.shards {
+		listDB, ok := shard.(sakuin.ListableObjectStore)
+		if !ok {
+			return nil, "", sakuin.ErrListNotSupported
+		}
+
+		page, next, err := listDB.List(ctx, prefix, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, page...)
+		more = more || next != ""
+	}
+
+	sort.Strings(ids)
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+		more = true
+	}
+	if !more || len(ids) == 0 {
+		return ids, "", nil
+	}
+	return ids, ids[len(ids)-1], nil
+}
+
+// Stats sums the stats of every shard. It fails if any shard fails,
+// returning the errors of all of them, since partial totals would
+// silently under count.
+func (s *ObjectStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	total := &sakuin.StoreStatsInfo{}
+	var errs error
+	for _, shard := range s.shards {
+		statsDB, ok := shard.(sakuin.StoreStats)
+		if !ok {
+			return nil, sakuin.ErrStatsNotSupported
+		}
+
+		stats, err := statsDB.Stats(ctx)
+		if err != nil {
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		total.Count += stats.Count
+		total.Bytes += stats.Bytes
+	}
+	if errs != nil {
+		return nil, errs
+	}
+	return total, nil
+}
@@ -0,0 +1,132 @@
+package sharded
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStatsObjectStore fails every call to Stats.
+type failingStatsObjectStore struct {
+	*sakuin.InMemoryObjectStore
+	err error
+}
+
+func (s failingStatsObjectStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	return nil, s.err
+}
+
+func newShards(n int) []*sakuin.InMemoryObjectStore {
+	shards := make([]*sakuin.InMemoryObjectStore, n)
+	for i := range shards {
+		shards[i] = sakuin.NewInMemoryObjectStore()
+	}
+	return shards
+}
+
+func newStore(t *testing.T, shards []*sakuin.InMemoryObjectStore) *ObjectStore {
+	objStores := make([]sakuin.ObjectStore, len(shards))
+	for i, shard := range shards {
+		objStores[i] = shard
+	}
+	s, err := New(objStores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), newStore(t, newShards(3)))
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), newStore(t, newShards(3)))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), newStore(t, newShards(3)))
+
+	t.Run("should fail with ErrNoShards without any shards", func(subT *testing.T) {
+		_, err := New(nil)
+		assert.Equal(subT, ErrNoShards, err)
+	})
+
+	t.Run("should store each id on a single shard", func(subT *testing.T) {
+		shards := newShards(3)
+		s := newStore(subT, shards)
+
+		for i := 0; i < 100; i++ {
+			id := fmt.Sprint("id-", i)
+			err := s.Put(context.Background(), id, []byte(id))
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			for n, shard := range shards {
+				info, err := shard.Stat(context.Background(), id)
+				if !assert.Nil(subT, err) {
+					return
+				}
+				assert.Equal(subT, n == Shard(id, len(shards)), info.Exists)
+			}
+		}
+	})
+
+	t.Run("should spread ids evenly across shards", func(subT *testing.T) {
+		const ids = 10000
+		counts := make([]int, 3)
+		for i := 0; i < ids; i++ {
+			counts[Shard(fmt.Sprint("id-", i), len(counts))]++
+		}
+
+		for _, count := range counts {
+			assert.InDelta(subT, ids/len(counts), count, float64(ids/len(counts)/10))
+		}
+	})
+
+	t.Run("should only move ids onto a new shard", func(subT *testing.T) {
+		moved := 0
+		for i := 0; i < 10000; i++ {
+			id := fmt.Sprint("id-", i)
+			before, after := Shard(id, 3), Shard(id, 4)
+			if before != after {
+				assert.Equal(subT, 3, after)
+				moved++
+			}
+		}
+		assert.InDelta(subT, 2500, moved, 250)
+	})
+
+	t.Run("should sum the stats of every shard", func(subT *testing.T) {
+		shards := newShards(3)
+		s := newStore(subT, shards)
+
+		for i := 0; i < 10; i++ {
+			err := s.Put(context.Background(), fmt.Sprint("id-", i), []byte("content"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		stats, err := s.Stats(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StoreStatsInfo{Count: 10, Bytes: 70}, stats)
+	})
+
+	t.Run("should fail stats if any shard fails", func(subT *testing.T) {
+		statsErr := errors.New("stats failed")
+		s, err := New([]sakuin.ObjectStore{
+			sakuin.NewInMemoryObjectStore(),
+			failingStatsObjectStore{InMemoryObjectStore: sakuin.NewInMemoryObjectStore(), err: statsErr},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.Stats(context.Background())
+		assert.ErrorIs(subT, err, statsErr)
+	})
+}
@@ -0,0 +1,216 @@
+// Package tiered provides an ObjectStore which keeps recently written
+// objects in a fast hot store and moves older ones into a cheaper cold
+// store, without callers having to know which store holds an id.
+package tiered
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	"go.uber.org/multierr"
+)
+
+// Options configures an ObjectStore.
+type Options struct {
+	// Promote copies objects read from the cold store into the hot
+	// store, so later reads are served from the hot store.
+	Promote bool
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// ObjectStore writes new objects to the hot store and reads from the hot
+// store before falling back to the cold store. Objects are moved to the
+// cold store by Demote, or by DemoteOlderThan and RunDemotion based on
+// when they were written to the hot store.
+//
+// Write times are only tracked in memory for objects written through the
+// ObjectStore, so objects already in the hot store when it's created are
+// never demoted by age, only by Demote.
+type ObjectStore struct {
+	hot  sakuin.ObjectStore
+	cold sakuin.ObjectStore
+	opts Options
+
+	mu      sync.Mutex
+	written map[string]time.Time
+}
+
+// New returns an ObjectStore tiered over the given hot and cold stores.
+func New(hot, cold sakuin.ObjectStore, opts Options) *ObjectStore {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &ObjectStore{
+		hot:     hot,
+		cold:    cold,
+		opts:    opts,
+		written: make(map[string]time.Time),
+	}
+}
+
+func isNotExist(err error) bool {
+	var objErr sakuin.ObjectDoesNotExistErr
+	return errors.As(err, &objErr)
+}
+
+func (s *ObjectStore) track(id string) {
+	s.mu.Lock()
+	s.written[id] = s.opts.Now()
+	s.mu.Unlock()
+}
+
+func (s *ObjectStore) untrack(id string) {
+	s.mu.Lock()
+	delete(s.written, id)
+	s.mu.Unlock()
+}
+
+// Stat reports the object from whichever store holds it, preferring the hot store.
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	info, err := s.hot.Stat(ctx, id)
+	if err != nil || info.Exists {
+		return info, err
+	}
+	return s.cold.Stat(ctx, id)
+}
+
+// Get reads the object from the hot store, falling back to the cold store.
+// Objects found in the cold store are promoted if enabled. Failing to
+// promote doesn't fail the Get, since the object will still be read from
+// the cold store next time.
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b, err := s.hot.Get(ctx, id)
+	if !isNotExist(err) {
+		return b, err
+	}
+
+	b, err = s.cold.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.Promote && s.hot.Put(ctx, id, b) == nil {
+		s.track(id)
+	}
+	return b, nil
+}
+
+// Put writes the object to the hot store. Any older copy in the cold
+// store is left in place, since reads prefer the hot store, until it's
+// overwritten by a demotion or removed by Delete.
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	err := s.hot.Put(ctx, id, b)
+	if err != nil {
+		return err
+	}
+	s.track(id)
+	return nil
+}
+
+// Update updates the object in whichever store holds it,
+// preferring the hot store.
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	err := s.hot.Update(ctx, id, b)
+	if err == nil {
+		s.track(id)
+	}
+	if !isNotExist(err) {
+		return err
+	}
+	return s.cold.Update(ctx, id, b)
+}
+
+// Delete removes the object from both stores. It only fails with a
+// sakuin.ObjectDoesNotExistErr if neither store held the object.
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	s.untrack(id)
+
+	hotErr := s.hot.Delete(ctx, id)
+	coldErr := s.cold.Delete(ctx, id)
+	switch {
+	case isNotExist(hotErr) && isNotExist(coldErr):
+		return hotErr
+	case isNotExist(hotErr):
+		return coldErr
+	case isNotExist(coldErr):
+		return hotErr
+	default:
+		return multierr.Combine(hotErr, coldErr)
+	}
+}
+
+// Demote moves the object from the hot store to the cold store. It fails
+// with a sakuin.ObjectDoesNotExistErr if the hot store doesn't hold it.
+// The object is written to the cold store before being deleted from the
+// hot store, so it's always readable from one of them.
+func (s *ObjectStore) Demote(ctx context.Context, id string) error {
+	b, err := s.hot.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.cold.Put(ctx, id, b)
+	if err != nil {
+		return err
+	}
+
+	err = s.hot.Delete(ctx, id)
+	if err != nil && !isNotExist(err) {
+		return err
+	}
+	s.untrack(id)
+	return nil
+}
+
+// DemoteOlderThan demotes every object written to the hot store at least
+// age ago, returning how many were demoted. It stops at the first failure.
+func (s *ObjectStore) DemoteOlderThan(ctx context.Context, age time.Duration) (int, error) {
+	cutoff := s.opts.Now().Add(-age)
+
+	s.mu.Lock()
+	var ids []string
+	for id, written := range s.written {
+		if !written.After(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(ids)
+
+	demoted := 0
+	for _, id := range ids {
+		err := s.Demote(ctx, id)
+		if isNotExist(err) {
+			s.untrack(id)
+			continue
+		}
+		if err != nil {
+			return demoted, err
+		}
+		demoted++
+	}
+	return demoted, nil
+}
+
+// RunDemotion calls DemoteOlderThan every interval until ctx is done,
+// which is the only error it returns. Failed demotions are retried on
+// the next interval.
+func (s *ObjectStore) RunDemotion(ctx context.Context, age time.Duration, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			s.DemoteOlderThan(ctx, age)
+		}
+	}
+}
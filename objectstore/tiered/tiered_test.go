@@ -0,0 +1,179 @@
+package tiered
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exists reports whether the store holds the object.
+func exists(t *testing.T, objStore sakuin.ObjectStore, id string) bool {
+	info, err := objStore.Stat(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Exists
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), New(sakuin.NewInMemoryObjectStore(), sakuin.NewInMemoryObjectStore(), Options{}))
+
+	t.Run("should write new objects to the hot store", func(subT *testing.T) {
+		hot, cold := sakuin.NewInMemoryObjectStore(), sakuin.NewInMemoryObjectStore()
+		s := New(hot, cold, Options{})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, exists(subT, hot, "test"))
+		assert.False(subT, exists(subT, cold, "test"))
+	})
+
+	t.Run("should read objects from the cold store", func(subT *testing.T) {
+		hot, cold := sakuin.NewInMemoryObjectStore(), sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		s := New(hot, cold, Options{})
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+		assert.False(subT, exists(subT, hot, "test"))
+
+		info, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, info.Exists)
+		assert.Equal(subT, len("content"), info.Size)
+	})
+
+	t.Run("should promote objects read from the cold store if enabled", func(subT *testing.T) {
+		hot, cold := sakuin.NewInMemoryObjectStore(), sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		s := New(hot, cold, Options{Promote: true})
+
+		_, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := hot.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+	})
+
+	t.Run("should demote objects to the cold store", func(subT *testing.T) {
+		hot, cold := sakuin.NewInMemoryObjectStore(), sakuin.NewInMemoryObjectStore()
+		s := New(hot, cold, Options{})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Demote(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, exists(subT, hot, "test"))
+		assert.True(subT, exists(subT, cold, "test"))
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+	})
+
+	t.Run("should fail to demote objects missing from the hot store", func(subT *testing.T) {
+		s := New(sakuin.NewInMemoryObjectStore(), sakuin.NewInMemoryObjectStore(), Options{})
+
+		err := s.Demote(context.Background(), "test")
+
+		var objErr sakuin.ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should demote objects by age", func(subT *testing.T) {
+		now := time.Now()
+		hot, cold := sakuin.NewInMemoryObjectStore(), sakuin.NewInMemoryObjectStore()
+		s := New(hot, cold, Options{Now: func() time.Time { return now }})
+
+		err := s.Put(context.Background(), "old", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		now = now.Add(time.Hour)
+		err = s.Put(context.Background(), "new", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		demoted, err := s.DemoteOlderThan(context.Background(), time.Hour)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 1, demoted)
+		assert.True(subT, exists(subT, cold, "old"))
+		assert.False(subT, exists(subT, hot, "old"))
+		assert.True(subT, exists(subT, hot, "new"))
+	})
+
+	t.Run("should demote in the background until canceled", func(subT *testing.T) {
+		hot, cold := sakuin.NewInMemoryObjectStore(), sakuin.NewInMemoryObjectStore()
+		s := New(hot, cold, Options{})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- s.RunDemotion(ctx, 0, time.Millisecond)
+		}()
+
+		assert.Eventually(subT, func() bool {
+			return cold.NumOfObects() == 1
+		}, time.Second, time.Millisecond)
+		cancel()
+		assert.Equal(subT, context.Canceled, <-done)
+	})
+
+	t.Run("should delete objects from both stores", func(subT *testing.T) {
+		hot := sakuin.NewInMemoryObjectStore().WithObject("test", []byte("new"))
+		cold := sakuin.NewInMemoryObjectStore().WithObject("test", []byte("old"))
+		s := New(hot, cold, Options{})
+
+		err := s.Delete(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, exists(subT, hot, "test"))
+		assert.False(subT, exists(subT, cold, "test"))
+
+		_, err = s.Get(context.Background(), "test")
+		var objErr sakuin.ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should delete objects only held by the cold store", func(subT *testing.T) {
+		cold := sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		s := New(sakuin.NewInMemoryObjectStore(), cold, Options{})
+
+		err := s.Delete(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, exists(subT, cold, "test"))
+	})
+}
@@ -0,0 +1,223 @@
+package sakuin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"go.uber.org/zap"
+)
+
+// InvalidPatchErr represents a patch which is either malformed
+// or couldn't be applied to the current metadata.
+type InvalidPatchErr struct {
+	ID  string
+	Err error
+}
+
+func (e InvalidPatchErr) Error() string {
+	return fmt.Sprintf("invalid patch for %s: %s", e.ID, e.Err)
+}
+
+func (e InvalidPatchErr) Unwrap() error {
+	return e.Err
+}
+
+// PatchConflictErr represents a well-formed patch which couldn't be applied
+// to the current metadata, e.g. because it references a missing path. It
+// unwraps to an InvalidPatchErr.
+type PatchConflictErr struct {
+	ID  string
+	Err error
+}
+
+func (e PatchConflictErr) Error() string {
+	return fmt.Sprintf("patch can't be applied to %s: %s", e.ID, e.Err)
+}
+
+func (e PatchConflictErr) Unwrap() error {
+	return InvalidPatchErr{ID: e.ID, Err: e.Err}
+}
+
+// PatchTestFailedErr represents a patch whose "test" operation
+// didn't match the current metadata.
+type PatchTestFailedErr struct {
+	ID string
+}
+
+func (e PatchTestFailedErr) Error() string {
+	return fmt.Sprintf("patch test operation failed for %s", e.ID)
+}
+
+// PatchMetadata applies an RFC 6902 JSON Patch to the metadata of an indexed object.
+//
+// If the DocumentStore implements RevisionedDocumentStore the patched metadata is
+// only written if it hasn't changed since it was read, otherwise the write is last-write-wins.
+func (s *Service) PatchMetadata(ctx context.Context, req *pb.PatchMetadataRequest) (resp *pb.PatchMetadataResponse, err error) {
+	defer s.observe("PatchMetadata", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	log := s.logger(req.Id)
+
+	patch, err := jsonpatch.DecodePatch(req.Patch)
+	if err != nil {
+		log.Error("unable to decode patch", zap.Error(err))
+		return nil, InvalidPatchErr{ID: req.Id, Err: err}
+	}
+
+	revision, err := s.modifyMetadata(ctx, req.Id, req.ExpectedRevision, func(doc []byte) ([]byte, error) {
+		patched, err := patch.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, PatchTestFailedErr{ID: req.Id}
+		}
+		if err != nil {
+			return nil, PatchConflictErr{ID: req.Id, Err: err}
+		}
+		return patched, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PatchMetadataResponse{Revision: revision}, nil
+}
+
+// modifyMetadata reads the current metadata, hands its JSON encoding to modify
+// and replaces the metadata with the result. The reserved metadata isn't handed
+// to modify, results which set it are rejected, and it's always carried over
+// from the current metadata.
+func (s *Service) modifyMetadata(ctx context.Context, id, expectedRevision string, modify func([]byte) ([]byte, error)) (string, error) {
+	log := s.logger(id)
+
+	current, revision, err := s.getMetadata(ctx, id)
+	if err != nil {
+		log.Error("unexpected error when getting metadata", zap.Error(err))
+		return "", err
+	}
+	if s.isExpired(current) {
+		log.Warn("metadata has expired")
+		return "", DocumentDoesNotExistErr{ID: id}
+	}
+
+	revDB, revisioned := s.docDB.(RevisionedDocumentStore)
+	if expectedRevision != "" {
+		if !revisioned {
+			log.Error("document store does not support revisions")
+			return "", ErrRevisionsNotSupported
+		}
+		if expectedRevision != revision {
+			return "", RevisionMismatchErr{ID: id, Expected: expectedRevision, Actual: revision}
+		}
+	}
+
+	doc := CopyDoc(current)
+	reserved, hasReserved := doc[ReservedMetadataKey]
+	delete(doc, ReservedMetadataKey)
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	b, err = modify(b)
+	if err != nil {
+		return "", err
+	}
+
+	var metadata map[string]interface{}
+	err = json.Unmarshal(b, &metadata)
+	if err != nil {
+		return "", InvalidPatchErr{ID: id, Err: err}
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+
+	err = s.validateMetadata(ctx, id, metadata)
+	if err != nil {
+		return "", err
+	}
+	if hasReserved {
+		metadata[ReservedMetadataKey] = reserved
+	}
+
+	log.Info("replacing metadata")
+	if !revisioned {
+		err = s.docDB.Replace(ctx, id, metadata)
+	} else {
+		revision, err = revDB.ReplaceIfRevision(ctx, id, metadata, revision)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.audit(ctx, id, AuditPatch, current, metadata)
+	s.runHook("OnMetadataUpdated", s.hooks.OnMetadataUpdated, id, HookSummary{Revision: revision})
+	return revision, nil
+}
+
+// MergePatchMetadata applies an RFC 7386 JSON Merge Patch to the metadata of an indexed
+// object and returns the new revision, if the DocumentStore supports revisions.
+//
+// Unlike UpdateMetadata, null values remove fields and arrays are always replaced as a whole.
+func (s *Service) MergePatchMetadata(ctx context.Context, id string, patch json.RawMessage) (revision string, err error) {
+	defer s.observe("MergePatchMetadata", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return "", err
+	}
+	defer s.exit()
+
+	log := s.logger(id)
+
+	var p interface{}
+	err = json.Unmarshal(patch, &p)
+	if err != nil {
+		log.Error("unable to decode merge patch", zap.Error(err))
+		return "", InvalidPatchErr{ID: id, Err: err}
+	}
+
+	return s.modifyMetadata(ctx, id, "", func(doc []byte) ([]byte, error) {
+		var target interface{}
+		err := json.Unmarshal(doc, &target)
+		if err != nil {
+			return nil, err
+		}
+
+		patched := mergePatch(target, p)
+		if _, ok := patched.(map[string]interface{}); !ok {
+			return nil, InvalidPatchErr{ID: id, Err: errors.New("metadata must be a JSON object")}
+		}
+		return json.Marshal(patched)
+	})
+}
+
+// mergePatch implements the MergePatch function from RFC 7386, section 2.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
@@ -0,0 +1,328 @@
+package sakuin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchMetadata(t *testing.T) {
+	t.Run("should apply add, remove and replace operations", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+			"name": "test",
+			"tags": []interface{}{"a"},
+			"old":  true,
+		})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		_, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+			Id: "test",
+			Patch: []byte(`[
+				{"op": "replace", "path": "/name", "value": "patched"},
+				{"op": "add", "path": "/tags/-", "value": "b"},
+				{"op": "remove", "path": "/old"}
+			]`),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{
+			"name": "patched",
+			"tags": []interface{}{"a", "b"},
+		}, doc)
+	})
+
+	t.Run("should preserve reserved metadata", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+			"name":              "test",
+			ReservedMetadataKey: map[string]interface{}{checksumMetadataKey: "sha256:abc"},
+		})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		_, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+			Id:    "test",
+			Patch: []byte(`[{"op": "replace", "path": "/name", "value": "patched"}]`),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "patched", doc["name"])
+		assert.Equal(subT, "sha256:abc", getReservedString(doc, checksumMetadataKey))
+	})
+
+	t.Run("should reject patches which set reserved metadata", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+			"name":              "test",
+			ReservedMetadataKey: map[string]interface{}{checksumMetadataKey: "sha256:abc"},
+		})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		for _, patch := range []string{
+			`[{"op": "add", "path": "/_sakuin", "value": {"checksum": "sha256:def"}}]`,
+			`[{"op": "add", "path": "/_sakuin", "value": 1}]`,
+		} {
+			_, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+				Id:    "test",
+				Patch: []byte(patch),
+			})
+			if !assert.ErrorIs(subT, err, ErrReservedMetadataKey) {
+				return
+			}
+		}
+
+		_, err := s.MergePatchMetadata(context.Background(), "test", json.RawMessage(`{"_sakuin": {"expiresAt": "2000-01-01T00:00:00Z"}}`))
+		if !assert.ErrorIs(subT, err, ErrReservedMetadataKey) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", doc["name"])
+		assert.Equal(subT, map[string]interface{}{checksumMetadataKey: "sha256:abc"}, doc[ReservedMetadataKey])
+	})
+
+	t.Run("should fail if a test operation fails", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		_, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+			Id: "test",
+			Patch: []byte(`[
+				{"op": "test", "path": "/name", "value": "other"},
+				{"op": "replace", "path": "/name", "value": "patched"}
+			]`),
+		})
+
+		var testErr PatchTestFailedErr
+		if !assert.ErrorAs(subT, err, &testErr) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", doc["name"])
+	})
+
+	t.Run("should fail if the patch is invalid", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+		})
+
+		testCases := map[string]string{
+			"malformed":    `{"op": "add"}`,
+			"missing path": `[{"op": "remove", "path": "/missing"}]`,
+			"bad index":    `[{"op": "add", "path": "/name/5", "value": 1}]`,
+		}
+		for name, patch := range testCases {
+			_, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+				Id:    "test",
+				Patch: []byte(patch),
+			})
+
+			var patchErr InvalidPatchErr
+			assert.ErrorAs(subT, err, &patchErr, name)
+		}
+	})
+
+	t.Run("should distinguish patches which can't be applied", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+		})
+
+		_, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+			Id:    "test",
+			Patch: []byte(`{"op": "add"}`),
+		})
+
+		var conflictErr PatchConflictErr
+		assert.False(subT, errors.As(err, &conflictErr), "malformed")
+
+		_, err = s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+			Id:    "test",
+			Patch: []byte(`[{"op": "remove", "path": "/missing"}]`),
+		})
+		assert.ErrorAs(subT, err, &conflictErr, "missing path")
+	})
+
+	t.Run("should fail if ID doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+			Id:    "docDoesNotExistID",
+			Patch: []byte(`[]`),
+		})
+
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+	})
+
+	t.Run("should fail if the expected revision doesn't match", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+		})
+
+		_, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+			Id:               "test",
+			Patch:            []byte(`[{"op": "replace", "path": "/name", "value": "patched"}]`),
+			ExpectedRevision: "100",
+		})
+
+		var revErr RevisionMismatchErr
+		assert.ErrorAs(subT, err, &revErr)
+	})
+
+	t.Run("should return the new revision", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+		})
+
+		getResp, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		resp, err := s.PatchMetadata(context.Background(), &pb.PatchMetadataRequest{
+			Id:               "test",
+			Patch:            []byte(`[{"op": "replace", "path": "/name", "value": "patched"}]`),
+			ExpectedRevision: getResp.Revision,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.NotEqual(subT, getResp.Revision, resp.Revision)
+	})
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7386, Appendix A
+	testCases := []struct {
+		target string
+		patch  string
+		result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, testCase := range testCases {
+		var target, patch, expected interface{}
+		if !assert.Nil(t, json.Unmarshal([]byte(testCase.target), &target)) {
+			return
+		}
+		if !assert.Nil(t, json.Unmarshal([]byte(testCase.patch), &patch)) {
+			return
+		}
+		if !assert.Nil(t, json.Unmarshal([]byte(testCase.result), &expected)) {
+			return
+		}
+
+		assert.Equal(t, expected, mergePatch(target, patch), "target: %s, patch: %s", testCase.target, testCase.patch)
+	}
+}
+
+func TestMergePatchMetadata(t *testing.T) {
+	t.Run("should remove nulls and replace arrays", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+			"name":   "test",
+			"tags":   []interface{}{"a", "b"},
+			"nested": map[string]interface{}{"keep": true, "drop": true},
+			ReservedMetadataKey: map[string]interface{}{
+				checksumMetadataKey: "sha256:abc",
+			},
+		})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		_, err := s.MergePatchMetadata(context.Background(), "test", json.RawMessage(`{
+			"name": null,
+			"tags": ["c"],
+			"nested": {"drop": null},
+			"_sakuin": null
+		}`))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{
+			"tags":   []interface{}{"c"},
+			"nested": map[string]interface{}{"keep": true},
+			ReservedMetadataKey: map[string]interface{}{
+				checksumMetadataKey: "sha256:abc",
+			},
+		}, doc)
+	})
+
+	t.Run("should fail if the result isn't an object", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+		})
+
+		_, err := s.MergePatchMetadata(context.Background(), "test", json.RawMessage(`["a"]`))
+
+		var patchErr InvalidPatchErr
+		assert.ErrorAs(subT, err, &patchErr)
+	})
+
+	t.Run("should fail if ID doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.MergePatchMetadata(context.Background(), "docDoesNotExistID", json.RawMessage(`{}`))
+
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+	})
+}
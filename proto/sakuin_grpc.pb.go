@@ -0,0 +1,631 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v3.19.1
+// source: sakuin.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Sakuin_GetObject_FullMethodName       = "/proto.Sakuin/GetObject"
+	Sakuin_UpdateObject_FullMethodName    = "/proto.Sakuin/UpdateObject"
+	Sakuin_GetMetadata_FullMethodName     = "/proto.Sakuin/GetMetadata"
+	Sakuin_UpdateMetadata_FullMethodName  = "/proto.Sakuin/UpdateMetadata"
+	Sakuin_PatchMetadata_FullMethodName   = "/proto.Sakuin/PatchMetadata"
+	Sakuin_Index_FullMethodName           = "/proto.Sakuin/Index"
+	Sakuin_Copy_FullMethodName            = "/proto.Sakuin/Copy"
+	Sakuin_Move_FullMethodName            = "/proto.Sakuin/Move"
+	Sakuin_Delete_FullMethodName          = "/proto.Sakuin/Delete"
+	Sakuin_Stat_FullMethodName            = "/proto.Sakuin/Stat"
+	Sakuin_List_FullMethodName            = "/proto.Sakuin/List"
+	Sakuin_PutObjectStream_FullMethodName = "/proto.Sakuin/PutObjectStream"
+	Sakuin_GetObjectStream_FullMethodName = "/proto.Sakuin/GetObjectStream"
+)
+
+// SakuinClient is the client API for Sakuin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SakuinClient interface {
+	GetObject(ctx context.Context, in *GetObjectRequest, opts ...grpc.CallOption) (*GetObjectResponse, error)
+	UpdateObject(ctx context.Context, in *UpdateObjectRequest, opts ...grpc.CallOption) (*UpdateObjectResponse, error)
+	GetMetadata(ctx context.Context, in *GetMetadataRequest, opts ...grpc.CallOption) (*GetMetadataResponse, error)
+	UpdateMetadata(ctx context.Context, in *UpdateMetadataRequest, opts ...grpc.CallOption) (*UpdateMetadataResponse, error)
+	PatchMetadata(ctx context.Context, in *PatchMetadataRequest, opts ...grpc.CallOption) (*PatchMetadataResponse, error)
+	// Index isn't annotated since indexing over HTTP is a multipart upload,
+	// which the gateway serves with a custom handler.
+	Index(ctx context.Context, in *IndexRequest, opts ...grpc.CallOption) (*IndexResponse, error)
+	Copy(ctx context.Context, in *CopyRequest, opts ...grpc.CallOption) (*CopyResponse, error)
+	Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*MoveResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Stat reports whether an object and its metadata exist without reading
+	// the object. Missing ids aren't an error.
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error)
+	// List pages through the ids of indexed objects, if the object store
+	// supports listing.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// PutObjectStream indexes an object too large for a single message. The
+	// first chunk carries the index request and the rest carry the content.
+	PutObjectStream(ctx context.Context, opts ...grpc.CallOption) (Sakuin_PutObjectStreamClient, error)
+	GetObjectStream(ctx context.Context, in *GetObjectRequest, opts ...grpc.CallOption) (Sakuin_GetObjectStreamClient, error)
+}
+
+type sakuinClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSakuinClient(cc grpc.ClientConnInterface) SakuinClient {
+	return &sakuinClient{cc}
+}
+
+func (c *sakuinClient) GetObject(ctx context.Context, in *GetObjectRequest, opts ...grpc.CallOption) (*GetObjectResponse, error) {
+	out := new(GetObjectResponse)
+	err := c.cc.Invoke(ctx, Sakuin_GetObject_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) UpdateObject(ctx context.Context, in *UpdateObjectRequest, opts ...grpc.CallOption) (*UpdateObjectResponse, error) {
+	out := new(UpdateObjectResponse)
+	err := c.cc.Invoke(ctx, Sakuin_UpdateObject_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) GetMetadata(ctx context.Context, in *GetMetadataRequest, opts ...grpc.CallOption) (*GetMetadataResponse, error) {
+	out := new(GetMetadataResponse)
+	err := c.cc.Invoke(ctx, Sakuin_GetMetadata_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) UpdateMetadata(ctx context.Context, in *UpdateMetadataRequest, opts ...grpc.CallOption) (*UpdateMetadataResponse, error) {
+	out := new(UpdateMetadataResponse)
+	err := c.cc.Invoke(ctx, Sakuin_UpdateMetadata_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) PatchMetadata(ctx context.Context, in *PatchMetadataRequest, opts ...grpc.CallOption) (*PatchMetadataResponse, error) {
+	out := new(PatchMetadataResponse)
+	err := c.cc.Invoke(ctx, Sakuin_PatchMetadata_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) Index(ctx context.Context, in *IndexRequest, opts ...grpc.CallOption) (*IndexResponse, error) {
+	out := new(IndexResponse)
+	err := c.cc.Invoke(ctx, Sakuin_Index_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) Copy(ctx context.Context, in *CopyRequest, opts ...grpc.CallOption) (*CopyResponse, error) {
+	out := new(CopyResponse)
+	err := c.cc.Invoke(ctx, Sakuin_Copy_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*MoveResponse, error) {
+	out := new(MoveResponse)
+	err := c.cc.Invoke(ctx, Sakuin_Move_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, Sakuin_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*StatResponse, error) {
+	out := new(StatResponse)
+	err := c.cc.Invoke(ctx, Sakuin_Stat_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, Sakuin_List_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sakuinClient) PutObjectStream(ctx context.Context, opts ...grpc.CallOption) (Sakuin_PutObjectStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Sakuin_ServiceDesc.Streams[0], Sakuin_PutObjectStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sakuinPutObjectStreamClient{stream}
+	return x, nil
+}
+
+type Sakuin_PutObjectStreamClient interface {
+	Send(*ObjectChunk) error
+	CloseAndRecv() (*IndexResponse, error)
+	grpc.ClientStream
+}
+
+type sakuinPutObjectStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *sakuinPutObjectStreamClient) Send(m *ObjectChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *sakuinPutObjectStreamClient) CloseAndRecv() (*IndexResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IndexResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *sakuinClient) GetObjectStream(ctx context.Context, in *GetObjectRequest, opts ...grpc.CallOption) (Sakuin_GetObjectStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Sakuin_ServiceDesc.Streams[1], Sakuin_GetObjectStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sakuinGetObjectStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Sakuin_GetObjectStreamClient interface {
+	Recv() (*ObjectChunk, error)
+	grpc.ClientStream
+}
+
+type sakuinGetObjectStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *sakuinGetObjectStreamClient) Recv() (*ObjectChunk, error) {
+	m := new(ObjectChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SakuinServer is the server API for Sakuin service.
+// All implementations must embed UnimplementedSakuinServer
+// for forward compatibility
+type SakuinServer interface {
+	GetObject(context.Context, *GetObjectRequest) (*GetObjectResponse, error)
+	UpdateObject(context.Context, *UpdateObjectRequest) (*UpdateObjectResponse, error)
+	GetMetadata(context.Context, *GetMetadataRequest) (*GetMetadataResponse, error)
+	UpdateMetadata(context.Context, *UpdateMetadataRequest) (*UpdateMetadataResponse, error)
+	PatchMetadata(context.Context, *PatchMetadataRequest) (*PatchMetadataResponse, error)
+	// Index isn't annotated since indexing over HTTP is a multipart upload,
+	// which the gateway serves with a custom handler.
+	Index(context.Context, *IndexRequest) (*IndexResponse, error)
+	Copy(context.Context, *CopyRequest) (*CopyResponse, error)
+	Move(context.Context, *MoveRequest) (*MoveResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Stat reports whether an object and its metadata exist without reading
+	// the object. Missing ids aren't an error.
+	Stat(context.Context, *StatRequest) (*StatResponse, error)
+	// List pages through the ids of indexed objects, if the object store
+	// supports listing.
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// PutObjectStream indexes an object too large for a single message. The
+	// first chunk carries the index request and the rest carry the content.
+	PutObjectStream(Sakuin_PutObjectStreamServer) error
+	GetObjectStream(*GetObjectRequest, Sakuin_GetObjectStreamServer) error
+	mustEmbedUnimplementedSakuinServer()
+}
+
+// UnimplementedSakuinServer must be embedded to have forward compatible implementations.
+type UnimplementedSakuinServer struct {
+}
+
+func (UnimplementedSakuinServer) GetObject(context.Context, *GetObjectRequest) (*GetObjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetObject not implemented")
+}
+func (UnimplementedSakuinServer) UpdateObject(context.Context, *UpdateObjectRequest) (*UpdateObjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateObject not implemented")
+}
+func (UnimplementedSakuinServer) GetMetadata(context.Context, *GetMetadataRequest) (*GetMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMetadata not implemented")
+}
+func (UnimplementedSakuinServer) UpdateMetadata(context.Context, *UpdateMetadataRequest) (*UpdateMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateMetadata not implemented")
+}
+func (UnimplementedSakuinServer) PatchMetadata(context.Context, *PatchMetadataRequest) (*PatchMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PatchMetadata not implemented")
+}
+func (UnimplementedSakuinServer) Index(context.Context, *IndexRequest) (*IndexResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Index not implemented")
+}
+func (UnimplementedSakuinServer) Copy(context.Context, *CopyRequest) (*CopyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Copy not implemented")
+}
+func (UnimplementedSakuinServer) Move(context.Context, *MoveRequest) (*MoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Move not implemented")
+}
+func (UnimplementedSakuinServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedSakuinServer) Stat(context.Context, *StatRequest) (*StatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedSakuinServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedSakuinServer) PutObjectStream(Sakuin_PutObjectStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method PutObjectStream not implemented")
+}
+func (UnimplementedSakuinServer) GetObjectStream(*GetObjectRequest, Sakuin_GetObjectStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetObjectStream not implemented")
+}
+func (UnimplementedSakuinServer) mustEmbedUnimplementedSakuinServer() {}
+
+// UnsafeSakuinServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SakuinServer will
+// result in compilation errors.
+type UnsafeSakuinServer interface {
+	mustEmbedUnimplementedSakuinServer()
+}
+
+func RegisterSakuinServer(s grpc.ServiceRegistrar, srv SakuinServer) {
+	s.RegisterService(&Sakuin_ServiceDesc, srv)
+}
+
+func _Sakuin_GetObject_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetObjectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).GetObject(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_GetObject_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).GetObject(ctx, req.(*GetObjectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_UpdateObject_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateObjectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).UpdateObject(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_UpdateObject_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).UpdateObject(ctx, req.(*UpdateObjectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_GetMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).GetMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_GetMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).GetMetadata(ctx, req.(*GetMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_UpdateMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).UpdateMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_UpdateMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).UpdateMetadata(ctx, req.(*UpdateMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_PatchMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PatchMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).PatchMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_PatchMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).PatchMetadata(ctx, req.(*PatchMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_Index_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IndexRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).Index(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_Index_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).Index(ctx, req.(*IndexRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_Copy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CopyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).Copy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_Copy_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).Copy(ctx, req.(*CopyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_Move_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).Move(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_Move_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).Move(ctx, req.(*MoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SakuinServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Sakuin_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SakuinServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Sakuin_PutObjectStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SakuinServer).PutObjectStream(&sakuinPutObjectStreamServer{stream})
+}
+
+type Sakuin_PutObjectStreamServer interface {
+	SendAndClose(*IndexResponse) error
+	Recv() (*ObjectChunk, error)
+	grpc.ServerStream
+}
+
+type sakuinPutObjectStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *sakuinPutObjectStreamServer) SendAndClose(m *IndexResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *sakuinPutObjectStreamServer) Recv() (*ObjectChunk, error) {
+	m := new(ObjectChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Sakuin_GetObjectStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetObjectRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SakuinServer).GetObjectStream(m, &sakuinGetObjectStreamServer{stream})
+}
+
+type Sakuin_GetObjectStreamServer interface {
+	Send(*ObjectChunk) error
+	grpc.ServerStream
+}
+
+type sakuinGetObjectStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *sakuinGetObjectStreamServer) Send(m *ObjectChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Sakuin_ServiceDesc is the grpc.ServiceDesc for Sakuin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Sakuin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Sakuin",
+	HandlerType: (*SakuinServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetObject",
+			Handler:    _Sakuin_GetObject_Handler,
+		},
+		{
+			MethodName: "UpdateObject",
+			Handler:    _Sakuin_UpdateObject_Handler,
+		},
+		{
+			MethodName: "GetMetadata",
+			Handler:    _Sakuin_GetMetadata_Handler,
+		},
+		{
+			MethodName: "UpdateMetadata",
+			Handler:    _Sakuin_UpdateMetadata_Handler,
+		},
+		{
+			MethodName: "PatchMetadata",
+			Handler:    _Sakuin_PatchMetadata_Handler,
+		},
+		{
+			MethodName: "Index",
+			Handler:    _Sakuin_Index_Handler,
+		},
+		{
+			MethodName: "Copy",
+			Handler:    _Sakuin_Copy_Handler,
+		},
+		{
+			MethodName: "Move",
+			Handler:    _Sakuin_Move_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Sakuin_Delete_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _Sakuin_Stat_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Sakuin_List_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PutObjectStream",
+			Handler:       _Sakuin_PutObjectStream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetObjectStream",
+			Handler:       _Sakuin_GetObjectStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sakuin.proto",
+}
@@ -0,0 +1,392 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// ErrQueryNotSupported is returned when searching but the configured
+// DocumentStore doesn't implement QueryableDocumentStore.
+var ErrQueryNotSupported = errors.New("document store does not support queries")
+
+// InvalidQueryErr represents a Query which can't be evaluated.
+type InvalidQueryErr struct {
+	Reason string
+}
+
+func (e InvalidQueryErr) Error() string {
+	return fmt.Sprintf("invalid query: %s", e.Reason)
+}
+
+// PredicateKind is how a Predicate matches the field at its path.
+type PredicateKind string
+
+const (
+	// PredicateEquals matches fields equal to the predicate Value.
+	// Numbers are compared by value regardless of their type.
+	PredicateEquals PredicateKind = "equals"
+
+	// PredicatePrefix matches string fields starting with the predicate Value.
+	PredicatePrefix PredicateKind = "prefix"
+
+	// PredicateRange matches numeric fields between the predicate Min and Max, inclusive.
+	PredicateRange PredicateKind = "range"
+)
+
+// Predicate matches documents on the field at a dotted path, e.g. "author.name".
+// Paths only pass through objects, so a path into an array never matches.
+type Predicate struct {
+	Path  string
+	Kind  PredicateKind
+	Value interface{}
+	Min   float64
+	Max   float64
+}
+
+// FieldEquals matches documents whose field at path equals value.
+func FieldEquals(path string, value interface{}) Predicate {
+	return Predicate{Path: path, Kind: PredicateEquals, Value: value}
+}
+
+// FieldHasPrefix matches documents whose field at path is a string starting with prefix.
+func FieldHasPrefix(path string, prefix string) Predicate {
+	return Predicate{Path: path, Kind: PredicatePrefix, Value: prefix}
+}
+
+// FieldInRange matches documents whose field at path is a number between min
+// and max, inclusive. Use math.Inf for a range which is open on either side.
+func FieldInRange(path string, min, max float64) Predicate {
+	return Predicate{Path: path, Kind: PredicateRange, Min: min, Max: max}
+}
+
+// Query selects the documents matching all of its predicates, ordered by id.
+type Query struct {
+	Predicates []Predicate
+
+	// Limit is the maximum number of documents returned.
+	// Zero or less means no limit.
+	Limit int
+
+	// Cursor continues from the page which returned it.
+	// Empty starts from the first page.
+	Cursor string
+}
+
+// Validate checks the query can be evaluated.
+func (q Query) Validate() error {
+	for _, p := range q.Predicates {
+		if p.Path == "" {
+			return InvalidQueryErr{Reason: "predicate is missing a path"}
+		}
+		switch p.Kind {
+		case PredicateEquals:
+		case PredicatePrefix:
+			if _, ok := p.Value.(string); !ok {
+				return InvalidQueryErr{Reason: fmt.Sprintf("prefix for %s must be a string", p.Path)}
+			}
+		case PredicateRange:
+			if math.IsNaN(p.Min) || math.IsNaN(p.Max) || p.Min > p.Max {
+				return InvalidQueryErr{Reason: fmt.Sprintf("range for %s is empty", p.Path)}
+			}
+		default:
+			return InvalidQueryErr{Reason: fmt.Sprintf("unknown predicate kind: %s", p.Kind)}
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the document matches all of the query's predicates.
+func (q Query) Matches(doc map[string]interface{}) bool {
+	for _, p := range q.Predicates {
+		if !p.matches(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p Predicate) matches(doc map[string]interface{}) bool {
+	v, ok := lookupPath(doc, p.Path)
+	if !ok {
+		return false
+	}
+
+	switch p.Kind {
+	case PredicateEquals:
+		return valuesEqual(v, p.Value)
+	case PredicatePrefix:
+		s, ok := v.(string)
+		prefix, _ := p.Value.(string)
+		return ok && strings.HasPrefix(s, prefix)
+	case PredicateRange:
+		f, ok := toFloat(v)
+		return ok && p.Min <= f && f <= p.Max
+	default:
+		return false
+	}
+}
+
+func lookupPath(doc map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = doc
+	for _, seg := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		v, ok = m[seg]
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func valuesEqual(a, b interface{}) bool {
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok || bok {
+		return aok && bok && af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// QueryDocument is a document matched by a Query.
+type QueryDocument struct {
+	ID       string
+	Document map[string]interface{}
+}
+
+// QueryResult is a page of documents matched by a Query. An empty
+// NextCursor means there are no more pages.
+type QueryResult struct {
+	Documents  []QueryDocument
+	NextCursor string
+}
+
+// QueryableDocumentStore is an optional interface a DocumentStore can
+// implement to support searching documents by their fields.
+type QueryableDocumentStore interface {
+	DocumentStore
+
+	// Query returns the documents matching the query, in ascending order of
+	// id, with the same cursor semantics as ListableObjectStore.List.
+	Query(ctx context.Context, q Query) (QueryResult, error)
+}
+
+// RunQueryableDocumentStorageTests checks stores evaluate queries with the
+// same semantics as InMemoryDocumentStore. Every document it stores has a
+// "suite" field, which every query it runs matches on, so the store doesn't
+// need to be empty.
+func RunQueryableDocumentStorageTests(t TestingT, docStore QueryableDocumentStore) {
+	docs := map[string]map[string]interface{}{
+		"query/a": {"name": "alpha", "size": 10.0, "owner": map[string]interface{}{"name": "ann", "team": "x"}},
+		"query/b": {"name": "beta", "size": 20.0, "owner": map[string]interface{}{"name": "bob", "team": "x"}},
+		"query/c": {"name": "alphabet", "size": 30.0, "owner": map[string]interface{}{"name": "cat", "team": "y"}, "tags": []interface{}{"t"}},
+		"query/d": {"name": "delta", "size": "40"},
+	}
+	for id, doc := range docs {
+		doc["suite"] = "queryable"
+		err := docStore.Upsert(context.Background(), id, doc)
+		if !assert.Nil(t, err) {
+			return
+		}
+	}
+
+	query := func(subT TestingT, q Query) ([]string, string, bool) {
+		q.Predicates = append(q.Predicates, FieldEquals("suite", "queryable"))
+		result, err := docStore.Query(context.Background(), q)
+		if !assert.Nil(subT, err) {
+			return nil, "", false
+		}
+
+		ids := make([]string, 0, len(result.Documents))
+		for _, doc := range result.Documents {
+			ids = append(ids, doc.ID)
+		}
+		return ids, result.NextCursor, true
+	}
+
+	testCases := []struct {
+		Name       string
+		Predicates []Predicate
+		IDs        []string
+	}{
+		{
+			Name:       "should match equal fields at nested paths",
+			Predicates: []Predicate{FieldEquals("owner.team", "x")},
+			IDs:        []string{"query/a", "query/b"},
+		},
+		{
+			Name:       "should match equal numbers of different types",
+			Predicates: []Predicate{FieldEquals("size", 20)},
+			IDs:        []string{"query/b"},
+		},
+		{
+			Name:       "should match string prefixes",
+			Predicates: []Predicate{FieldHasPrefix("name", "alpha")},
+			IDs:        []string{"query/a", "query/c"},
+		},
+		{
+			Name:       "should match numbers within an inclusive range",
+			Predicates: []Predicate{FieldInRange("size", 15, 30)},
+			IDs:        []string{"query/b", "query/c"},
+		},
+		{
+			Name:       "should match numbers within an open range",
+			Predicates: []Predicate{FieldInRange("size", 20, math.Inf(1))},
+			IDs:        []string{"query/b", "query/c"},
+		},
+		{
+			Name:       "should only match documents matching every predicate",
+			Predicates: []Predicate{FieldEquals("owner.team", "x"), FieldInRange("size", 15, math.Inf(1))},
+			IDs:        []string{"query/b"},
+		},
+		{
+			Name:       "should not match missing fields",
+			Predicates: []Predicate{FieldEquals("owner.email", "ann@example.com")},
+			IDs:        []string{},
+		},
+		{
+			Name:       "should not match paths into arrays",
+			Predicates: []Predicate{FieldEquals("tags.0", "t")},
+			IDs:        []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		tc := testCase
+		t.Run(tc.Name, func(subT TestingT) {
+			ids, next, ok := query(subT, Query{Predicates: tc.Predicates})
+			if !ok {
+				return
+			}
+			assert.Equal(subT, tc.IDs, ids)
+			assert.Empty(subT, next)
+		})
+	}
+
+	t.Run("should page through matching documents", func(subT TestingT) {
+		var pages [][]string
+		cursor := ""
+		for len(pages) <= len(docs) {
+			ids, next, ok := query(subT, Query{Limit: 3, Cursor: cursor})
+			if !ok {
+				return
+			}
+			pages = append(pages, ids)
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		assert.Equal(subT, [][]string{{"query/a", "query/b", "query/c"}, {"query/d"}}, pages)
+	})
+
+	t.Run("should fail with InvalidQueryErr for unknown predicates", func(subT TestingT) {
+		_, err := docStore.Query(context.Background(), Query{
+			Predicates: []Predicate{{Path: "name", Kind: "like", Value: "alpha"}},
+		})
+		var qerr InvalidQueryErr
+		assert.ErrorAs(subT, err, &qerr)
+	})
+}
+
+func (s *InMemoryDocumentStore) Query(ctx context.Context, q Query) (QueryResult, error) {
+	err := q.Validate()
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	s.mu.Lock()
+	var ids []string
+	for id, doc := range s.docs {
+		if q.Matches(doc) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	ids, next := pageIDs(ids, q.Cursor, q.Limit)
+
+	docs := make([]QueryDocument, len(ids))
+	for i, id := range ids {
+		docs[i] = QueryDocument{ID: id, Document: CopyDoc(s.docs[id])}
+	}
+	s.mu.Unlock()
+
+	return QueryResult{Documents: docs, NextCursor: next}, nil
+}
+
+// Search returns the metadata of indexed objects matching the query.
+// Expired and soft deleted entries are left out, so pages may hold
+// fewer documents than the query limit even when there are more pages.
+//
+// Queries go straight to the configured DocumentStore, without
+// the timeouts, concurrency limit or retries of other calls.
+func (s *Service) Search(ctx context.Context, q Query) (result QueryResult, err error) {
+	defer s.observe("Search", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return QueryResult{}, err
+	}
+	defer s.exit()
+
+	queryDB, ok := s.rawDocDB.(QueryableDocumentStore)
+	if !ok {
+		return QueryResult{}, ErrQueryNotSupported
+	}
+
+	for _, p := range q.Predicates {
+		if p.Path == ReservedMetadataKey || strings.HasPrefix(p.Path, ReservedMetadataKey+".") {
+			return QueryResult{}, InvalidQueryErr{Reason: fmt.Sprintf("%s can't be queried", ReservedMetadataKey)}
+		}
+	}
+
+	result, err = queryDB.Query(ctx, q)
+	if err != nil {
+		s.log.Error("unable to query documents", zap.Error(err))
+		return QueryResult{}, err
+	}
+
+	docs := result.Documents[:0]
+	for _, doc := range result.Documents {
+		if strings.HasPrefix(doc.ID, trashIDPrefix) || s.isExpired(doc.Document) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	result.Documents = docs
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package sakuin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemoryQueryableDocumentStore(t *testing.T) {
+	RunQueryableDocumentStorageTests(liftTestingT(t), NewInMemoryDocumentStore())
+}
+
+func TestSearch(t *testing.T) {
+	t.Run("should leave out expired and soft deleted entries", func(subT *testing.T) {
+		now := time.Now()
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().
+				WithDocument("live", map[string]interface{}{"team": "x"}).
+				WithDocument(trashID("deleted"), map[string]interface{}{"team": "x"}).
+				WithDocument("expired", setReservedMetadata(map[string]interface{}{"team": "x"}, expiresAtMetadataKey, formatExpiresAt(now.Add(-time.Minute)))),
+			Now: func() time.Time { return now },
+		})
+
+		result, err := s.Search(context.Background(), Query{
+			Predicates: []Predicate{FieldEquals("team", "x")},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Len(subT, result.Documents, 1) {
+			return
+		}
+		assert.Equal(subT, "live", result.Documents[0].ID)
+	})
+
+	t.Run("should fail to query reserved metadata", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.Search(context.Background(), Query{
+			Predicates: []Predicate{FieldEquals(ReservedMetadataKey+"."+checksumMetadataKey, "sha256:")},
+		})
+		assert.IsType(subT, InvalidQueryErr{}, err)
+	})
+
+	t.Run("should fail if the document store doesn't support queries", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: unrevisionedDocumentStore{NewInMemoryDocumentStore()},
+		})
+
+		_, err := s.Search(context.Background(), Query{})
+		assert.Equal(subT, ErrQueryNotSupported, err)
+	})
+}
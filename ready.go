@@ -0,0 +1,99 @@
+package sakuin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Pinger is optionally implemented by an ObjectStore or DocumentStore
+// which can cheaply check that it's reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Names of the dependencies reported by NotReadyErr.
+const (
+	ObjectStoreDependency   = "object_store"
+	DocumentStoreDependency = "document_store"
+)
+
+// readinessProbeID is statted on stores which don't implement Pinger.
+// It's never indexed, so the Stat only has to succeed.
+const readinessProbeID = "_sakuin_readiness_probe"
+
+// NotReadyErr represents a readiness check which failed for
+// the given dependencies, by name.
+type NotReadyErr struct {
+	Failed map[string]error
+}
+
+func (e NotReadyErr) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failures := make([]string, len(names))
+	for i, name := range names {
+		failures[i] = fmt.Sprintf("%s: %s", name, e.Failed[name])
+	}
+	return "not ready: " + strings.Join(failures, ", ")
+}
+
+// Ready checks that both stores are reachable, using Ping if a store implements
+// Pinger and otherwise a Stat of an id which is never indexed. The stores are
+// checked concurrently and a NotReadyErr is returned if either check fails.
+//
+// The checks go straight to the configured stores, without the timeouts,
+// concurrency limit or retries of other calls, so ctx should have a deadline.
+func (s *Service) Ready(ctx context.Context) (err error) {
+	err = s.enter()
+	if err != nil {
+		return err
+	}
+	defer s.exit()
+
+	var (
+		wg     sync.WaitGroup
+		objErr error
+		docErr error
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		objErr = pingStore(ctx, s.rawObjDB, s.rawObjDB.Stat)
+	}()
+	go func() {
+		defer wg.Done()
+		docErr = pingStore(ctx, s.rawDocDB, s.rawDocDB.Stat)
+	}()
+	wg.Wait()
+
+	failed := make(map[string]error)
+	if objErr != nil {
+		s.log.Error("object store is not ready", zap.Error(objErr))
+		failed[ObjectStoreDependency] = objErr
+	}
+	if docErr != nil {
+		s.log.Error("document store is not ready", zap.Error(docErr))
+		failed[DocumentStoreDependency] = docErr
+	}
+	if len(failed) > 0 {
+		return NotReadyErr{Failed: failed}
+	}
+	return nil
+}
+
+func pingStore(ctx context.Context, store interface{}, stat func(context.Context, string) (*StatInfo, error)) error {
+	if p, ok := store.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	_, err := stat(ctx, readinessProbeID)
+	return err
+}
@@ -0,0 +1,74 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pingingObjectStore struct {
+	*InMemoryObjectStore
+	err error
+}
+
+func (s pingingObjectStore) Ping(ctx context.Context) error {
+	return s.err
+}
+
+type statFailingDocumentStore struct {
+	*InMemoryDocumentStore
+}
+
+func (s statFailingDocumentStore) Stat(ctx context.Context, id string) (*StatInfo, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestReady(t *testing.T) {
+	t.Run("should be ready if both stores respond", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   pingingObjectStore{InMemoryObjectStore: NewInMemoryObjectStore()},
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		err := s.Ready(context.Background())
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should report which stores failed", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore: pingingObjectStore{
+				InMemoryObjectStore: NewInMemoryObjectStore(),
+				err:                 errors.New("bucket not found"),
+			},
+			DocumentStore: statFailingDocumentStore{NewInMemoryDocumentStore()},
+		})
+
+		err := s.Ready(context.Background())
+
+		var readyErr NotReadyErr
+		if !assert.ErrorAs(subT, err, &readyErr) {
+			return
+		}
+		assert.Len(subT, readyErr.Failed, 2)
+		assert.EqualError(subT, readyErr.Failed[ObjectStoreDependency], "bucket not found")
+		assert.EqualError(subT, readyErr.Failed[DocumentStoreDependency], "connection refused")
+		assert.Equal(subT, "not ready: document_store: connection refused, object_store: bucket not found", err.Error())
+	})
+
+	t.Run("should not be ready once closed", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		err := s.Close(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Ready(context.Background())
+		assert.Equal(subT, ErrServiceClosed, err)
+	})
+}
@@ -0,0 +1,246 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryPolicy configures how store calls which failed with
+// transient errors are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts per store call,
+	// including the first one. Retries are disabled when less than 2.
+	MaxAttempts int
+
+	// BaseBackoff is how long to wait before the first retry.
+	// The wait doubles after every retry.
+	BaseBackoff time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of every wait which is randomised.
+	Jitter float64
+
+	// Retryable reports whether a failed store call should be retried.
+	// Defaults to retrying all errors. Not found, already exists, revision
+	// mismatch and context errors are never retried, though a StoreTimeoutErr may be.
+	Retryable func(error) bool
+
+	// log is set when the policy wraps a store.
+	log *zap.Logger
+}
+
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	switch err.(type) {
+	case ObjectDoesNotExistErr, DocumentDoesNotExistErr, ObjectAlreadyExistsErr, RevisionMismatchErr:
+		return false
+	}
+	if errors.Is(err, ErrRevisionsNotSupported) {
+		return false
+	}
+
+	// Calls which hit their own timeout may be retried, but not
+	// those which failed because the request context is done.
+	var timeoutErr StoreTimeoutErr
+	if !errors.As(err, &timeoutErr) && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return false
+	}
+	if p.Retryable == nil {
+		return true
+	}
+	return p.Retryable(err)
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseBackoff << retry
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// do calls f until it succeeds, fails with an error which isn't retryable,
+// runs out of attempts or the context is done.
+func (p RetryPolicy) do(ctx context.Context, op string, f func() error) error {
+	var err error
+	for attempt := 0; attempt < p.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(p.backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+
+		err = f()
+		if err == nil || !p.retryable(err) {
+			return err
+		}
+		p.log.Warn("store call failed", zap.String("op", op), zap.Int("attempt", attempt+1), zap.Error(err))
+	}
+	return err
+}
+
+// wrapObjectStore applies the policy to every call of the given store,
+// preserving whether it implements StreamingObjectStore.
+func (p RetryPolicy) wrapObjectStore(log *zap.Logger, objDB ObjectStore) ObjectStore {
+	if objDB == nil || !p.enabled() {
+		return objDB
+	}
+	p.log = log
+
+	r := retryObjectStore{objDB: objDB, policy: p}
+	if streamDB, ok := objDB.(StreamingObjectStore); ok {
+		return retryStreamingObjectStore{retryObjectStore: r, streamDB: streamDB}
+	}
+	return r
+}
+
+// wrapDocumentStore applies the policy to every call of the given store,
+// preserving whether it implements RevisionedDocumentStore.
+func (p RetryPolicy) wrapDocumentStore(log *zap.Logger, docDB DocumentStore) DocumentStore {
+	if docDB == nil || !p.enabled() {
+		return docDB
+	}
+	p.log = log
+
+	r := retryDocumentStore{docDB: docDB, policy: p}
+	if revDB, ok := docDB.(RevisionedDocumentStore); ok {
+		return retryRevisionedDocumentStore{retryDocumentStore: r, revDB: revDB}
+	}
+	return r
+}
+
+type retryObjectStore struct {
+	objDB  ObjectStore
+	policy RetryPolicy
+}
+
+func (s retryObjectStore) Stat(ctx context.Context, id string) (info *StatInfo, err error) {
+	err = s.policy.do(ctx, "object stat", func() error {
+		info, err = s.objDB.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s retryObjectStore) Get(ctx context.Context, id string) (b []byte, err error) {
+	err = s.policy.do(ctx, "object get", func() error {
+		b, err = s.objDB.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s retryObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.policy.do(ctx, "object put", func() error {
+		return s.objDB.Put(ctx, id, b)
+	})
+}
+
+func (s retryObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	return s.policy.do(ctx, "object update", func() error {
+		return s.objDB.Update(ctx, id, b)
+	})
+}
+
+func (s retryObjectStore) Delete(ctx context.Context, id string) error {
+	return s.policy.do(ctx, "object delete", func() error {
+		return s.objDB.Delete(ctx, id)
+	})
+}
+
+type retryStreamingObjectStore struct {
+	retryObjectStore
+	streamDB StreamingObjectStore
+}
+
+// PutStream is never retried since r can only be read once.
+func (s retryStreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.streamDB.PutStream(ctx, id, r, size)
+}
+
+func (s retryStreamingObjectStore) GetStream(ctx context.Context, id string) (rc io.ReadCloser, size int64, err error) {
+	err = s.policy.do(ctx, "object get stream", func() error {
+		rc, size, err = s.streamDB.GetStream(ctx, id)
+		return err
+	})
+	return
+}
+
+type retryDocumentStore struct {
+	docDB  DocumentStore
+	policy RetryPolicy
+}
+
+func (s retryDocumentStore) Stat(ctx context.Context, id string) (info *StatInfo, err error) {
+	err = s.policy.do(ctx, "document stat", func() error {
+		info, err = s.docDB.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s retryDocumentStore) Get(ctx context.Context, id string) (doc map[string]interface{}, err error) {
+	err = s.policy.do(ctx, "document get", func() error {
+		doc, err = s.docDB.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s retryDocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.policy.do(ctx, "document upsert", func() error {
+		return s.docDB.Upsert(ctx, id, doc)
+	})
+}
+
+func (s retryDocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.policy.do(ctx, "document replace", func() error {
+		return s.docDB.Replace(ctx, id, doc)
+	})
+}
+
+func (s retryDocumentStore) Delete(ctx context.Context, id string) error {
+	return s.policy.do(ctx, "document delete", func() error {
+		return s.docDB.Delete(ctx, id)
+	})
+}
+
+type retryRevisionedDocumentStore struct {
+	retryDocumentStore
+	revDB RevisionedDocumentStore
+}
+
+func (s retryRevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (doc map[string]interface{}, rev string, err error) {
+	err = s.policy.do(ctx, "document get", func() error {
+		doc, rev, err = s.revDB.GetWithRevision(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s retryRevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.policy.do(ctx, "document upsert", func() error {
+		rev, err = s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
+
+func (s retryRevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.policy.do(ctx, "document replace", func() error {
+		rev, err = s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
@@ -0,0 +1,168 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var errThrottled = errors.New("throttled")
+
+// flakyObjectStore fails the first failures calls to Get with err.
+type flakyObjectStore struct {
+	ObjectStore
+	failures int32
+	err      error
+	attempts int32
+}
+
+func (s *flakyObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	if atomic.AddInt32(&s.attempts, 1) <= s.failures {
+		return nil, s.err
+	}
+	return s.ObjectStore.Get(ctx, id)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Run("should retry until the store call succeeds", func(subT *testing.T) {
+		objStore := &flakyObjectStore{
+			ObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			failures:    2,
+			err:         errThrottled,
+		}
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RetryPolicy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseBackoff: time.Millisecond,
+			},
+		})
+
+		resp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), resp.Content)
+		assert.Equal(subT, int32(3), objStore.attempts)
+	})
+
+	t.Run("should give up after max attempts", func(subT *testing.T) {
+		objStore := &flakyObjectStore{
+			ObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			failures:    5,
+			err:         errThrottled,
+		}
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RetryPolicy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseBackoff: time.Millisecond,
+				Jitter:      0.5,
+			},
+		})
+
+		_, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		assert.Equal(subT, errThrottled, err)
+		assert.Equal(subT, int32(3), objStore.attempts)
+	})
+
+	t.Run("should only retry errors accepted by Retryable", func(subT *testing.T) {
+		objStore := &flakyObjectStore{
+			ObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			failures:    2,
+			err:         errors.New("permanent"),
+		}
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RetryPolicy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseBackoff: time.Millisecond,
+				Retryable: func(err error) bool {
+					return errors.Is(err, errThrottled)
+				},
+			},
+		})
+
+		_, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		assert.Error(subT, err)
+		assert.Equal(subT, int32(1), objStore.attempts)
+	})
+
+	t.Run("should never retry not found errors", func(subT *testing.T) {
+		objStore := &flakyObjectStore{
+			ObjectStore: NewInMemoryObjectStore(),
+			failures:    1,
+			err:         ObjectDoesNotExistErr{ID: "test"},
+		}
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RetryPolicy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseBackoff: time.Millisecond,
+			},
+		})
+
+		_, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+
+		var objErr ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+		assert.Equal(subT, int32(1), objStore.attempts)
+	})
+
+	t.Run("should stop retrying once the context is cancelled", func(subT *testing.T) {
+		objStore := &flakyObjectStore{
+			ObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			failures:    5,
+			err:         errThrottled,
+		}
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RetryPolicy: RetryPolicy{
+				MaxAttempts: 5,
+				BaseBackoff: time.Hour,
+			},
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err := s.GetObject(ctx, &pb.GetObjectRequest{Id: "test"})
+		assert.Equal(subT, errThrottled, err)
+		assert.Equal(subT, int32(1), objStore.attempts)
+		assert.Less(subT, time.Since(start), time.Second)
+	})
+
+	t.Run("should preserve optional store interfaces", func(subT *testing.T) {
+		p := RetryPolicy{MaxAttempts: 2}
+
+		_, ok := p.wrapDocumentStore(zap.NewNop(), NewInMemoryDocumentStore()).(RevisionedDocumentStore)
+		assert.True(subT, ok)
+
+		_, ok = p.wrapDocumentStore(zap.NewNop(), unrevisionedDocumentStore{NewInMemoryDocumentStore()}).(RevisionedDocumentStore)
+		assert.False(subT, ok)
+
+		_, ok = p.wrapObjectStore(zap.NewNop(), nonStreamingObjectStore{NewInMemoryObjectStore()}).(StreamingObjectStore)
+		assert.False(subT, ok)
+
+		_, ok = p.wrapObjectStore(zap.NewNop(), &streamingObjectStore{InMemoryObjectStore: NewInMemoryObjectStore()}).(StreamingObjectStore)
+		assert.True(subT, ok)
+	})
+}
@@ -6,137 +6,1105 @@ package sakuin
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"hash/fnv"
 	"io"
+	"sync"
+	"time"
 
 	pb "github.com/z5labs/sakuin/proto"
 
-	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// ErrMissingID represents a request which requires an id but didn't provide one.
+var ErrMissingID = errors.New("missing id")
+
 type Config struct {
 	ObjectStore   ObjectStore
 	DocumentStore DocumentStore
 	RandSrc       io.Reader
+
+	// IDGenerator generates ids for newly indexed objects.
+	// Defaults to a UUIDGenerator reading from RandSrc.
+	IDGenerator IDGenerator
+
+	// MaxIDAttempts is how many ids are generated for an object before giving
+	// up on finding one which isn't already used. Defaults to DefaultMaxIDAttempts.
+	MaxIDAttempts int
+
+	// ChecksumAlgorithm is used for computing object checksums.
+	// Defaults to SHA256.
+	ChecksumAlgorithm ChecksumAlgorithm
+
+	// ExpirationIndex tracks when entries expire.
+	// Defaults to an InMemoryExpirationIndex.
+	ExpirationIndex ExpirationIndex
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	// MaxObjectSize is the maximum size, in bytes, of an object.
+	// Zero means unlimited.
+	MaxObjectSize int64
+
+	// ObjectCipher, if set, encrypts objects before they're stored and
+	// decrypts them when read. Streaming reads and writes are buffered
+	// in memory when it's set.
+	ObjectCipher ObjectCipher
+
+	// CompressObjects is how objects are compressed before they're stored,
+	// and before they're encrypted. Objects are always decompressed when read,
+	// so changing it doesn't affect objects which are already stored.
+	// Defaults to CompressionNone.
+	CompressObjects Compression
+
+	// MetadataValidator, if set, must accept metadata before it's written.
+	MetadataValidator MetadataValidator
+
+	// Hooks are called after entries have been changed.
+	Hooks Hooks
+
+	// Metrics receives measurements from every operation.
+	// Defaults to discarding them.
+	Metrics Metrics
+
+	// RetryPolicy is applied to every ObjectStore and DocumentStore call.
+	// Defaults to not retrying.
+	RetryPolicy RetryPolicy
+
+	// Timeouts bound every attempt of an ObjectStore or DocumentStore call.
+	// Defaults to no timeouts.
+	Timeouts Timeouts
+
+	// AuditStore, if set, records every change to metadata.
+	AuditStore AuditStore
+
+	// IdempotencyStore records the ids assigned to idempotency keys.
+	// Defaults to an InMemoryIdempotencyStore.
+	IdempotencyStore IdempotencyStore
+
+	// IdempotencyWindow is how long an idempotency key is remembered for.
+	// Defaults to DefaultIdempotencyWindow.
+	IdempotencyWindow time.Duration
+
+	// SoftDelete makes Delete move entries to the trash, from where
+	// they can be restored until they're purged by PurgeTrash.
+	SoftDelete bool
+
+	// TrashIndex tracks when entries were moved to the trash.
+	// Defaults to an InMemoryExpirationIndex.
+	TrashIndex ExpirationIndex
+
+	// MaxConcurrentStoreOps is how many ObjectStore and DocumentStore calls,
+	// in total, may be in flight at once. Zero means unlimited.
+	MaxConcurrentStoreOps int
+
+	// BulkConcurrency is how many ids bulk operations process concurrently.
+	// Defaults to DefaultBulkConcurrency.
+	BulkConcurrency int
+
+	// DedupeByContent makes Index return the id of an already indexed,
+	// identical object instead of storing the object again.
+	DedupeByContent bool
+
+	// HashIndex maps checksums to ids when DedupeByContent is set.
+	// Defaults to an InMemoryHashIndex.
+	HashIndex HashIndex
+
+	// Logger receives all of the logs written by the Service.
+	// Defaults to discarding them.
+	Logger *zap.Logger
 }
 
 type Service struct {
 	objDB ObjectStore
 	docDB DocumentStore
 
-	rander io.Reader
+	idGen           IDGenerator
+	maxIDAttempts   int
+	checksumAlg     ChecksumAlgorithm
+	expirations     ExpirationIndex
+	now             func() time.Time
+	maxObjSize      int64
+	validator       MetadataValidator
+	hooks           Hooks
+	metrics         Metrics
+	bulkConcurrency int
+	dedupe          bool
+	hashes          HashIndex
+	auditStore      AuditStore
+	idempotency     IdempotencyStore
+	idemWindow      time.Duration
+	softDelete      bool
+	trash           ExpirationIndex
+	log             *zap.Logger
+
+	// rawObjDB and rawDocDB are the configured stores, without
+	// any retries, timeouts or limits, for detecting optional interfaces.
+	rawObjDB ObjectStore
+	rawDocDB DocumentStore
+
+	closeMu  sync.RWMutex
+	closed   bool
+	inflight sync.WaitGroup
+
+	// updateLocks serialize the updates of an object, by the hash of its id.
+	updateLocks [64]sync.Mutex
 }
 
 func New(cfg Config) *Service {
+	idGen := cfg.IDGenerator
+	if idGen == nil {
+		idGen = UUIDGenerator{RandSrc: cfg.RandSrc}
+	}
+
+	maxIDAttempts := cfg.MaxIDAttempts
+	if maxIDAttempts <= 0 {
+		maxIDAttempts = DefaultMaxIDAttempts
+	}
+
+	checksumAlg := cfg.ChecksumAlgorithm
+	if checksumAlg == "" {
+		checksumAlg = SHA256
+	}
+
+	expirations := cfg.ExpirationIndex
+	if expirations == nil {
+		expirations = NewInMemoryExpirationIndex()
+	}
+
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+
+	hashes := cfg.HashIndex
+	if hashes == nil {
+		hashes = NewInMemoryHashIndex()
+	}
+
+	idempotency := cfg.IdempotencyStore
+	if idempotency == nil {
+		idempotency = NewInMemoryIdempotencyStore()
+	}
+
+	idemWindow := cfg.IdempotencyWindow
+	if idemWindow <= 0 {
+		idemWindow = DefaultIdempotencyWindow
+	}
+
+	trash := cfg.TrashIndex
+	if trash == nil {
+		trash = NewInMemoryExpirationIndex()
+	}
+
+	log := cfg.Logger
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	bulkConcurrency := cfg.BulkConcurrency
+	if bulkConcurrency <= 0 {
+		bulkConcurrency = DefaultBulkConcurrency
+	}
+
+	// Retries wait for a free slot on every attempt, but
+	// waiting doesn't count towards an attempt's timeout
+	limit := newStoreLimit(cfg.MaxConcurrentStoreOps)
+
 	return &Service{
-		objDB:  cfg.ObjectStore,
-		docDB:  cfg.DocumentStore,
-		rander: cfg.RandSrc,
+		objDB:           cfg.RetryPolicy.wrapObjectStore(log, limit.wrapObjectStore(cfg.Timeouts.wrapObjectStore(compressObjectStore(cfg.CompressObjects, encryptObjectStore(cfg.ObjectCipher, cfg.ObjectStore))))),
+		docDB:           cfg.RetryPolicy.wrapDocumentStore(log, limit.wrapDocumentStore(cfg.Timeouts.wrapDocumentStore(cfg.DocumentStore))),
+		idGen:           idGen,
+		maxIDAttempts:   maxIDAttempts,
+		checksumAlg:     checksumAlg,
+		expirations:     expirations,
+		now:             now,
+		maxObjSize:      cfg.MaxObjectSize,
+		validator:       cfg.MetadataValidator,
+		hooks:           cfg.Hooks,
+		metrics:         metrics,
+		bulkConcurrency: bulkConcurrency,
+		dedupe:          cfg.DedupeByContent,
+		hashes:          hashes,
+		auditStore:      cfg.AuditStore,
+		idempotency:     idempotency,
+		idemWindow:      idemWindow,
+		softDelete:      cfg.SoftDelete,
+		trash:           trash,
+		log:             log,
+		rawObjDB:        cfg.ObjectStore,
+		rawDocDB:        cfg.DocumentStore,
+	}
+}
+
+// logger returns a logger scoped to a single request for the given id.
+func (s *Service) logger(id string) *zap.Logger {
+	return s.log.With(zap.String("id", id))
+}
+
+func (s *Service) checkObjectSize(obj []byte) error {
+	size := int64(len(obj))
+	if s.maxObjSize > 0 && size > s.maxObjSize {
+		s.log.Error("object is too large", zap.Int64("size", size), zap.Int64("limit", s.maxObjSize))
+		return ObjectTooLargeErr{Limit: s.maxObjSize, Size: size}
 	}
+	return nil
 }
 
-func (s *Service) GetObject(ctx context.Context, req *pb.GetObjectRequest) (*pb.GetObjectResponse, error) {
+func (s *Service) checkObjectNotEmpty(id string, obj []byte, allowEmpty bool) error {
+	if len(obj) == 0 && !allowEmpty {
+		s.logger(id).Error("object has no content")
+		return EmptyObjectErr{ID: id}
+	}
+	return nil
+}
+
+func (s *Service) GetObject(ctx context.Context, req *pb.GetObjectRequest) (resp *pb.GetObjectResponse, err error) {
+	defer s.observe("GetObject", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	log := s.logger(req.Id)
+
 	obj, err := s.objDB.Get(ctx, req.Id)
 	if err != nil {
 		return nil, err
 	}
-	return &pb.GetObjectResponse{Content: obj}, nil
+
+	doc, err := s.getReserved(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if s.isExpired(doc) {
+		log.Warn("object has expired")
+		return nil, ObjectDoesNotExistErr{ID: req.Id}
+	}
+
+	return &pb.GetObjectResponse{
+		Content:     obj,
+		Checksum:    getReservedString(doc, checksumMetadataKey),
+		ContentType: getReservedString(doc, contentTypeMetadataKey),
+		Filename:    getReservedString(doc, filenameMetadataKey),
+	}, nil
 }
 
-func (s *Service) UpdateObject(ctx context.Context, req *pb.UpdateObjectRequest) (*pb.UpdateObjectResponse, error) {
-	return nil, s.objDB.Update(ctx, req.Id, req.Content)
+// StatObject reports what's known about an object without reading it. The
+// checksum and content type recorded by the Service take precedence over
+// any reported by the ObjectStore.
+func (s *Service) StatObject(ctx context.Context, id string) (info *StatInfo, err error) {
+	defer s.observe("StatObject", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	log := s.logger(id)
+
+	info, err = s.objDB.Stat(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Exists {
+		return nil, ObjectDoesNotExistErr{ID: id}
+	}
+
+	doc, err := s.getReserved(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.isExpired(doc) {
+		log.Warn("object has expired")
+		return nil, ObjectDoesNotExistErr{ID: id}
+	}
+
+	applyReservedStat(info, doc)
+	return info, nil
+}
+
+// applyReservedStat overrides the checksum and content type reported
+// by the ObjectStore with those recorded by the Service.
+func applyReservedStat(info *StatInfo, doc map[string]interface{}) {
+	if checksum := getReservedString(doc, checksumMetadataKey); checksum != "" {
+		info.Checksum = checksum
+	}
+	if contentType := getReservedString(doc, contentTypeMetadataKey); contentType != "" {
+		info.ContentType = contentType
+	}
+}
+
+// EntryStat reports on the object and metadata indexed under an id,
+// either of which is nil if it doesn't exist.
+type EntryStat struct {
+	Object   *StatInfo
+	Metadata *StatInfo
 }
 
-func (s *Service) GetMetadata(ctx context.Context, req *pb.GetMetadataRequest) (*pb.GetMetadataResponse, error) {
-	metadata, err := s.docDB.Get(ctx, req.Id)
+// Stat reports on both the object and metadata indexed under id without
+// reading the object, so neither existing isn't an error. The Size of the
+// metadata is its number of top level fields, not counting the bookkeeping
+// recorded by the Service, and metadata holding only that is reported as missing.
+func (s *Service) Stat(ctx context.Context, id string) (stat *EntryStat, err error) {
+	defer s.observe("Stat", time.Now(), &err)
+
+	err = s.enter()
 	if err != nil {
-		zap.L().Error("unexpected error when getting metadata", zap.String("id", req.Id))
 		return nil, err
 	}
+	defer s.exit()
+
+	log := s.logger(id)
 
-	any, err := marshalJSONToAny(metadata)
+	doc, err := s.getReserved(ctx, id)
 	if err != nil {
 		return nil, err
 	}
+	if s.isExpired(doc) {
+		log.Warn("entry has expired")
+		return &EntryStat{}, nil
+	}
 
-	return &pb.GetMetadataResponse{Metadata: any}, nil
+	stat = &EntryStat{}
+	objInfo, err := s.objDB.Stat(ctx, id)
+	if err != nil {
+		log.Error("unexpected error when stat-ing object", zap.Error(err))
+		return nil, err
+	}
+	if objInfo.Exists {
+		applyReservedStat(objInfo, doc)
+		stat.Object = objInfo
+	}
+
+	fields := len(doc)
+	if _, ok := doc[ReservedMetadataKey]; ok {
+		fields--
+	}
+	if fields == 0 {
+		return stat, nil
+	}
+
+	docInfo, err := s.docDB.Stat(ctx, id)
+	if err != nil {
+		log.Error("unexpected error when stat-ing metadata", zap.Error(err))
+		return nil, err
+	}
+	if docInfo.Exists {
+		docInfo.Size = fields
+		stat.Metadata = docInfo
+	}
+	return stat, nil
 }
 
-func (s *Service) UpdateMetadata(ctx context.Context, req *pb.UpdateMetadataRequest) (*pb.UpdateMetadataResponse, error) {
-	stats, err := s.docDB.Stat(ctx, req.Id)
+// UpdateObject replaces the content of an existing object. Given expected
+// checksums, the object is only updated if its current content matches one
+// of them, otherwise a ChecksumMismatchErr is returned. Updates of an object
+// through the same Service are serialized so they can't slip in between the
+// comparison and the update, but writes by other processes sharing the
+// stores still can.
+func (s *Service) UpdateObject(ctx context.Context, req *pb.UpdateObjectRequest) (resp *pb.UpdateObjectResponse, err error) {
+	defer s.observe("UpdateObject", time.Now(), &err)
+
+	err = s.enter()
 	if err != nil {
-		zap.L().Error("unexpected error when stat-ing metadata", zap.Error(err))
 		return nil, err
 	}
-	if !stats.Exists {
-		zap.L().Error("metadata doesn't exist", zap.String("id", req.Id))
+	defer s.exit()
+
+	log := s.logger(req.Id)
+
+	err = s.checkObjectNotEmpty(req.Id, req.Content, req.AllowEmpty)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkObjectSize(req.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err := s.checksumAlg.Checksum(req.Content)
+	if err != nil {
+		log.Error("unexpected error when computing checksum", zap.Error(err))
+		return nil, err
+	}
+
+	mu := s.updateLock(req.Id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	// The previous content is kept for restoring it if recording the checksum fails
+	prev, err := s.objDB.Get(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkExpectedChecksums(req.Id, prev, req.ExpectedChecksums)
+	if err != nil {
+		return nil, err
+	}
+
+	// The content type is always overwritten so a stale one isn't served for the new content
+	reserved := setReservedMetadata(nil, checksumMetadataKey, checksum)
+	reserved = setReservedMetadata(reserved, contentTypeMetadataKey, req.ContentType)
+
+	err = RunTxn(ctx,
+		TxnStep{
+			Name: "update object",
+			Do: func(ctx context.Context) error {
+				return s.objDB.Update(ctx, req.Id, req.Content)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.objDB.Update(ctx, req.Id, prev)
+			},
+		},
+		TxnStep{
+			Name: "record checksum",
+			Do: func(ctx context.Context) error {
+				return s.docDB.Upsert(ctx, req.Id, reserved)
+			},
+		},
+	)
+	if err != nil {
+		log.Error("unable to update object", zap.Error(err))
+		return nil, err
+	}
+	s.metrics.ObserveObjectSize(len(req.Content))
+
+	s.runHook("OnObjectUpdated", s.hooks.OnObjectUpdated, req.Id, HookSummary{Checksum: checksum, Size: len(req.Content)})
+	return &pb.UpdateObjectResponse{Checksum: checksum}, nil
+}
+
+func (s *Service) updateLock(id string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &s.updateLocks[h.Sum32()%uint32(len(s.updateLocks))]
+}
+
+// checkExpectedChecksums fails unless the object matches one of the
+// expected checksums, if there are any. Malformed checksums never match.
+func (s *Service) checkExpectedChecksums(id string, obj []byte, expected []string) error {
+	if len(expected) == 0 {
+		return nil
+	}
+
+	for _, checksum := range expected {
+		ok, err := VerifyChecksum(checksum, obj)
+		if err == nil && ok {
+			return nil
+		}
+	}
+	s.logger(id).Error("object doesn't match the expected checksums")
+	return ChecksumMismatchErr{ID: id, Expected: expected}
+}
+
+// getReserved returns the metadata document holding the reserved
+// metadata for an object, or nil if the object has no metadata.
+func (s *Service) getReserved(ctx context.Context, id string) (map[string]interface{}, error) {
+	log := s.logger(id)
+
+	doc, err := s.docDB.Get(ctx, id)
+	if _, ok := err.(DocumentDoesNotExistErr); ok {
+		return nil, nil
+	}
+	if err != nil {
+		log.Error("unexpected error when getting reserved metadata", zap.Error(err))
+		return nil, err
+	}
+	return doc, nil
+}
+
+// GetMetadata returns the metadata indexed under id. The bookkeeping
+// recorded by the Service is left out of the metadata, so it can be sent
+// back to UpdateMetadata as is, and the checksum and content type recorded
+// for the object are returned as fields of the response instead.
+func (s *Service) GetMetadata(ctx context.Context, req *pb.GetMetadataRequest) (resp *pb.GetMetadataResponse, err error) {
+	defer s.observe("GetMetadata", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	log := s.logger(req.Id)
+
+	metadata, revision, err := s.getMetadata(ctx, req.Id)
+	if err != nil {
+		log.Error("unexpected error when getting metadata")
+		return nil, err
+	}
+	if s.isExpired(metadata) {
+		log.Warn("metadata has expired")
+		return nil, DocumentDoesNotExistErr{ID: req.Id}
+	}
+
+	// Like Stat, metadata holding nothing but the reserved metadata is
+	// reported as missing.
+	fields := withoutReserved(metadata)
+	if len(fields) == 0 {
 		return nil, DocumentDoesNotExistErr{ID: req.Id}
 	}
 
+	marshal := marshalJSONToAny
+	if req.AsStruct {
+		marshal = marshalJSONToStruct
+	}
+	any, err := marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetMetadataResponse{
+		Metadata:    any,
+		Revision:    revision,
+		Checksum:    getReservedString(metadata, checksumMetadataKey),
+		ContentType: getReservedString(metadata, contentTypeMetadataKey),
+	}, nil
+}
+
+func (s *Service) getMetadata(ctx context.Context, id string) (map[string]interface{}, string, error) {
+	if revDB, ok := s.docDB.(RevisionedDocumentStore); ok {
+		return revDB.GetWithRevision(ctx, id)
+	}
+
+	metadata, err := s.docDB.Get(ctx, id)
+	return metadata, "", err
+}
+
+func (s *Service) UpdateMetadata(ctx context.Context, req *pb.UpdateMetadataRequest) (resp *pb.UpdateMetadataResponse, err error) {
+	defer s.observe("UpdateMetadata", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
 	metadata, err := unmarshalAnyToJSON(req.Metadata)
 	if err != nil {
+		s.logger(req.Id).Error("unable to unmarshal metadata", zap.Error(err))
 		return nil, err
 	}
 
-	zap.L().Info("updating metadata", zap.String("id", req.Id))
-	return nil, s.docDB.Upsert(ctx, req.Id, metadata)
+	revision, err := s.updateMetadata(ctx, req.Id, metadata, req.ExpectedRevision)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateMetadataResponse{Revision: revision}, nil
 }
 
-func (s *Service) Index(ctx context.Context, req *pb.IndexRequest) (*pb.IndexResponse, error) {
-	id, err := s.generateUUID(ctx)
+// updateMetadata merges the metadata into the existing metadata and
+// returns the new revision, if the DocumentStore supports revisions.
+func (s *Service) updateMetadata(ctx context.Context, id string, metadata map[string]interface{}, expectedRevision string) (string, error) {
+	log := s.logger(id)
+
+	stats, err := s.docDB.Stat(ctx, id)
+	if err != nil {
+		log.Error("unexpected error when stat-ing metadata", zap.Error(err))
+		return "", err
+	}
+	if !stats.Exists {
+		log.Error("metadata doesn't exist")
+		return "", DocumentDoesNotExistErr{ID: id}
+	}
+
+	err = s.validateMetadata(ctx, id, metadata)
+	if err != nil {
+		return "", err
+	}
+
+	old, audited := s.auditSnapshot(ctx, id)
+
+	log.Info("updating metadata")
+	var revision string
+	revDB, ok := s.docDB.(RevisionedDocumentStore)
+	if !ok {
+		if expectedRevision != "" {
+			log.Error("document store does not support revisions")
+			return "", ErrRevisionsNotSupported
+		}
+		err = s.docDB.Upsert(ctx, id, metadata)
+	} else {
+		revision, err = revDB.UpsertIfRevision(ctx, id, metadata, expectedRevision)
+	}
+	if err != nil {
+		log.Error("unexpected error when updating metadata", zap.Error(err))
+		return "", err
+	}
+
+	if audited {
+		s.audit(ctx, id, AuditUpdate, old, upsertedMetadata(metadata, old))
+	}
+	s.runHook("OnMetadataUpdated", s.hooks.OnMetadataUpdated, id, HookSummary{Revision: revision})
+	return revision, nil
+}
+
+func (s *Service) Index(ctx context.Context, req *pb.IndexRequest) (resp *pb.IndexResponse, err error) {
+	defer s.observe("Index", time.Now(), &err)
+
+	err = s.enter()
 	if err != nil {
 		return nil, err
 	}
+	defer s.exit()
 
-	g, gctx := errgroup.WithContext(ctx)
+	err = s.checkObjectNotEmpty(req.Id, req.Object, req.AllowEmpty)
+	if err != nil {
+		return nil, err
+	}
 
-	// Upload object to object store
-	g.Go(func() error {
-		zap.L().Info("indexing object", zap.String("id", id))
-		return s.objDB.Put(gctx, id, req.Object)
-	})
+	err = s.checkObjectSize(req.Object)
+	if err != nil {
+		return nil, err
+	}
 
-	// Upload document to doc store
+	var metadata map[string]interface{}
 	if req.Metadata != nil {
-		g.Go(func() error {
-			metadata, err := unmarshalAnyToJSON(req.Metadata)
-			if err != nil {
-				return err
-			}
-
-			zap.L().Info("indexing metadata", zap.String("id", id))
-			return s.docDB.Upsert(gctx, id, metadata)
-		})
+		metadata, err = unmarshalAnyToJSON(req.Metadata)
+		if err != nil {
+			s.log.Error("unable to unmarshal metadata", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	checksum, err := s.checksumAlg.Checksum(req.Object)
+	if err != nil {
+		s.log.Error("unexpected error when computing checksum", zap.Error(err))
+		return nil, err
+	}
+
+	if req.IdempotencyKey != "" && !req.DryRun {
+		id, replay, rerr := s.reserveIdempotencyKey(ctx, req.IdempotencyKey)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if replay {
+			return &pb.IndexResponse{Id: id, Checksum: checksum}, nil
+		}
+		defer func() {
+			s.settleIdempotencyKey(ctx, req.IdempotencyKey, resp, err)
+		}()
+	}
+
+	// Caller supplied ids are always honoured, so only generated ids are deduplicated
+	if s.dedupe && req.Id == "" && !req.DryRun {
+		id, ok, err := s.deduplicate(ctx, checksum, metadata)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &pb.IndexResponse{Id: id, Checksum: checksum, Deduplicated: true}, nil
+		}
+	}
+
+	id, err := s.indexID(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	log := s.logger(id)
+
+	err = s.validateMetadata(ctx, id, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DryRun {
+		log.Info("dry run, skipping writes")
+		return &pb.IndexResponse{Id: id, Checksum: checksum, DryRun: true}, nil
+	}
+
+	expiresAt, expires := s.expiresAt(req)
+
+	doc := indexedMetadata(metadata, checksum, req, expiresAt, expires)
+
+	err = RunTxn(ctx,
+		TxnStep{
+			Name: "put object",
+			Do: func(ctx context.Context) error {
+				log.Info("indexing object")
+				return s.objDB.Put(ctx, id, req.Object)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.objDB.Delete(ctx, id)
+			},
+		},
+		TxnStep{
+			Name: "upsert metadata",
+			Do: func(ctx context.Context) error {
+				log.Info("indexing metadata")
+				return s.docDB.Upsert(ctx, id, doc)
+			},
+		},
+	)
+	if err != nil {
+		log.Error("unable to index", zap.Error(err))
+		return nil, err
+	}
+	s.metrics.ObserveObjectSize(len(req.Object))
+
+	if expires {
+		s.trackExpiration(ctx, id, expiresAt)
+	}
+	s.recordChecksum(ctx, checksum, id)
+
+	s.runHook("OnIndexed", s.hooks.OnIndexed, id, HookSummary{Checksum: checksum, Size: len(req.Object)})
+	return &pb.IndexResponse{Id: id, Checksum: checksum}, nil
+}
+
+// indexedMetadata records the reserved metadata of a newly indexed object in its metadata.
+func indexedMetadata(metadata map[string]interface{}, checksum string, req *pb.IndexRequest, expiresAt time.Time, expires bool) map[string]interface{} {
+	doc := setReservedMetadata(metadata, checksumMetadataKey, checksum)
+	if req.ContentType != "" {
+		doc = setReservedMetadata(doc, contentTypeMetadataKey, req.ContentType)
+	}
+	if filename := SanitizeFilename(req.Filename); filename != "" {
+		doc = setReservedMetadata(doc, filenameMetadataKey, filename)
+	}
+	if expires {
+		doc = setReservedMetadata(doc, expiresAtMetadataKey, formatExpiresAt(expiresAt))
+	}
+	return doc
+}
+
+// Copy duplicates an object, along with its metadata if it has any,
+// under a new id. If no destination id is given, one will be generated.
+func (s *Service) Copy(ctx context.Context, req *pb.CopyRequest) (resp *pb.CopyResponse, err error) {
+	defer s.observe("Copy", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	id, summary, err := s.copyEntry(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.runHook("OnIndexed", s.hooks.OnIndexed, id, summary)
+	return &pb.CopyResponse{Id: id}, nil
+}
+
+func (s *Service) copyEntry(ctx context.Context, req *pb.CopyRequest) (string, HookSummary, error) {
+	err := checkID(req.DestinationId)
+	if err != nil {
+		return "", HookSummary{}, err
+	}
+
+	obj, err := s.objDB.Get(ctx, req.SourceId)
+	if err != nil {
+		s.log.Error("unable to get source object", zap.String("id", req.SourceId), zap.Error(err))
+		return "", HookSummary{}, err
+	}
+
+	metadata, err := s.docDB.Get(ctx, req.SourceId)
+	if _, ok := err.(DocumentDoesNotExistErr); ok {
+		s.log.Info("source object has no metadata to copy", zap.String("id", req.SourceId))
+		metadata = nil
+		err = nil
+	}
+	if err != nil {
+		s.log.Error("unable to get source metadata", zap.String("id", req.SourceId), zap.Error(err))
+		return "", HookSummary{}, err
+	}
+
+	id, err := s.indexID(ctx, req.DestinationId)
+	if err != nil {
+		return "", HookSummary{}, err
+	}
+
+	summary := HookSummary{Checksum: getReservedString(metadata, checksumMetadataKey), Size: len(obj)}
+
+	s.log.Info("copying object", zap.String("source", req.SourceId), zap.String("destination", id))
+	err = s.objDB.Put(ctx, id, obj)
+	if err != nil {
+		s.log.Error("unable to copy object", zap.String("id", id), zap.Error(err))
+		return "", HookSummary{}, err
+	}
+	s.metrics.ObserveObjectSize(len(obj))
+	if metadata == nil {
+		return id, summary, nil
+	}
+
+	s.log.Info("copying metadata", zap.String("source", req.SourceId), zap.String("destination", id))
+	err = s.docDB.Upsert(ctx, id, CopyDoc(metadata))
+	if err != nil {
+		s.log.Error("unable to copy metadata", zap.String("id", id), zap.Error(err))
+		if errors.Is(err, ErrReadOnly) {
+			return "", HookSummary{}, err
+		}
+		if derr := s.objDB.Delete(ctx, id); derr != nil {
+			s.log.Error("unable to clean up copied object", zap.String("id", id), zap.Error(derr))
+		}
+		return "", HookSummary{}, err
+	}
+
+	if expiresAt, ok := s.getExpiresAt(metadata); ok {
+		s.trackExpiration(ctx, id, expiresAt)
+	}
+	return id, summary, nil
+}
+
+// Move relocates an object, along with its metadata, from its old id to a new id.
+//
+// If the old entry can't be removed the copy is rolled back. When neither
+// is possible a PartialMoveErr is returned naming the id left behind.
+func (s *Service) Move(ctx context.Context, req *pb.MoveRequest) (resp *pb.MoveResponse, err error) {
+	defer s.observe("Move", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
 	}
+	defer s.exit()
 
-	err = g.Wait()
+	if req.NewId == "" {
+		return nil, ErrMissingID
+	}
+	err = checkID(req.NewId)
 	if err != nil {
-		// TODO: cleanup
 		return nil, err
 	}
 
-	return &pb.IndexResponse{Id: id}, nil
+	stats, err := s.objDB.Stat(ctx, req.NewId)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Exists {
+		s.log.Error("object already exists", zap.String("id", req.NewId))
+		return nil, ObjectAlreadyExistsErr{ID: req.NewId}
+	}
+
+	_, summary, err := s.copyEntry(ctx, &pb.CopyRequest{SourceId: req.OldId, DestinationId: req.NewId})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("removing moved object", zap.String("id", req.OldId))
+	err = s.objDB.Delete(ctx, req.OldId)
+	if err != nil {
+		s.log.Error("unable to remove moved object, rolling back", zap.String("id", req.OldId), zap.Error(err))
+		rerr := s.deleteEntry(ctx, req.NewId)
+		if rerr != nil {
+			s.log.Error("unable to roll back move", zap.String("id", req.NewId), zap.Error(rerr))
+			return nil, PartialMoveErr{OldID: req.OldId, NewID: req.NewId, LeftoverID: req.NewId, Err: err}
+		}
+		return nil, err
+	}
+
+	s.log.Info("removing moved metadata", zap.String("id", req.OldId))
+	err = s.docDB.Delete(ctx, req.OldId)
+	if _, ok := err.(DocumentDoesNotExistErr); ok {
+		err = nil
+	}
+	if err != nil {
+		s.log.Error("unable to remove moved metadata", zap.String("id", req.OldId), zap.Error(err))
+		return nil, PartialMoveErr{OldID: req.OldId, NewID: req.NewId, LeftoverID: req.OldId, Err: err}
+	}
+
+	s.runHook("OnDeleted", s.hooks.OnDeleted, req.OldId, HookSummary{})
+	s.runHook("OnIndexed", s.hooks.OnIndexed, req.NewId, summary)
+	return &pb.MoveResponse{}, nil
 }
 
-func (s *Service) generateUUID(ctx context.Context) (string, error) {
-	for {
-		id := uuid.Must(uuid.NewRandomFromReader(s.rander)).String()
-		stats, err := s.objDB.Stat(ctx, id)
+// Delete removes an object along with its metadata, either of which may be
+// missing. If either removal fails, whatever was already removed is restored.
+//
+// When soft deletes are enabled the entry is moved to the trash instead,
+// from where it can be restored until it's purged.
+func (s *Service) Delete(ctx context.Context, req *pb.DeleteRequest) (resp *pb.DeleteResponse, err error) {
+	defer s.observe("Delete", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	log := s.logger(req.Id)
+
+	stats, err := s.objDB.Stat(ctx, req.Id)
+	if err != nil {
+		log.Error("unable to stat object", zap.Error(err))
+		return nil, err
+	}
+
+	doc, err := s.getReserved(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !stats.Exists && doc == nil {
+		log.Error("neither object nor metadata exist")
+		return nil, ObjectDoesNotExistErr{ID: req.Id}
+	}
+
+	var obj []byte
+	if stats.Exists {
+		obj, err = s.objDB.Get(ctx, req.Id)
+		if err != nil {
+			log.Error("unable to get object", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	var steps []TxnStep
+	deletedAt := s.now()
+	if s.softDelete {
+		// Only the most recently deleted entry for an id is kept in the trash
+		err = s.deleteEntry(ctx, trashID(req.Id))
 		if err != nil {
-			return "", err
+			log.Error("unable to clear the trash", zap.Error(err))
+			return nil, err
 		}
-		if !stats.Exists {
-			return id, nil
+		steps = s.trashSteps(req.Id, obj, stats.Exists, doc, deletedAt)
+	}
+	steps = append(steps, s.deleteSteps(req.Id, obj, stats.Exists, doc)...)
+
+	log.Info("deleting object and metadata")
+	err = RunTxn(ctx, steps...)
+	if err != nil {
+		log.Error("unable to delete", zap.Error(err))
+		return nil, err
+	}
+
+	err = s.expirations.Remove(ctx, req.Id)
+	if err != nil {
+		log.Error("unable to stop tracking expiration", zap.Error(err))
+	}
+	if s.softDelete {
+		err = s.trash.Add(ctx, req.Id, deletedAt)
+		if err != nil {
+			log.Error("unable to track trashed entry", zap.Error(err))
 		}
 	}
+	s.audit(ctx, req.Id, AuditDelete, doc, nil)
+
+	s.runHook("OnDeleted", s.hooks.OnDeleted, req.Id, HookSummary{Checksum: getReservedString(doc, checksumMetadataKey), Size: stats.Size})
+	return &pb.DeleteResponse{
+		ObjectDeleted:   stats.Exists,
+		MetadataDeleted: doc != nil,
+		ObjectSize:      int64(stats.Size),
+	}, nil
+}
+
+// DeleteMetadata removes the metadata of an indexed object, including the
+// reserved metadata, while leaving the object itself in place.
+func (s *Service) DeleteMetadata(ctx context.Context, id string) (err error) {
+	defer s.observe("DeleteMetadata", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return err
+	}
+	defer s.exit()
+
+	log := s.logger(id)
+
+	old, audited := s.auditSnapshot(ctx, id)
+
+	log.Info("deleting metadata")
+	err = s.docDB.Delete(ctx, id)
+	if err != nil {
+		log.Error("unable to delete metadata", zap.Error(err))
+		return err
+	}
+
+	if audited {
+		s.audit(ctx, id, AuditDelete, old, nil)
+	}
+	return nil
+}
+
+// DeleteObject removes an indexed object while leaving its metadata in place.
+func (s *Service) DeleteObject(ctx context.Context, id string) (err error) {
+	defer s.observe("DeleteObject", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return err
+	}
+	defer s.exit()
+
+	log := s.logger(id)
+
+	mu := s.updateLock(id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	log.Info("deleting object")
+	err = s.objDB.Delete(ctx, id)
+	if err != nil {
+		log.Error("unable to delete object", zap.Error(err))
+		return err
+	}
+
+	s.forgetChecksum(ctx, id)
+	return nil
+}
+
+// deleteSteps remove the object, if it exists, and the metadata, if any,
+// restoring them when undone.
+func (s *Service) deleteSteps(id string, obj []byte, hasObj bool, doc map[string]interface{}) []TxnStep {
+	var steps []TxnStep
+	if hasObj {
+		steps = append(steps, TxnStep{
+			Name: "delete object",
+			Do: func(ctx context.Context) error {
+				return s.objDB.Delete(ctx, id)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.objDB.Put(ctx, id, obj)
+			},
+		})
+	}
+	if doc != nil {
+		steps = append(steps, TxnStep{
+			Name: "delete metadata",
+			Do: func(ctx context.Context) error {
+				return s.docDB.Delete(ctx, id)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.docDB.Upsert(ctx, id, doc)
+			},
+		})
+	}
+	return steps
+}
+
+// deleteEntry removes both the object and metadata for the given id,
+// ignoring whichever doesn't exist.
+func (s *Service) deleteEntry(ctx context.Context, id string) error {
+	err := s.objDB.Delete(ctx, id)
+	if _, ok := err.(ObjectDoesNotExistErr); !ok && err != nil {
+		return err
+	}
+
+	err = s.docDB.Delete(ctx, id)
+	if _, ok := err.(DocumentDoesNotExistErr); !ok && err != nil {
+		return err
+	}
+	return nil
 }
 
 func marshalJSONToAny(m map[string]interface{}) (*anypb.Any, error) {
 	b, err := json.Marshal(m)
 	if err != nil {
-		zap.L().Error("unexpected error when marshalling json", zap.Error(err))
 		return nil, err
 	}
 
@@ -144,18 +1112,52 @@ func marshalJSONToAny(m map[string]interface{}) (*anypb.Any, error) {
 	return anypb.New(&msg)
 }
 
+// marshalJSONToStruct is like marshalJSONToAny, except the metadata
+// is sent as a google.protobuf.Struct.
+func marshalJSONToStruct(m map[string]interface{}) (*anypb.Any, error) {
+	msg, err := structpb.NewStruct(m)
+	if err != nil {
+		return nil, err
+	}
+	return anypb.New(msg)
+}
+
+// unmarshalAnyToJSON accepts metadata sent as a pb.JSONMetadata or
+// google.protobuf.Struct. Any other message is converted to its JSON
+// form, which records the message type under the "@type" key, so the
+// metadata can be unmarshalled back into the same message with protojson.
 func unmarshalAnyToJSON(any *anypb.Any) (map[string]interface{}, error) {
+	if any.MessageIs(&structpb.Struct{}) {
+		var msg structpb.Struct
+		err := any.UnmarshalTo(&msg)
+		if err != nil {
+			return nil, err
+		}
+		return msg.AsMap(), nil
+	}
+	if any.GetTypeUrl() != "" && !any.MessageIs(&pb.JSONMetadata{}) {
+		b, err := protojson.Marshal(any)
+		if err != nil {
+			return nil, UnsupportedMetadataTypeErr{TypeURL: any.TypeUrl, Err: err}
+		}
+
+		var metadata map[string]interface{}
+		err = json.Unmarshal(b, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		return metadata, nil
+	}
+
 	var msg pb.JSONMetadata
 	err := any.UnmarshalTo(&msg)
 	if err != nil {
-		zap.L().Error("unexpected error when unmarshalling any proto", zap.Error(err))
 		return nil, err
 	}
 
 	var metadata map[string]interface{}
 	err = json.Unmarshal(msg.Json, &metadata)
 	if err != nil {
-		zap.L().Error("unexpected error when unmarshalling json metadata", zap.Error(err))
 		return nil, err
 	}
 
@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 
 	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 func TestGetObject(t *testing.T) {
@@ -22,7 +30,8 @@ func TestGetObject(t *testing.T) {
 	}
 
 	s := New(Config{
-		ObjectStore: objStore,
+		ObjectStore:   objStore,
+		DocumentStore: NewInMemoryDocumentStore(),
 	})
 
 	t.Run("should fail if ID doesn't exist", func(subT *testing.T) {
@@ -54,14 +63,52 @@ func TestGetObject(t *testing.T) {
 	})
 }
 
+func TestStatObject(t *testing.T) {
+	s := New(Config{
+		ObjectStore:   NewInMemoryObjectStore(),
+		DocumentStore: NewInMemoryDocumentStore(),
+	})
+
+	t.Run("should fail if ID doesn't exist", func(subT *testing.T) {
+		_, err := s.StatObject(context.Background(), "missing")
+
+		var objErr ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should report the checksum and content type recorded when indexing", func(subT *testing.T) {
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Id:          "test",
+			Object:      []byte("test object content"),
+			ContentType: "text/plain",
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		info, err := s.StatObject(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, info.Exists)
+		assert.Equal(subT, len("test object content"), info.Size)
+		assert.Equal(subT, resp.Checksum, info.Checksum)
+		assert.Equal(subT, "text/plain", info.ContentType)
+		assert.False(subT, info.CreatedAt.IsZero())
+		assert.False(subT, info.LastModified.IsZero())
+	})
+}
+
 func TestUpdateObject(t *testing.T) {
 	t.Run("should fail if ID doesn't exist", func(subT *testing.T) {
 		s := New(Config{
-			ObjectStore: NewInMemoryObjectStore(),
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
 		})
 
 		_, err := s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{
-			Id: "objectDoesNotExistID",
+			Id:      "objectDoesNotExistID",
+			Content: []byte("new content"),
 		})
 
 		if _, ok := err.(ObjectDoesNotExistErr); err == nil || !ok {
@@ -83,7 +130,8 @@ func TestUpdateObject(t *testing.T) {
 		}
 
 		s := New(Config{
-			ObjectStore: objStore,
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
 		})
 
 		resp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{
@@ -100,6 +148,64 @@ func TestUpdateObject(t *testing.T) {
 			return
 		}
 	})
+
+	t.Run("should fail without writing if the expected checksums don't match", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().
+			WithObject("testObject", []byte("test content"))
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		stale, err := SHA256.Checksum([]byte("stale content"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		_, err = s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{
+			Id:                "testObject",
+			Content:           []byte("new content"),
+			ExpectedChecksums: []string{stale, "malformed"},
+		})
+		if _, ok := err.(ChecksumMismatchErr); !ok {
+			subT.Errorf("expected a ChecksumMismatchErr but got: %v", err)
+			return
+		}
+
+		b, err := objStore.Get(context.Background(), "testObject")
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+		if !bytes.Equal([]byte("test content"), b) {
+			subT.Errorf("expected object to be unchanged but got: %s", b)
+		}
+	})
+
+	t.Run("should succeed if any expected checksum matches", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore: NewInMemoryObjectStore().
+				WithObject("testObject", []byte("test content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		current, err := SHA256.Checksum([]byte("test content"))
+		if err != nil {
+			subT.Error(err)
+			return
+		}
+
+		_, err = s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{
+			Id:                "testObject",
+			Content:           []byte("new content"),
+			ExpectedChecksums: []string{"sha256:stale", current},
+		})
+		if err != nil {
+			subT.Error(err)
+		}
+	})
 }
 
 func TestGetMetadata(t *testing.T) {
@@ -159,6 +265,155 @@ func TestGetMetadata(t *testing.T) {
 			return
 		}
 	})
+
+	t.Run("should return a struct if requested", func(subT *testing.T) {
+		resp, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{
+			Id:       testGoodDocID,
+			AsStruct: true,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var msg structpb.Struct
+		if !assert.Nil(subT, resp.Metadata.UnmarshalTo(&msg)) {
+			return
+		}
+		assert.Equal(subT, testGoodDoc, msg.AsMap())
+	})
+
+	t.Run("should return the reserved metadata as fields of their own", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+				"name": "test",
+				ReservedMetadataKey: map[string]interface{}{
+					checksumMetadataKey:    "sha256:abc",
+					contentTypeMetadataKey: "text/plain",
+				},
+			}),
+		})
+
+		resp, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "sha256:abc", resp.Checksum)
+		assert.Equal(subT, "text/plain", resp.ContentType)
+
+		metadata, err := unmarshalAnyToJSON(resp.Metadata)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, metadata)
+	})
+
+	t.Run("should fail if doc holds only reserved metadata", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+				ReservedMetadataKey: map[string]interface{}{checksumMetadataKey: "sha256:abc"},
+			}),
+		})
+
+		_, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+	})
+}
+
+func TestUnmarshalAnyToJSON(t *testing.T) {
+	t.Run("should accept json metadata", func(subT *testing.T) {
+		any, err := anypb.New(&pb.JSONMetadata{Json: []byte(`{"name":"test","count":1}`)})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		metadata, err := unmarshalAnyToJSON(any)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test", "count": float64(1)}, metadata)
+	})
+
+	t.Run("should accept a struct", func(subT *testing.T) {
+		msg, err := structpb.NewStruct(map[string]interface{}{
+			"name":   "test",
+			"count":  1,
+			"nested": map[string]interface{}{"tags": []interface{}{"a", "b"}},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		any, err := anypb.New(msg)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		metadata, err := unmarshalAnyToJSON(any)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{
+			"name":   "test",
+			"count":  float64(1),
+			"nested": map[string]interface{}{"tags": []interface{}{"a", "b"}},
+		}, metadata)
+
+		any, err = marshalJSONToStruct(metadata)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, any.MessageIs(&structpb.Struct{}))
+
+		roundTripped, err := unmarshalAnyToJSON(any)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, metadata, roundTripped)
+	})
+
+	t.Run("should keep the type of other messages", func(subT *testing.T) {
+		expected := &pb.CopyRequest{SourceId: "a", DestinationId: "b"}
+		any, err := anypb.New(expected)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		metadata, err := unmarshalAnyToJSON(any)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, any.TypeUrl, metadata["@type"])
+		assert.Equal(subT, "a", metadata["sourceId"])
+
+		b, err := json.Marshal(metadata)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		var roundTripped anypb.Any
+		if !assert.Nil(subT, protojson.Unmarshal(b, &roundTripped)) {
+			return
+		}
+		msg, err := roundTripped.UnmarshalNew()
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, proto.Equal(expected, msg))
+	})
+
+	t.Run("should fail for unknown message types", func(subT *testing.T) {
+		any := &anypb.Any{
+			TypeUrl: "type.googleapis.com/unknown.Metadata",
+			Value:   []byte{0x0a, 0x01, 0x61},
+		}
+
+		_, err := unmarshalAnyToJSON(any)
+
+		var terr UnsupportedMetadataTypeErr
+		if !assert.ErrorAs(subT, err, &terr) {
+			return
+		}
+		assert.Equal(subT, any.TypeUrl, terr.TypeURL)
+	})
 }
 
 func TestIndex(t *testing.T) {
@@ -206,6 +461,81 @@ func TestIndex(t *testing.T) {
 		}
 	})
 
+	t.Run("should use caller supplied id", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Id:     "my-id",
+			Object: []byte("test object content"),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "my-id", resp.Id)
+	})
+
+	t.Run("should fail with ObjectAlreadyExistsErr if caller supplied id is taken", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("my-id", []byte("original content"))
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{
+			Id:     "my-id",
+			Object: []byte("test object content"),
+		})
+
+		var existsErr ObjectAlreadyExistsErr
+		if !assert.ErrorAs(subT, err, &existsErr) {
+			return
+		}
+		assert.Equal(subT, "my-id", existsErr.ID)
+
+		obj, err := objStore.Get(context.Background(), "my-id")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("original content"), obj)
+	})
+
+	t.Run("should reject metadata which sets reserved metadata", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		docStore := NewInMemoryDocumentStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+			RandSrc:       rand.Reader,
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{
+			"name": "test",
+			ReservedMetadataKey: map[string]interface{}{
+				checksumMetadataKey:  "sha256:forged",
+				expiresAtMetadataKey: "2000-01-01T00:00:00Z",
+			},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.Index(context.Background(), &pb.IndexRequest{
+			Id:       "my-id",
+			Metadata: metadata,
+			Object:   []byte("test object content"),
+		})
+		if !assert.ErrorIs(subT, err, ErrReservedMetadataKey) {
+			return
+		}
+		assert.Equal(subT, 0, objStore.NumOfObects())
+		assert.Equal(subT, 0, docStore.NumOfDocs())
+	})
+
 	t.Run("should succeed even if uuid already exists in db", func(subT *testing.T) {
 		same := "0123456789ABCDEF"
 		different := "FEDBCA9876543210"
@@ -240,3 +570,916 @@ func TestIndex(t *testing.T) {
 		}
 	})
 }
+
+func TestUpdateMetadata(t *testing.T) {
+	t.Run("should fail if ID doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+			Id:       "docDoesNotExistID",
+			Metadata: metadata,
+		})
+
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+	})
+
+	t.Run("should return the new revision", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		getResp, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "updated"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		updateResp, err := s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+			Id:               "test",
+			Metadata:         metadata,
+			ExpectedRevision: getResp.Revision,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.NotEmpty(subT, getResp.Revision)
+		assert.NotEqual(subT, getResp.Revision, updateResp.Revision)
+	})
+
+	t.Run("should fail with RevisionMismatchErr if another update happened first", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().
+			WithDocument("test", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		// Both clients read the same revision of the metadata
+		clientA, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		clientB, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		metadataA, err := marshalJSONToAny(map[string]interface{}{"name": "a"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+			Id:               "test",
+			Metadata:         metadataA,
+			ExpectedRevision: clientA.Revision,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		metadataB, err := marshalJSONToAny(map[string]interface{}{"name": "b"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+			Id:               "test",
+			Metadata:         metadataB,
+			ExpectedRevision: clientB.Revision,
+		})
+
+		var revErr RevisionMismatchErr
+		if !assert.ErrorAs(subT, err, &revErr) {
+			return
+		}
+		assert.Equal(subT, clientB.Revision, revErr.Expected)
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "a", doc["name"])
+	})
+
+	t.Run("should reject metadata which sets reserved metadata", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+			"name":              "test",
+			ReservedMetadataKey: map[string]interface{}{checksumMetadataKey: "sha256:abc"},
+		})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		for _, metadata := range []map[string]interface{}{
+			{ReservedMetadataKey: 1},
+			{ReservedMetadataKey: map[string]interface{}{checksumMetadataKey: "sha256:forged"}},
+		} {
+			any, err := marshalJSONToAny(metadata)
+			if !assert.Nil(subT, err) {
+				return
+			}
+
+			_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+				Id:       "test",
+				Metadata: any,
+			})
+			var validationErr MetadataValidationErr
+			if !assert.ErrorAs(subT, err, &validationErr) || !assert.ErrorIs(subT, err, ErrReservedMetadataKey) {
+				return
+			}
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "sha256:abc", getReservedString(doc, checksumMetadataKey))
+	})
+
+	t.Run("should accept metadata as returned by GetMetadata", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore()
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: docStore,
+			RandSrc:       rand.Reader,
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		indexResp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Metadata:    metadata,
+			Object:      []byte("test object content"),
+			ContentType: "text/plain",
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		getResp, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: indexResp.Id})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+			Id:       indexResp.Id,
+			Metadata: getResp.Metadata,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), indexResp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", doc["name"])
+		assert.NotEmpty(subT, getResp.Checksum)
+		assert.Equal(subT, getResp.Checksum, getReservedString(doc, checksumMetadataKey))
+		assert.Equal(subT, "text/plain", getReservedString(doc, contentTypeMetadataKey))
+	})
+
+	t.Run("should fail with MergeConflictErr if an object field is set to a scalar", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+			"owner": map[string]interface{}{"name": "test"},
+		})
+
+		s := New(Config{
+			DocumentStore: docStore,
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"owner": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+			Id:       "test",
+			Metadata: metadata,
+		})
+		var mergeErr MergeConflictErr
+		if !assert.ErrorAs(subT, err, &mergeErr) {
+			return
+		}
+		assert.Equal(subT, "owner", mergeErr.Field)
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"owner": map[string]interface{}{"name": "test"}}, doc)
+	})
+
+	t.Run("should fail if expected revision is given but store doesn't support revisions", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: unrevisionedDocumentStore{
+				NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{}),
+			},
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+			Id:               "test",
+			Metadata:         metadata,
+			ExpectedRevision: "1",
+		})
+		assert.ErrorIs(subT, err, ErrRevisionsNotSupported)
+	})
+}
+
+// unrevisionedDocumentStore hides the RevisionedDocumentStore methods
+// of the wrapped store.
+type unrevisionedDocumentStore struct {
+	DocumentStore
+}
+
+func TestObjectChecksum(t *testing.T) {
+	t.Run("should return the same checksum from index and get", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		indexResp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("test object content"),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		getResp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{
+			Id: indexResp.Id,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.NotEmpty(subT, indexResp.Checksum)
+		assert.Equal(subT, indexResp.Checksum, getResp.Checksum)
+	})
+
+	t.Run("should use the configured checksum algorithm", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:       NewInMemoryObjectStore(),
+			DocumentStore:     NewInMemoryDocumentStore(),
+			RandSrc:           rand.Reader,
+			ChecksumAlgorithm: CRC32C,
+		})
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("test object content"),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.True(subT, strings.HasPrefix(resp.Checksum, "crc32c:"))
+	})
+
+	t.Run("should recompute checksum when object is updated", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		indexResp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("test object content"),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		updateResp, err := s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{
+			Id:      indexResp.Id,
+			Content: []byte("updated content"),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		getResp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{
+			Id: indexResp.Id,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		assert.NotEqual(subT, indexResp.Checksum, updateResp.Checksum)
+		assert.Equal(subT, updateResp.Checksum, getResp.Checksum)
+	})
+
+	t.Run("should detect corrupted object content", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		indexResp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("test object content"),
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		objStore.WithObject(indexResp.Id, []byte("corrupted content"))
+
+		getResp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{
+			Id: indexResp.Id,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		ok, err := VerifyChecksum(getResp.Checksum, getResp.Content)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, ok)
+	})
+}
+
+func TestCopy(t *testing.T) {
+	t.Run("should copy object and metadata under a new id", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("source", []byte("content"))
+		docStore := NewInMemoryDocumentStore().WithDocument("source", map[string]interface{}{
+			"name": "test",
+			"tags": map[string]interface{}{"a": "b"},
+		})
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+			RandSrc:       rand.Reader,
+		})
+
+		resp, err := s.Copy(context.Background(), &pb.CopyRequest{SourceId: "source"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.NotEqual(subT, "source", resp.Id) {
+			return
+		}
+
+		obj, err := objStore.Get(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj)
+
+		doc, err := docStore.Get(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", doc["name"])
+
+		// the copied metadata must not share state with the source
+		doc["tags"].(map[string]interface{})["a"] = "c"
+		source, err := docStore.Get(context.Background(), "source")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "b", source["tags"].(map[string]interface{})["a"])
+	})
+
+	t.Run("should use caller supplied destination id", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("source", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		resp, err := s.Copy(context.Background(), &pb.CopyRequest{
+			SourceId:      "source",
+			DestinationId: "destination",
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "destination", resp.Id)
+	})
+
+	t.Run("should fail with ObjectAlreadyExistsErr if destination id is taken", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore: NewInMemoryObjectStore().
+				WithObject("source", []byte("content")).
+				WithObject("destination", []byte("other content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		_, err := s.Copy(context.Background(), &pb.CopyRequest{
+			SourceId:      "source",
+			DestinationId: "destination",
+		})
+
+		var existsErr ObjectAlreadyExistsErr
+		assert.ErrorAs(subT, err, &existsErr)
+	})
+
+	t.Run("should fail with ObjectDoesNotExistErr if source object doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		_, err := s.Copy(context.Background(), &pb.CopyRequest{SourceId: "source"})
+
+		var objErr ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should only copy object if source has no metadata", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore()
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("source", []byte("content")),
+			DocumentStore: docStore,
+			RandSrc:       rand.Reader,
+		})
+
+		resp, err := s.Copy(context.Background(), &pb.CopyRequest{SourceId: "source"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var docErr DocumentDoesNotExistErr
+		_, err = docStore.Get(context.Background(), resp.Id)
+		assert.ErrorAs(subT, err, &docErr)
+	})
+
+	t.Run("should clean up copied object if metadata copy fails", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("source", []byte("content"))
+		s := New(Config{
+			ObjectStore: objStore,
+			DocumentStore: failingDocumentStore{
+				DocumentStore: NewInMemoryDocumentStore().WithDocument("source", map[string]interface{}{"name": "test"}),
+				err:           errors.New("upsert failed"),
+			},
+			RandSrc: rand.Reader,
+		})
+
+		_, err := s.Copy(context.Background(), &pb.CopyRequest{
+			SourceId:      "source",
+			DestinationId: "destination",
+		})
+		if !assert.Error(subT, err) {
+			return
+		}
+
+		assert.Equal(subT, 1, objStore.NumOfObects())
+	})
+}
+
+// failingDocumentStore fails every Upsert with the given error.
+type failingDocumentStore struct {
+	DocumentStore
+	err error
+}
+
+func (s failingDocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.err
+}
+
+func TestMove(t *testing.T) {
+	t.Run("should move object and metadata to the new id", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("old", []byte("content"))
+		docStore := NewInMemoryDocumentStore().WithDocument("old", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+		})
+
+		_, err := s.Move(context.Background(), &pb.MoveRequest{OldId: "old", NewId: "new"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		obj, err := objStore.Get(context.Background(), "new")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj)
+
+		doc, err := docStore.Get(context.Background(), "new")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", doc["name"])
+
+		var objErr ObjectDoesNotExistErr
+		_, err = objStore.Get(context.Background(), "old")
+		assert.ErrorAs(subT, err, &objErr)
+
+		var docErr DocumentDoesNotExistErr
+		_, err = docStore.Get(context.Background(), "old")
+		assert.ErrorAs(subT, err, &docErr)
+	})
+
+	t.Run("should fail if new id is missing", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("old", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.Move(context.Background(), &pb.MoveRequest{OldId: "old"})
+		assert.ErrorIs(subT, err, ErrMissingID)
+	})
+
+	t.Run("should fail with ObjectAlreadyExistsErr if new id is taken", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().
+			WithObject("old", []byte("content")).
+			WithObject("new", []byte("other content"))
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.Move(context.Background(), &pb.MoveRequest{OldId: "old", NewId: "new"})
+
+		var existsErr ObjectAlreadyExistsErr
+		if !assert.ErrorAs(subT, err, &existsErr) {
+			return
+		}
+		assert.Equal(subT, 2, objStore.NumOfObects())
+	})
+
+	t.Run("should fail with ObjectDoesNotExistErr if old id is unknown", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.Move(context.Background(), &pb.MoveRequest{OldId: "old", NewId: "new"})
+
+		var objErr ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should roll back copy if old object can't be removed", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("old", []byte("content"))
+		docStore := NewInMemoryDocumentStore().WithDocument("old", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			ObjectStore: deleteFailingObjectStore{
+				ObjectStore: objStore,
+				ids:         map[string]bool{"old": true},
+			},
+			DocumentStore: docStore,
+		})
+
+		_, err := s.Move(context.Background(), &pb.MoveRequest{OldId: "old", NewId: "new"})
+		if !assert.Error(subT, err) {
+			return
+		}
+
+		var partialErr PartialMoveErr
+		if !assert.False(subT, errors.As(err, &partialErr)) {
+			return
+		}
+
+		assert.Equal(subT, 1, objStore.NumOfObects())
+		assert.Equal(subT, 1, docStore.NumOfDocs())
+
+		_, err = objStore.Get(context.Background(), "old")
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should return PartialMoveErr naming new id if roll back fails", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("old", []byte("content"))
+
+		s := New(Config{
+			ObjectStore: deleteFailingObjectStore{
+				ObjectStore: objStore,
+				ids:         map[string]bool{"old": true, "new": true},
+			},
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.Move(context.Background(), &pb.MoveRequest{OldId: "old", NewId: "new"})
+
+		var partialErr PartialMoveErr
+		if !assert.ErrorAs(subT, err, &partialErr) {
+			return
+		}
+		assert.Equal(subT, "new", partialErr.LeftoverID)
+	})
+
+	t.Run("should return PartialMoveErr naming old id if old metadata can't be removed", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("old", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			ObjectStore: NewInMemoryObjectStore().WithObject("old", []byte("content")),
+			DocumentStore: deleteFailingDocumentStore{
+				DocumentStore: docStore,
+				err:           errors.New("delete failed"),
+			},
+		})
+
+		_, err := s.Move(context.Background(), &pb.MoveRequest{OldId: "old", NewId: "new"})
+
+		var partialErr PartialMoveErr
+		if !assert.ErrorAs(subT, err, &partialErr) {
+			return
+		}
+		assert.Equal(subT, "old", partialErr.LeftoverID)
+
+		_, err = docStore.Get(context.Background(), "new")
+		assert.Nil(subT, err)
+	})
+}
+
+// deleteFailingObjectStore fails to delete the given ids.
+type deleteFailingObjectStore struct {
+	ObjectStore
+	ids map[string]bool
+}
+
+func (s deleteFailingObjectStore) Delete(ctx context.Context, id string) error {
+	if s.ids[id] {
+		return errors.New("delete failed")
+	}
+	return s.ObjectStore.Delete(ctx, id)
+}
+
+// deleteFailingDocumentStore fails every Delete with the given error.
+type deleteFailingDocumentStore struct {
+	DocumentStore
+	err error
+}
+
+func (s deleteFailingDocumentStore) Delete(ctx context.Context, id string) error {
+	return s.err
+}
+
+func TestMaxObjectSize(t *testing.T) {
+	newService := func() *Service {
+		return New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+			MaxObjectSize: 10,
+		})
+	}
+
+	t.Run("should index object exactly at the limit", func(subT *testing.T) {
+		_, err := newService().Index(context.Background(), &pb.IndexRequest{
+			Object: make([]byte, 10),
+		})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should fail to index object one byte over the limit", func(subT *testing.T) {
+		_, err := newService().Index(context.Background(), &pb.IndexRequest{
+			Object: make([]byte, 11),
+		})
+
+		var sizeErr ObjectTooLargeErr
+		if !assert.ErrorAs(subT, err, &sizeErr) {
+			return
+		}
+		assert.Equal(subT, int64(10), sizeErr.Limit)
+		assert.Equal(subT, int64(11), sizeErr.Size)
+	})
+
+	t.Run("should update object exactly at the limit", func(subT *testing.T) {
+		_, err := newService().UpdateObject(context.Background(), &pb.UpdateObjectRequest{
+			Id:      "test",
+			Content: make([]byte, 10),
+		})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should fail to update object one byte over the limit", func(subT *testing.T) {
+		_, err := newService().UpdateObject(context.Background(), &pb.UpdateObjectRequest{
+			Id:      "test",
+			Content: make([]byte, 11),
+		})
+
+		var sizeErr ObjectTooLargeErr
+		assert.ErrorAs(subT, err, &sizeErr)
+	})
+
+	t.Run("should not limit object size by default", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: make([]byte, 1<<20),
+		})
+		assert.Nil(subT, err)
+	})
+}
+
+func TestEmptyObject(t *testing.T) {
+	newService := func() *Service {
+		return New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+	}
+
+	t.Run("should fail to update object with empty content", func(subT *testing.T) {
+		s := newService()
+		_, err := s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{
+			Id: "test",
+		})
+		if !assert.Equal(subT, EmptyObjectErr{ID: "test"}, err) {
+			return
+		}
+
+		obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj.Content)
+	})
+
+	t.Run("should update object with empty content if allowed", func(subT *testing.T) {
+		_, err := newService().UpdateObject(context.Background(), &pb.UpdateObjectRequest{
+			Id:         "test",
+			AllowEmpty: true,
+		})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should fail to index empty object", func(subT *testing.T) {
+		_, err := newService().Index(context.Background(), &pb.IndexRequest{
+			Object: []byte{},
+		})
+		assert.IsType(subT, EmptyObjectErr{}, err)
+	})
+
+	t.Run("should index empty object if allowed", func(subT *testing.T) {
+		_, err := newService().Index(context.Background(), &pb.IndexRequest{
+			AllowEmpty: true,
+		})
+		assert.Nil(subT, err)
+	})
+}
+
+func TestIndexDryRun(t *testing.T) {
+	t.Run("should not write anything", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		docStore := NewInMemoryDocumentStore()
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+			RandSrc:       rand.Reader,
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		resp, err := s.Index(context.Background(), &pb.IndexRequest{
+			Metadata: metadata,
+			Object:   []byte("content"),
+			DryRun:   true,
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, resp.DryRun)
+		assert.NotEmpty(subT, resp.Id)
+		assert.NotEmpty(subT, resp.Checksum)
+
+		assert.Equal(subT, 0, objStore.NumOfObects())
+		stats, err := docStore.Stat(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, stats.Exists)
+	})
+
+	t.Run("should still validate the request", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("taken", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+			MaxObjectSize: 4,
+		})
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{
+			Object: []byte("content"),
+			DryRun: true,
+		})
+
+		var sizeErr ObjectTooLargeErr
+		assert.ErrorAs(subT, err, &sizeErr)
+
+		_, err = s.Index(context.Background(), &pb.IndexRequest{
+			Id:     "taken",
+			Object: []byte("new"),
+			DryRun: true,
+		})
+
+		var existsErr ObjectAlreadyExistsErr
+		assert.ErrorAs(subT, err, &existsErr)
+	})
+}
+
+func TestDeleteMetadata(t *testing.T) {
+	t.Run("should keep the object", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+		})
+
+		err := s.DeleteMetadata(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = docStore.Get(context.Background(), "test")
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+
+		resp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), resp.Content)
+	})
+
+	t.Run("should fail if metadata doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		err := s.DeleteMetadata(context.Background(), "docDoesNotExistID")
+
+		var docErr DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+	})
+}
+
+func TestDeleteObject(t *testing.T) {
+	t.Run("should keep the metadata", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+		})
+
+		err := s.DeleteObject(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 0, objStore.NumOfObects())
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+	})
+
+	t.Run("should fail if object doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		err := s.DeleteObject(context.Background(), "objDoesNotExistID")
+
+		var objErr ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+	})
+}
@@ -0,0 +1,68 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrStatsNotSupported is returned when a store can't cheaply report its size.
+var ErrStatsNotSupported = errors.New("store does not support stats")
+
+// StoreStats is optionally implemented by an ObjectStore or DocumentStore
+// which can report how much it holds.
+type StoreStats interface {
+	Stats(ctx context.Context) (*StoreStatsInfo, error)
+}
+
+type StoreStatsInfo struct {
+	Count int64
+	Bytes int64
+}
+
+// ServiceStats summarises everything held by the Service's stores.
+type ServiceStats struct {
+	Objects     int64
+	ObjectBytes int64
+	Documents   int64
+}
+
+// Stats returns the totals reported by the configured stores. If either store
+// doesn't implement StoreStats an ErrStatsNotSupported is returned.
+func (s *Service) Stats(ctx context.Context) (stats *ServiceStats, err error) {
+	defer s.observe("Stats", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	objStats, err := storeStats(ctx, s.rawObjDB)
+	if err != nil {
+		s.log.Error("unable to get object store stats", zap.Error(err))
+		return nil, err
+	}
+
+	docStats, err := storeStats(ctx, s.rawDocDB)
+	if err != nil {
+		s.log.Error("unable to get document store stats", zap.Error(err))
+		return nil, err
+	}
+
+	return &ServiceStats{
+		Objects:     objStats.Count,
+		ObjectBytes: objStats.Bytes,
+		Documents:   docStats.Count,
+	}, nil
+}
+
+func storeStats(ctx context.Context, store interface{}) (*StoreStatsInfo, error) {
+	st, ok := store.(StoreStats)
+	if !ok {
+		return nil, ErrStatsNotSupported
+	}
+	return st.Stats(ctx)
+}
@@ -0,0 +1,37 @@
+package sakuin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	t.Run("should total the in-memory stores", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore: NewInMemoryObjectStore().
+				WithObject("a", []byte("12345")).
+				WithObject("b", []byte("123")),
+			DocumentStore: NewInMemoryDocumentStore().
+				WithDocument("a", map[string]interface{}{"name": "a"}),
+			RetryPolicy: RetryPolicy{MaxAttempts: 2},
+		})
+
+		stats, err := s.Stats(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &ServiceStats{Objects: 2, ObjectBytes: 8, Documents: 1}, stats)
+	})
+
+	t.Run("should fail if a store doesn't support stats", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: unrevisionedDocumentStore{NewInMemoryDocumentStore()},
+		})
+
+		_, err := s.Stats(context.Background())
+		assert.Equal(subT, ErrStatsNotSupported, err)
+	})
+}
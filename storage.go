@@ -4,11 +4,19 @@
 package sakuin
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/stretchr/testify/assert"
-	"go.uber.org/zap"
 )
 
 type ObjectDoesNotExistErr struct {
@@ -19,6 +27,52 @@ func (e ObjectDoesNotExistErr) Error() string {
 	return e.ID
 }
 
+// ObjectAlreadyExistsErr represents an attempt to create an object
+// under an id which is already taken.
+type ObjectAlreadyExistsErr struct {
+	ID string
+}
+
+func (e ObjectAlreadyExistsErr) Error() string {
+	return fmt.Sprintf("object already exists: %s", e.ID)
+}
+
+// PartialMoveErr represents a move which wasn't able to complete
+// nor be rolled back, leaving some of the entry behind at LeftoverID.
+type PartialMoveErr struct {
+	OldID      string
+	NewID      string
+	LeftoverID string
+	Err        error
+}
+
+func (e PartialMoveErr) Error() string {
+	return fmt.Sprintf("partially moved %s to %s, leftover entry at %s: %s", e.OldID, e.NewID, e.LeftoverID, e.Err)
+}
+
+func (e PartialMoveErr) Unwrap() error {
+	return e.Err
+}
+
+// ObjectTooLargeErr represents an object which exceeds the configured maximum object size.
+type ObjectTooLargeErr struct {
+	Limit int64
+	Size  int64
+}
+
+func (e ObjectTooLargeErr) Error() string {
+	return fmt.Sprintf("object size %d exceeds limit of %d bytes", e.Size, e.Limit)
+}
+
+// EmptyObjectErr represents an object with no content, which is rejected unless explicitly allowed.
+type EmptyObjectErr struct {
+	ID string
+}
+
+func (e EmptyObjectErr) Error() string {
+	return fmt.Sprintf("object has no content: %s", e.ID)
+}
+
 type DocumentDoesNotExistErr struct {
 	ID string
 }
@@ -27,9 +81,68 @@ func (e DocumentDoesNotExistErr) Error() string {
 	return e.ID
 }
 
+// MergeConflictErr represents a document which can't be merged into the
+// stored one since Field holds an object in the stored document but not in
+// the new one.
+type MergeConflictErr struct {
+	Field string
+}
+
+func (e MergeConflictErr) Error() string {
+	return fmt.Sprintf("can't merge into field %s: expected an object", e.Field)
+}
+
+// ErrRevisionsNotSupported is returned when a revision is required
+// but the configured DocumentStore doesn't implement RevisionedDocumentStore.
+var ErrRevisionsNotSupported = errors.New("document store does not support revisions")
+
+// RevisionMismatchErr represents an attempt to update a document
+// based on a revision which is no longer the current one.
+type RevisionMismatchErr struct {
+	ID       string
+	Expected string
+	Actual   string
+}
+
+func (e RevisionMismatchErr) Error() string {
+	return fmt.Sprintf("revision mismatch for %s: expected %s but found %s", e.ID, e.Expected, e.Actual)
+}
+
 type StatInfo struct {
 	Exists bool
-	Size   int
+
+	// Size is the number of bytes held by the store, so for objects
+	// encrypted with an ObjectCipher it's the length of the ciphertext
+	// and for compressed objects it's their compressed length. For
+	// documents it's the number of top level fields.
+	Size int
+
+	// Checksum is the checksum the store verifies the object against
+	// when it's read, if any. Most stores leave it empty.
+	Checksum string
+
+	// ContentType is the content type of the object, if the store records it.
+	ContentType string
+
+	// CreatedAt and LastModified are when the entry was first written and
+	// last written. They're zero if the store doesn't track them.
+	CreatedAt    time.Time
+	LastModified time.Time
+}
+
+// entryTimes records when an in-memory entry was created and last modified.
+type entryTimes struct {
+	created  time.Time
+	modified time.Time
+}
+
+// touched returns the times after the entry is written at now.
+func (t entryTimes) touched(now time.Time) entryTimes {
+	if t.created.IsZero() {
+		t.created = now
+	}
+	t.modified = now
+	return t
 }
 
 type ObjectStore interface {
@@ -37,6 +150,112 @@ type ObjectStore interface {
 	Get(ctx context.Context, id string) ([]byte, error)
 	Put(ctx context.Context, id string, b []byte) error
 	Update(ctx context.Context, id string, b []byte) error
+	Delete(ctx context.Context, id string) error
+}
+
+// StreamingObjectStore is an optional interface an ObjectStore can implement
+// to store objects without first buffering them entirely in memory.
+type StreamingObjectStore interface {
+	ObjectStore
+
+	// PutStream stores all content read from r. The size is
+	// only a hint and is negative when unknown. If reading from
+	// r fails, or ctx is done first, no object should be stored.
+	PutStream(ctx context.Context, id string, r io.Reader, size int64) error
+
+	// GetStream returns a reader for the object content along with its size.
+	// Callers must always close the reader, even if it isn't read to completion.
+	// Reads should fail once ctx is done.
+	GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error)
+}
+
+// ErrListNotSupported is returned by wrappers around an ObjectStore
+// which doesn't implement ListableObjectStore.
+var ErrListNotSupported = errors.New("object store does not support listing")
+
+// ErrReadOnly is returned for writes to a store which is read-only,
+// e.g. during a maintenance window. Since the undo of a failed write
+// would be rejected as well, the Service doesn't attempt to roll back
+// writes which failed with it.
+var ErrReadOnly = errors.New("store is read-only")
+
+// ListableObjectStore is an optional interface an ObjectStore can implement
+// to support listing the ids it holds.
+type ListableObjectStore interface {
+	ObjectStore
+
+	// List returns up to limit ids starting with prefix, in ascending order,
+	// following those returned by the page which gave the cursor. An empty
+	// cursor starts from the first page and an empty next cursor means there
+	// are no more pages. A limit of zero or less means no limit.
+	List(ctx context.Context, prefix string, cursor string, limit int) (ids []string, nextCursor string, err error)
+}
+
+// pageIDs returns a page of the given ids, which must be sorted, as described by ListableObjectStore.
+// Cursors are the last id of the previous page, so pages stay stable as ids are added and removed.
+func pageIDs(ids []string, cursor string, limit int) ([]string, string) {
+	start := sort.SearchStrings(ids, cursor)
+	if start < len(ids) && ids[start] == cursor && cursor != "" {
+		start++
+	}
+	ids = ids[start:]
+
+	if limit <= 0 || len(ids) <= limit {
+		return ids, ""
+	}
+	return ids[:limit], ids[limit-1]
+}
+
+// AsStreaming returns the given store if it implements StreamingObjectStore,
+// otherwise it adapts the store by buffering objects in memory.
+func AsStreaming(objStore ObjectStore) StreamingObjectStore {
+	if streamStore, ok := objStore.(StreamingObjectStore); ok {
+		return streamStore
+	}
+	return bufferedStreamingObjectStore{objStore}
+}
+
+type bufferedStreamingObjectStore struct {
+	ObjectStore
+}
+
+func (s bufferedStreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	b, err := ioutil.ReadAll(contextReader{ctx: ctx, r: r})
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, id, b)
+}
+
+func (s bufferedStreamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	b, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ioutil.NopCloser(contextReader{ctx: ctx, r: bytes.NewReader(b)}), int64(len(b)), nil
+}
+
+// contextReader fails reads once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	err := r.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// errReader fails every read with err.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
 }
 
 type TestingT interface {
@@ -44,6 +263,9 @@ type TestingT interface {
 	Run(name string, f func(TestingT))
 }
 
+// RunObjectStorageTests checks the contract of ObjectStore. Along with the
+// documented behaviour, stores must never alias caller memory: the slices
+// passed to Put and Update, and returned by Get, belong to the caller.
 func RunObjectStorageTests(t TestingT, objStore ObjectStore) {
 	t.Run("get object should fail with ObjectDoesNotExistErr if object doesn't exist", func(subT TestingT) {
 		var objErr ObjectDoesNotExistErr
@@ -56,66 +278,522 @@ func RunObjectStorageTests(t TestingT, objStore ObjectStore) {
 		err := objStore.Update(context.Background(), "", []byte{})
 		assert.ErrorAs(subT, err, &objErr, "expected an ObjectDoesNotExistErr")
 	})
+
+	t.Run("delete object should fail with ObjectDoesNotExistErr if object doesn't exist", func(subT TestingT) {
+		var objErr ObjectDoesNotExistErr
+		err := objStore.Delete(context.Background(), "")
+		assert.ErrorAs(subT, err, &objErr, "expected an ObjectDoesNotExistErr")
+	})
+
+	t.Run("get object should fail with ObjectDoesNotExistErr after object is deleted", func(subT TestingT) {
+		err := objStore.Put(context.Background(), "deleteMe", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = objStore.Delete(context.Background(), "deleteMe")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var objErr ObjectDoesNotExistErr
+		_, err = objStore.Get(context.Background(), "deleteMe")
+		assert.ErrorAs(subT, err, &objErr, "expected an ObjectDoesNotExistErr")
+	})
+
+	t.Run("update should advance the last modified time if the store tracks it", func(subT TestingT) {
+		err := objStore.Put(context.Background(), "modified", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		before, err := objStore.Stat(context.Background(), "modified")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if before.LastModified.IsZero() {
+			return
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		err = objStore.Update(context.Background(), "modified", []byte("updated"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		after, err := objStore.Stat(context.Background(), "modified")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, after.LastModified.After(before.LastModified), "expected last modified time to advance")
+		assert.True(subT, after.CreatedAt.Equal(before.CreatedAt), "expected created time to stay the same")
+	})
+
+	t.Run("put and update should not hold on to the given object", func(subT TestingT) {
+		b := []byte("content")
+		err := objStore.Put(context.Background(), "aliasPut", b)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		b[0] = 'C'
+
+		obj, err := objStore.Get(context.Background(), "aliasPut")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj)
+
+		b = []byte("updated")
+		err = objStore.Update(context.Background(), "aliasPut", b)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		b[0] = 'U'
+
+		obj, err = objStore.Get(context.Background(), "aliasPut")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("updated"), obj)
+	})
+
+	t.Run("get should return an object which is safe to modify", func(subT TestingT) {
+		err := objStore.Put(context.Background(), "aliasGet", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		obj, err := objStore.Get(context.Background(), "aliasGet")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		obj[0] = 'C'
+
+		obj, err = objStore.Get(context.Background(), "aliasGet")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj)
+	})
+}
+
+// RunStreamingObjectStorageTests checks the contract of StreamingObjectStore,
+// which stores must satisfy in addition to the one checked by RunObjectStorageTests.
+func RunStreamingObjectStorageTests(t TestingT, objStore StreamingObjectStore) {
+	content := bytes.Repeat([]byte("0123456789"), 1<<10)
+
+	t.Run("get stream should return everything put by put stream", func(subT TestingT) {
+		err := objStore.PutStream(context.Background(), "stream", bytes.NewReader(content), int64(len(content)))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		rc, size, err := objStore.GetStream(context.Background(), "stream")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer rc.Close()
+
+		b, err := ioutil.ReadAll(rc)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, content, b)
+		assert.Equal(subT, int64(len(content)), size)
+	})
+
+	t.Run("put stream should not store anything if reading fails", func(subT TestingT) {
+		r := io.MultiReader(bytes.NewReader(content), errReader{errors.New("read failed")})
+		err := objStore.PutStream(context.Background(), "failedStream", r, -1)
+		if !assert.NotNil(subT, err) {
+			return
+		}
+
+		stats, err := objStore.Stat(context.Background(), "failedStream")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, stats.Exists)
+	})
+
+	t.Run("put stream should stop once the context is cancelled", func(subT TestingT) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		r := io.MultiReader(bytes.NewReader(content), cancelReader{cancel: cancel}, bytes.NewReader(content))
+		err := objStore.PutStream(ctx, "cancelledStream", r, -1)
+		if !assert.ErrorIs(subT, err, context.Canceled) {
+			return
+		}
+
+		stats, err := objStore.Stat(context.Background(), "cancelledStream")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, stats.Exists)
+	})
+
+	t.Run("get stream should support partial reads", func(subT TestingT) {
+		err := objStore.Put(context.Background(), "partial", content)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		rc, _, err := objStore.GetStream(context.Background(), "partial")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer rc.Close()
+
+		head := make([]byte, 10)
+		_, err = io.ReadFull(rc, head)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, content[:10], head)
+
+		rest, err := ioutil.ReadAll(rc)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, content[10:], rest)
+	})
+
+	t.Run("get stream should allow closing before reading everything", func(subT TestingT) {
+		err := objStore.Put(context.Background(), "abandoned", content)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		rc, _, err := objStore.GetStream(context.Background(), "abandoned")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = rc.Read(make([]byte, 1))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Nil(subT, rc.Close()) {
+			return
+		}
+
+		b, err := objStore.Get(context.Background(), "abandoned")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, content, b)
+	})
+
+	t.Run("get stream should stop reading once the context is cancelled", func(subT TestingT) {
+		err := objStore.Put(context.Background(), "cancelled", content)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rc, _, err := objStore.GetStream(ctx, "cancelled")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer rc.Close()
+
+		_, err = rc.Read(make([]byte, 1))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		cancel()
+
+		_, err = ioutil.ReadAll(rc)
+		assert.ErrorIs(subT, err, context.Canceled)
+	})
+
+	t.Run("get stream should fail with ObjectDoesNotExistErr if object doesn't exist", func(subT TestingT) {
+		var objErr ObjectDoesNotExistErr
+		_, _, err := objStore.GetStream(context.Background(), "missingStream")
+		assert.ErrorAs(subT, err, &objErr, "expected an ObjectDoesNotExistErr")
+	})
+}
+
+// RunListableObjectStorageTests checks the contract of ListableObjectStore,
+// which stores must satisfy in addition to the one checked by RunObjectStorageTests.
+func RunListableObjectStorageTests(t TestingT, objStore ListableObjectStore) {
+	ids := []string{"list/a", "list/b", "list/c", "list/d", "list/e"}
+	for _, id := range append([]string{"listx/a", "lis"}, ids...) {
+		err := objStore.Put(context.Background(), id, []byte("content"))
+		if !assert.Nil(t, err) {
+			return
+		}
+	}
+
+	listAll := func(subT TestingT, limit int) ([][]string, bool) {
+		var pages [][]string
+		cursor := ""
+		for {
+			page, next, err := objStore.List(context.Background(), "list/", cursor, limit)
+			if !assert.Nil(subT, err) {
+				return nil, false
+			}
+			pages = append(pages, page)
+			if next == "" {
+				return pages, true
+			}
+			if !assert.Less(subT, len(pages), len(ids)+1, "expected pagination to finish") {
+				return nil, false
+			}
+			cursor = next
+		}
+	}
+
+	t.Run("list should return every id with the prefix in order", func(subT TestingT) {
+		pages, ok := listAll(subT, 0)
+		if !ok {
+			return
+		}
+		assert.Equal(subT, [][]string{ids}, pages)
+	})
+
+	t.Run("list should page through ids", func(subT TestingT) {
+		pages, ok := listAll(subT, 2)
+		if !ok {
+			return
+		}
+		assert.Equal(subT, [][]string{ids[:2], ids[2:4], ids[4:]}, pages)
+	})
+
+	t.Run("list should not return an empty last page", func(subT TestingT) {
+		pages, ok := listAll(subT, len(ids))
+		if !ok {
+			return
+		}
+		assert.Equal(subT, [][]string{ids}, pages)
+	})
+
+	t.Run("list should keep its place when earlier ids are removed", func(subT TestingT) {
+		page, next, err := objStore.List(context.Background(), "list/", "", 2)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Equal(subT, ids[:2], page) {
+			return
+		}
+
+		err = objStore.Delete(context.Background(), "list/a")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer objStore.Put(context.Background(), "list/a", []byte("content"))
+
+		page, _, err = objStore.List(context.Background(), "list/", next, 2)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, ids[2:4], page)
+	})
+
+	t.Run("list should return nothing if no ids have the prefix", func(subT TestingT) {
+		page, next, err := objStore.List(context.Background(), "missing/", "", 2)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, page)
+		assert.Empty(subT, next)
+	})
+}
+
+// cancelReader cancels its context the first time it's read from.
+type cancelReader struct {
+	cancel context.CancelFunc
+}
+
+func (r cancelReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return 0, io.EOF
 }
 
+// InMemoryObjectStore holds objects in memory. Objects are copied on the
+// way in and out, so callers are free to modify the slices they pass or get.
 type InMemoryObjectStore struct {
 	mu      sync.Mutex
 	objects map[string][]byte
+	times   map[string]entryTimes
+	uploads map[string]*memUpload
+
+	// lru is nil unless the store is bounded.
+	lru     *lruIndex
+	onEvict func(id string)
 }
 
 func NewInMemoryObjectStore() *InMemoryObjectStore {
 	return &InMemoryObjectStore{
 		objects: make(map[string][]byte),
+		times:   make(map[string]entryTimes),
+		uploads: make(map[string]*memUpload),
 	}
 }
 
+// NewInMemoryObjectStoreWithLimit returns an InMemoryObjectStore which
+// holds at most maxBytes of objects and maxObjects objects, evicting the
+// least recently used objects to make room for new ones. Stat, Get and
+// writes all count as using an object. Objects larger than maxBytes are
+// rejected with an ObjectTooLargeErr. A limit of zero or less is unlimited.
+func NewInMemoryObjectStoreWithLimit(maxBytes int64, maxObjects int) *InMemoryObjectStore {
+	s := NewInMemoryObjectStore()
+	s.lru = newLRUIndex(maxBytes, maxObjects)
+	return s
+}
+
+// WithEvictionHandler sets a func to call with the id of every object
+// evicted to make room for another one, e.g. for logging evictions.
+// It's called without the store locked.
+func (s *InMemoryObjectStore) WithEvictionHandler(f func(id string)) *InMemoryObjectStore {
+	s.onEvict = f
+	return s
+}
+
 func (s *InMemoryObjectStore) Stat(ctx context.Context, id string) (*StatInfo, error) {
 	s.mu.Lock()
 	obj, exists := s.objects[id]
+	times := s.times[id]
+	s.touch(id)
 	s.mu.Unlock()
 
-	return &StatInfo{Exists: exists, Size: len(obj)}, nil
+	return &StatInfo{Exists: exists, Size: len(obj), CreatedAt: times.created, LastModified: times.modified}, nil
 }
 
 func (s *InMemoryObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
 	s.mu.Lock()
 	obj, exists := s.objects[id]
+	s.touch(id)
 	s.mu.Unlock()
 	if !exists {
-		zap.L().Warn("unable to find object in memory", zap.String("id", id))
 		return nil, ObjectDoesNotExistErr{ID: id}
 	}
-	zap.L().Debug("successfully retrieved object from memory", zap.String("id", id))
 
-	return obj, nil
+	return copyBytes(obj), nil
 }
 
 func (s *InMemoryObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	if s.lru != nil && !s.lru.fits(int64(len(b))) {
+		return ObjectTooLargeErr{Limit: s.lru.maxBytes, Size: int64(len(b))}
+	}
+
 	s.mu.Lock()
-	s.objects[id] = b
+	evicted := s.put(id, b)
 	s.mu.Unlock()
-	zap.L().Debug("successfully stored object in memory", zap.String("id", id))
 
+	s.evicted(evicted)
 	return nil
 }
 
 func (s *InMemoryObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	if s.lru != nil && !s.lru.fits(int64(len(b))) {
+		return ObjectTooLargeErr{Limit: s.lru.maxBytes, Size: int64(len(b))}
+	}
+
+	s.mu.Lock()
+	if _, exists := s.objects[id]; !exists {
+		s.mu.Unlock()
+		return ObjectDoesNotExistErr{ID: id}
+	}
+	evicted := s.put(id, b)
+	s.mu.Unlock()
+
+	s.evicted(evicted)
+	return nil
+}
+
+func (s *InMemoryObjectStore) Delete(ctx context.Context, id string) error {
 	s.mu.Lock()
 	if _, exists := s.objects[id]; !exists {
+		s.mu.Unlock()
 		return ObjectDoesNotExistErr{ID: id}
 	}
-	s.objects[id] = b
+	delete(s.objects, id)
+	delete(s.times, id)
+	if s.lru != nil {
+		s.lru.remove(id)
+	}
 	s.mu.Unlock()
 
-	zap.L().Debug("successfully updated object in memory", zap.String("id", id))
 	return nil
 }
 
+// put must be called with the lock held. It returns the ids of the
+// objects evicted to make room for the new one.
+func (s *InMemoryObjectStore) put(id string, b []byte) []string {
+	s.objects[id] = copyBytes(b)
+	s.times[id] = s.times[id].touched(time.Now())
+	if s.lru == nil {
+		return nil
+	}
+
+	evicted := s.lru.set(id, int64(len(b)))
+	for _, id := range evicted {
+		delete(s.objects, id)
+		delete(s.times, id)
+	}
+	return evicted
+}
+
+// touch must be called with the lock held.
+func (s *InMemoryObjectStore) touch(id string) {
+	if s.lru != nil {
+		s.lru.touch(id)
+	}
+}
+
+func (s *InMemoryObjectStore) evicted(ids []string) {
+	if s.onEvict == nil {
+		return
+	}
+	for _, id := range ids {
+		s.onEvict(id)
+	}
+}
+
+func (s *InMemoryObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	s.mu.Lock()
+	var ids []string
+	for id := range s.objects {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Strings(ids)
+	ids, next := pageIDs(ids, cursor, limit)
+	return ids, next, nil
+}
+
+// PutStream reads the object into memory before storing it.
+func (s *InMemoryObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return bufferedStreamingObjectStore{s}.PutStream(ctx, id, r, size)
+}
+
+func (s *InMemoryObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	return bufferedStreamingObjectStore{s}.GetStream(ctx, id)
+}
+
 func (s *InMemoryObjectStore) WithObject(id string, obj []byte) *InMemoryObjectStore {
-	s.objects[id] = obj
+	s.evicted(s.put(id, obj))
 	return s
 }
 
+func (s *InMemoryObjectStore) Stats(ctx context.Context) (*StoreStatsInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := &StoreStatsInfo{Count: int64(len(s.objects))}
+	for _, obj := range s.objects {
+		stats.Bytes += int64(len(obj))
+	}
+	return stats, nil
+}
+
 func (s *InMemoryObjectStore) NumOfObects() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -127,63 +805,488 @@ type DocumentStore interface {
 	Stat(ctx context.Context, id string) (*StatInfo, error)
 	Get(ctx context.Context, id string) (map[string]interface{}, error)
 	Upsert(ctx context.Context, id string, b map[string]interface{}) error
+
+	// Replace overwrites the stored document entirely, unlike Upsert
+	// which merges into it.
+	Replace(ctx context.Context, id string, doc map[string]interface{}) error
+	Delete(ctx context.Context, id string) error
 }
 
+// RevisionedDocumentStore is an optional interface a DocumentStore can
+// implement to support optimistic concurrency control. Revisions are
+// opaque tokens which change every time a document is modified.
+type RevisionedDocumentStore interface {
+	DocumentStore
+
+	// GetWithRevision returns the document along with its current revision.
+	GetWithRevision(ctx context.Context, id string) (map[string]interface{}, string, error)
+
+	// UpsertIfRevision merges the document into the stored one only if the
+	// stored revision matches the given revision, otherwise a RevisionMismatchErr
+	// is returned. An empty revision skips the comparison. The new revision
+	// is returned on success.
+	UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error)
+
+	// ReplaceIfRevision is the Replace equivalent of UpsertIfRevision.
+	ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error)
+}
+
+// RunDocumentStorageTests checks the contract of DocumentStore. Along with
+// the documented behaviour, stores must never alias caller memory: the maps
+// passed to Upsert and Replace, and returned by Get, belong to the caller.
 func RunDocumentStorageTests(t TestingT, docStore DocumentStore) {
 	t.Run("should fail with DocumentDoesNotExistErr if document doesn't exist", func(subT TestingT) {
 		var docErr DocumentDoesNotExistErr
 		_, err := docStore.Get(context.Background(), "")
 		assert.ErrorAs(subT, err, &docErr, "expected and DocumentDoesNotExistErr")
 	})
+
+	t.Run("delete should fail with DocumentDoesNotExistErr if document doesn't exist", func(subT TestingT) {
+		var docErr DocumentDoesNotExistErr
+		err := docStore.Delete(context.Background(), "")
+		assert.ErrorAs(subT, err, &docErr, "expected and DocumentDoesNotExistErr")
+	})
+
+	t.Run("replace should remove fields missing from the new document", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "replaceMe", map[string]interface{}{"name": "test", "description": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = docStore.Replace(context.Background(), "replaceMe", map[string]interface{}{"name": "replaced"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "replaceMe")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "replaced"}, doc)
+	})
+
+	t.Run("get should fail with DocumentDoesNotExistErr after document is deleted", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "deleteMe", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = docStore.Delete(context.Background(), "deleteMe")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		var docErr DocumentDoesNotExistErr
+		_, err = docStore.Get(context.Background(), "deleteMe")
+		assert.ErrorAs(subT, err, &docErr, "expected and DocumentDoesNotExistErr")
+	})
+
+	t.Run("upsert should deep merge nested documents", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "mergeNested", map[string]interface{}{
+			"nested": map[string]interface{}{"a": "1", "deeper": map[string]interface{}{"b": "2"}},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = docStore.Upsert(context.Background(), "mergeNested", map[string]interface{}{
+			"nested": map[string]interface{}{"c": "3", "deeper": map[string]interface{}{"d": "4"}},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "mergeNested")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{
+			"nested": map[string]interface{}{"a": "1", "c": "3", "deeper": map[string]interface{}{"b": "2", "d": "4"}},
+		}, doc)
+	})
+
+	t.Run("upsert should overwrite scalar fields", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "mergeScalar", map[string]interface{}{"name": "old", "nested": map[string]interface{}{"a": "old"}})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = docStore.Upsert(context.Background(), "mergeScalar", map[string]interface{}{"name": "new", "nested": map[string]interface{}{"a": "new"}})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "mergeScalar")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "new", "nested": map[string]interface{}{"a": "new"}}, doc)
+	})
+
+	t.Run("upsert should keep fields missing from the new document", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "mergeKeep", map[string]interface{}{"name": "test", "description": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = docStore.Upsert(context.Background(), "mergeKeep", map[string]interface{}{"owner": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "mergeKeep")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test", "description": "test", "owner": "test"}, doc)
+	})
+
+	t.Run("stat should count the fields of the merged document", func(subT TestingT) {
+		info, err := docStore.Stat(context.Background(), "mergeStat")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, info.Exists)
+
+		err = docStore.Upsert(context.Background(), "mergeStat", map[string]interface{}{"a": "1", "b": "2"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = docStore.Upsert(context.Background(), "mergeStat", map[string]interface{}{"b": "3", "c": "4"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		info, err = docStore.Stat(context.Background(), "mergeStat")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, info.Exists)
+		assert.Equal(subT, 3, info.Size)
+	})
+
+	t.Run("concurrent upserts to the same document should not lose fields", func(subT TestingT) {
+		const upserts = 20
+
+		var wg sync.WaitGroup
+		errs := make([]error, upserts)
+		for i := 0; i < upserts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = docStore.Upsert(context.Background(), "mergeConcurrent", map[string]interface{}{
+					fmt.Sprint("field-", i): "value",
+				})
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		doc, err := docStore.Get(context.Background(), "mergeConcurrent")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Len(subT, doc, upserts)
+	})
+
+	t.Run("upsert should advance the last modified time if the store tracks it", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "modified", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		before, err := docStore.Stat(context.Background(), "modified")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if before.LastModified.IsZero() {
+			return
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		err = docStore.Upsert(context.Background(), "modified", map[string]interface{}{"description": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		after, err := docStore.Stat(context.Background(), "modified")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, after.LastModified.After(before.LastModified), "expected last modified time to advance")
+		assert.True(subT, after.CreatedAt.Equal(before.CreatedAt), "expected created time to stay the same")
+	})
+
+	t.Run("upsert and replace should not hold on to the given document", func(subT TestingT) {
+		doc := map[string]interface{}{"name": "test", "nested": map[string]interface{}{"a": "b"}}
+		err := docStore.Upsert(context.Background(), "aliasUpsert", doc)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		doc["name"] = "modified"
+		doc["nested"].(map[string]interface{})["a"] = "modified"
+
+		got, err := docStore.Get(context.Background(), "aliasUpsert")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test", "nested": map[string]interface{}{"a": "b"}}, got)
+
+		doc = map[string]interface{}{"nested": map[string]interface{}{"c": "d"}}
+		err = docStore.Replace(context.Background(), "aliasUpsert", doc)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		doc["nested"].(map[string]interface{})["c"] = "modified"
+
+		got, err = docStore.Get(context.Background(), "aliasUpsert")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"nested": map[string]interface{}{"c": "d"}}, got)
+	})
+
+	t.Run("get should return a document which is safe to modify", func(subT TestingT) {
+		err := docStore.Upsert(context.Background(), "aliasGet", map[string]interface{}{"nested": map[string]interface{}{"a": "b"}})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		got, err := docStore.Get(context.Background(), "aliasGet")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		got["name"] = "added"
+		got["nested"].(map[string]interface{})["a"] = "modified"
+
+		got, err = docStore.Get(context.Background(), "aliasGet")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"nested": map[string]interface{}{"a": "b"}}, got)
+	})
 }
 
+// InMemoryDocumentStore holds documents in memory. Documents are deep copied
+// on the way in and out, so callers are free to modify the maps they pass or get.
 type InMemoryDocumentStore struct {
-	mu   sync.Mutex
-	docs map[string]map[string]interface{}
+	mu    sync.Mutex
+	docs  map[string]map[string]interface{}
+	revs  map[string]uint64
+	times map[string]entryTimes
+
+	// lru is nil unless the store is bounded.
+	lru     *lruIndex
+	onEvict func(id string)
 }
 
 func NewInMemoryDocumentStore() *InMemoryDocumentStore {
 	return &InMemoryDocumentStore{
-		docs: make(map[string]map[string]interface{}),
+		docs:  make(map[string]map[string]interface{}),
+		revs:  make(map[string]uint64),
+		times: make(map[string]entryTimes),
 	}
 }
 
+// NewInMemoryDocumentStoreWithLimit returns an InMemoryDocumentStore which
+// holds at most maxDocs documents, evicting the least recently used ones to
+// make room for new ones. Stat, Get and writes all count as using a document.
+// A limit of zero or less is unlimited.
+func NewInMemoryDocumentStoreWithLimit(maxDocs int) *InMemoryDocumentStore {
+	s := NewInMemoryDocumentStore()
+	s.lru = newLRUIndex(0, maxDocs)
+	return s
+}
+
+// WithEvictionHandler sets a func to call with the id of every document
+// evicted to make room for another one, e.g. for logging evictions.
+// It's called without the store locked.
+func (s *InMemoryDocumentStore) WithEvictionHandler(f func(id string)) *InMemoryDocumentStore {
+	s.onEvict = f
+	return s
+}
+
 func (s *InMemoryDocumentStore) Stat(ctx context.Context, id string) (*StatInfo, error) {
 	s.mu.Lock()
 	doc, exists := s.docs[id]
+	times := s.times[id]
+	s.touch(id)
 	s.mu.Unlock()
 
-	return &StatInfo{Exists: exists, Size: len(doc)}, nil
+	return &StatInfo{Exists: exists, Size: len(doc), CreatedAt: times.created, LastModified: times.modified}, nil
 }
 
 func (s *InMemoryDocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
 	s.mu.Lock()
 	doc, exists := s.docs[id]
+	s.touch(id)
 	s.mu.Unlock()
 	if !exists {
-		zap.L().Warn("unable to retrieve document from memory", zap.String("id", id))
 		return nil, DocumentDoesNotExistErr{ID: id}
 	}
-	zap.L().Debug("successfully retrieved document from memory", zap.String("id", id))
 
-	return doc, nil
+	return CopyDoc(doc), nil
 }
 
 func (s *InMemoryDocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
 	s.mu.Lock()
+	evicted, err := s.upsert(id, doc)
+	s.mu.Unlock()
+
+	s.evicted(evicted)
+	return err
+}
+
+func (s *InMemoryDocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	s.mu.Lock()
+	evicted := s.replace(id, doc)
+	s.mu.Unlock()
+
+	s.evicted(evicted)
+	return nil
+}
+
+func (s *InMemoryDocumentStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	if _, exists := s.docs[id]; !exists {
+		s.mu.Unlock()
+		return DocumentDoesNotExistErr{ID: id}
+	}
+	delete(s.docs, id)
+	delete(s.times, id)
+	if s.lru != nil {
+		s.lru.remove(id)
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *InMemoryDocumentStore) Stats(ctx context.Context) (*StoreStatsInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &StoreStatsInfo{Count: int64(len(s.docs))}, nil
+}
+
+func (s *InMemoryDocumentStore) GetWithRevision(ctx context.Context, id string) (map[string]interface{}, string, error) {
+	s.mu.Lock()
+	doc, exists := s.docs[id]
+	rev := s.revs[id]
+	s.touch(id)
+	s.mu.Unlock()
+	if !exists {
+		return nil, "", DocumentDoesNotExistErr{ID: id}
+	}
+
+	return CopyDoc(doc), formatRevision(rev), nil
+}
+
+func (s *InMemoryDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	s.mu.Lock()
+	if err := s.checkRevision(id, revision); err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	evicted, err := s.upsert(id, doc)
+	rev := formatRevision(s.revs[id])
+	s.mu.Unlock()
+
+	s.evicted(evicted)
+	if err != nil {
+		return "", err
+	}
+	return rev, nil
+}
+
+func (s *InMemoryDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	s.mu.Lock()
+	if err := s.checkRevision(id, revision); err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	evicted := s.replace(id, doc)
+	rev := formatRevision(s.revs[id])
+	s.mu.Unlock()
+
+	s.evicted(evicted)
+	return rev, nil
+}
+
+// checkRevision must be called with the lock held.
+func (s *InMemoryDocumentStore) checkRevision(id string, revision string) error {
+	if revision == "" {
+		return nil
+	}
+	if _, exists := s.docs[id]; !exists {
+		return DocumentDoesNotExistErr{ID: id}
+	}
+	if actual := formatRevision(s.revs[id]); revision != actual {
+		return RevisionMismatchErr{ID: id, Expected: revision, Actual: actual}
+	}
+	return nil
+}
+
+// upsert must be called with the lock held. It returns the ids of the
+// documents evicted to make room for the new one.
+func (s *InMemoryDocumentStore) upsert(id string, doc map[string]interface{}) ([]string, error) {
+	doc = CopyDoc(doc)
 	d, ok := s.docs[id]
 	if ok {
-		doc = mergeDocs(doc, d)
+		var err error
+		doc, err = MergeDocs(doc, d)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return s.set(id, doc), nil
+}
+
+// replace must be called with the lock held. It returns the ids of the
+// documents evicted to make room for the new one.
+func (s *InMemoryDocumentStore) replace(id string, doc map[string]interface{}) []string {
+	return s.set(id, CopyDoc(doc))
+}
+
+// set must be called with the lock held, with a doc nothing else holds.
+func (s *InMemoryDocumentStore) set(id string, doc map[string]interface{}) []string {
 	s.docs[id] = doc
-	s.mu.Unlock()
-	zap.L().Debug("successfully stored document in memory", zap.String("id", id))
+	s.revs[id]++
+	s.times[id] = s.times[id].touched(time.Now())
+	if s.lru == nil {
+		return nil
+	}
 
-	return nil
+	evicted := s.lru.set(id, 0)
+	for _, id := range evicted {
+		delete(s.docs, id)
+		delete(s.times, id)
+	}
+	return evicted
+}
+
+// touch must be called with the lock held.
+func (s *InMemoryDocumentStore) touch(id string) {
+	if s.lru != nil {
+		s.lru.touch(id)
+	}
+}
+
+func (s *InMemoryDocumentStore) evicted(ids []string) {
+	if s.onEvict == nil {
+		return
+	}
+	for _, id := range ids {
+		s.onEvict(id)
+	}
 }
 
 func (s *InMemoryDocumentStore) WithDocument(id string, doc map[string]interface{}) *InMemoryDocumentStore {
-	s.docs[id] = doc
+	s.evicted(s.replace(id, doc))
 	return s
 }
 
@@ -194,7 +1297,21 @@ func (s *InMemoryDocumentStore) NumOfDocs() int {
 	return len(s.docs)
 }
 
-func mergeDocs(dst, src map[string]interface{}) map[string]interface{} {
+func formatRevision(rev uint64) string {
+	return strconv.FormatUint(rev, 10)
+}
+
+// MergeDocs deep merges src into dst, keeping the values already in dst
+// where both have the same key, and returns dst. It's how DocumentStores
+// are expected to merge an upserted document into the stored one.
+//
+// A MergeConflictErr is returned if a field holds an object in src but not
+// in dst, in which case dst may have been partially merged into.
+func MergeDocs(dst, src map[string]interface{}) (map[string]interface{}, error) {
+	return mergeDocs(dst, src, "")
+}
+
+func mergeDocs(dst, src map[string]interface{}, path string) (map[string]interface{}, error) {
 	for k, sv := range src {
 		dv, exists := dst[k]
 		if !exists {
@@ -207,13 +1324,27 @@ func mergeDocs(dst, src map[string]interface{}) map[string]interface{} {
 			continue
 		}
 
+		field := k
+		if path != "" {
+			field = path + "." + k
+		}
 		dvMap, ok := dv.(map[string]interface{})
 		if !ok {
-			panic("expected documents to have consistent type for given field")
+			return dst, MergeConflictErr{Field: field}
 		}
 
-		mergeDocs(dvMap, svMap)
+		_, err := mergeDocs(dvMap, svMap, field)
+		if err != nil {
+			return dst, err
+		}
 	}
 
-	return dst
+	return dst, nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
 }
@@ -0,0 +1,447 @@
+// Package circuitbreaker provides ObjectStore and DocumentStore wrappers
+// which stop calling a store that keeps failing, so callers fail fast
+// instead of waiting on a backend which is down.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/z5labs/sakuin"
+)
+
+// ErrCircuitOpen is returned instead of calling the store while the breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// State is the state of a Breaker.
+type State int
+
+const (
+	// StateClosed lets every call through.
+	StateClosed State = iota
+
+	// StateOpen fails every call with ErrCircuitOpen.
+	StateOpen
+
+	// StateHalfOpen lets a limited number of probe calls through
+	// to find out whether the store has recovered.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Options configures a Breaker. Zero values are replaced by their defaults.
+type Options struct {
+	// FailureThreshold is how many consecutive failures open the breaker.
+	// Defaults to 5.
+	FailureThreshold int
+
+	// OpenDuration is how long the breaker stays open before letting
+	// probe calls through. Defaults to 30 seconds.
+	OpenDuration time.Duration
+
+	// HalfOpenProbes is how many probe calls are let through at once
+	// while half-open, all of which must succeed to close the breaker.
+	// Defaults to 1.
+	HalfOpenProbes int
+
+	// IsFailure reports whether an error counts as a failure.
+	// Defaults to IsFailure.
+	IsFailure func(error) bool
+
+	// OnStateChange is called after every state transition,
+	// e.g. to record metrics. It mustn't call the Breaker.
+	OnStateChange func(from, to State)
+
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// IsFailure counts every error as a failure except those which show the
+// store is working: the typed not-found errors, already exists errors,
+// revision mismatches and the not supported errors. Calls canceled by
+// the caller aren't failures either.
+func IsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var objErr sakuin.ObjectDoesNotExistErr
+	var docErr sakuin.DocumentDoesNotExistErr
+	var existsErr sakuin.ObjectAlreadyExistsErr
+	var revErr sakuin.RevisionMismatchErr
+	if errors.As(err, &objErr) || errors.As(err, &docErr) || errors.As(err, &existsErr) || errors.As(err, &revErr) {
+		return false
+	}
+	for _, target := range []error{sakuin.ErrRevisionsNotSupported, sakuin.ErrListNotSupported, sakuin.ErrQueryNotSupported, sakuin.ErrStatsNotSupported, context.Canceled} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// Breaker is a closed, open and half-open circuit breaker. It may be
+// shared by several stores, which then open and close together.
+type Breaker struct {
+	opts Options
+
+	mu        sync.Mutex
+	state     State
+	gen       uint64
+	failures  int
+	openedAt  time.Time
+	probes    int
+	successes int
+}
+
+// NewBreaker returns a closed Breaker.
+func NewBreaker(opts Options) *Breaker {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.OpenDuration <= 0 {
+		opts.OpenDuration = 30 * time.Second
+	}
+	if opts.HalfOpenProbes <= 0 {
+		opts.HalfOpenProbes = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = IsFailure
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Breaker{opts: opts}
+}
+
+// State returns the current state of the breaker. An open breaker whose
+// OpenDuration has passed is reported as open until the next call.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Do calls f unless the breaker is open, in which case ErrCircuitOpen
+// is returned. The error returned by f is passed through unchanged.
+func (b *Breaker) Do(f func() error) error {
+	gen, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	err = f()
+	b.done(gen, err)
+	return err
+}
+
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	var from State
+	changed := false
+	defer func() {
+		b.mu.Unlock()
+		if changed {
+			b.notify(from, StateHalfOpen)
+		}
+	}()
+
+	switch b.state {
+	case StateOpen:
+		if b.opts.Now().Sub(b.openedAt) < b.opts.OpenDuration {
+			return 0, ErrCircuitOpen
+		}
+		from, changed = b.state, true
+		b.setState(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probes >= b.opts.HalfOpenProbes {
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	return b.gen, nil
+}
+
+// done records the outcome of a call let through while the breaker was
+// in generation gen. Calls which finish after a later transition are
+// ignored, so they can't be mistaken for probes.
+func (b *Breaker) done(gen uint64, err error) {
+	failed := b.opts.IsFailure(err)
+
+	b.mu.Lock()
+	if gen != b.gen {
+		b.mu.Unlock()
+		return
+	}
+
+	from := b.state
+	switch {
+	case b.state == StateClosed && failed:
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			b.setState(StateOpen)
+		}
+	case b.state == StateClosed:
+		b.failures = 0
+	case b.state == StateHalfOpen && failed:
+		b.setState(StateOpen)
+	case b.state == StateHalfOpen:
+		b.successes++
+		if b.successes >= b.opts.HalfOpenProbes {
+			b.setState(StateClosed)
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(from, to)
+	}
+}
+
+// setState must be called with the lock held.
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.gen++
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+	if state == StateOpen {
+		b.openedAt = b.opts.Now()
+	}
+}
+
+func (b *Breaker) notify(from, to State) {
+	if b.opts.OnStateChange != nil {
+		b.opts.OnStateChange(from, to)
+	}
+}
+
+// NewObjectStore returns an ObjectStore which calls inner through the breaker.
+//
+// The returned store implements sakuin.StreamingObjectStore if inner does.
+// It always implements sakuin.ListableObjectStore and sakuin.StoreStats,
+// returning sakuin.ErrListNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewObjectStore(inner sakuin.ObjectStore, breaker *Breaker) sakuin.ObjectStore {
+	s := &ObjectStore{inner: inner, breaker: breaker}
+	if streamDB, ok := inner.(sakuin.StreamingObjectStore); ok {
+		return &StreamingObjectStore{ObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// NewDocumentStore returns a DocumentStore which calls inner through the breaker.
+//
+// The returned store implements sakuin.RevisionedDocumentStore if inner does.
+// It always implements sakuin.QueryableDocumentStore and sakuin.StoreStats,
+// returning sakuin.ErrQueryNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewDocumentStore(inner sakuin.DocumentStore, breaker *Breaker) sakuin.DocumentStore {
+	s := &DocumentStore{inner: inner, breaker: breaker}
+	if revDB, ok := inner.(sakuin.RevisionedDocumentStore); ok {
+		return &RevisionedDocumentStore{DocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+// ObjectStore calls the wrapped ObjectStore through a Breaker.
+type ObjectStore struct {
+	inner   sakuin.ObjectStore
+	breaker *Breaker
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (info *sakuin.StatInfo, err error) {
+	err = s.breaker.Do(func() error {
+		info, err = s.inner.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) (b []byte, err error) {
+	err = s.breaker.Do(func() error {
+		b, err = s.inner.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.breaker.Do(func() error {
+		return s.inner.Put(ctx, id, b)
+	})
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	return s.breaker.Do(func() error {
+		return s.inner.Update(ctx, id, b)
+	})
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	return s.breaker.Do(func() error {
+		return s.inner.Delete(ctx, id)
+	})
+}
+
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) (ids []string, next string, err error) {
+	listDB, ok := s.inner.(sakuin.ListableObjectStore)
+	if !ok {
+		return nil, "", sakuin.ErrListNotSupported
+	}
+
+	err = s.breaker.Do(func() error {
+		ids, next, err = listDB.List(ctx, prefix, cursor, limit)
+		return err
+	})
+	return
+}
+
+func (s *ObjectStore) Stats(ctx context.Context) (stats *sakuin.StoreStatsInfo, err error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	err = s.breaker.Do(func() error {
+		stats, err = statsDB.Stats(ctx)
+		return err
+	})
+	return
+}
+
+// StreamingObjectStore is returned by NewObjectStore for stores which
+// implement sakuin.StreamingObjectStore. Only opening a stream goes
+// through the breaker, reading from it doesn't.
+type StreamingObjectStore struct {
+	*ObjectStore
+	streamDB sakuin.StreamingObjectStore
+}
+
+func (s *StreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.breaker.Do(func() error {
+		return s.streamDB.PutStream(ctx, id, r, size)
+	})
+}
+
+func (s *StreamingObjectStore) GetStream(ctx context.Context, id string) (rc io.ReadCloser, size int64, err error) {
+	err = s.breaker.Do(func() error {
+		rc, size, err = s.streamDB.GetStream(ctx, id)
+		return err
+	})
+	return
+}
+
+// DocumentStore calls the wrapped DocumentStore through a Breaker.
+type DocumentStore struct {
+	inner   sakuin.DocumentStore
+	breaker *Breaker
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (info *sakuin.StatInfo, err error) {
+	err = s.breaker.Do(func() error {
+		info, err = s.inner.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (doc map[string]interface{}, err error) {
+	err = s.breaker.Do(func() error {
+		doc, err = s.inner.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.breaker.Do(func() error {
+		return s.inner.Upsert(ctx, id, doc)
+	})
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.breaker.Do(func() error {
+		return s.inner.Replace(ctx, id, doc)
+	})
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	return s.breaker.Do(func() error {
+		return s.inner.Delete(ctx, id)
+	})
+}
+
+func (s *DocumentStore) Query(ctx context.Context, q sakuin.Query) (result sakuin.QueryResult, err error) {
+	queryDB, ok := s.inner.(sakuin.QueryableDocumentStore)
+	if !ok {
+		return sakuin.QueryResult{}, sakuin.ErrQueryNotSupported
+	}
+
+	err = s.breaker.Do(func() error {
+		result, err = queryDB.Query(ctx, q)
+		return err
+	})
+	return
+}
+
+func (s *DocumentStore) Stats(ctx context.Context) (stats *sakuin.StoreStatsInfo, err error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	err = s.breaker.Do(func() error {
+		stats, err = statsDB.Stats(ctx)
+		return err
+	})
+	return
+}
+
+// RevisionedDocumentStore is returned by NewDocumentStore for stores
+// which implement sakuin.RevisionedDocumentStore.
+type RevisionedDocumentStore struct {
+	*DocumentStore
+	revDB sakuin.RevisionedDocumentStore
+}
+
+func (s *RevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (doc map[string]interface{}, rev string, err error) {
+	err = s.breaker.Do(func() error {
+		doc, rev, err = s.revDB.GetWithRevision(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *RevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.breaker.Do(func() error {
+		rev, err = s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
+
+func (s *RevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.breaker.Do(func() error {
+		rev, err = s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
@@ -0,0 +1,229 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// fakeClock only moves when advanced.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// downDocumentStore fails every Get with err while down.
+type downDocumentStore struct {
+	*sakuin.InMemoryDocumentStore
+	down  bool
+	err   error
+	calls int
+}
+
+func (s *downDocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	s.calls++
+	if s.down {
+		return nil, s.err
+	}
+	return s.InMemoryDocumentStore.Get(ctx, id)
+}
+
+type transition struct {
+	From, To State
+}
+
+func TestBreaker(t *testing.T) {
+	newBreaker := func(clock *fakeClock, transitions *[]transition) *Breaker {
+		return NewBreaker(Options{
+			FailureThreshold: 2,
+			OpenDuration:     time.Minute,
+			HalfOpenProbes:   2,
+			Now:              clock.Now,
+			OnStateChange: func(from, to State) {
+				*transitions = append(*transitions, transition{From: from, To: to})
+			},
+		})
+	}
+	fail := func() error { return errUnavailable }
+	succeed := func() error { return nil }
+
+	t.Run("should drive the full state machine", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		var transitions []transition
+		b := newBreaker(clock, &transitions)
+
+		assert.Equal(subT, errUnavailable, b.Do(fail))
+		assert.Equal(subT, StateClosed, b.State())
+		assert.Equal(subT, errUnavailable, b.Do(fail))
+		assert.Equal(subT, StateOpen, b.State())
+
+		called := false
+		err := b.Do(func() error {
+			called = true
+			return nil
+		})
+		assert.Equal(subT, ErrCircuitOpen, err)
+		assert.False(subT, called)
+
+		clock.Advance(time.Minute)
+		assert.Nil(subT, b.Do(succeed))
+		assert.Equal(subT, StateHalfOpen, b.State())
+		assert.Nil(subT, b.Do(succeed))
+		assert.Equal(subT, StateClosed, b.State())
+
+		assert.Equal(subT, []transition{
+			{From: StateClosed, To: StateOpen},
+			{From: StateOpen, To: StateHalfOpen},
+			{From: StateHalfOpen, To: StateClosed},
+		}, transitions)
+	})
+
+	t.Run("should reopen if a probe fails", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		var transitions []transition
+		b := newBreaker(clock, &transitions)
+
+		b.Do(fail)
+		b.Do(fail)
+		clock.Advance(time.Minute)
+
+		assert.Equal(subT, errUnavailable, b.Do(fail))
+		assert.Equal(subT, StateOpen, b.State())
+		assert.Equal(subT, ErrCircuitOpen, b.Do(succeed))
+
+		clock.Advance(time.Minute)
+		assert.Nil(subT, b.Do(succeed))
+		assert.Equal(subT, StateHalfOpen, b.State())
+	})
+
+	t.Run("should limit the probes in flight while half-open", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		var transitions []transition
+		b := newBreaker(clock, &transitions)
+
+		b.Do(fail)
+		b.Do(fail)
+		clock.Advance(time.Minute)
+
+		var errs []error
+		b.Do(func() error {
+			errs = append(errs, b.Do(func() error {
+				errs = append(errs, b.Do(succeed))
+				return nil
+			}))
+			return nil
+		})
+		assert.Equal(subT, []error{ErrCircuitOpen, nil}, errs)
+		assert.Equal(subT, StateClosed, b.State())
+	})
+
+	t.Run("should reset the failure count after a success", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		var transitions []transition
+		b := newBreaker(clock, &transitions)
+
+		b.Do(fail)
+		b.Do(succeed)
+		b.Do(fail)
+		assert.Equal(subT, StateClosed, b.State())
+	})
+
+	t.Run("should ignore calls which finish after a transition", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		var transitions []transition
+		b := newBreaker(clock, &transitions)
+
+		b.Do(func() error {
+			b.Do(fail)
+			b.Do(fail)
+			clock.Advance(time.Minute)
+			b.Do(succeed)
+			return nil
+		})
+		assert.Equal(subT, StateHalfOpen, b.State())
+	})
+}
+
+func TestDocumentStore(t *testing.T) {
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), NewDocumentStore(sakuin.NewInMemoryDocumentStore(), NewBreaker(Options{})))
+
+	t.Run("should fail fast while the store is down", func(subT *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		inner := &downDocumentStore{
+			InMemoryDocumentStore: sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+			down:                  true,
+			err:                   errUnavailable,
+		}
+		s := NewDocumentStore(inner, NewBreaker(Options{
+			FailureThreshold: 3,
+			OpenDuration:     time.Minute,
+			Now:              clock.Now,
+		}))
+
+		for i := 0; i < 5; i++ {
+			s.Get(context.Background(), "test")
+		}
+		assert.Equal(subT, 3, inner.calls)
+
+		_, err := s.Get(context.Background(), "test")
+		assert.Equal(subT, ErrCircuitOpen, err)
+
+		inner.down = false
+		clock.Advance(time.Minute)
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+	})
+
+	t.Run("should not count missing documents as failures", func(subT *testing.T) {
+		s := NewDocumentStore(sakuin.NewInMemoryDocumentStore(), NewBreaker(Options{FailureThreshold: 1}))
+
+		for i := 0; i < 3; i++ {
+			_, err := s.Get(context.Background(), "missing")
+			var docErr sakuin.DocumentDoesNotExistErr
+			assert.ErrorAs(subT, err, &docErr)
+		}
+	})
+
+	t.Run("should preserve revision support", func(subT *testing.T) {
+		s := NewDocumentStore(sakuin.NewInMemoryDocumentStore(), NewBreaker(Options{}))
+
+		_, ok := s.(sakuin.RevisionedDocumentStore)
+		assert.True(subT, ok)
+	})
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), NewBreaker(Options{})))
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), NewBreaker(Options{})).(sakuin.StreamingObjectStore))
+
+	t.Run("should not count missing objects as failures", func(subT *testing.T) {
+		b := NewBreaker(Options{FailureThreshold: 1})
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), b)
+
+		for i := 0; i < 3; i++ {
+			_, err := s.Get(context.Background(), "missing")
+			var objErr sakuin.ObjectDoesNotExistErr
+			assert.ErrorAs(subT, err, &objErr)
+		}
+		assert.Equal(subT, StateClosed, b.State())
+	})
+}
@@ -0,0 +1,266 @@
+// Package logging provides ObjectStore and DocumentStore wrappers which
+// log every call made to the wrapped store.
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	"go.uber.org/zap"
+)
+
+// Outcomes logged for each call.
+const (
+	OutcomeSuccess  = "success"
+	OutcomeNotFound = "not_found"
+	OutcomeError    = "error"
+)
+
+// NewObjectStore returns an ObjectStore which logs every call to inner
+// with its method, id, duration, size and outcome. Successful calls are
+// logged at debug level, missing objects at warn level and any other
+// failure at error level. Errors are returned unchanged.
+//
+// The returned store implements sakuin.StreamingObjectStore if inner does.
+// It always implements sakuin.ListableObjectStore and sakuin.StoreStats,
+// returning sakuin.ErrListNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewObjectStore(inner sakuin.ObjectStore, log *zap.Logger) sakuin.ObjectStore {
+	s := &ObjectStore{inner: inner, log: log}
+	if streamDB, ok := inner.(sakuin.StreamingObjectStore); ok {
+		return &StreamingObjectStore{ObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// NewDocumentStore returns a DocumentStore which logs every call to inner
+// in the same way as NewObjectStore. The size logged is the number of
+// top level fields in the document.
+//
+// The returned store implements sakuin.RevisionedDocumentStore if inner does.
+// It always implements sakuin.QueryableDocumentStore and sakuin.StoreStats,
+// returning sakuin.ErrQueryNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewDocumentStore(inner sakuin.DocumentStore, log *zap.Logger) sakuin.DocumentStore {
+	s := &DocumentStore{inner: inner, log: log}
+	if revDB, ok := inner.(sakuin.RevisionedDocumentStore); ok {
+		return &RevisionedDocumentStore{DocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+// logCall logs the outcome of a single store call.
+func logCall(log *zap.Logger, method string, id string, start time.Time, err error, fields ...zap.Field) {
+	fields = append(fields,
+		zap.String("method", method),
+		zap.String("id", id),
+		zap.Duration("duration", time.Since(start)),
+	)
+
+	var objErr sakuin.ObjectDoesNotExistErr
+	var docErr sakuin.DocumentDoesNotExistErr
+	switch {
+	case err == nil:
+		log.Debug("store call succeeded", append(fields, zap.String("outcome", OutcomeSuccess))...)
+	case errors.As(err, &objErr), errors.As(err, &docErr):
+		log.Warn("store call found nothing", append(fields, zap.String("outcome", OutcomeNotFound))...)
+	default:
+		log.Error("store call failed", append(fields, zap.String("outcome", OutcomeError), zap.Error(err))...)
+	}
+}
+
+// ObjectStore logs every call made to the wrapped ObjectStore.
+type ObjectStore struct {
+	inner sakuin.ObjectStore
+	log   *zap.Logger
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	start := time.Now()
+	info, err := s.inner.Stat(ctx, id)
+	if err == nil {
+		logCall(s.log, "Stat", id, start, nil, zap.Int("size", info.Size), zap.Bool("exists", info.Exists))
+		return info, nil
+	}
+	logCall(s.log, "Stat", id, start, err)
+	return nil, err
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	start := time.Now()
+	b, err := s.inner.Get(ctx, id)
+	logCall(s.log, "Get", id, start, err, zap.Int("size", len(b)))
+	return b, err
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	start := time.Now()
+	err := s.inner.Put(ctx, id, b)
+	logCall(s.log, "Put", id, start, err, zap.Int("size", len(b)))
+	return err
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	start := time.Now()
+	err := s.inner.Update(ctx, id, b)
+	logCall(s.log, "Update", id, start, err, zap.Int("size", len(b)))
+	return err
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.Delete(ctx, id)
+	logCall(s.log, "Delete", id, start, err)
+	return err
+}
+
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	listDB, ok := s.inner.(sakuin.ListableObjectStore)
+	if !ok {
+		return nil, "", sakuin.ErrListNotSupported
+	}
+
+	start := time.Now()
+	ids, next, err := listDB.List(ctx, prefix, cursor, limit)
+	logCall(s.log, "List", "", start, err, zap.String("prefix", prefix), zap.Int("count", len(ids)))
+	return ids, next, err
+}
+
+func (s *ObjectStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	start := time.Now()
+	stats, err := statsDB.Stats(ctx)
+	logCall(s.log, "Stats", "", start, err)
+	return stats, err
+}
+
+// StreamingObjectStore is returned by NewObjectStore for stores which
+// implement sakuin.StreamingObjectStore. Streamed calls are logged once
+// the stream has been opened, not once it has been read.
+type StreamingObjectStore struct {
+	*ObjectStore
+	streamDB sakuin.StreamingObjectStore
+}
+
+func (s *StreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	start := time.Now()
+	err := s.streamDB.PutStream(ctx, id, r, size)
+	logCall(s.log, "PutStream", id, start, err, zap.Int64("size", size))
+	return err
+}
+
+func (s *StreamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	start := time.Now()
+	rc, size, err := s.streamDB.GetStream(ctx, id)
+	logCall(s.log, "GetStream", id, start, err, zap.Int64("size", size))
+	return rc, size, err
+}
+
+// DocumentStore logs every call made to the wrapped DocumentStore.
+type DocumentStore struct {
+	inner sakuin.DocumentStore
+	log   *zap.Logger
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	start := time.Now()
+	info, err := s.inner.Stat(ctx, id)
+	if err == nil {
+		logCall(s.log, "Stat", id, start, nil, zap.Int("size", info.Size), zap.Bool("exists", info.Exists))
+		return info, nil
+	}
+	logCall(s.log, "Stat", id, start, err)
+	return nil, err
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	start := time.Now()
+	doc, err := s.inner.Get(ctx, id)
+	logCall(s.log, "Get", id, start, err, zap.Int("size", len(doc)))
+	return doc, err
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	start := time.Now()
+	size := len(doc)
+	err := s.inner.Upsert(ctx, id, doc)
+	logCall(s.log, "Upsert", id, start, err, zap.Int("size", size))
+	return err
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	start := time.Now()
+	size := len(doc)
+	err := s.inner.Replace(ctx, id, doc)
+	logCall(s.log, "Replace", id, start, err, zap.Int("size", size))
+	return err
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.Delete(ctx, id)
+	logCall(s.log, "Delete", id, start, err)
+	return err
+}
+
+func (s *DocumentStore) Query(ctx context.Context, q sakuin.Query) (sakuin.QueryResult, error) {
+	queryDB, ok := s.inner.(sakuin.QueryableDocumentStore)
+	if !ok {
+		return sakuin.QueryResult{}, sakuin.ErrQueryNotSupported
+	}
+
+	start := time.Now()
+	result, err := queryDB.Query(ctx, q)
+	logCall(s.log, "Query", "", start, err, zap.Int("count", len(result.Documents)))
+	return result, err
+}
+
+func (s *DocumentStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	start := time.Now()
+	stats, err := statsDB.Stats(ctx)
+	logCall(s.log, "Stats", "", start, err)
+	return stats, err
+}
+
+// RevisionedDocumentStore is returned by NewDocumentStore for stores
+// which implement sakuin.RevisionedDocumentStore.
+type RevisionedDocumentStore struct {
+	*DocumentStore
+	revDB sakuin.RevisionedDocumentStore
+}
+
+func (s *RevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (map[string]interface{}, string, error) {
+	start := time.Now()
+	doc, rev, err := s.revDB.GetWithRevision(ctx, id)
+	logCall(s.log, "GetWithRevision", id, start, err, zap.Int("size", len(doc)), zap.String("revision", rev))
+	return doc, rev, err
+}
+
+func (s *RevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	start := time.Now()
+	size := len(doc)
+	rev, err := s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+	logCall(s.log, "UpsertIfRevision", id, start, err, zap.Int("size", size), zap.String("revision", rev))
+	return rev, err
+}
+
+func (s *RevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	start := time.Now()
+	size := len(doc)
+	rev, err := s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+	logCall(s.log, "ReplaceIfRevision", id, start, err, zap.Int("size", size), zap.String("revision", rev))
+	return rev, err
+}
@@ -0,0 +1,151 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// failingObjectStore fails every Put.
+type failingObjectStore struct {
+	*sakuin.InMemoryObjectStore
+	err error
+}
+
+func (s failingObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.err
+}
+
+// plainObjectStore hides the optional interfaces of the store it embeds.
+type plainObjectStore struct {
+	sakuin.ObjectStore
+}
+
+func TestObjectStore(t *testing.T) {
+	newStore := func() sakuin.ObjectStore {
+		return NewObjectStore(sakuin.NewInMemoryObjectStore(), zap.NewNop())
+	}
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), newStore())
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), newStore().(sakuin.StreamingObjectStore))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), newStore().(sakuin.ListableObjectStore))
+
+	t.Run("should log each call with its outcome", func(subT *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), zap.New(core))
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.Get(context.Background(), "missing")
+		if !assert.Error(subT, err) {
+			return
+		}
+
+		entries := logs.AllUntimed()
+		if !assert.Len(subT, entries, 2) {
+			return
+		}
+
+		put := entries[0]
+		assert.Equal(subT, zapcore.DebugLevel, put.Level)
+		fields := put.ContextMap()
+		assert.Equal(subT, "Put", fields["method"])
+		assert.Equal(subT, "test", fields["id"])
+		assert.Equal(subT, int64(len("content")), fields["size"])
+		assert.Equal(subT, OutcomeSuccess, fields["outcome"])
+		assert.Contains(subT, fields, "duration")
+
+		get := entries[1]
+		assert.Equal(subT, zapcore.WarnLevel, get.Level)
+		fields = get.ContextMap()
+		assert.Equal(subT, "Get", fields["method"])
+		assert.Equal(subT, "missing", fields["id"])
+		assert.Equal(subT, OutcomeNotFound, fields["outcome"])
+	})
+
+	t.Run("should log other failures as errors and return them unchanged", func(subT *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		putErr := errors.New("put failed")
+		s := NewObjectStore(failingObjectStore{InMemoryObjectStore: sakuin.NewInMemoryObjectStore(), err: putErr}, zap.New(core))
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		assert.Equal(subT, putErr, err)
+
+		entries := logs.AllUntimed()
+		if !assert.Len(subT, entries, 1) {
+			return
+		}
+		assert.Equal(subT, zapcore.ErrorLevel, entries[0].Level)
+		assert.Equal(subT, OutcomeError, entries[0].ContextMap()["outcome"])
+		assert.Equal(subT, "put failed", entries[0].ContextMap()["error"])
+	})
+
+	t.Run("should only support optional interfaces the inner store does", func(subT *testing.T) {
+		s := NewObjectStore(plainObjectStore{sakuin.NewInMemoryObjectStore()}, zap.NewNop())
+
+		_, ok := s.(sakuin.StreamingObjectStore)
+		assert.False(subT, ok)
+
+		_, _, err := s.(sakuin.ListableObjectStore).List(context.Background(), "", "", 0)
+		assert.Equal(subT, sakuin.ErrListNotSupported, err)
+	})
+}
+
+func TestDocumentStore(t *testing.T) {
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), NewDocumentStore(sakuin.NewInMemoryDocumentStore(), zap.NewNop()))
+	sakuin.RunQueryableDocumentStorageTests(storagetest.Lift(t), NewDocumentStore(sakuin.NewInMemoryDocumentStore(), zap.NewNop()).(sakuin.QueryableDocumentStore))
+
+	t.Run("should log each call with its outcome", func(subT *testing.T) {
+		core, logs := observer.New(zap.DebugLevel)
+		s := NewDocumentStore(sakuin.NewInMemoryDocumentStore(), zap.New(core))
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test", "size": 1})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Delete(context.Background(), "missing")
+		if !assert.Error(subT, err) {
+			return
+		}
+
+		entries := logs.AllUntimed()
+		if !assert.Len(subT, entries, 2) {
+			return
+		}
+
+		upsert := entries[0]
+		assert.Equal(subT, zapcore.DebugLevel, upsert.Level)
+		fields := upsert.ContextMap()
+		assert.Equal(subT, "Upsert", fields["method"])
+		assert.Equal(subT, "test", fields["id"])
+		assert.Equal(subT, int64(2), fields["size"])
+		assert.Equal(subT, OutcomeSuccess, fields["outcome"])
+
+		del := entries[1]
+		assert.Equal(subT, zapcore.WarnLevel, del.Level)
+		assert.Equal(subT, "Delete", del.ContextMap()["method"])
+		assert.Equal(subT, OutcomeNotFound, del.ContextMap()["outcome"])
+	})
+
+	t.Run("should preserve revision support and error types", func(subT *testing.T) {
+		s := NewDocumentStore(sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}), zap.NewNop())
+
+		revDB, ok := s.(sakuin.RevisionedDocumentStore)
+		if !assert.True(subT, ok) {
+			return
+		}
+
+		_, err := revDB.UpsertIfRevision(context.Background(), "test", map[string]interface{}{"name": "new"}, "stale")
+		var revErr sakuin.RevisionMismatchErr
+		assert.ErrorAs(subT, err, &revErr)
+	})
+}
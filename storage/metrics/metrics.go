@@ -0,0 +1,365 @@
+// Package metrics provides ObjectStore and DocumentStore wrappers which
+// record Prometheus metrics for every call made to the wrapped store.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of error counted for each call.
+const (
+	ErrorNotFound = "not_found"
+	ErrorOther    = "other"
+)
+
+// InstrumentObjectStore returns an ObjectStore which records every call
+// to inner with the following metrics, registered with reg:
+//
+//	sakuin_object_store_calls_total{method}
+//	sakuin_object_store_errors_total{method, kind}
+//	sakuin_object_store_call_duration_seconds{method}
+//	sakuin_object_store_object_size_bytes{method}
+//
+// Errors are counted as ErrorNotFound for sakuin.ObjectDoesNotExistErr and
+// ErrorOther for anything else, and are returned unchanged. Object sizes are
+// only recorded for successful calls which read or write an object.
+//
+// Any labels given are added to every metric, which lets several stores be
+// instrumented with the same registry, as long as they're all given the same
+// label names. Instrumenting another store with the same registry and label
+// values shares its metrics.
+//
+// The returned store implements sakuin.StreamingObjectStore if inner does.
+// It always implements sakuin.ListableObjectStore and sakuin.StoreStats,
+// returning sakuin.ErrListNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func InstrumentObjectStore(inner sakuin.ObjectStore, reg prometheus.Registerer, labels ...prometheus.Labels) sakuin.ObjectStore {
+	s := &ObjectStore{
+		inner: inner,
+		m: newStoreMetrics(reg, "object_store", mergeLabels(labels), prometheus.HistogramOpts{
+			Name:    "object_size_bytes",
+			Help:    "Size of the objects read and written.",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 10),
+		}),
+	}
+	if streamDB, ok := inner.(sakuin.StreamingObjectStore); ok {
+		return &StreamingObjectStore{ObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// InstrumentDocumentStore returns a DocumentStore which records every call
+// to inner in the same way as InstrumentObjectStore, with the metrics named
+// sakuin_document_store_* instead. Rather than a size in bytes, it records
+// the number of top level fields in each document, as
+// sakuin_document_store_document_fields{method}.
+//
+// The returned store implements sakuin.RevisionedDocumentStore if inner does.
+// It always implements sakuin.QueryableDocumentStore and sakuin.StoreStats,
+// returning sakuin.ErrQueryNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func InstrumentDocumentStore(inner sakuin.DocumentStore, reg prometheus.Registerer, labels ...prometheus.Labels) sakuin.DocumentStore {
+	s := &DocumentStore{
+		inner: inner,
+		m: newStoreMetrics(reg, "document_store", mergeLabels(labels), prometheus.HistogramOpts{
+			Name:    "document_fields",
+			Help:    "Number of top level fields in the documents read and written.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		}),
+	}
+	if revDB, ok := inner.(sakuin.RevisionedDocumentStore); ok {
+		return &RevisionedDocumentStore{DocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+func mergeLabels(labels []prometheus.Labels) prometheus.Labels {
+	merged := make(prometheus.Labels)
+	for _, l := range labels {
+		for k, v := range l {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+type storeMetrics struct {
+	calls    *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+}
+
+func newStoreMetrics(reg prometheus.Registerer, subsystem string, labels prometheus.Labels, sizeOpts prometheus.HistogramOpts) *storeMetrics {
+	sizeOpts.Namespace = "sakuin"
+	sizeOpts.Subsystem = subsystem
+	sizeOpts.ConstLabels = labels
+
+	return &storeMetrics{
+		calls: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "sakuin",
+			Subsystem:   subsystem,
+			Name:        "calls_total",
+			Help:        "Number of calls made to the store.",
+			ConstLabels: labels,
+		}, []string{"method"})).(*prometheus.CounterVec),
+		errors: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   "sakuin",
+			Subsystem:   subsystem,
+			Name:        "errors_total",
+			Help:        "Number of calls made to the store which failed.",
+			ConstLabels: labels,
+		}, []string{"method", "kind"})).(*prometheus.CounterVec),
+		duration: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   "sakuin",
+			Subsystem:   subsystem,
+			Name:        "call_duration_seconds",
+			Help:        "Time taken by calls made to the store.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: labels,
+		}, []string{"method"})).(*prometheus.HistogramVec),
+		size: register(reg, prometheus.NewHistogramVec(sizeOpts, []string{"method"})).(*prometheus.HistogramVec),
+	}
+}
+
+// register registers c with reg, returning the collector already
+// registered in its place if there is one.
+func register(reg prometheus.Registerer, c prometheus.Collector) prometheus.Collector {
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		return are.ExistingCollector
+	}
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// observe records a single call to the store.
+func (m *storeMetrics) observe(method string, start time.Time, err error) {
+	m.calls.WithLabelValues(method).Inc()
+	m.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+
+	kind := ErrorOther
+	var objErr sakuin.ObjectDoesNotExistErr
+	var docErr sakuin.DocumentDoesNotExistErr
+	if errors.As(err, &objErr) || errors.As(err, &docErr) {
+		kind = ErrorNotFound
+	}
+	m.errors.WithLabelValues(method, kind).Inc()
+}
+
+// observeSize records the size of what a successful call read or wrote.
+func (m *storeMetrics) observeSize(method string, size int, err error) {
+	if err != nil || size < 0 {
+		return
+	}
+	m.size.WithLabelValues(method).Observe(float64(size))
+}
+
+// ObjectStore records metrics for every call made to the wrapped ObjectStore.
+type ObjectStore struct {
+	inner sakuin.ObjectStore
+	m     *storeMetrics
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	start := time.Now()
+	info, err := s.inner.Stat(ctx, id)
+	s.m.observe("Stat", start, err)
+	return info, err
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	start := time.Now()
+	b, err := s.inner.Get(ctx, id)
+	s.m.observe("Get", start, err)
+	s.m.observeSize("Get", len(b), err)
+	return b, err
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	start := time.Now()
+	err := s.inner.Put(ctx, id, b)
+	s.m.observe("Put", start, err)
+	s.m.observeSize("Put", len(b), err)
+	return err
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	start := time.Now()
+	err := s.inner.Update(ctx, id, b)
+	s.m.observe("Update", start, err)
+	s.m.observeSize("Update", len(b), err)
+	return err
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.Delete(ctx, id)
+	s.m.observe("Delete", start, err)
+	return err
+}
+
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	listDB, ok := s.inner.(sakuin.ListableObjectStore)
+	if !ok {
+		return nil, "", sakuin.ErrListNotSupported
+	}
+
+	start := time.Now()
+	ids, next, err := listDB.List(ctx, prefix, cursor, limit)
+	s.m.observe("List", start, err)
+	return ids, next, err
+}
+
+func (s *ObjectStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	start := time.Now()
+	stats, err := statsDB.Stats(ctx)
+	s.m.observe("Stats", start, err)
+	return stats, err
+}
+
+// StreamingObjectStore is returned by InstrumentObjectStore for stores
+// which implement sakuin.StreamingObjectStore. Streamed calls are recorded
+// once the stream has been opened, not once it has been read, and their
+// sizes only when known up front.
+type StreamingObjectStore struct {
+	*ObjectStore
+	streamDB sakuin.StreamingObjectStore
+}
+
+func (s *StreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	start := time.Now()
+	err := s.streamDB.PutStream(ctx, id, r, size)
+	s.m.observe("PutStream", start, err)
+	s.m.observeSize("PutStream", int(size), err)
+	return err
+}
+
+func (s *StreamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	start := time.Now()
+	rc, size, err := s.streamDB.GetStream(ctx, id)
+	s.m.observe("GetStream", start, err)
+	s.m.observeSize("GetStream", int(size), err)
+	return rc, size, err
+}
+
+// DocumentStore records metrics for every call made to the wrapped DocumentStore.
+type DocumentStore struct {
+	inner sakuin.DocumentStore
+	m     *storeMetrics
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	start := time.Now()
+	info, err := s.inner.Stat(ctx, id)
+	s.m.observe("Stat", start, err)
+	return info, err
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	start := time.Now()
+	doc, err := s.inner.Get(ctx, id)
+	s.m.observe("Get", start, err)
+	s.m.observeSize("Get", len(doc), err)
+	return doc, err
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	start := time.Now()
+	size := len(doc)
+	err := s.inner.Upsert(ctx, id, doc)
+	s.m.observe("Upsert", start, err)
+	s.m.observeSize("Upsert", size, err)
+	return err
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	start := time.Now()
+	size := len(doc)
+	err := s.inner.Replace(ctx, id, doc)
+	s.m.observe("Replace", start, err)
+	s.m.observeSize("Replace", size, err)
+	return err
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	start := time.Now()
+	err := s.inner.Delete(ctx, id)
+	s.m.observe("Delete", start, err)
+	return err
+}
+
+func (s *DocumentStore) Query(ctx context.Context, q sakuin.Query) (sakuin.QueryResult, error) {
+	queryDB, ok := s.inner.(sakuin.QueryableDocumentStore)
+	if !ok {
+		return sakuin.QueryResult{}, sakuin.ErrQueryNotSupported
+	}
+
+	start := time.Now()
+	result, err := queryDB.Query(ctx, q)
+	s.m.observe("Query", start, err)
+	return result, err
+}
+
+func (s *DocumentStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	start := time.Now()
+	stats, err := statsDB.Stats(ctx)
+	s.m.observe("Stats", start, err)
+	return stats, err
+}
+
+// RevisionedDocumentStore is returned by InstrumentDocumentStore for stores
+// which implement sakuin.RevisionedDocumentStore.
+type RevisionedDocumentStore struct {
+	*DocumentStore
+	revDB sakuin.RevisionedDocumentStore
+}
+
+func (s *RevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (map[string]interface{}, string, error) {
+	start := time.Now()
+	doc, rev, err := s.revDB.GetWithRevision(ctx, id)
+	s.m.observe("GetWithRevision", start, err)
+	s.m.observeSize("GetWithRevision", len(doc), err)
+	return doc, rev, err
+}
+
+func (s *RevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	start := time.Now()
+	size := len(doc)
+	rev, err := s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+	s.m.observe("UpsertIfRevision", start, err)
+	s.m.observeSize("UpsertIfRevision", size, err)
+	return rev, err
+}
+
+func (s *RevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	start := time.Now()
+	size := len(doc)
+	rev, err := s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+	s.m.observe("ReplaceIfRevision", start, err)
+	s.m.observeSize("ReplaceIfRevision", size, err)
+	return rev, err
+}
@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingObjectStore fails every Put.
+type failingObjectStore struct {
+	*sakuin.InMemoryObjectStore
+	err error
+}
+
+func (s failingObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.err
+}
+
+// plainObjectStore hides the optional interfaces of the store it embeds.
+type plainObjectStore struct {
+	sakuin.ObjectStore
+}
+
+func TestObjectStore(t *testing.T) {
+	newStore := func() sakuin.ObjectStore {
+		return InstrumentObjectStore(sakuin.NewInMemoryObjectStore(), prometheus.NewRegistry())
+	}
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), newStore())
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), newStore().(sakuin.StreamingObjectStore))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), newStore().(sakuin.ListableObjectStore))
+
+	t.Run("should record each call with its outcome", func(subT *testing.T) {
+		reg := prometheus.NewRegistry()
+		s := InstrumentObjectStore(sakuin.NewInMemoryObjectStore(), reg, prometheus.Labels{"store": "objects"})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.Get(context.Background(), "missing")
+		var notFound sakuin.ObjectDoesNotExistErr
+		if !assert.ErrorAs(subT, err, &notFound) {
+			return
+		}
+
+		expected := `
+# HELP sakuin_object_store_calls_total Number of calls made to the store.
+# TYPE sakuin_object_store_calls_total counter
+sakuin_object_store_calls_total{method="Get",store="objects"} 2
+sakuin_object_store_calls_total{method="Put",store="objects"} 1
+# HELP sakuin_object_store_errors_total Number of calls made to the store which failed.
+# TYPE sakuin_object_store_errors_total counter
+sakuin_object_store_errors_total{kind="not_found",method="Get",store="objects"} 1
+`
+		err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "sakuin_object_store_calls_total", "sakuin_object_store_errors_total")
+		assert.Nil(subT, err)
+
+		families, err := reg.Gather()
+		if !assert.Nil(subT, err) {
+			return
+		}
+		histograms := make(map[string]map[string]uint64)
+		for _, f := range families {
+			for _, m := range f.GetMetric() {
+				if m.GetHistogram() == nil {
+					continue
+				}
+				labels := make(map[string]string)
+				for _, l := range m.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				if !assert.Equal(subT, "objects", labels["store"]) {
+					return
+				}
+				if histograms[f.GetName()] == nil {
+					histograms[f.GetName()] = make(map[string]uint64)
+				}
+				histograms[f.GetName()][labels["method"]] = m.GetHistogram().GetSampleCount()
+			}
+		}
+		assert.Equal(subT, map[string]map[string]uint64{
+			"sakuin_object_store_call_duration_seconds": {"Get": 2, "Put": 1},
+			"sakuin_object_store_object_size_bytes":     {"Get": 1, "Put": 1},
+		}, histograms)
+	})
+
+	t.Run("should count other failures and return them unchanged", func(subT *testing.T) {
+		reg := prometheus.NewRegistry()
+		putErr := errors.New("put failed")
+		s := InstrumentObjectStore(failingObjectStore{InMemoryObjectStore: sakuin.NewInMemoryObjectStore(), err: putErr}, reg)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		assert.Equal(subT, putErr, err)
+
+		expected := `
+# HELP sakuin_object_store_errors_total Number of calls made to the store which failed.
+# TYPE sakuin_object_store_errors_total counter
+sakuin_object_store_errors_total{kind="other",method="Put"} 1
+`
+		err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "sakuin_object_store_errors_total")
+		assert.Nil(subT, err)
+
+		n, err := testutil.GatherAndCount(reg, "sakuin_object_store_object_size_bytes")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 0, n)
+	})
+
+	t.Run("should share metrics between stores with the same labels", func(subT *testing.T) {
+		reg := prometheus.NewRegistry()
+		a := InstrumentObjectStore(sakuin.NewInMemoryObjectStore(), reg, prometheus.Labels{"store": "objects"})
+		b := InstrumentObjectStore(sakuin.NewInMemoryObjectStore(), reg, prometheus.Labels{"store": "objects"})
+		c := InstrumentObjectStore(sakuin.NewInMemoryObjectStore(), reg, prometheus.Labels{"store": "other"})
+
+		for _, s := range []sakuin.ObjectStore{a, b, c} {
+			err := s.Put(context.Background(), "test", []byte("content"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		expected := `
+# HELP sakuin_object_store_calls_total Number of calls made to the store.
+# TYPE sakuin_object_store_calls_total counter
+sakuin_object_store_calls_total{method="Put",store="objects"} 2
+sakuin_object_store_calls_total{method="Put",store="other"} 1
+`
+		err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "sakuin_object_store_calls_total")
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should only support optional interfaces the inner store does", func(subT *testing.T) {
+		s := InstrumentObjectStore(plainObjectStore{sakuin.NewInMemoryObjectStore()}, prometheus.NewRegistry())
+
+		_, ok := s.(sakuin.StreamingObjectStore)
+		assert.False(subT, ok)
+
+		_, _, err := s.(sakuin.ListableObjectStore).List(context.Background(), "", "", 0)
+		assert.Equal(subT, sakuin.ErrListNotSupported, err)
+	})
+}
+
+func TestDocumentStore(t *testing.T) {
+	newStore := func() sakuin.DocumentStore {
+		return InstrumentDocumentStore(sakuin.NewInMemoryDocumentStore(), prometheus.NewRegistry())
+	}
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), newStore())
+	sakuin.RunQueryableDocumentStorageTests(storagetest.Lift(t), newStore().(sakuin.QueryableDocumentStore))
+
+	t.Run("should record each call with its outcome", func(subT *testing.T) {
+		reg := prometheus.NewRegistry()
+		s := InstrumentDocumentStore(sakuin.NewInMemoryDocumentStore(), reg)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test", "size": 1})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Delete(context.Background(), "missing")
+		var notFound sakuin.DocumentDoesNotExistErr
+		if !assert.ErrorAs(subT, err, &notFound) {
+			return
+		}
+
+		expected := `
+# HELP sakuin_document_store_calls_total Number of calls made to the store.
+# TYPE sakuin_document_store_calls_total counter
+sakuin_document_store_calls_total{method="Delete"} 1
+sakuin_document_store_calls_total{method="Upsert"} 1
+# HELP sakuin_document_store_errors_total Number of calls made to the store which failed.
+# TYPE sakuin_document_store_errors_total counter
+sakuin_document_store_errors_total{kind="not_found",method="Delete"} 1
+`
+		err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "sakuin_document_store_calls_total", "sakuin_document_store_errors_total")
+		assert.Nil(subT, err)
+
+		n, err := testutil.GatherAndCount(reg, "sakuin_document_store_document_fields", "sakuin_document_store_call_duration_seconds")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, 3, n)
+	})
+
+	t.Run("should preserve revision support and error types", func(subT *testing.T) {
+		s := InstrumentDocumentStore(sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}), prometheus.NewRegistry())
+
+		revDB, ok := s.(sakuin.RevisionedDocumentStore)
+		if !assert.True(subT, ok) {
+			return
+		}
+
+		_, err := revDB.UpsertIfRevision(context.Background(), "test", map[string]interface{}{"name": "new"}, "stale")
+		var revErr sakuin.RevisionMismatchErr
+		assert.ErrorAs(subT, err, &revErr)
+	})
+}
@@ -0,0 +1,304 @@
+// Package ratelimit provides store wrappers which limit how often the
+// wrapped stores are called, e.g. to stay under the QPS limits of a
+// backing database when traffic is bursty.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/z5labs/sakuin"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned in FailFast mode instead of calling the
+// store when the limiter has no tokens left.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Mode decides what happens to calls while the limiter has no tokens left.
+type Mode int
+
+const (
+	// Wait blocks calls until the limiter allows them or their context is done.
+	Wait Mode = iota
+
+	// FailFast fails calls with ErrRateLimited.
+	FailFast
+)
+
+// Options configures the wrapped stores. The same limiters may be shared
+// between wrappers, e.g. to limit an object and document store held in
+// the same database together.
+type Options struct {
+	// Read limits Stat, Get and the other calls which don't write.
+	// A nil limiter doesn't limit anything.
+	Read *rate.Limiter
+
+	// Write limits Put, Update, Upsert, Replace, Delete and their
+	// streaming and revisioned equivalents.
+	Write *rate.Limiter
+
+	Mode Mode
+
+	// ForMethod optionally overrides the limiter for a method, given by
+	// its name, e.g. "Query". Returning nil falls back to Read or Write.
+	ForMethod func(method string) *rate.Limiter
+}
+
+type limiter struct {
+	opts Options
+}
+
+func (l limiter) wait(ctx context.Context, method string, write bool) error {
+	lim := l.opts.Read
+	if write {
+		lim = l.opts.Write
+	}
+	if l.opts.ForMethod != nil {
+		if override := l.opts.ForMethod(method); override != nil {
+			lim = override
+		}
+	}
+	if lim == nil {
+		return nil
+	}
+
+	if l.opts.Mode == FailFast {
+		if !lim.Allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	return lim.Wait(ctx)
+}
+
+// NewObjectStore returns an ObjectStore which calls inner at the rates
+// allowed by opts. Errors from inner are returned unchanged.
+//
+// The returned store implements sakuin.StreamingObjectStore if inner does.
+// It always implements sakuin.ListableObjectStore and sakuin.StoreStats,
+// returning sakuin.ErrListNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewObjectStore(inner sakuin.ObjectStore, opts Options) sakuin.ObjectStore {
+	s := &ObjectStore{inner: inner, limiter: limiter{opts: opts}}
+	if streamDB, ok := inner.(sakuin.StreamingObjectStore); ok {
+		return &StreamingObjectStore{ObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// NewDocumentStore returns a DocumentStore which calls inner at the rates
+// allowed by opts. Errors from inner are returned unchanged.
+//
+// The returned store implements sakuin.RevisionedDocumentStore if inner does.
+// It always implements sakuin.QueryableDocumentStore and sakuin.StoreStats,
+// returning sakuin.ErrQueryNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewDocumentStore(inner sakuin.DocumentStore, opts Options) sakuin.DocumentStore {
+	s := &DocumentStore{inner: inner, limiter: limiter{opts: opts}}
+	if revDB, ok := inner.(sakuin.RevisionedDocumentStore); ok {
+		return &RevisionedDocumentStore{DocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+// ObjectStore rate limits calls to the wrapped ObjectStore.
+type ObjectStore struct {
+	inner sakuin.ObjectStore
+	limiter
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	err := s.wait(ctx, "Stat", false)
+	if err != nil {
+		return nil, err
+	}
+	return s.inner.Stat(ctx, id)
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	err := s.wait(ctx, "Get", false)
+	if err != nil {
+		return nil, err
+	}
+	return s.inner.Get(ctx, id)
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	err := s.wait(ctx, "Put", true)
+	if err != nil {
+		return err
+	}
+	return s.inner.Put(ctx, id, b)
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	err := s.wait(ctx, "Update", true)
+	if err != nil {
+		return err
+	}
+	return s.inner.Update(ctx, id, b)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	err := s.wait(ctx, "Delete", true)
+	if err != nil {
+		return err
+	}
+	return s.inner.Delete(ctx, id)
+}
+
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	listDB, ok := s.inner.(sakuin.ListableObjectStore)
+	if !ok {
+		return nil, "", sakuin.ErrListNotSupported
+	}
+
+	err := s.wait(ctx, "List", false)
+	if err != nil {
+		return nil, "", err
+	}
+	return listDB.List(ctx, prefix, cursor, limit)
+}
+
+func (s *ObjectStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	err := s.wait(ctx, "Stats", false)
+	if err != nil {
+		return nil, err
+	}
+	return statsDB.Stats(ctx)
+}
+
+// StreamingObjectStore is returned by NewObjectStore for stores which
+// implement sakuin.StreamingObjectStore. Only opening a stream is
+// limited, reading from it isn't.
+type StreamingObjectStore struct {
+	*ObjectStore
+	streamDB sakuin.StreamingObjectStore
+}
+
+func (s *StreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	err := s.wait(ctx, "PutStream", true)
+	if err != nil {
+		return err
+	}
+	return s.streamDB.PutStream(ctx, id, r, size)
+}
+
+func (s *StreamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	err := s.wait(ctx, "GetStream", false)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.streamDB.GetStream(ctx, id)
+}
+
+// DocumentStore rate limits calls to the wrapped DocumentStore.
+type DocumentStore struct {
+	inner sakuin.DocumentStore
+	limiter
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	err := s.wait(ctx, "Stat", false)
+	if err != nil {
+		return nil, err
+	}
+	return s.inner.Stat(ctx, id)
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	err := s.wait(ctx, "Get", false)
+	if err != nil {
+		return nil, err
+	}
+	return s.inner.Get(ctx, id)
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	err := s.wait(ctx, "Upsert", true)
+	if err != nil {
+		return err
+	}
+	return s.inner.Upsert(ctx, id, doc)
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	err := s.wait(ctx, "Replace", true)
+	if err != nil {
+		return err
+	}
+	return s.inner.Replace(ctx, id, doc)
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	err := s.wait(ctx, "Delete", true)
+	if err != nil {
+		return err
+	}
+	return s.inner.Delete(ctx, id)
+}
+
+func (s *DocumentStore) Query(ctx context.Context, q sakuin.Query) (sakuin.QueryResult, error) {
+	queryDB, ok := s.inner.(sakuin.QueryableDocumentStore)
+	if !ok {
+		return sakuin.QueryResult{}, sakuin.ErrQueryNotSupported
+	}
+
+	err := s.wait(ctx, "Query", false)
+	if err != nil {
+		return sakuin.QueryResult{}, err
+	}
+	return queryDB.Query(ctx, q)
+}
+
+func (s *DocumentStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	err := s.wait(ctx, "Stats", false)
+	if err != nil {
+		return nil, err
+	}
+	return statsDB.Stats(ctx)
+}
+
+// RevisionedDocumentStore is returned by NewDocumentStore for stores
+// which implement sakuin.RevisionedDocumentStore.
+type RevisionedDocumentStore struct {
+	*DocumentStore
+	revDB sakuin.RevisionedDocumentStore
+}
+
+func (s *RevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (map[string]interface{}, string, error) {
+	err := s.wait(ctx, "GetWithRevision", false)
+	if err != nil {
+		return nil, "", err
+	}
+	return s.revDB.GetWithRevision(ctx, id)
+}
+
+func (s *RevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	err := s.wait(ctx, "UpsertIfRevision", true)
+	if err != nil {
+		return "", err
+	}
+	return s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+}
+
+func (s *RevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	err := s.wait(ctx, "ReplaceIfRevision", true)
+	if err != nil {
+		return "", err
+	}
+	return s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func unlimited() Options {
+	return Options{
+		Read:  rate.NewLimiter(rate.Inf, 1),
+		Write: rate.NewLimiter(rate.Inf, 1),
+	}
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), unlimited()))
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), unlimited()).(sakuin.StreamingObjectStore))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), unlimited()).(sakuin.ListableObjectStore))
+
+	t.Run("should space out calls", func(subT *testing.T) {
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), Options{
+			Write: rate.NewLimiter(rate.Every(20*time.Millisecond), 1),
+		})
+
+		start := time.Now()
+		for i := 0; i < 4; i++ {
+			err := s.Put(context.Background(), "test", []byte("content"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+		assert.GreaterOrEqual(subT, time.Since(start), 55*time.Millisecond)
+	})
+
+	t.Run("should stop waiting once the context is canceled", func(subT *testing.T) {
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), Options{
+			Read: rate.NewLimiter(rate.Every(time.Hour), 1),
+		})
+
+		_, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err = s.Stat(ctx, "test")
+		assert.Equal(subT, context.Canceled, err)
+		assert.Less(subT, time.Since(start), time.Second)
+	})
+
+	t.Run("should fail with ErrRateLimited in fail fast mode", func(subT *testing.T) {
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), Options{
+			Write: rate.NewLimiter(rate.Every(time.Hour), 1),
+			Mode:  FailFast,
+		})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Put(context.Background(), "test", []byte("content"))
+		assert.Equal(subT, ErrRateLimited, err)
+	})
+
+	t.Run("should limit reads and writes separately", func(subT *testing.T) {
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), Options{
+			Read:  rate.NewLimiter(rate.Inf, 1),
+			Write: rate.NewLimiter(0, 0),
+			Mode:  FailFast,
+		})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		assert.Equal(subT, ErrRateLimited, err)
+
+		_, err = s.Stat(context.Background(), "test")
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should use the limiter returned for a method", func(subT *testing.T) {
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content")), Options{
+			Read: rate.NewLimiter(rate.Inf, 1),
+			Mode: FailFast,
+			ForMethod: func(method string) *rate.Limiter {
+				if method == "Get" {
+					return rate.NewLimiter(0, 0)
+				}
+				return nil
+			},
+		})
+
+		_, err := s.Get(context.Background(), "test")
+		assert.Equal(subT, ErrRateLimited, err)
+
+		_, err = s.Stat(context.Background(), "test")
+		assert.Nil(subT, err)
+	})
+}
+
+func TestDocumentStore(t *testing.T) {
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), NewDocumentStore(sakuin.NewInMemoryDocumentStore(), unlimited()))
+	sakuin.RunQueryableDocumentStorageTests(storagetest.Lift(t), NewDocumentStore(sakuin.NewInMemoryDocumentStore(), unlimited()).(sakuin.QueryableDocumentStore))
+
+	t.Run("should fail with ErrRateLimited in fail fast mode", func(subT *testing.T) {
+		s := NewDocumentStore(sakuin.NewInMemoryDocumentStore(), Options{
+			Write: rate.NewLimiter(rate.Every(time.Hour), 1),
+			Mode:  FailFast,
+		}).(sakuin.RevisionedDocumentStore)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"a": "b"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpsertIfRevision(context.Background(), "test", map[string]interface{}{"a": "c"}, "")
+		assert.Equal(subT, ErrRateLimited, err)
+	})
+}
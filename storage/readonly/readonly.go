@@ -0,0 +1,218 @@
+// Package readonly provides store wrappers which can reject every write,
+// so the API keeps serving reads during maintenance windows, e.g. while
+// migrating the backing stores.
+package readonly
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+
+	"github.com/z5labs/sakuin"
+)
+
+// Switch flips the stores wrapped with it between read-only and read-write
+// at runtime. Sharing a single Switch between the object and document
+// stores keeps them from ever disagreeing. The zero value is read-write.
+type Switch struct {
+	readOnly int32
+}
+
+// NewSwitch returns a Switch which starts out read-only or read-write.
+func NewSwitch(readOnly bool) *Switch {
+	sw := &Switch{}
+	sw.SetReadOnly(readOnly)
+	return sw
+}
+
+// SetReadOnly makes the wrapped stores read-only or read-write. Writes
+// already in flight when the stores are made read-only aren't interrupted.
+func (sw *Switch) SetReadOnly(readOnly bool) {
+	var v int32
+	if readOnly {
+		v = 1
+	}
+	atomic.StoreInt32(&sw.readOnly, v)
+}
+
+// ReadOnly reports whether the wrapped stores are read-only.
+func (sw *Switch) ReadOnly() bool {
+	return atomic.LoadInt32(&sw.readOnly) == 1
+}
+
+func (sw *Switch) write(f func() error) error {
+	if sw.ReadOnly() {
+		return sakuin.ErrReadOnly
+	}
+	return f()
+}
+
+// NewObjectStore returns an ObjectStore which fails every write to inner
+// with sakuin.ErrReadOnly while sw is read-only. Reads always pass through.
+//
+// The returned store implements sakuin.StreamingObjectStore if inner does.
+// It always implements sakuin.ListableObjectStore and sakuin.StoreStats,
+// returning sakuin.ErrListNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewObjectStore(inner sakuin.ObjectStore, sw *Switch) sakuin.ObjectStore {
+	s := &ObjectStore{inner: inner, sw: sw}
+	if streamDB, ok := inner.(sakuin.StreamingObjectStore); ok {
+		return &StreamingObjectStore{ObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// NewDocumentStore returns a DocumentStore which fails every write to inner
+// with sakuin.ErrReadOnly while sw is read-only. Reads always pass through.
+//
+// The returned store implements sakuin.RevisionedDocumentStore if inner does.
+// It always implements sakuin.QueryableDocumentStore and sakuin.StoreStats,
+// returning sakuin.ErrQueryNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewDocumentStore(inner sakuin.DocumentStore, sw *Switch) sakuin.DocumentStore {
+	s := &DocumentStore{inner: inner, sw: sw}
+	if revDB, ok := inner.(sakuin.RevisionedDocumentStore); ok {
+		return &RevisionedDocumentStore{DocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+// ObjectStore rejects writes to the wrapped ObjectStore while its Switch is read-only.
+type ObjectStore struct {
+	inner sakuin.ObjectStore
+	sw    *Switch
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	return s.inner.Stat(ctx, id)
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	return s.inner.Get(ctx, id)
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.sw.write(func() error {
+		return s.inner.Put(ctx, id, b)
+	})
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	return s.sw.write(func() error {
+		return s.inner.Update(ctx, id, b)
+	})
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	return s.sw.write(func() error {
+		return s.inner.Delete(ctx, id)
+	})
+}
+
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	listDB, ok := s.inner.(sakuin.ListableObjectStore)
+	if !ok {
+		return nil, "", sakuin.ErrListNotSupported
+	}
+	return listDB.List(ctx, prefix, cursor, limit)
+}
+
+func (s *ObjectStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+	return statsDB.Stats(ctx)
+}
+
+// StreamingObjectStore is returned by NewObjectStore for stores which
+// implement sakuin.StreamingObjectStore.
+type StreamingObjectStore struct {
+	*ObjectStore
+	streamDB sakuin.StreamingObjectStore
+}
+
+func (s *StreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.sw.write(func() error {
+		return s.streamDB.PutStream(ctx, id, r, size)
+	})
+}
+
+func (s *StreamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	return s.streamDB.GetStream(ctx, id)
+}
+
+// DocumentStore rejects writes to the wrapped DocumentStore while its Switch is read-only.
+type DocumentStore struct {
+	inner sakuin.DocumentStore
+	sw    *Switch
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	return s.inner.Stat(ctx, id)
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	return s.inner.Get(ctx, id)
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.sw.write(func() error {
+		return s.inner.Upsert(ctx, id, doc)
+	})
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.sw.write(func() error {
+		return s.inner.Replace(ctx, id, doc)
+	})
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	return s.sw.write(func() error {
+		return s.inner.Delete(ctx, id)
+	})
+}
+
+func (s *DocumentStore) Query(ctx context.Context, q sakuin.Query) (sakuin.QueryResult, error) {
+	queryDB, ok := s.inner.(sakuin.QueryableDocumentStore)
+	if !ok {
+		return sakuin.QueryResult{}, sakuin.ErrQueryNotSupported
+	}
+	return queryDB.Query(ctx, q)
+}
+
+func (s *DocumentStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+	return statsDB.Stats(ctx)
+}
+
+// RevisionedDocumentStore is returned by NewDocumentStore for stores
+// which implement sakuin.RevisionedDocumentStore.
+type RevisionedDocumentStore struct {
+	*DocumentStore
+	revDB sakuin.RevisionedDocumentStore
+}
+
+func (s *RevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (map[string]interface{}, string, error) {
+	return s.revDB.GetWithRevision(ctx, id)
+}
+
+func (s *RevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.sw.write(func() error {
+		rev, err = s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
+
+func (s *RevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.sw.write(func() error {
+		rev, err = s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
@@ -0,0 +1,80 @@
+package readonly
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), &Switch{}))
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), &Switch{}).(sakuin.StreamingObjectStore))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), &Switch{}).(sakuin.ListableObjectStore))
+
+	t.Run("should reject writes while read-only", func(subT *testing.T) {
+		inner := sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		s := NewObjectStore(inner, NewSwitch(true)).(sakuin.StreamingObjectStore)
+
+		assert.Equal(subT, sakuin.ErrReadOnly, s.Put(context.Background(), "new", []byte("content")))
+		assert.Equal(subT, sakuin.ErrReadOnly, s.PutStream(context.Background(), "new", bytes.NewReader([]byte("content")), 7))
+		assert.Equal(subT, sakuin.ErrReadOnly, s.Update(context.Background(), "test", []byte("updated")))
+		assert.Equal(subT, sakuin.ErrReadOnly, s.Delete(context.Background(), "test"))
+		assert.Equal(subT, 1, inner.NumOfObects())
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+	})
+
+	t.Run("should accept writes once made read-write", func(subT *testing.T) {
+		sw := NewSwitch(true)
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), sw)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Equal(subT, sakuin.ErrReadOnly, err) {
+			return
+		}
+
+		sw.SetReadOnly(false)
+		err = s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		sw.SetReadOnly(true)
+		err = s.Delete(context.Background(), "test")
+		assert.Equal(subT, sakuin.ErrReadOnly, err)
+	})
+}
+
+func TestDocumentStore(t *testing.T) {
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), NewDocumentStore(sakuin.NewInMemoryDocumentStore(), &Switch{}))
+	sakuin.RunQueryableDocumentStorageTests(storagetest.Lift(t), NewDocumentStore(sakuin.NewInMemoryDocumentStore(), &Switch{}).(sakuin.QueryableDocumentStore))
+
+	t.Run("should reject writes while read-only", func(subT *testing.T) {
+		doc := map[string]interface{}{"a": "b"}
+		inner := sakuin.NewInMemoryDocumentStore().WithDocument("test", doc)
+		s := NewDocumentStore(inner, NewSwitch(true)).(sakuin.RevisionedDocumentStore)
+
+		assert.Equal(subT, sakuin.ErrReadOnly, s.Upsert(context.Background(), "test", map[string]interface{}{"c": "d"}))
+		assert.Equal(subT, sakuin.ErrReadOnly, s.Replace(context.Background(), "test", map[string]interface{}{"c": "d"}))
+		assert.Equal(subT, sakuin.ErrReadOnly, s.Delete(context.Background(), "test"))
+		_, err := s.UpsertIfRevision(context.Background(), "test", map[string]interface{}{"c": "d"}, "")
+		assert.Equal(subT, sakuin.ErrReadOnly, err)
+		_, err = s.ReplaceIfRevision(context.Background(), "test", map[string]interface{}{"c": "d"}, "")
+		assert.Equal(subT, sakuin.ErrReadOnly, err)
+
+		got, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, doc, got)
+	})
+}
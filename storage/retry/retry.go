@@ -0,0 +1,344 @@
+// Package retry provides ObjectStore and DocumentStore wrappers which
+// retry store calls that failed with transient errors.
+//
+// Every call may be issued more than once, including writes whose first
+// attempt failed after the store had already applied them, e.g. when a
+// response is lost to a network error. Put, Update, Replace and Delete
+// are idempotent so this is safe for them. Upsert is safe as long as the
+// store merges documents with sakuin.MergeDocs, since merging the same
+// document twice gives the same result. Stores whose writes can't be
+// re-issued should return errors which the policy doesn't retry.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/z5labs/sakuin"
+)
+
+// Policy configures how failed store calls are retried.
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts per store call,
+	// including the first one. Calls are never retried when less than 2.
+	MaxAttempts int
+
+	// InitialBackoff is how long to wait before the first retry.
+	// The wait doubles after every retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between retries. Zero means no cap.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of every wait which is randomised.
+	Jitter float64
+
+	// IsRetryable reports whether a failed store call should be retried.
+	// Defaults to IsRetryable. Calls are never retried once their
+	// context is done, whatever this returns.
+	IsRetryable func(error) bool
+
+	// Sleep waits for the given duration, returning early with the
+	// context error if it's done first. Defaults to waiting on a timer.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// IsRetryable retries every error except context errors and those which
+// retrying can't change: the typed not-found errors, already exists
+// errors, revision mismatches and the not supported errors.
+func IsRetryable(err error) bool {
+	var objErr sakuin.ObjectDoesNotExistErr
+	var docErr sakuin.DocumentDoesNotExistErr
+	var existsErr sakuin.ObjectAlreadyExistsErr
+	var revErr sakuin.RevisionMismatchErr
+	if errors.As(err, &objErr) || errors.As(err, &docErr) || errors.As(err, &existsErr) || errors.As(err, &revErr) {
+		return false
+	}
+	for _, target := range []error{sakuin.ErrRevisionsNotSupported, sakuin.ErrListNotSupported, sakuin.ErrQueryNotSupported, sakuin.ErrStatsNotSupported} {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// Backoff returns how long to wait before the given retry, counting from
+// zero, without jitter.
+func (p Policy) Backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 0; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+func (p Policy) jittered(retry int) time.Duration {
+	d := p.Backoff(retry)
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+func (p Policy) retryable(err error) bool {
+	if p.IsRetryable == nil {
+		return IsRetryable(err)
+	}
+	return p.IsRetryable(err)
+}
+
+func (p Policy) sleep(ctx context.Context, d time.Duration) error {
+	if p.Sleep != nil {
+		return p.Sleep(ctx, d)
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Do calls f until it succeeds, fails with an error which isn't retryable
+// or runs out of attempts, returning the last error. If ctx is done
+// between attempts, the context error is returned instead.
+func (p Policy) Do(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 0; attempt < p.MaxAttempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			serr := p.sleep(ctx, p.jittered(attempt-1))
+			if serr != nil {
+				return serr
+			}
+		}
+
+		err = f()
+		if err == nil || ctx.Err() != nil || !p.retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// NewObjectStore returns an ObjectStore which retries calls to inner
+// as configured by the policy.
+//
+// The returned store implements sakuin.StreamingObjectStore if inner does.
+// PutStream is never retried, since its reader can only be read once.
+// It always implements sakuin.ListableObjectStore and sakuin.StoreStats,
+// returning sakuin.ErrListNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewObjectStore(inner sakuin.ObjectStore, policy Policy) sakuin.ObjectStore {
+	s := &ObjectStore{inner: inner, policy: policy}
+	if streamDB, ok := inner.(sakuin.StreamingObjectStore); ok {
+		return &StreamingObjectStore{ObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// NewDocumentStore returns a DocumentStore which retries calls to inner
+// as configured by the policy.
+//
+// The returned store implements sakuin.RevisionedDocumentStore if inner does.
+// It always implements sakuin.QueryableDocumentStore and sakuin.StoreStats,
+// returning sakuin.ErrQueryNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewDocumentStore(inner sakuin.DocumentStore, policy Policy) sakuin.DocumentStore {
+	s := &DocumentStore{inner: inner, policy: policy}
+	if revDB, ok := inner.(sakuin.RevisionedDocumentStore); ok {
+		return &RevisionedDocumentStore{DocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+// ObjectStore retries calls made to the wrapped ObjectStore.
+type ObjectStore struct {
+	inner  sakuin.ObjectStore
+	policy Policy
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (info *sakuin.StatInfo, err error) {
+	err = s.policy.Do(ctx, func() error {
+		info, err = s.inner.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) (b []byte, err error) {
+	err = s.policy.Do(ctx, func() error {
+		b, err = s.inner.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.policy.Do(ctx, func() error {
+		return s.inner.Put(ctx, id, b)
+	})
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	return s.policy.Do(ctx, func() error {
+		return s.inner.Update(ctx, id, b)
+	})
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	return s.policy.Do(ctx, func() error {
+		return s.inner.Delete(ctx, id)
+	})
+}
+
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) (ids []string, next string, err error) {
+	listDB, ok := s.inner.(sakuin.ListableObjectStore)
+	if !ok {
+		return nil, "", sakuin.ErrListNotSupported
+	}
+
+	err = s.policy.Do(ctx, func() error {
+		ids, next, err = listDB.List(ctx, prefix, cursor, limit)
+		return err
+	})
+	return
+}
+
+func (s *ObjectStore) Stats(ctx context.Context) (stats *sakuin.StoreStatsInfo, err error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	err = s.policy.Do(ctx, func() error {
+		stats, err = statsDB.Stats(ctx)
+		return err
+	})
+	return
+}
+
+// StreamingObjectStore is returned by NewObjectStore for stores which
+// implement sakuin.StreamingObjectStore.
+type StreamingObjectStore struct {
+	*ObjectStore
+	streamDB sakuin.StreamingObjectStore
+}
+
+// PutStream is never retried since r can only be read once.
+func (s *StreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.streamDB.PutStream(ctx, id, r, size)
+}
+
+func (s *StreamingObjectStore) GetStream(ctx context.Context, id string) (rc io.ReadCloser, size int64, err error) {
+	err = s.policy.Do(ctx, func() error {
+		rc, size, err = s.streamDB.GetStream(ctx, id)
+		return err
+	})
+	return
+}
+
+// DocumentStore retries calls made to the wrapped DocumentStore.
+type DocumentStore struct {
+	inner  sakuin.DocumentStore
+	policy Policy
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (info *sakuin.StatInfo, err error) {
+	err = s.policy.Do(ctx, func() error {
+		info, err = s.inner.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (doc map[string]interface{}, err error) {
+	err = s.policy.Do(ctx, func() error {
+		doc, err = s.inner.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.policy.Do(ctx, func() error {
+		return s.inner.Upsert(ctx, id, doc)
+	})
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	return s.policy.Do(ctx, func() error {
+		return s.inner.Replace(ctx, id, doc)
+	})
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	return s.policy.Do(ctx, func() error {
+		return s.inner.Delete(ctx, id)
+	})
+}
+
+func (s *DocumentStore) Query(ctx context.Context, q sakuin.Query) (result sakuin.QueryResult, err error) {
+	queryDB, ok := s.inner.(sakuin.QueryableDocumentStore)
+	if !ok {
+		return sakuin.QueryResult{}, sakuin.ErrQueryNotSupported
+	}
+
+	err = s.policy.Do(ctx, func() error {
+		result, err = queryDB.Query(ctx, q)
+		return err
+	})
+	return
+}
+
+func (s *DocumentStore) Stats(ctx context.Context) (stats *sakuin.StoreStatsInfo, err error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	err = s.policy.Do(ctx, func() error {
+		stats, err = statsDB.Stats(ctx)
+		return err
+	})
+	return
+}
+
+// RevisionedDocumentStore is returned by NewDocumentStore for stores
+// which implement sakuin.RevisionedDocumentStore.
+type RevisionedDocumentStore struct {
+	*DocumentStore
+	revDB sakuin.RevisionedDocumentStore
+}
+
+func (s *RevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (doc map[string]interface{}, rev string, err error) {
+	err = s.policy.Do(ctx, func() error {
+		doc, rev, err = s.revDB.GetWithRevision(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s *RevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.policy.Do(ctx, func() error {
+		rev, err = s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
+
+func (s *RevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = s.policy.Do(ctx, func() error {
+		rev, err = s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
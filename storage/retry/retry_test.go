@@ -0,0 +1,258 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errThrottled = errors.New("throttled")
+
+// flakyObjectStore fails the first failures calls to Get and Put with err.
+type flakyObjectStore struct {
+	*sakuin.InMemoryObjectStore
+	failures int32
+	err      error
+	attempts int32
+}
+
+func (s *flakyObjectStore) fail() bool {
+	return atomic.AddInt32(&s.attempts, 1) <= s.failures
+}
+
+func (s *flakyObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	if s.fail() {
+		return nil, s.err
+	}
+	return s.InMemoryObjectStore.Get(ctx, id)
+}
+
+func (s *flakyObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	if s.fail() {
+		return s.err
+	}
+	return s.InMemoryObjectStore.Put(ctx, id, b)
+}
+
+// flakyDocumentStore fails the first failures calls to Upsert with err.
+type flakyDocumentStore struct {
+	*sakuin.InMemoryDocumentStore
+	failures int32
+	err      error
+	attempts int32
+}
+
+func (s *flakyDocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	if atomic.AddInt32(&s.attempts, 1) <= s.failures {
+		return s.err
+	}
+	return s.InMemoryDocumentStore.Upsert(ctx, id, doc)
+}
+
+// recordSleeps records every wait instead of sleeping.
+func recordSleeps(waits *[]time.Duration) func(context.Context, time.Duration) error {
+	return func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+}
+
+func TestObjectStore(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), policy))
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), NewObjectStore(sakuin.NewInMemoryObjectStore(), policy).(sakuin.StreamingObjectStore))
+
+	t.Run("should retry until the store call succeeds", func(subT *testing.T) {
+		inner := &flakyObjectStore{
+			InMemoryObjectStore: sakuin.NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			failures:            2,
+			err:                 errThrottled,
+		}
+		var waits []time.Duration
+		s := NewObjectStore(inner, Policy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Sleep:          recordSleeps(&waits),
+		})
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+		assert.Equal(subT, int32(3), inner.attempts)
+		assert.Equal(subT, []time.Duration{time.Millisecond, 2 * time.Millisecond}, waits)
+	})
+
+	t.Run("should give up after max attempts", func(subT *testing.T) {
+		inner := &flakyObjectStore{
+			InMemoryObjectStore: sakuin.NewInMemoryObjectStore(),
+			failures:            10,
+			err:                 errThrottled,
+		}
+		var waits []time.Duration
+		s := NewObjectStore(inner, Policy{
+			MaxAttempts:    4,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     3 * time.Millisecond,
+			Sleep:          recordSleeps(&waits),
+		})
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		assert.Equal(subT, errThrottled, err)
+		assert.Equal(subT, int32(4), inner.attempts)
+		assert.Equal(subT, []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}, waits)
+	})
+
+	t.Run("should never retry missing objects", func(subT *testing.T) {
+		inner := &flakyObjectStore{
+			InMemoryObjectStore: sakuin.NewInMemoryObjectStore(),
+			failures:            10,
+			err:                 sakuin.ObjectDoesNotExistErr{ID: "test"},
+		}
+		s := NewObjectStore(inner, Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+		_, err := s.Get(context.Background(), "test")
+		var objErr sakuin.ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+		assert.Equal(subT, int32(1), inner.attempts)
+	})
+
+	t.Run("should only retry errors accepted by IsRetryable", func(subT *testing.T) {
+		inner := &flakyObjectStore{
+			InMemoryObjectStore: sakuin.NewInMemoryObjectStore(),
+			failures:            10,
+			err:                 errThrottled,
+		}
+		s := NewObjectStore(inner, Policy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			IsRetryable: func(err error) bool {
+				return !errors.Is(err, errThrottled)
+			},
+		})
+
+		_, err := s.Get(context.Background(), "test")
+		assert.Equal(subT, errThrottled, err)
+		assert.Equal(subT, int32(1), inner.attempts)
+	})
+
+	t.Run("should stop retrying once the context is done", func(subT *testing.T) {
+		inner := &flakyObjectStore{
+			InMemoryObjectStore: sakuin.NewInMemoryObjectStore(),
+			failures:            10,
+			err:                 errThrottled,
+		}
+		s := NewObjectStore(inner, Policy{MaxAttempts: 5, InitialBackoff: time.Hour})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := s.Get(ctx, "test")
+		assert.Equal(subT, context.DeadlineExceeded, err)
+		assert.Equal(subT, int32(1), inner.attempts)
+	})
+}
+
+func TestDocumentStore(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), NewDocumentStore(sakuin.NewInMemoryDocumentStore(), policy))
+
+	t.Run("should retry upserts until they succeed", func(subT *testing.T) {
+		inner := &flakyDocumentStore{
+			InMemoryDocumentStore: sakuin.NewInMemoryDocumentStore(),
+			failures:              2,
+			err:                   errThrottled,
+		}
+		var waits []time.Duration
+		s := NewDocumentStore(inner, Policy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Millisecond,
+			Sleep:          recordSleeps(&waits),
+		})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, int32(3), inner.attempts)
+		assert.Len(subT, waits, 2)
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+	})
+
+	t.Run("should never retry missing documents", func(subT *testing.T) {
+		inner := &flakyDocumentStore{
+			InMemoryDocumentStore: sakuin.NewInMemoryDocumentStore(),
+			failures:              10,
+			err:                   sakuin.DocumentDoesNotExistErr{ID: "test"},
+		}
+		s := NewDocumentStore(inner, Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test"})
+		var docErr sakuin.DocumentDoesNotExistErr
+		assert.ErrorAs(subT, err, &docErr)
+		assert.Equal(subT, int32(1), inner.attempts)
+	})
+
+	t.Run("should preserve revision support", func(subT *testing.T) {
+		s := NewDocumentStore(sakuin.NewInMemoryDocumentStore(), policy)
+
+		_, ok := s.(sakuin.RevisionedDocumentStore)
+		assert.True(subT, ok)
+	})
+}
+
+func TestPolicy(t *testing.T) {
+	t.Run("should double the backoff up to the max", func(subT *testing.T) {
+		p := Policy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+		var backoffs []time.Duration
+		for retry := 0; retry < 5; retry++ {
+			backoffs = append(backoffs, p.Backoff(retry))
+		}
+		assert.Equal(subT, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, backoffs)
+	})
+
+	t.Run("should keep jittered waits within the backoff", func(subT *testing.T) {
+		var waits []time.Duration
+		p := Policy{
+			MaxAttempts:    10,
+			InitialBackoff: time.Second,
+			Jitter:         0.5,
+			Sleep:          recordSleeps(&waits),
+		}
+
+		p.Do(context.Background(), func() error {
+			return errThrottled
+		})
+		if !assert.Len(subT, waits, 9) {
+			return
+		}
+		for retry, wait := range waits {
+			assert.LessOrEqual(subT, wait, p.Backoff(retry))
+			assert.GreaterOrEqual(subT, wait, p.Backoff(retry)/2)
+		}
+	})
+
+	t.Run("should make one attempt when max attempts isn't set", func(subT *testing.T) {
+		attempts := 0
+		err := Policy{}.Do(context.Background(), func() error {
+			attempts++
+			return errThrottled
+		})
+		assert.Equal(subT, errThrottled, err)
+		assert.Equal(subT, 1, attempts)
+	})
+}
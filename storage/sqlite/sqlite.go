@@ -0,0 +1,299 @@
+// Package sqlite provides an ObjectStore and a DocumentStore which keep
+// their contents in SQLite tables.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/z5labs/sakuin"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// DefaultBusyTimeout is how long Open waits for other connections to
+// release their locks, if no other timeout is given.
+const DefaultBusyTimeout = 5 * time.Second
+
+// Options configures the database returned by Open.
+type Options struct {
+	// BusyTimeout is how long a statement waits for other connections to
+	// release their locks before failing with SQLITE_BUSY. Zero uses
+	// DefaultBusyTimeout.
+	BusyTimeout time.Duration
+}
+
+// Open opens the SQLite database file at path, creating it if needed, for
+// use by the stores in this package. The database uses write-ahead logging,
+// so reads don't block writes, and begins transactions as IMMEDIATE, so
+// read-merge-writes take the write lock up front rather than failing to
+// upgrade to it.
+func Open(path string, opts Options) (*sql.DB, error) {
+	timeout := opts.BusyTimeout
+	if timeout == 0 {
+		timeout = DefaultBusyTimeout
+	}
+
+	params := url.Values{}
+	params.Set("_busy_timeout", fmt.Sprint(timeout.Milliseconds()))
+	params.Set("_journal_mode", "WAL")
+	params.Set("_txlock", "immediate")
+	return sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+}
+
+// ObjectStore stores objects in the objects table, one row per object.
+type ObjectStore struct {
+	db *sql.DB
+}
+
+// NewObjectStore returns an ObjectStore which stores objects in db,
+// creating the objects table if it doesn't exist.
+func NewObjectStore(ctx context.Context, db *sql.DB) (*ObjectStore, error) {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS objects (
+		id TEXT PRIMARY KEY,
+		content BLOB NOT NULL,
+		size INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectStore{db: db}, nil
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	var size int
+	err := s.db.QueryRowContext(ctx, `SELECT size FROM objects WHERE id = ?`, id).Scan(&size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{Exists: true, Size: size}, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	b := []byte{}
+	err := s.db.QueryRowContext(ctx, `SELECT content FROM objects WHERE id = ?`, id).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO objects (id, content, size) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET content = excluded.content, size = excluded.size`,
+		id, nonNil(b), len(b),
+	)
+	return err
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE objects SET content = ?, size = ? WHERE id = ?`, nonNil(b), len(b), id)
+	if err != nil {
+		return err
+	}
+	return objectAffected(res, id)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM objects WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return objectAffected(res, id)
+}
+
+// objectAffected fails with an ObjectDoesNotExistErr if res affected no rows.
+func objectAffected(res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sakuin.ObjectDoesNotExistErr{ID: id}
+	}
+	return nil
+}
+
+// nonNil keeps the content of empty objects from being stored as NULL.
+func nonNil(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+// List reads one page of ids from the primary key index.
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	query := `SELECT id FROM objects WHERE substr(id, 1, ?) = ? AND id > ? ORDER BY id`
+	args := []interface{}{len(prefix), prefix, cursor}
+	if limit > 0 {
+		// Reading one more id than asked for tells whether there's another page.
+		query += ` LIMIT ?`
+		args = append(args, limit+1)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, "", err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if limit <= 0 || len(ids) <= limit {
+		return ids, "", nil
+	}
+	return ids[:limit], ids[limit-1], nil
+}
+
+// DocumentStore stores documents as JSON in the docs table, one row per
+// document.
+//
+// Upserts read, merge and write the document in a single transaction,
+// which databases returned by Open begin as IMMEDIATE, so concurrent
+// Upserts of the same document are serialized and don't lose fields.
+type DocumentStore struct {
+	db *sql.DB
+}
+
+// NewDocumentStore returns a DocumentStore which stores documents in db,
+// creating the docs table if it doesn't exist.
+func NewDocumentStore(ctx context.Context, db *sql.DB) (*DocumentStore, error) {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS docs (
+		id TEXT PRIMARY KEY,
+		doc TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentStore{db: db}, nil
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	var size int
+	err := s.db.QueryRowContext(ctx, `SELECT (SELECT count(*) FROM json_each(doc)) FROM docs WHERE id = ?`, id).Scan(&size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &sakuin.StatInfo{Exists: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sakuin.StatInfo{Exists: true, Size: size}, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	return getDoc(ctx, s.db, id)
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	// Decoding the encoded document copies it, so merging can't modify
+	// the caller's document.
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var newDoc map[string]interface{}
+	err = json.Unmarshal(b, &newDoc)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	old, err := getDoc(ctx, tx, id)
+	var docErr sakuin.DocumentDoesNotExistErr
+	if err != nil && !errors.As(err, &docErr) {
+		return err
+	}
+	merged, err := sakuin.MergeDocs(newDoc, old)
+	if err != nil {
+		return err
+	}
+
+	err = putDoc(ctx, tx, id, merged)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	return putDoc(ctx, s.db, id, doc)
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM docs WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	return nil
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func getDoc(ctx context.Context, q querier, id string) (map[string]interface{}, error) {
+	var b []byte
+	err := q.QueryRowContext(ctx, `SELECT doc FROM docs WHERE id = ?`, id).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, sakuin.DocumentDoesNotExistErr{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func putDoc(ctx context.Context, q querier, id string, doc map[string]interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = q.ExecContext(ctx, `INSERT INTO docs (id, doc) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET doc = excluded.doc`,
+		id, string(b),
+	)
+	return err
+}
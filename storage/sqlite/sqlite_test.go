@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openDB(t testing.TB) *sql.DB {
+	db, err := Open(filepath.Join(t.TempDir(), "sakuin.db"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newObjectStore(t testing.TB) *ObjectStore {
+	s, err := NewObjectStore(context.Background(), openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newDocumentStore(t testing.TB) *DocumentStore {
+	s, err := NewDocumentStore(context.Background(), openDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestObjectStore(t *testing.T) {
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), newObjectStore(t))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), newObjectStore(t))
+
+	t.Run("should report the size of stored objects", func(subT *testing.T) {
+		s := newObjectStore(subT)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		stats, err := s.Stat(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &sakuin.StatInfo{Exists: true, Size: len("content")}, stats)
+	})
+
+	t.Run("should store empty objects", func(subT *testing.T) {
+		s := newObjectStore(subT)
+
+		err := s.Put(context.Background(), "test", nil)
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte{}, b)
+	})
+
+	t.Run("should share a database with the DocumentStore", func(subT *testing.T) {
+		db := openDB(subT)
+		_, err := NewObjectStore(context.Background(), db)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = NewDocumentStore(context.Background(), db)
+		assert.Nil(subT, err)
+	})
+}
+
+func TestDocumentStore(t *testing.T) {
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), newDocumentStore(t))
+
+	t.Run("should fail to merge an object into another value", func(subT *testing.T) {
+		s := newDocumentStore(subT)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{
+			"owner": map[string]interface{}{"name": "a"},
+		})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Upsert(context.Background(), "test", map[string]interface{}{"owner": "b"})
+		var mergeErr sakuin.MergeConflictErr
+		if !assert.ErrorAs(subT, err, &mergeErr) {
+			return
+		}
+
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"owner": map[string]interface{}{"name": "a"}}, doc)
+	})
+}
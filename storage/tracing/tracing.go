@@ -0,0 +1,295 @@
+// Package tracing provides ObjectStore and DocumentStore wrappers which
+// trace every call made to the wrapped store with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/z5labs/sakuin"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer spans are started with.
+const TracerName = "github.com/z5labs/sakuin/storage/tracing"
+
+// Attributes set on spans.
+const (
+	// IDKey is the id of the object or document.
+	IDKey = attribute.Key("sakuin.id")
+
+	// SizeKey is the size in bytes of the object read or written.
+	SizeKey = attribute.Key("sakuin.size")
+
+	// FieldsKey is the number of top level fields in the document
+	// read or written.
+	FieldsKey = attribute.Key("sakuin.fields")
+
+	// NotFoundKey is true when the object or document doesn't exist.
+	NotFoundKey = attribute.Key("sakuin.not_found")
+)
+
+// NewObjectStore returns an ObjectStore which starts a span named
+// sakuin.ObjectStore/<method> for every call to inner, using a tracer
+// from tp, or the global TracerProvider if tp is nil.
+//
+// Spans are annotated with the id and size of the object, and whether
+// it was found. sakuin.ObjectDoesNotExistErr only sets NotFoundKey, while
+// any other error is recorded on the span and sets its status to error.
+// Errors are returned unchanged.
+//
+// The returned store implements sakuin.StreamingObjectStore if inner does.
+// It always implements sakuin.ListableObjectStore and sakuin.StoreStats,
+// returning sakuin.ErrListNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewObjectStore(inner sakuin.ObjectStore, tp trace.TracerProvider) sakuin.ObjectStore {
+	s := &ObjectStore{inner: inner, tracer: newTracer(tp, "sakuin.ObjectStore/")}
+	if streamDB, ok := inner.(sakuin.StreamingObjectStore); ok {
+		return &StreamingObjectStore{ObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// NewDocumentStore returns a DocumentStore which traces every call to
+// inner in the same way as NewObjectStore, with spans named
+// sakuin.DocumentStore/<method>. Rather than a size in bytes, spans are
+// annotated with the number of top level fields in the document.
+//
+// The returned store implements sakuin.RevisionedDocumentStore if inner does.
+// It always implements sakuin.QueryableDocumentStore and sakuin.StoreStats,
+// returning sakuin.ErrQueryNotSupported and sakuin.ErrStatsNotSupported
+// when inner doesn't.
+func NewDocumentStore(inner sakuin.DocumentStore, tp trace.TracerProvider) sakuin.DocumentStore {
+	s := &DocumentStore{inner: inner, tracer: newTracer(tp, "sakuin.DocumentStore/")}
+	if revDB, ok := inner.(sakuin.RevisionedDocumentStore); ok {
+		return &RevisionedDocumentStore{DocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+type tracer struct {
+	trace.Tracer
+	prefix string
+}
+
+func newTracer(tp trace.TracerProvider, prefix string) tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tracer{Tracer: tp.Tracer(TracerName), prefix: prefix}
+}
+
+// start starts the span for a single store call.
+func (t tracer) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.Start(ctx, t.prefix+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// end records the outcome of a store call on its span and ends it.
+func end(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	defer span.End()
+
+	var objErr sakuin.ObjectDoesNotExistErr
+	var docErr sakuin.DocumentDoesNotExistErr
+	switch {
+	case err == nil:
+		span.SetAttributes(attrs...)
+	case errors.As(err, &objErr), errors.As(err, &docErr):
+		span.SetAttributes(NotFoundKey.Bool(true))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// ObjectStore traces every call made to the wrapped ObjectStore.
+type ObjectStore struct {
+	inner  sakuin.ObjectStore
+	tracer tracer
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	ctx, span := s.tracer.start(ctx, "Stat", IDKey.String(id))
+	info, err := s.inner.Stat(ctx, id)
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	end(span, nil, SizeKey.Int(info.Size), NotFoundKey.Bool(!info.Exists))
+	return info, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, id string) ([]byte, error) {
+	ctx, span := s.tracer.start(ctx, "Get", IDKey.String(id))
+	b, err := s.inner.Get(ctx, id)
+	end(span, err, SizeKey.Int(len(b)), NotFoundKey.Bool(false))
+	return b, err
+}
+
+func (s *ObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	ctx, span := s.tracer.start(ctx, "Put", IDKey.String(id), SizeKey.Int(len(b)))
+	err := s.inner.Put(ctx, id, b)
+	end(span, err)
+	return err
+}
+
+func (s *ObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	ctx, span := s.tracer.start(ctx, "Update", IDKey.String(id), SizeKey.Int(len(b)))
+	err := s.inner.Update(ctx, id, b)
+	end(span, err, NotFoundKey.Bool(false))
+	return err
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, id string) error {
+	ctx, span := s.tracer.start(ctx, "Delete", IDKey.String(id))
+	err := s.inner.Delete(ctx, id)
+	end(span, err, NotFoundKey.Bool(false))
+	return err
+}
+
+func (s *ObjectStore) List(ctx context.Context, prefix string, cursor string, limit int) ([]string, string, error) {
+	listDB, ok := s.inner.(sakuin.ListableObjectStore)
+	if !ok {
+		return nil, "", sakuin.ErrListNotSupported
+	}
+
+	ctx, span := s.tracer.start(ctx, "List", attribute.String("sakuin.prefix", prefix), attribute.Int("sakuin.limit", limit))
+	ids, next, err := listDB.List(ctx, prefix, cursor, limit)
+	end(span, err, attribute.Int("sakuin.count", len(ids)))
+	return ids, next, err
+}
+
+func (s *ObjectStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	ctx, span := s.tracer.start(ctx, "Stats")
+	stats, err := statsDB.Stats(ctx)
+	end(span, err)
+	return stats, err
+}
+
+// StreamingObjectStore is returned by NewObjectStore for stores which
+// implement sakuin.StreamingObjectStore. GetStream spans end once the
+// stream has been opened, not once it has been read.
+type StreamingObjectStore struct {
+	*ObjectStore
+	streamDB sakuin.StreamingObjectStore
+}
+
+func (s *StreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	ctx, span := s.tracer.start(ctx, "PutStream", IDKey.String(id), SizeKey.Int64(size))
+	err := s.streamDB.PutStream(ctx, id, r, size)
+	end(span, err)
+	return err
+}
+
+func (s *StreamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	ctx, span := s.tracer.start(ctx, "GetStream", IDKey.String(id))
+	rc, size, err := s.streamDB.GetStream(ctx, id)
+	end(span, err, SizeKey.Int64(size), NotFoundKey.Bool(false))
+	return rc, size, err
+}
+
+// DocumentStore traces every call made to the wrapped DocumentStore.
+type DocumentStore struct {
+	inner  sakuin.DocumentStore
+	tracer tracer
+}
+
+func (s *DocumentStore) Stat(ctx context.Context, id string) (*sakuin.StatInfo, error) {
+	ctx, span := s.tracer.start(ctx, "Stat", IDKey.String(id))
+	info, err := s.inner.Stat(ctx, id)
+	if err != nil {
+		end(span, err)
+		return nil, err
+	}
+	end(span, nil, FieldsKey.Int(info.Size), NotFoundKey.Bool(!info.Exists))
+	return info, nil
+}
+
+func (s *DocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	ctx, span := s.tracer.start(ctx, "Get", IDKey.String(id))
+	doc, err := s.inner.Get(ctx, id)
+	end(span, err, FieldsKey.Int(len(doc)), NotFoundKey.Bool(false))
+	return doc, err
+}
+
+func (s *DocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	ctx, span := s.tracer.start(ctx, "Upsert", IDKey.String(id), FieldsKey.Int(len(doc)))
+	err := s.inner.Upsert(ctx, id, doc)
+	end(span, err)
+	return err
+}
+
+func (s *DocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	ctx, span := s.tracer.start(ctx, "Replace", IDKey.String(id), FieldsKey.Int(len(doc)))
+	err := s.inner.Replace(ctx, id, doc)
+	end(span, err)
+	return err
+}
+
+func (s *DocumentStore) Delete(ctx context.Context, id string) error {
+	ctx, span := s.tracer.start(ctx, "Delete", IDKey.String(id))
+	err := s.inner.Delete(ctx, id)
+	end(span, err, NotFoundKey.Bool(false))
+	return err
+}
+
+func (s *DocumentStore) Query(ctx context.Context, q sakuin.Query) (sakuin.QueryResult, error) {
+	queryDB, ok := s.inner.(sakuin.QueryableDocumentStore)
+	if !ok {
+		return sakuin.QueryResult{}, sakuin.ErrQueryNotSupported
+	}
+
+	ctx, span := s.tracer.start(ctx, "Query")
+	result, err := queryDB.Query(ctx, q)
+	end(span, err, attribute.Int("sakuin.count", len(result.Documents)))
+	return result, err
+}
+
+func (s *DocumentStore) Stats(ctx context.Context) (*sakuin.StoreStatsInfo, error) {
+	statsDB, ok := s.inner.(sakuin.StoreStats)
+	if !ok {
+		return nil, sakuin.ErrStatsNotSupported
+	}
+
+	ctx, span := s.tracer.start(ctx, "Stats")
+	stats, err := statsDB.Stats(ctx)
+	end(span, err)
+	return stats, err
+}
+
+// RevisionedDocumentStore is returned by NewDocumentStore for stores
+// which implement sakuin.RevisionedDocumentStore.
+type RevisionedDocumentStore struct {
+	*DocumentStore
+	revDB sakuin.RevisionedDocumentStore
+}
+
+func (s *RevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (map[string]interface{}, string, error) {
+	ctx, span := s.tracer.start(ctx, "GetWithRevision", IDKey.String(id))
+	doc, rev, err := s.revDB.GetWithRevision(ctx, id)
+	end(span, err, FieldsKey.Int(len(doc)), NotFoundKey.Bool(false))
+	return doc, rev, err
+}
+
+func (s *RevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	ctx, span := s.tracer.start(ctx, "UpsertIfRevision", IDKey.String(id), FieldsKey.Int(len(doc)))
+	rev, err := s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+	end(span, err)
+	return rev, err
+}
+
+func (s *RevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (string, error) {
+	ctx, span := s.tracer.start(ctx, "ReplaceIfRevision", IDKey.String(id), FieldsKey.Int(len(doc)))
+	rev, err := s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+	end(span, err)
+	return rev, err
+}
@@ -0,0 +1,195 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+	"github.com/z5labs/sakuin/storagetest"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// failingObjectStore fails every Put.
+type failingObjectStore struct {
+	*sakuin.InMemoryObjectStore
+	err error
+}
+
+func (s failingObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return s.err
+}
+
+// plainObjectStore hides the optional interfaces of the store it embeds.
+type plainObjectStore struct {
+	sakuin.ObjectStore
+}
+
+func newTracerProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)), sr
+}
+
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestObjectStore(t *testing.T) {
+	newStore := func() sakuin.ObjectStore {
+		tp, _ := newTracerProvider()
+		return NewObjectStore(sakuin.NewInMemoryObjectStore(), tp)
+	}
+	sakuin.RunObjectStorageTests(storagetest.Lift(t), newStore())
+	sakuin.RunStreamingObjectStorageTests(storagetest.Lift(t), newStore().(sakuin.StreamingObjectStore))
+	sakuin.RunListableObjectStorageTests(storagetest.Lift(t), newStore().(sakuin.ListableObjectStore))
+
+	t.Run("should trace each call with its outcome", func(subT *testing.T) {
+		tp, sr := newTracerProvider()
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), tp)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.Get(context.Background(), "missing")
+		var notFound sakuin.ObjectDoesNotExistErr
+		if !assert.ErrorAs(subT, err, &notFound) {
+			return
+		}
+
+		spans := sr.Ended()
+		if !assert.Len(subT, spans, 2) {
+			return
+		}
+
+		put := spans[0]
+		assert.Equal(subT, "sakuin.ObjectStore/Put", put.Name())
+		assert.Equal(subT, trace.SpanKindClient, put.SpanKind())
+		assert.Equal(subT, codes.Unset, put.Status().Code)
+		putAttrs := attrs(put)
+		assert.Equal(subT, "test", putAttrs[IDKey].AsString())
+		assert.Equal(subT, int64(len("content")), putAttrs[SizeKey].AsInt64())
+
+		get := spans[1]
+		assert.Equal(subT, "sakuin.ObjectStore/Get", get.Name())
+		assert.Equal(subT, codes.Unset, get.Status().Code)
+		assert.Empty(subT, get.Events())
+		getAttrs := attrs(get)
+		assert.Equal(subT, "missing", getAttrs[IDKey].AsString())
+		assert.True(subT, getAttrs[NotFoundKey].AsBool())
+	})
+
+	t.Run("should record other errors and return them unchanged", func(subT *testing.T) {
+		tp, sr := newTracerProvider()
+		putErr := errors.New("put failed")
+		s := NewObjectStore(failingObjectStore{InMemoryObjectStore: sakuin.NewInMemoryObjectStore(), err: putErr}, tp)
+
+		err := s.Put(context.Background(), "test", []byte("content"))
+		assert.Equal(subT, putErr, err)
+
+		spans := sr.Ended()
+		if !assert.Len(subT, spans, 1) {
+			return
+		}
+		assert.Equal(subT, codes.Error, spans[0].Status().Code)
+		assert.Equal(subT, "put failed", spans[0].Status().Description)
+		events := spans[0].Events()
+		if !assert.Len(subT, events, 1) {
+			return
+		}
+		assert.Equal(subT, "exception", events[0].Name)
+	})
+
+	t.Run("should start spans as children of the caller's span", func(subT *testing.T) {
+		tp, sr := newTracerProvider()
+		s := NewObjectStore(sakuin.NewInMemoryObjectStore(), tp)
+
+		ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+		_, err := s.Stat(ctx, "test")
+		parent.End()
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		spans := sr.Ended()
+		if !assert.Len(subT, spans, 2) {
+			return
+		}
+		stat := spans[0]
+		assert.Equal(subT, "sakuin.ObjectStore/Stat", stat.Name())
+		assert.Equal(subT, parent.SpanContext().SpanID(), stat.Parent().SpanID())
+		assert.True(subT, attrs(stat)[NotFoundKey].AsBool())
+	})
+
+	t.Run("should only support optional interfaces the inner store does", func(subT *testing.T) {
+		tp, _ := newTracerProvider()
+		s := NewObjectStore(plainObjectStore{sakuin.NewInMemoryObjectStore()}, tp)
+
+		_, ok := s.(sakuin.StreamingObjectStore)
+		assert.False(subT, ok)
+
+		_, _, err := s.(sakuin.ListableObjectStore).List(context.Background(), "", "", 0)
+		assert.Equal(subT, sakuin.ErrListNotSupported, err)
+	})
+}
+
+func TestDocumentStore(t *testing.T) {
+	newStore := func() sakuin.DocumentStore {
+		tp, _ := newTracerProvider()
+		return NewDocumentStore(sakuin.NewInMemoryDocumentStore(), tp)
+	}
+	sakuin.RunDocumentStorageTests(storagetest.Lift(t), newStore())
+	sakuin.RunQueryableDocumentStorageTests(storagetest.Lift(t), newStore().(sakuin.QueryableDocumentStore))
+
+	t.Run("should trace each call with its outcome", func(subT *testing.T) {
+		tp, sr := newTracerProvider()
+		s := NewDocumentStore(sakuin.NewInMemoryDocumentStore(), tp)
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{"name": "test", "size": 1})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Delete(context.Background(), "missing")
+		var notFound sakuin.DocumentDoesNotExistErr
+		if !assert.ErrorAs(subT, err, &notFound) {
+			return
+		}
+
+		spans := sr.Ended()
+		if !assert.Len(subT, spans, 2) {
+			return
+		}
+
+		upsert := spans[0]
+		assert.Equal(subT, "sakuin.DocumentStore/Upsert", upsert.Name())
+		assert.Equal(subT, int64(2), attrs(upsert)[FieldsKey].AsInt64())
+
+		del := spans[1]
+		assert.Equal(subT, "sakuin.DocumentStore/Delete", del.Name())
+		assert.True(subT, attrs(del)[NotFoundKey].AsBool())
+	})
+
+	t.Run("should preserve revision support and error types", func(subT *testing.T) {
+		tp, _ := newTracerProvider()
+		s := NewDocumentStore(sakuin.NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}), tp)
+
+		revDB, ok := s.(sakuin.RevisionedDocumentStore)
+		if !assert.True(subT, ok) {
+			return
+		}
+
+		_, err := revDB.UpsertIfRevision(context.Background(), "test", map[string]interface{}{"name": "new"}, "stale")
+		var revErr sakuin.RevisionMismatchErr
+		assert.ErrorAs(subT, err, &revErr)
+	})
+}
@@ -1,7 +1,10 @@
 package sakuin
 
 import (
+	"context"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 type testingT struct {
@@ -20,8 +23,217 @@ func (t testingT) Run(name string, f func(TestingT)) {
 
 func TestInMemoryObjectStore(t *testing.T) {
 	RunObjectStorageTests(liftTestingT(t), NewInMemoryObjectStore())
+	RunStreamingObjectStorageTests(liftTestingT(t), NewInMemoryObjectStore())
+	RunListableObjectStorageTests(liftTestingT(t), NewInMemoryObjectStore())
 }
 
 func TestInMemoryDocumentStore(t *testing.T) {
 	RunDocumentStorageTests(liftTestingT(t), NewInMemoryDocumentStore())
 }
+
+func TestBoundedInMemoryObjectStore(t *testing.T) {
+	RunObjectStorageTests(liftTestingT(t), NewInMemoryObjectStoreWithLimit(1<<20, 64))
+	RunStreamingObjectStorageTests(liftTestingT(t), NewInMemoryObjectStoreWithLimit(1<<20, 64))
+	RunListableObjectStorageTests(liftTestingT(t), NewInMemoryObjectStoreWithLimit(1<<20, 64))
+
+	t.Run("should evict the least recently used objects past the object limit", func(subT *testing.T) {
+		var evicted []string
+		s := NewInMemoryObjectStoreWithLimit(0, 2).WithEvictionHandler(func(id string) {
+			evicted = append(evicted, id)
+		})
+
+		for _, id := range []string{"a", "b"} {
+			err := s.Put(context.Background(), id, []byte("content"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		_, err := s.Get(context.Background(), "a")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Put(context.Background(), "c", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"b"}, evicted)
+		assert.Equal(subT, 2, s.NumOfObects())
+
+		var objErr ObjectDoesNotExistErr
+		_, err = s.Get(context.Background(), "b")
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should evict the least recently used objects past the byte limit", func(subT *testing.T) {
+		var evicted []string
+		s := NewInMemoryObjectStoreWithLimit(10, 0).WithEvictionHandler(func(id string) {
+			evicted = append(evicted, id)
+		})
+
+		for _, id := range []string{"a", "b", "c"} {
+			err := s.Put(context.Background(), id, []byte("abc"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		_, err := s.Stat(context.Background(), "a")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Update(context.Background(), "c", []byte("abcdef"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"b"}, evicted)
+
+		stats, err := s.Stats(context.Background())
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, &StoreStatsInfo{Count: 2, Bytes: 9}, stats)
+	})
+
+	t.Run("should not count updates as new objects", func(subT *testing.T) {
+		var evicted []string
+		s := NewInMemoryObjectStoreWithLimit(0, 2).WithEvictionHandler(func(id string) {
+			evicted = append(evicted, id)
+		})
+
+		for _, id := range []string{"a", "b", "b", "a"} {
+			err := s.Put(context.Background(), id, []byte("content"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+			err = s.Update(context.Background(), id, []byte("updated"))
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+		assert.Empty(subT, evicted)
+		assert.Equal(subT, 2, s.NumOfObects())
+	})
+
+	t.Run("should not need to evict after a delete", func(subT *testing.T) {
+		var evicted []string
+		s := NewInMemoryObjectStoreWithLimit(0, 1).WithEvictionHandler(func(id string) {
+			evicted = append(evicted, id)
+		})
+
+		err := s.Put(context.Background(), "a", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Delete(context.Background(), "a")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		err = s.Put(context.Background(), "b", []byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Empty(subT, evicted)
+	})
+
+	t.Run("should fail with ObjectTooLargeErr for objects past the byte limit", func(subT *testing.T) {
+		s := NewInMemoryObjectStoreWithLimit(4, 0).WithObject("a", []byte("abc"))
+
+		err := s.Put(context.Background(), "b", []byte("content"))
+		assert.Equal(subT, ObjectTooLargeErr{Limit: 4, Size: 7}, err)
+		assert.Equal(subT, 1, s.NumOfObects())
+	})
+}
+
+func TestBoundedInMemoryDocumentStore(t *testing.T) {
+	RunDocumentStorageTests(liftTestingT(t), NewInMemoryDocumentStoreWithLimit(64))
+
+	t.Run("should evict the least recently used documents past the limit", func(subT *testing.T) {
+		var evicted []string
+		s := NewInMemoryDocumentStoreWithLimit(2).WithEvictionHandler(func(id string) {
+			evicted = append(evicted, id)
+		})
+
+		for _, id := range []string{"a", "b"} {
+			err := s.Upsert(context.Background(), id, map[string]interface{}{"id": id})
+			if !assert.Nil(subT, err) {
+				return
+			}
+		}
+
+		_, _, err := s.GetWithRevision(context.Background(), "a")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Replace(context.Background(), "c", map[string]interface{}{"id": "c"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"b"}, evicted)
+		assert.Equal(subT, 2, s.NumOfDocs())
+
+		var docErr DocumentDoesNotExistErr
+		_, err = s.Get(context.Background(), "b")
+		assert.ErrorAs(subT, err, &docErr)
+	})
+}
+
+func TestMergeDocs(t *testing.T) {
+	t.Run("should keep the values of dst and add the rest of src", func(subT *testing.T) {
+		doc, err := MergeDocs(
+			map[string]interface{}{"a": "new", "nested": map[string]interface{}{"b": "new"}, "c": map[string]interface{}{}},
+			map[string]interface{}{"a": "old", "nested": map[string]interface{}{"b": "old", "d": "old"}, "c": "old"},
+		)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{
+			"a":      "new",
+			"nested": map[string]interface{}{"b": "new", "d": "old"},
+			"c":      map[string]interface{}{},
+		}, doc)
+	})
+
+	t.Run("should fail with MergeConflictErr if dst has a scalar where src has an object", func(subT *testing.T) {
+		_, err := MergeDocs(
+			map[string]interface{}{"nested": map[string]interface{}{"deeper": 1}},
+			map[string]interface{}{"nested": map[string]interface{}{"deeper": map[string]interface{}{"a": "b"}}},
+		)
+
+		var mergeErr MergeConflictErr
+		if !assert.ErrorAs(subT, err, &mergeErr) {
+			return
+		}
+		assert.Equal(subT, "nested.deeper", mergeErr.Field)
+	})
+
+	t.Run("should not panic for the reserved metadata", func(subT *testing.T) {
+		s := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+			ReservedMetadataKey: map[string]interface{}{checksumMetadataKey: "sha256:abc"},
+		})
+
+		err := s.Upsert(context.Background(), "test", map[string]interface{}{ReservedMetadataKey: 1})
+
+		var mergeErr MergeConflictErr
+		if !assert.ErrorAs(subT, err, &mergeErr) {
+			return
+		}
+		doc, err := s.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "sha256:abc", getReservedString(doc, checksumMetadataKey))
+	})
+}
+
+func TestAsStreaming(t *testing.T) {
+	RunStreamingObjectStorageTests(liftTestingT(t), AsStreaming(nonStreamingObjectStore{NewInMemoryObjectStore()}))
+}
+
+// nonStreamingObjectStore hides any optional interfaces of the embedded store.
+type nonStreamingObjectStore struct {
+	ObjectStore
+}
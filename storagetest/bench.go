@@ -0,0 +1,185 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/z5labs/sakuin"
+)
+
+// benchObjectSizes are the object sizes every ObjectStore is benchmarked with.
+var benchObjectSizes = []struct {
+	Name string
+	Size int
+}{
+	{Name: "1KB", Size: 1 << 10},
+	{Name: "100KB", Size: 100 << 10},
+	{Name: "10MB", Size: 10 << 20},
+}
+
+// benchDocFields are the document sizes, in top level fields, every
+// DocumentStore is benchmarked with.
+var benchDocFields = []int{10, 100, 1000}
+
+func benchObject(size int) []byte {
+	b := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(b)
+	return b
+}
+
+func benchDoc(fields int) map[string]interface{} {
+	doc := make(map[string]interface{}, fields)
+	for i := 0; i < fields; i++ {
+		doc[fmt.Sprint("field-", i)] = fmt.Sprint("value-", i)
+	}
+	return doc
+}
+
+func benchFail(b *testing.B, err error) {
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+// RunObjectStorageBenchmarks benchmarks Put, Get, Update and Delete on the
+// store across object sizes, along with Gets in parallel, so backends can
+// be compared with each other and with the sakuin.InMemoryObjectStore baseline.
+// Throughput is reported through b.SetBytes. Objects are written under
+// ids prefixed with "bench-" and deleted again afterwards.
+func RunObjectStorageBenchmarks(b *testing.B, objStore sakuin.ObjectStore) {
+	ctx := context.Background()
+
+	for _, size := range benchObjectSizes {
+		obj := benchObject(size.Size)
+		id := "bench-" + size.Name
+
+		b.Run("Put/"+size.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(obj)))
+			for i := 0; i < b.N; i++ {
+				benchFail(b, objStore.Put(ctx, id, obj))
+			}
+			b.StopTimer()
+			benchFail(b, objStore.Delete(ctx, id))
+		})
+
+		b.Run("Get/"+size.Name, func(b *testing.B) {
+			benchFail(b, objStore.Put(ctx, id, obj))
+			b.SetBytes(int64(len(obj)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := objStore.Get(ctx, id)
+				benchFail(b, err)
+			}
+			b.StopTimer()
+			benchFail(b, objStore.Delete(ctx, id))
+		})
+
+		b.Run("ParallelGet/"+size.Name, func(b *testing.B) {
+			benchFail(b, objStore.Put(ctx, id, obj))
+			b.SetBytes(int64(len(obj)))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, err := objStore.Get(ctx, id)
+					if err != nil {
+						// Fatal can only be called from the benchmark goroutine.
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+			benchFail(b, objStore.Delete(ctx, id))
+		})
+
+		b.Run("Update/"+size.Name, func(b *testing.B) {
+			benchFail(b, objStore.Put(ctx, id, obj))
+			b.SetBytes(int64(len(obj)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				benchFail(b, objStore.Update(ctx, id, obj))
+			}
+			b.StopTimer()
+			benchFail(b, objStore.Delete(ctx, id))
+		})
+
+		b.Run("Delete/"+size.Name, func(b *testing.B) {
+			b.SetBytes(int64(len(obj)))
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				benchFail(b, objStore.Put(ctx, id, obj))
+				b.StartTimer()
+				benchFail(b, objStore.Delete(ctx, id))
+			}
+		})
+	}
+}
+
+// RunDocumentStorageBenchmarks is the DocumentStore equivalent of
+// RunObjectStorageBenchmarks, benchmarking Upsert, Get, Replace and Delete
+// across documents with different numbers of fields. Since documents
+// don't have a size in bytes, no throughput is reported.
+func RunDocumentStorageBenchmarks(b *testing.B, docStore sakuin.DocumentStore) {
+	ctx := context.Background()
+
+	for _, fields := range benchDocFields {
+		doc := benchDoc(fields)
+		name := fmt.Sprint(fields, "Fields")
+		id := "bench-" + name
+
+		b.Run("Upsert/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchFail(b, docStore.Upsert(ctx, id, doc))
+			}
+			b.StopTimer()
+			benchFail(b, docStore.Delete(ctx, id))
+		})
+
+		b.Run("Get/"+name, func(b *testing.B) {
+			benchFail(b, docStore.Upsert(ctx, id, doc))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := docStore.Get(ctx, id)
+				benchFail(b, err)
+			}
+			b.StopTimer()
+			benchFail(b, docStore.Delete(ctx, id))
+		})
+
+		b.Run("ParallelGet/"+name, func(b *testing.B) {
+			benchFail(b, docStore.Upsert(ctx, id, doc))
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, err := docStore.Get(ctx, id)
+					if err != nil {
+						// Fatal can only be called from the benchmark goroutine.
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+			benchFail(b, docStore.Delete(ctx, id))
+		})
+
+		b.Run("Replace/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				benchFail(b, docStore.Replace(ctx, id, doc))
+			}
+			b.StopTimer()
+			benchFail(b, docStore.Delete(ctx, id))
+		})
+
+		b.Run("Delete/"+name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				benchFail(b, docStore.Replace(ctx, id, doc))
+				b.StartTimer()
+				benchFail(b, docStore.Delete(ctx, id))
+			}
+		})
+	}
+}
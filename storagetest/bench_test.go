@@ -0,0 +1,15 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/z5labs/sakuin"
+)
+
+func BenchmarkInMemoryObjectStore(b *testing.B) {
+	RunObjectStorageBenchmarks(b, sakuin.NewInMemoryObjectStore())
+}
+
+func BenchmarkInMemoryDocumentStore(b *testing.B) {
+	RunDocumentStorageBenchmarks(b, sakuin.NewInMemoryDocumentStore())
+}
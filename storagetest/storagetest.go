@@ -0,0 +1,26 @@
+// Package storagetest lets the tests of ObjectStore and DocumentStore
+// implementations run the storage test suites of sakuin.
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/z5labs/sakuin"
+)
+
+// Lift adapts t to a sakuin.TestingT, e.g.
+//
+//	sakuin.RunObjectStorageTests(storagetest.Lift(t), store)
+func Lift(t *testing.T) sakuin.TestingT {
+	return testingT{t}
+}
+
+type testingT struct {
+	*testing.T
+}
+
+func (t testingT) Run(name string, f func(sakuin.TestingT)) {
+	t.T.Run(name, func(subT *testing.T) {
+		f(Lift(subT))
+	})
+}
@@ -0,0 +1,338 @@
+package sakuin
+
+import (
+	"bufio"
+	"context"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"go.uber.org/zap"
+)
+
+// IndexStream indexes an object read from r, along with its metadata.
+//
+// If the configured ObjectStore implements StreamingObjectStore the object
+// is streamed directly to it, otherwise the object is buffered in memory first.
+// Unlike Index, the metadata is written after the object since the checksum
+// isn't known until the object has been completely read.
+func (s *Service) IndexStream(ctx context.Context, metadata map[string]interface{}, r io.Reader) (resp *pb.IndexResponse, err error) {
+	defer s.observe("IndexStream", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	return s.indexStream(ctx, &pb.IndexRequest{AllowEmpty: true}, metadata, r)
+}
+
+// IndexObjectStream is IndexStream for the options of an IndexRequest,
+// whose Object is ignored in favour of the content read from r. Since the
+// checksum isn't known until the object has been written, identical
+// objects aren't deduplicated.
+func (s *Service) IndexObjectStream(ctx context.Context, req *pb.IndexRequest, r io.Reader) (resp *pb.IndexResponse, err error) {
+	defer s.observe("IndexObjectStream", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	var metadata map[string]interface{}
+	if req.Metadata != nil {
+		metadata, err = unmarshalAnyToJSON(req.Metadata)
+		if err != nil {
+			s.log.Error("unable to unmarshal metadata", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	return s.indexStream(ctx, req, metadata, r)
+}
+
+func (s *Service) indexStream(ctx context.Context, req *pb.IndexRequest, metadata map[string]interface{}, r io.Reader) (resp *pb.IndexResponse, err error) {
+	// Peek so an empty object is rejected before anything is written
+	br := bufio.NewReader(r)
+	_, err = br.Peek(1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err == io.EOF {
+		err = s.checkObjectNotEmpty(req.Id, nil, req.AllowEmpty)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	h, err := s.checksumAlg.newHash()
+	if err != nil {
+		s.log.Error("unexpected error when computing checksum", zap.Error(err))
+		return nil, err
+	}
+	var size byteCounter
+	r = io.TeeReader(s.limitObjectSize(br), io.MultiWriter(h, &size))
+
+	if req.IdempotencyKey != "" && !req.DryRun {
+		id, replay, rerr := s.reserveIdempotencyKey(ctx, req.IdempotencyKey)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if replay {
+			_, err = io.Copy(ioutil.Discard, r)
+			if err != nil {
+				return nil, err
+			}
+			return &pb.IndexResponse{Id: id, Checksum: s.checksumAlg.format(h)}, nil
+		}
+		defer func() {
+			s.settleIdempotencyKey(ctx, req.IdempotencyKey, resp, err)
+		}()
+	}
+
+	id, err := s.indexID(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	log := s.logger(id)
+
+	err = s.validateMetadata(ctx, id, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DryRun {
+		log.Info("dry run, skipping writes")
+		_, err = io.Copy(ioutil.Discard, r)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.IndexResponse{Id: id, Checksum: s.checksumAlg.format(h), DryRun: true}, nil
+	}
+
+	log.Info("indexing object stream")
+	err = s.putStream(ctx, id, r, -1)
+	if err != nil {
+		log.Error("unexpected error when indexing object stream", zap.Error(err))
+		return nil, err
+	}
+	s.metrics.ObserveObjectSize(int(size))
+
+	checksum := s.checksumAlg.format(h)
+	expiresAt, expires := s.expiresAt(req)
+	doc := indexedMetadata(CopyDoc(metadata), checksum, req, expiresAt, expires)
+
+	log.Info("indexing metadata")
+	err = s.docDB.Upsert(ctx, id, doc)
+	if err != nil {
+		log.Error("unexpected error when indexing metadata", zap.Error(err))
+		if derr := s.objDB.Delete(ctx, id); derr != nil {
+			log.Error("unable to clean up indexed object", zap.Error(derr))
+		}
+		return nil, err
+	}
+
+	if expires {
+		s.trackExpiration(ctx, id, expiresAt)
+	}
+	s.recordChecksum(ctx, checksum, id)
+
+	s.runHook("OnIndexed", s.hooks.OnIndexed, id, HookSummary{Checksum: checksum, Size: int(size)})
+	return &pb.IndexResponse{Id: id, Checksum: checksum}, nil
+}
+
+// UpdateObjectStream replaces the content of an existing object with the
+// content read from r, enforcing the maximum object size as it's read. The
+// Content of req is ignored, otherwise it behaves like UpdateObject except
+// the previous content isn't kept around, so it can't be restored if
+// recording the new checksum fails.
+func (s *Service) UpdateObjectStream(ctx context.Context, req *pb.UpdateObjectRequest, r io.Reader) (resp *pb.UpdateObjectResponse, err error) {
+	defer s.observe("UpdateObjectStream", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer s.exit()
+
+	log := s.logger(req.Id)
+
+	// Peek so an empty object is rejected before anything is written
+	br := bufio.NewReader(r)
+	_, err = br.Peek(1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if err == io.EOF {
+		err = s.checkObjectNotEmpty(req.Id, nil, req.AllowEmpty)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mu := s.updateLock(req.Id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	info, err := s.objDB.Stat(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Exists {
+		return nil, ObjectDoesNotExistErr{ID: req.Id}
+	}
+
+	err = s.checkExpectedChecksumsStream(ctx, req.Id, req.ExpectedChecksums)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := s.checksumAlg.newHash()
+	if err != nil {
+		log.Error("unexpected error when computing checksum", zap.Error(err))
+		return nil, err
+	}
+	var size byteCounter
+	tr := io.TeeReader(s.limitObjectSize(br), io.MultiWriter(h, &size))
+
+	log.Info("updating object stream")
+	err = s.putStream(ctx, req.Id, tr, -1)
+	if err != nil {
+		log.Error("unable to update object stream", zap.Error(err))
+		return nil, err
+	}
+	s.metrics.ObserveObjectSize(int(size))
+
+	// The content type is always overwritten so a stale one isn't served for the new content
+	checksum := s.checksumAlg.format(h)
+	reserved := setReservedMetadata(nil, checksumMetadataKey, checksum)
+	reserved = setReservedMetadata(reserved, contentTypeMetadataKey, req.ContentType)
+
+	err = s.docDB.Upsert(ctx, req.Id, reserved)
+	if err != nil {
+		log.Error("unable to record checksum of updated object", zap.Error(err))
+		return nil, err
+	}
+
+	s.runHook("OnObjectUpdated", s.hooks.OnObjectUpdated, req.Id, HookSummary{Checksum: checksum, Size: int(size)})
+	return &pb.UpdateObjectResponse{Checksum: checksum}, nil
+}
+
+// checkExpectedChecksumsStream is checkExpectedChecksums for an object
+// which is streamed from the ObjectStore rather than read into memory.
+func (s *Service) checkExpectedChecksumsStream(ctx context.Context, id string, expected []string) error {
+	if len(expected) == 0 {
+		return nil
+	}
+
+	// One hash per algorithm, malformed checksums are left to never match
+	hashes := make(map[ChecksumAlgorithm]hash.Hash)
+	for _, checksum := range expected {
+		alg, _, ok := strings.Cut(checksum, ":")
+		if !ok {
+			continue
+		}
+		h, err := ChecksumAlgorithm(alg).newHash()
+		if err != nil {
+			continue
+		}
+		hashes[ChecksumAlgorithm(alg)] = h
+	}
+
+	if len(hashes) > 0 {
+		rc, _, err := AsStreaming(s.objDB).GetStream(ctx, id)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		ws := make([]io.Writer, 0, len(hashes))
+		for _, h := range hashes {
+			ws = append(ws, h)
+		}
+		_, err = io.Copy(io.MultiWriter(ws...), rc)
+		if err != nil {
+			return err
+		}
+
+		for _, checksum := range expected {
+			alg, _, _ := strings.Cut(checksum, ":")
+			h, ok := hashes[ChecksumAlgorithm(alg)]
+			if ok && ChecksumAlgorithm(alg).format(h) == checksum {
+				return nil
+			}
+		}
+	}
+	s.logger(id).Error("object doesn't match the expected checksums")
+	return ChecksumMismatchErr{ID: id, Expected: expected}
+}
+
+// GetObjectStream returns a reader for the object content along with its size.
+// The caller must close the reader once done with it, even when abandoning it midway.
+//
+// If the configured ObjectStore doesn't implement StreamingObjectStore
+// the object is read into memory and served from there.
+func (s *Service) GetObjectStream(ctx context.Context, id string) (rc io.ReadCloser, size int64, err error) {
+	defer s.observe("GetObjectStream", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer s.exit()
+
+	log := s.logger(id)
+
+	doc, err := s.getReserved(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if s.isExpired(doc) {
+		log.Warn("object has expired")
+		return nil, 0, ObjectDoesNotExistErr{ID: id}
+	}
+
+	return AsStreaming(s.objDB).GetStream(ctx, id)
+}
+
+func (s *Service) putStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return AsStreaming(s.objDB).PutStream(ctx, id, r, size)
+}
+
+// limitObjectSize fails reads with an ObjectTooLargeErr once
+// more than the configured maximum object size has been read.
+func (s *Service) limitObjectSize(r io.Reader) io.Reader {
+	if s.maxObjSize <= 0 {
+		return r
+	}
+	return &sizeLimitedReader{r: r, limit: s.maxObjSize}
+}
+
+type sizeLimitedReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (r *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.limit {
+		return n, ObjectTooLargeErr{Limit: r.limit, Size: r.n}
+	}
+	return n, err
+}
+
+// byteCounter counts the bytes written to it.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,470 @@
+package sakuin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// streamingObjectStore records which objects were stored via PutStream.
+type streamingObjectStore struct {
+	*InMemoryObjectStore
+	streamed []string
+	readers  []*trackingReadCloser
+}
+
+func (s *streamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.streamed = append(s.streamed, id)
+	return s.Put(ctx, id, b)
+}
+
+func (s *streamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	b, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	rc := &trackingReadCloser{Reader: bytes.NewReader(b)}
+	s.readers = append(s.readers, rc)
+	return rc, int64(len(b)), nil
+}
+
+// trackingReadCloser records whether it was closed.
+type trackingReadCloser struct {
+	io.Reader
+	closed bool
+}
+
+func (rc *trackingReadCloser) Close() error {
+	rc.closed = true
+	return nil
+}
+
+// discardObjectStore streams objects into the void.
+type discardObjectStore struct {
+	*InMemoryObjectStore
+}
+
+func (s discardObjectStore) Stat(ctx context.Context, id string) (*StatInfo, error) {
+	return &StatInfo{}, nil
+}
+
+func (s discardObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return nil
+}
+
+func (s discardObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
+
+func TestIndexStream(t *testing.T) {
+	t.Run("should buffer object if store doesn't support streaming", func(subT *testing.T) {
+		objStore := nonStreamingObjectStore{NewInMemoryObjectStore()}
+		docStore := NewInMemoryDocumentStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+			RandSrc:       rand.Reader,
+		})
+
+		resp, err := s.IndexStream(context.Background(), map[string]interface{}{"name": "test"}, bytes.NewReader([]byte("content")))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		obj, err := objStore.Get(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj)
+
+		doc, err := docStore.Get(context.Background(), resp.Id)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", doc["name"])
+
+		ok, err := VerifyChecksum(resp.Checksum, obj)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, ok)
+	})
+
+	t.Run("should stream object if store supports streaming", func(subT *testing.T) {
+		objStore := &streamingObjectStore{InMemoryObjectStore: NewInMemoryObjectStore()}
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+		})
+
+		resp, err := s.IndexStream(context.Background(), nil, bytes.NewReader([]byte("content")))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{resp.Id}, objStore.streamed)
+
+		getResp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: resp.Id})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, resp.Checksum, getResp.Checksum)
+	})
+
+	t.Run("should fail if object exceeds max object size", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			RandSrc:       rand.Reader,
+			MaxObjectSize: 6,
+		})
+
+		_, err := s.IndexStream(context.Background(), nil, bytes.NewReader([]byte("content")))
+
+		var sizeErr ObjectTooLargeErr
+		if !assert.ErrorAs(subT, err, &sizeErr) {
+			return
+		}
+		assert.Equal(subT, 0, objStore.NumOfObects())
+	})
+
+	t.Run("should clean up object if metadata fails to index", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore: objStore,
+			DocumentStore: failingDocumentStore{
+				DocumentStore: NewInMemoryDocumentStore(),
+				err:           errors.New("upsert failed"),
+			},
+			RandSrc: rand.Reader,
+		})
+
+		_, err := s.IndexStream(context.Background(), nil, bytes.NewReader([]byte("content")))
+		if !assert.Error(subT, err) {
+			return
+		}
+		assert.Equal(subT, 0, objStore.NumOfObects())
+	})
+}
+
+func TestIndexObjectStream(t *testing.T) {
+	t.Run("should honour the options of the request", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		resp, err := s.IndexObjectStream(context.Background(), &pb.IndexRequest{
+			Id:          "test",
+			ContentType: "application/pdf",
+			Filename:    "../invoice.pdf",
+		}, bytes.NewReader([]byte("content")))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", resp.Id)
+
+		getResp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), getResp.Content)
+		assert.Equal(subT, resp.Checksum, getResp.Checksum)
+		assert.Equal(subT, "application/pdf", getResp.ContentType)
+		assert.Equal(subT, "invoice.pdf", getResp.Filename)
+	})
+
+	t.Run("should fail if the id is taken", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.IndexObjectStream(context.Background(), &pb.IndexRequest{Id: "test"}, bytes.NewReader([]byte("new content")))
+
+		var existsErr ObjectAlreadyExistsErr
+		assert.ErrorAs(subT, err, &existsErr)
+	})
+
+	t.Run("should fail with EmptyObjectErr unless empty objects are allowed", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.IndexObjectStream(context.Background(), &pb.IndexRequest{Id: "test"}, bytes.NewReader(nil))
+
+		var emptyErr EmptyObjectErr
+		if !assert.ErrorAs(subT, err, &emptyErr) {
+			return
+		}
+		assert.Equal(subT, 0, objStore.NumOfObects())
+
+		_, err = s.IndexObjectStream(context.Background(), &pb.IndexRequest{Id: "test", AllowEmpty: true}, bytes.NewReader(nil))
+		assert.Nil(subT, err)
+	})
+}
+
+func TestUpdateObjectStream(t *testing.T) {
+	t.Run("should stream object if store supports streaming", func(subT *testing.T) {
+		objStore := &streamingObjectStore{InMemoryObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content"))}
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		resp, err := s.UpdateObjectStream(context.Background(), &pb.UpdateObjectRequest{Id: "test"}, bytes.NewReader([]byte("new content")))
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []string{"test"}, objStore.streamed)
+
+		getResp, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("new content"), getResp.Content)
+		assert.Equal(subT, resp.Checksum, getResp.Checksum)
+	})
+
+	t.Run("should fail with ObjectDoesNotExistErr if object doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.UpdateObjectStream(context.Background(), &pb.UpdateObjectRequest{Id: "test"}, bytes.NewReader([]byte("content")))
+
+		var objErr ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+	})
+
+	t.Run("should keep the previous object if it exceeds max object size", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("test", []byte("old"))
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+			MaxObjectSize: 6,
+		})
+
+		_, err := s.UpdateObjectStream(context.Background(), &pb.UpdateObjectRequest{Id: "test"}, bytes.NewReader([]byte("content")))
+
+		var sizeErr ObjectTooLargeErr
+		if !assert.ErrorAs(subT, err, &sizeErr) {
+			return
+		}
+		b, err := objStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("old"), b)
+	})
+
+	t.Run("should fail with EmptyObjectErr if the stream is empty", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.UpdateObjectStream(context.Background(), &pb.UpdateObjectRequest{Id: "test"}, bytes.NewReader(nil))
+
+		var emptyErr EmptyObjectErr
+		assert.ErrorAs(subT, err, &emptyErr)
+	})
+
+	t.Run("should only update if the expected checksums match", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		current, err := SHA512.Checksum([]byte("content"))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateObjectStream(context.Background(), &pb.UpdateObjectRequest{
+			Id:                "test",
+			ExpectedChecksums: []string{"sha256:stale", "malformed"},
+		}, bytes.NewReader([]byte("stale update")))
+
+		var mismatchErr ChecksumMismatchErr
+		if !assert.ErrorAs(subT, err, &mismatchErr) {
+			return
+		}
+
+		_, err = s.UpdateObjectStream(context.Background(), &pb.UpdateObjectRequest{
+			Id:                "test",
+			ExpectedChecksums: []string{"sha256:stale", current},
+		}, bytes.NewReader([]byte("new content")))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		b, err := objStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("new content"), b)
+	})
+}
+
+func (s discardObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	return nil, 0, ObjectDoesNotExistErr{ID: id}
+}
+
+func TestGetObjectStream(t *testing.T) {
+	t.Run("should read object into memory if store doesn't support streaming", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   nonStreamingObjectStore{NewInMemoryObjectStore().WithObject("test", []byte("content"))},
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		rc, size, err := s.GetObjectStream(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer rc.Close()
+
+		b, err := ioutil.ReadAll(rc)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+		assert.Equal(subT, int64(len(b)), size)
+	})
+
+	t.Run("should stream object if store supports streaming", func(subT *testing.T) {
+		objStore := &streamingObjectStore{
+			InMemoryObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content")),
+		}
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		rc, size, err := s.GetObjectStream(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		defer rc.Close()
+
+		b, err := ioutil.ReadAll(rc)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), b)
+		assert.Equal(subT, int64(7), size)
+		assert.Len(subT, objStore.readers, 1)
+	})
+
+	t.Run("should release the store reader when abandoned midway", func(subT *testing.T) {
+		objStore := &streamingObjectStore{
+			InMemoryObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content")),
+		}
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		rc, _, err := s.GetObjectStream(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = rc.Read(make([]byte, 3))
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = rc.Close()
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, objStore.readers[0].closed)
+	})
+
+	t.Run("should fail with ObjectDoesNotExistErr if object doesn't exist", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, _, err := s.GetObjectStream(context.Background(), "test")
+
+		var objErr ObjectDoesNotExistErr
+		assert.ErrorAs(subT, err, &objErr)
+	})
+}
+
+const benchmarkObjectSize = 100 << 20
+
+// BenchmarkIndex indexes a 100MB object which must
+// first be read completely into memory.
+func BenchmarkIndex(b *testing.B) {
+	s := New(Config{
+		ObjectStore:   discardObjectStore{NewInMemoryObjectStore()},
+		DocumentStore: NewInMemoryDocumentStore(),
+		RandSrc:       rand.Reader,
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		obj, err := ioutil.ReadAll(io.LimitReader(zeroReader{}, benchmarkObjectSize))
+		if err != nil {
+			b.Error(err)
+			return
+		}
+
+		_, err = s.Index(context.Background(), &pb.IndexRequest{Object: obj})
+		if err != nil {
+			b.Error(err)
+			return
+		}
+	}
+}
+
+// BenchmarkIndexStream indexes a 100MB object by streaming it.
+func BenchmarkIndexStream(b *testing.B) {
+	s := New(Config{
+		ObjectStore:   discardObjectStore{NewInMemoryObjectStore()},
+		DocumentStore: NewInMemoryDocumentStore(),
+		RandSrc:       rand.Reader,
+	})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := s.IndexStream(context.Background(), nil, io.LimitReader(zeroReader{}, benchmarkObjectSize))
+		if err != nil {
+			b.Error(err)
+			return
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
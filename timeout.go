@@ -0,0 +1,203 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Timeouts bound how long individual store calls may take.
+// A zero duration leaves the corresponding calls unbounded.
+type Timeouts struct {
+	// ObjectRead applies to ObjectStore Stat and Get calls.
+	ObjectRead time.Duration
+
+	// ObjectWrite applies to ObjectStore Put, Update and Delete calls.
+	ObjectWrite time.Duration
+
+	// Document applies to all DocumentStore calls.
+	Document time.Duration
+}
+
+// StoreTimeoutErr represents a store call which didn't complete within its configured timeout.
+type StoreTimeoutErr struct {
+	Op      string
+	Timeout time.Duration
+}
+
+func (e StoreTimeoutErr) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.Op, e.Timeout)
+}
+
+func (e StoreTimeoutErr) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// withTimeout runs f with a context bounded by timeout. Only expiry of the timeout itself
+// is reported as a StoreTimeoutErr, the parent context's errors are passed through.
+func withTimeout(ctx context.Context, op string, timeout time.Duration, f func(context.Context) error) error {
+	if timeout <= 0 {
+		return f(ctx)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := f(tctx)
+	if err != nil && ctx.Err() == nil && errors.Is(tctx.Err(), context.DeadlineExceeded) {
+		return StoreTimeoutErr{Op: op, Timeout: timeout}
+	}
+	return err
+}
+
+// wrapObjectStore applies the timeouts to every call of the given store,
+// preserving whether it implements StreamingObjectStore.
+func (t Timeouts) wrapObjectStore(objDB ObjectStore) ObjectStore {
+	if objDB == nil || (t.ObjectRead <= 0 && t.ObjectWrite <= 0) {
+		return objDB
+	}
+
+	s := timeoutObjectStore{objDB: objDB, timeouts: t}
+	if streamDB, ok := objDB.(StreamingObjectStore); ok {
+		return timeoutStreamingObjectStore{timeoutObjectStore: s, streamDB: streamDB}
+	}
+	return s
+}
+
+// wrapDocumentStore applies the timeouts to every call of the given store,
+// preserving whether it implements RevisionedDocumentStore.
+func (t Timeouts) wrapDocumentStore(docDB DocumentStore) DocumentStore {
+	if docDB == nil || t.Document <= 0 {
+		return docDB
+	}
+
+	s := timeoutDocumentStore{docDB: docDB, timeout: t.Document}
+	if revDB, ok := docDB.(RevisionedDocumentStore); ok {
+		return timeoutRevisionedDocumentStore{timeoutDocumentStore: s, revDB: revDB}
+	}
+	return s
+}
+
+type timeoutObjectStore struct {
+	objDB    ObjectStore
+	timeouts Timeouts
+}
+
+func (s timeoutObjectStore) Stat(ctx context.Context, id string) (info *StatInfo, err error) {
+	err = withTimeout(ctx, "object stat", s.timeouts.ObjectRead, func(ctx context.Context) error {
+		info, err = s.objDB.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s timeoutObjectStore) Get(ctx context.Context, id string) (b []byte, err error) {
+	err = withTimeout(ctx, "object get", s.timeouts.ObjectRead, func(ctx context.Context) error {
+		b, err = s.objDB.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s timeoutObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	return withTimeout(ctx, "object put", s.timeouts.ObjectWrite, func(ctx context.Context) error {
+		return s.objDB.Put(ctx, id, b)
+	})
+}
+
+func (s timeoutObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	return withTimeout(ctx, "object update", s.timeouts.ObjectWrite, func(ctx context.Context) error {
+		return s.objDB.Update(ctx, id, b)
+	})
+}
+
+func (s timeoutObjectStore) Delete(ctx context.Context, id string) error {
+	return withTimeout(ctx, "object delete", s.timeouts.ObjectWrite, func(ctx context.Context) error {
+		return s.objDB.Delete(ctx, id)
+	})
+}
+
+// timeoutStreamingObjectStore doesn't bound streaming calls
+// since how long they take depends on the caller.
+type timeoutStreamingObjectStore struct {
+	timeoutObjectStore
+	streamDB StreamingObjectStore
+}
+
+func (s timeoutStreamingObjectStore) PutStream(ctx context.Context, id string, r io.Reader, size int64) error {
+	return s.streamDB.PutStream(ctx, id, r, size)
+}
+
+func (s timeoutStreamingObjectStore) GetStream(ctx context.Context, id string) (io.ReadCloser, int64, error) {
+	return s.streamDB.GetStream(ctx, id)
+}
+
+type timeoutDocumentStore struct {
+	docDB   DocumentStore
+	timeout time.Duration
+}
+
+func (s timeoutDocumentStore) Stat(ctx context.Context, id string) (info *StatInfo, err error) {
+	err = withTimeout(ctx, "document stat", s.timeout, func(ctx context.Context) error {
+		info, err = s.docDB.Stat(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s timeoutDocumentStore) Get(ctx context.Context, id string) (doc map[string]interface{}, err error) {
+	err = withTimeout(ctx, "document get", s.timeout, func(ctx context.Context) error {
+		doc, err = s.docDB.Get(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s timeoutDocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	return withTimeout(ctx, "document upsert", s.timeout, func(ctx context.Context) error {
+		return s.docDB.Upsert(ctx, id, doc)
+	})
+}
+
+func (s timeoutDocumentStore) Replace(ctx context.Context, id string, doc map[string]interface{}) error {
+	return withTimeout(ctx, "document replace", s.timeout, func(ctx context.Context) error {
+		return s.docDB.Replace(ctx, id, doc)
+	})
+}
+
+func (s timeoutDocumentStore) Delete(ctx context.Context, id string) error {
+	return withTimeout(ctx, "document delete", s.timeout, func(ctx context.Context) error {
+		return s.docDB.Delete(ctx, id)
+	})
+}
+
+type timeoutRevisionedDocumentStore struct {
+	timeoutDocumentStore
+	revDB RevisionedDocumentStore
+}
+
+func (s timeoutRevisionedDocumentStore) GetWithRevision(ctx context.Context, id string) (doc map[string]interface{}, rev string, err error) {
+	err = withTimeout(ctx, "document get", s.timeout, func(ctx context.Context) error {
+		doc, rev, err = s.revDB.GetWithRevision(ctx, id)
+		return err
+	})
+	return
+}
+
+func (s timeoutRevisionedDocumentStore) UpsertIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = withTimeout(ctx, "document upsert", s.timeout, func(ctx context.Context) error {
+		rev, err = s.revDB.UpsertIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
+
+func (s timeoutRevisionedDocumentStore) ReplaceIfRevision(ctx context.Context, id string, doc map[string]interface{}, revision string) (rev string, err error) {
+	err = withTimeout(ctx, "document replace", s.timeout, func(ctx context.Context) error {
+		rev, err = s.revDB.ReplaceIfRevision(ctx, id, doc, revision)
+		return err
+	})
+	return
+}
@@ -0,0 +1,110 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowDocumentStore delays every Get by the given duration, unless the context is done first.
+type slowDocumentStore struct {
+	DocumentStore
+	delay time.Duration
+}
+
+func (s slowDocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(s.delay):
+	}
+	return s.DocumentStore.Get(ctx, id)
+}
+
+func TestTimeouts(t *testing.T) {
+	t.Run("should fail with a StoreTimeoutErr if the store is too slow", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: slowDocumentStore{
+				DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+				delay:         time.Second,
+			},
+			Timeouts: Timeouts{Document: 10 * time.Millisecond},
+		})
+
+		_, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+
+		var timeoutErr StoreTimeoutErr
+		if !assert.ErrorAs(subT, err, &timeoutErr) {
+			return
+		}
+		assert.Equal(subT, "document get", timeoutErr.Op)
+		assert.True(subT, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("should not bound store calls if unset", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: slowDocumentStore{
+				DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+				delay:         20 * time.Millisecond,
+			},
+			Timeouts: Timeouts{ObjectRead: time.Millisecond},
+		})
+
+		_, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should pass through errors from the parent context", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: slowDocumentStore{
+				DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+				delay:         time.Second,
+			},
+			Timeouts: Timeouts{Document: time.Second},
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := s.GetMetadata(ctx, &pb.GetMetadataRequest{Id: "test"})
+
+		var timeoutErr StoreTimeoutErr
+		assert.False(subT, errors.As(err, &timeoutErr))
+		assert.Equal(subT, context.DeadlineExceeded, err)
+	})
+
+	t.Run("should retry store calls which timed out", func(subT *testing.T) {
+		docStore := &slowOnceDocumentStore{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+		}
+
+		s := New(Config{
+			DocumentStore: docStore,
+			Timeouts:      Timeouts{Document: 10 * time.Millisecond},
+			RetryPolicy:   RetryPolicy{MaxAttempts: 2},
+		})
+
+		_, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		assert.Nil(subT, err)
+	})
+}
+
+// slowOnceDocumentStore blocks the first Get until the context is done.
+type slowOnceDocumentStore struct {
+	DocumentStore
+	blocked bool
+}
+
+func (s *slowOnceDocumentStore) Get(ctx context.Context, id string) (map[string]interface{}, error) {
+	if !s.blocked {
+		s.blocked = true
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.DocumentStore.Get(ctx, id)
+}
@@ -0,0 +1,171 @@
+package sakuin
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// trashIDPrefix is prepended to the id of soft deleted entries,
+// which frees up their original id for reuse.
+const trashIDPrefix = "trash/"
+
+const deletedAtMetadataKey = "deletedAt"
+
+func trashID(id string) string {
+	return trashIDPrefix + id
+}
+
+// trashSteps copy the entry under its trash id, along with a tombstone
+// recording when it was deleted, and remove the copy when undone.
+func (s *Service) trashSteps(id string, obj []byte, hasObj bool, doc map[string]interface{}, deletedAt time.Time) []TxnStep {
+	tid := trashID(id)
+	tombstone := setReservedMetadata(CopyDoc(doc), deletedAtMetadataKey, deletedAt.UTC().Format(time.RFC3339Nano))
+
+	var steps []TxnStep
+	if hasObj {
+		steps = append(steps, TxnStep{
+			Name: "trash object",
+			Do: func(ctx context.Context) error {
+				return s.objDB.Put(ctx, tid, obj)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.objDB.Delete(ctx, tid)
+			},
+		})
+	}
+	steps = append(steps, TxnStep{
+		Name: "trash metadata",
+		Do: func(ctx context.Context) error {
+			return s.docDB.Upsert(ctx, tid, tombstone)
+		},
+		Undo: func(ctx context.Context) error {
+			return s.docDB.Delete(ctx, tid)
+		},
+	})
+	return steps
+}
+
+// Restore moves a soft deleted entry back out of the trash, as long
+// as it hasn't been purged and its id hasn't been reused since.
+func (s *Service) Restore(ctx context.Context, id string) (err error) {
+	defer s.observe("Restore", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return err
+	}
+	defer s.exit()
+
+	log := s.logger(id)
+	tid := trashID(id)
+
+	tombstone, err := s.getReserved(ctx, tid)
+	if err != nil {
+		return err
+	}
+	if getReservedString(tombstone, deletedAtMetadataKey) == "" {
+		log.Error("entry isn't in the trash")
+		return ObjectDoesNotExistErr{ID: id}
+	}
+
+	stats, err := s.objDB.Stat(ctx, id)
+	if err != nil {
+		return err
+	}
+	if stats.Exists {
+		log.Error("id has been reused since the entry was deleted")
+		return ObjectAlreadyExistsErr{ID: id}
+	}
+
+	trashStats, err := s.objDB.Stat(ctx, tid)
+	if err != nil {
+		return err
+	}
+
+	var steps []TxnStep
+	var obj []byte
+	if trashStats.Exists {
+		obj, err = s.objDB.Get(ctx, tid)
+		if err != nil {
+			log.Error("unable to get trashed object", zap.Error(err))
+			return err
+		}
+
+		steps = append(steps, TxnStep{
+			Name: "restore object",
+			Do: func(ctx context.Context) error {
+				return s.objDB.Put(ctx, id, obj)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.objDB.Delete(ctx, id)
+			},
+		})
+	}
+
+	doc := CopyDoc(tombstone)
+	deleteReservedMetadata(doc, deletedAtMetadataKey)
+	if len(doc) > 0 {
+		steps = append(steps, TxnStep{
+			Name: "restore metadata",
+			Do: func(ctx context.Context) error {
+				return s.docDB.Upsert(ctx, id, doc)
+			},
+			Undo: func(ctx context.Context) error {
+				return s.docDB.Delete(ctx, id)
+			},
+		})
+	}
+	steps = append(steps, s.deleteSteps(tid, obj, trashStats.Exists, tombstone)...)
+
+	log.Info("restoring entry from the trash")
+	err = RunTxn(ctx, steps...)
+	if err != nil {
+		log.Error("unable to restore entry", zap.Error(err))
+		return err
+	}
+
+	err = s.trash.Remove(ctx, id)
+	if err != nil {
+		log.Error("unable to stop tracking trashed entry", zap.Error(err))
+	}
+	if expiresAt, ok := s.getExpiresAt(doc); ok {
+		s.trackExpiration(ctx, id, expiresAt)
+	}
+
+	s.runHook("OnIndexed", s.hooks.OnIndexed, id, HookSummary{Checksum: getReservedString(doc, checksumMetadataKey), Size: len(obj)})
+	return nil
+}
+
+// PurgeTrash permanently removes the entries which were moved to the trash
+// at least olderThan ago and returns how many were removed.
+func (s *Service) PurgeTrash(ctx context.Context, olderThan time.Duration) (n int, err error) {
+	defer s.observe("PurgeTrash", time.Now(), &err)
+
+	err = s.enter()
+	if err != nil {
+		return 0, err
+	}
+	defer s.exit()
+
+	ids, err := s.trash.Expired(ctx, s.now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		s.log.Info("purging trashed entry", zap.String("id", id))
+		err = s.deleteEntry(ctx, trashID(id))
+		if err != nil {
+			s.log.Error("unable to purge trashed entry", zap.String("id", id), zap.Error(err))
+			return i, err
+		}
+
+		err = s.trash.Remove(ctx, id)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,149 @@
+package sakuin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoftDelete(t *testing.T) {
+	newService := func(now *time.Time) *Service {
+		return New(Config{
+			ObjectStore:   NewInMemoryObjectStore().WithObject("test", []byte("content")),
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"}),
+			Now:           func() time.Time { return *now },
+			SoftDelete:    true,
+		})
+	}
+
+	t.Run("should hide the entry until it's restored", func(subT *testing.T) {
+		now := time.Now()
+		s := newService(&now)
+
+		_, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.IsType(subT, ObjectDoesNotExistErr{}, err) {
+			return
+		}
+		_, err = s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		if !assert.IsType(subT, DocumentDoesNotExistErr{}, err) {
+			return
+		}
+
+		err = s.Restore(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj.Content)
+
+		resp, err := s.GetMetadata(context.Background(), &pb.GetMetadataRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		metadata, err := unmarshalAnyToJSON(resp.Metadata)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, map[string]interface{}{"name": "test"}, metadata)
+	})
+
+	t.Run("should not let callers write over trashed entries", func(subT *testing.T) {
+		now := time.Now()
+		s := newService(&now)
+
+		_, err := s.Index(context.Background(), &pb.IndexRequest{Id: "other", Object: []byte("other content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		_, err = s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.Index(context.Background(), &pb.IndexRequest{Id: trashID("test"), Object: []byte("new content")})
+		if !assert.IsType(subT, ReservedIDErr{}, err) {
+			return
+		}
+		_, err = s.Copy(context.Background(), &pb.CopyRequest{SourceId: "other", DestinationId: trashID("test")})
+		if !assert.IsType(subT, ReservedIDErr{}, err) {
+			return
+		}
+		_, err = s.Move(context.Background(), &pb.MoveRequest{OldId: "other", NewId: UploadChunkPrefix + "test"})
+		if !assert.IsType(subT, ReservedIDErr{}, err) {
+			return
+		}
+
+		err = s.Restore(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		obj, err := s.GetObject(context.Background(), &pb.GetObjectRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj.Content)
+	})
+
+	t.Run("should not restore over a reused id", func(subT *testing.T) {
+		now := time.Now()
+		s := newService(&now)
+
+		_, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.Index(context.Background(), &pb.IndexRequest{Id: "test", Object: []byte("new content")})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		err = s.Restore(context.Background(), "test")
+		assert.IsType(subT, ObjectAlreadyExistsErr{}, err)
+	})
+
+	t.Run("should only purge entries deleted before the window", func(subT *testing.T) {
+		now := time.Now()
+		s := newService(&now)
+
+		_, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		now = now.Add(30 * time.Minute)
+		n, err := s.PurgeTrash(context.Background(), time.Hour)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Equal(subT, 0, n) {
+			return
+		}
+
+		now = now.Add(time.Hour)
+		n, err = s.PurgeTrash(context.Background(), time.Hour)
+		if !assert.Nil(subT, err) {
+			return
+		}
+		if !assert.Equal(subT, 1, n) {
+			return
+		}
+
+		err = s.Restore(context.Background(), "test")
+		assert.IsType(subT, ObjectDoesNotExistErr{}, err)
+	})
+}
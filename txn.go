@@ -0,0 +1,80 @@
+package sakuin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/multierr"
+)
+
+// TxnStep is a single write which is part of a transaction across stores.
+type TxnStep struct {
+	// Name identifies the step in errors.
+	Name string
+
+	Do func(ctx context.Context) error
+
+	// Undo reverts a successful Do. It may be nil if there's nothing to revert.
+	Undo func(ctx context.Context) error
+}
+
+// TxnRollbackErr represents a failed transaction which couldn't be fully
+// rolled back, so the stores may have been left inconsistent.
+type TxnRollbackErr struct {
+	// Step is the name of the step which failed.
+	Step string
+
+	// Err is the error returned by the failed step.
+	Err error
+
+	// UndoErr holds the errors from all the undos which failed.
+	UndoErr error
+}
+
+func (e TxnRollbackErr) Error() string {
+	return fmt.Sprintf("%s failed: %s, and rolling back also failed: %s", e.Step, e.Err, e.UndoErr)
+}
+
+func (e TxnRollbackErr) Unwrap() error {
+	return e.Err
+}
+
+// RunTxn runs the steps in order. If a step fails, the steps which already
+// completed are undone in reverse order. The error from the failed step is
+// returned as is when the rollback succeeds, otherwise a TxnRollbackErr is.
+// Steps which fail with ErrReadOnly aren't rolled back, since the stores
+// are expected to be made read-only together and the undos would fail too.
+func RunTxn(ctx context.Context, steps ...TxnStep) error {
+	for i, step := range steps {
+		err := step.Do(ctx)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrReadOnly) {
+			return err
+		}
+
+		undoErr := undoTxn(ctx, steps[:i])
+		if undoErr != nil {
+			return TxnRollbackErr{Step: step.Name, Err: err, UndoErr: undoErr}
+		}
+		return err
+	}
+	return nil
+}
+
+func undoTxn(ctx context.Context, steps []TxnStep) error {
+	var errs error
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].Undo == nil {
+			continue
+		}
+
+		err := steps[i].Undo(ctx)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("undo %s: %w", steps[i].Name, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,374 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errStoreDown = errors.New("store is down")
+
+// methodFailingObjectStore fails every call to the named method with errStoreDown.
+type methodFailingObjectStore struct {
+	ObjectStore
+	method string
+}
+
+func (s methodFailingObjectStore) Put(ctx context.Context, id string, b []byte) error {
+	if s.method == "Put" {
+		return errStoreDown
+	}
+	return s.ObjectStore.Put(ctx, id, b)
+}
+
+func (s methodFailingObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	if s.method == "Update" {
+		return errStoreDown
+	}
+	return s.ObjectStore.Update(ctx, id, b)
+}
+
+func (s methodFailingObjectStore) Delete(ctx context.Context, id string) error {
+	if s.method == "Delete" {
+		return errStoreDown
+	}
+	return s.ObjectStore.Delete(ctx, id)
+}
+
+// methodFailingDocumentStore fails every call to the named method with errStoreDown.
+type methodFailingDocumentStore struct {
+	DocumentStore
+	method string
+}
+
+func (s methodFailingDocumentStore) Upsert(ctx context.Context, id string, doc map[string]interface{}) error {
+	if s.method == "Upsert" {
+		return errStoreDown
+	}
+	return s.DocumentStore.Upsert(ctx, id, doc)
+}
+
+func (s methodFailingDocumentStore) Delete(ctx context.Context, id string) error {
+	if s.method == "Delete" {
+		return errStoreDown
+	}
+	return s.DocumentStore.Delete(ctx, id)
+}
+
+func TestRunTxn(t *testing.T) {
+	t.Run("should undo completed steps in reverse order", func(subT *testing.T) {
+		var undone []string
+		step := func(name string, err error) TxnStep {
+			return TxnStep{
+				Name: name,
+				Do:   func(ctx context.Context) error { return err },
+				Undo: func(ctx context.Context) error {
+					undone = append(undone, name)
+					return nil
+				},
+			}
+		}
+
+		err := RunTxn(context.Background(), step("a", nil), step("b", nil), step("c", errStoreDown), step("d", nil))
+		assert.Equal(subT, errStoreDown, err)
+		assert.Equal(subT, []string{"b", "a"}, undone)
+	})
+
+	t.Run("should report undos which fail", func(subT *testing.T) {
+		errUndo := errors.New("undo failed")
+
+		err := RunTxn(context.Background(),
+			TxnStep{
+				Name: "a",
+				Do:   func(ctx context.Context) error { return nil },
+				Undo: func(ctx context.Context) error { return errUndo },
+			},
+			TxnStep{
+				Name: "b",
+				Do:   func(ctx context.Context) error { return errStoreDown },
+			},
+		)
+
+		var rerr TxnRollbackErr
+		if !assert.ErrorAs(subT, err, &rerr) {
+			return
+		}
+		assert.Equal(subT, "b", rerr.Step)
+		assert.ErrorIs(subT, err, errStoreDown)
+		assert.ErrorIs(subT, rerr.UndoErr, errUndo)
+	})
+
+	t.Run("should not undo steps if a store is read-only", func(subT *testing.T) {
+		undone := false
+
+		err := RunTxn(context.Background(),
+			TxnStep{
+				Name: "a",
+				Do:   func(ctx context.Context) error { return nil },
+				Undo: func(ctx context.Context) error {
+					undone = true
+					return nil
+				},
+			},
+			TxnStep{
+				Name: "b",
+				Do:   func(ctx context.Context) error { return ErrReadOnly },
+			},
+		)
+		assert.Equal(subT, ErrReadOnly, err)
+		assert.False(subT, undone)
+	})
+}
+
+func TestIndexRollback(t *testing.T) {
+	testCases := []struct {
+		name     string
+		objStore func(ObjectStore) ObjectStore
+		docStore func(DocumentStore) DocumentStore
+	}{
+		{
+			name:     "should leave the stores unchanged if putting the object fails",
+			objStore: func(s ObjectStore) ObjectStore { return methodFailingObjectStore{ObjectStore: s, method: "Put"} },
+			docStore: func(s DocumentStore) DocumentStore { return s },
+		},
+		{
+			name:     "should leave the stores unchanged if upserting the metadata fails",
+			objStore: func(s ObjectStore) ObjectStore { return s },
+			docStore: func(s DocumentStore) DocumentStore {
+				return methodFailingDocumentStore{DocumentStore: s, method: "Upsert"}
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			objStore := NewInMemoryObjectStore()
+			docStore := NewInMemoryDocumentStore()
+
+			s := New(Config{
+				ObjectStore:   testCase.objStore(objStore),
+				DocumentStore: testCase.docStore(docStore),
+				RandSrc:       rand.Reader,
+			})
+
+			_, err := s.Index(context.Background(), &pb.IndexRequest{Id: "test", Object: []byte("content")})
+			if !assert.Equal(subT, errStoreDown, err) {
+				return
+			}
+
+			objStats, _ := objStore.Stats(context.Background())
+			docStats, _ := docStore.Stats(context.Background())
+			assert.Equal(subT, &StoreStatsInfo{}, objStats)
+			assert.Equal(subT, &StoreStatsInfo{}, docStats)
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	newStores := func() (*InMemoryObjectStore, *InMemoryDocumentStore) {
+		objStore := NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"})
+		return objStore, docStore
+	}
+
+	t.Run("should remove the object and metadata", func(subT *testing.T) {
+		objStore, docStore := newStores()
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: docStore,
+		})
+
+		resp, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, resp.ObjectDeleted)
+		assert.True(subT, resp.MetadataDeleted)
+		assert.Equal(subT, int64(len("content")), resp.ObjectSize)
+
+		objStats, _ := objStore.Stat(context.Background(), "test")
+		docStats, _ := docStore.Stat(context.Background(), "test")
+		assert.False(subT, objStats.Exists)
+		assert.False(subT, docStats.Exists)
+	})
+
+	t.Run("should remove an object without metadata", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("test", []byte("content"))
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		resp, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.True(subT, resp.ObjectDeleted)
+		assert.False(subT, resp.MetadataDeleted)
+		assert.Equal(subT, int64(len("content")), resp.ObjectSize)
+
+		objStats, _ := objStore.Stat(context.Background(), "test")
+		assert.False(subT, objStats.Exists)
+	})
+
+	t.Run("should remove metadata without an object", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: docStore,
+		})
+
+		resp, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.False(subT, resp.ObjectDeleted)
+		assert.True(subT, resp.MetadataDeleted)
+		assert.Zero(subT, resp.ObjectSize)
+
+		docStats, _ := docStore.Stat(context.Background(), "test")
+		assert.False(subT, docStats.Exists)
+	})
+
+	t.Run("should fail if neither object nor metadata exist", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   NewInMemoryObjectStore(),
+			DocumentStore: NewInMemoryDocumentStore(),
+		})
+
+		_, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+		assert.IsType(subT, ObjectDoesNotExistErr{}, err)
+	})
+
+	testCases := []struct {
+		name     string
+		objStore func(ObjectStore) ObjectStore
+		docStore func(DocumentStore) DocumentStore
+	}{
+		{
+			name:     "should leave the stores unchanged if deleting the object fails",
+			objStore: func(s ObjectStore) ObjectStore { return methodFailingObjectStore{ObjectStore: s, method: "Delete"} },
+			docStore: func(s DocumentStore) DocumentStore { return s },
+		},
+		{
+			name:     "should leave the stores unchanged if deleting the metadata fails",
+			objStore: func(s ObjectStore) ObjectStore { return s },
+			docStore: func(s DocumentStore) DocumentStore {
+				return methodFailingDocumentStore{DocumentStore: s, method: "Delete"}
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(subT *testing.T) {
+			objStore, docStore := newStores()
+
+			s := New(Config{
+				ObjectStore:   testCase.objStore(objStore),
+				DocumentStore: testCase.docStore(docStore),
+			})
+
+			_, err := s.Delete(context.Background(), &pb.DeleteRequest{Id: "test"})
+			if !assert.Equal(subT, errStoreDown, err) {
+				return
+			}
+
+			obj, err := objStore.Get(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, []byte("content"), obj)
+
+			doc, err := docStore.Get(context.Background(), "test")
+			if !assert.Nil(subT, err) {
+				return
+			}
+			assert.Equal(subT, map[string]interface{}{"name": "test"}, doc)
+		})
+	}
+}
+
+// updateOnceObjectStore only allows a single Update.
+type updateOnceObjectStore struct {
+	ObjectStore
+	updated bool
+}
+
+func (s *updateOnceObjectStore) Update(ctx context.Context, id string, b []byte) error {
+	if s.updated {
+		return errStoreDown
+	}
+	s.updated = true
+	return s.ObjectStore.Update(ctx, id, b)
+}
+
+func TestUpdateObjectRollback(t *testing.T) {
+	t.Run("should restore the object if recording the checksum fails", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("test", []byte("content"))
+
+		s := New(Config{
+			ObjectStore:   objStore,
+			DocumentStore: methodFailingDocumentStore{DocumentStore: NewInMemoryDocumentStore(), method: "Upsert"},
+		})
+
+		_, err := s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{Id: "test", Content: []byte("updated")})
+		if !assert.Equal(subT, errStoreDown, err) {
+			return
+		}
+
+		obj, err := objStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj)
+	})
+
+	t.Run("should report if the object couldn't be restored", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:   &updateOnceObjectStore{ObjectStore: NewInMemoryObjectStore().WithObject("test", []byte("content"))},
+			DocumentStore: methodFailingDocumentStore{DocumentStore: NewInMemoryDocumentStore(), method: "Upsert"},
+		})
+
+		_, err := s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{Id: "test", Content: []byte("updated")})
+
+		var rerr TxnRollbackErr
+		if !assert.ErrorAs(subT, err, &rerr) {
+			return
+		}
+		assert.Equal(subT, "record checksum", rerr.Step)
+	})
+
+	t.Run("should leave the stores unchanged if updating the object fails", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore().WithObject("test", []byte("content"))
+		docStore := NewInMemoryDocumentStore()
+
+		s := New(Config{
+			ObjectStore:   methodFailingObjectStore{ObjectStore: objStore, method: "Update"},
+			DocumentStore: docStore,
+		})
+
+		_, err := s.UpdateObject(context.Background(), &pb.UpdateObjectRequest{Id: "test", Content: []byte("updated")})
+		if !assert.Equal(subT, errStoreDown, err) {
+			return
+		}
+
+		obj, err := objStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, []byte("content"), obj)
+
+		docStats, _ := docStore.Stat(context.Background(), "test")
+		assert.False(subT, docStats.Exists)
+	})
+}
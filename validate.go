@@ -0,0 +1,81 @@
+package sakuin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"go.uber.org/zap"
+)
+
+// MetadataValidator checks metadata before it's written to the DocumentStore.
+type MetadataValidator interface {
+	Validate(ctx context.Context, metadata map[string]interface{}) error
+}
+
+// MetadataValidationErr represents metadata which was rejected by the MetadataValidator.
+type MetadataValidationErr struct {
+	ID  string
+	Err error
+}
+
+func (e MetadataValidationErr) Error() string {
+	return fmt.Sprintf("invalid metadata for %s: %s", e.ID, e.Err)
+}
+
+func (e MetadataValidationErr) Unwrap() error {
+	return e.Err
+}
+
+// ErrReservedMetadataKey is the reason metadata which sets the ReservedMetadataKey is rejected.
+var ErrReservedMetadataKey = fmt.Errorf("%s is reserved for the service", ReservedMetadataKey)
+
+// JSONSchemaValidator validates metadata against a JSON Schema.
+type JSONSchemaValidator struct {
+	schema *jsonschema.Schema
+}
+
+// NewJSONSchemaValidator compiles the given JSON Schema document.
+func NewJSONSchemaValidator(schema []byte) (*JSONSchemaValidator, error) {
+	const url = "metadata.schema.json"
+
+	c := jsonschema.NewCompiler()
+	err := c.AddResource(url, bytes.NewReader(schema))
+	if err != nil {
+		return nil, err
+	}
+
+	sch, err := c.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONSchemaValidator{schema: sch}, nil
+}
+
+func (v *JSONSchemaValidator) Validate(ctx context.Context, metadata map[string]interface{}) error {
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	return v.schema.Validate(metadata)
+}
+
+// validateMetadata rejects metadata which sets the reserved metadata, since
+// only the Service may write it, and then runs the configured MetadataValidator,
+// if any.
+func (s *Service) validateMetadata(ctx context.Context, id string, metadata map[string]interface{}) error {
+	if _, ok := metadata[ReservedMetadataKey]; ok {
+		s.log.Error("metadata sets the reserved metadata", zap.String("id", id))
+		return MetadataValidationErr{ID: id, Err: ErrReservedMetadataKey}
+	}
+	if s.validator == nil {
+		return nil
+	}
+
+	err := s.validator.Validate(ctx, metadata)
+	if err != nil {
+		s.log.Error("metadata failed validation", zap.String("id", id), zap.Error(err))
+		return MetadataValidationErr{ID: id, Err: err}
+	}
+	return nil
+}
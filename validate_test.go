@@ -0,0 +1,145 @@
+package sakuin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	pb "github.com/z5labs/sakuin/proto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMetadataSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"}
+	},
+	"required": ["name"]
+}`
+
+func newTestValidator(t *testing.T) *JSONSchemaValidator {
+	v, err := NewJSONSchemaValidator([]byte(testMetadataSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestJSONSchemaValidator(t *testing.T) {
+	t.Run("should fail if the schema is invalid", func(subT *testing.T) {
+		_, err := NewJSONSchemaValidator([]byte(`{"type": 1}`))
+		assert.Error(subT, err)
+	})
+
+	t.Run("should accept valid metadata", func(subT *testing.T) {
+		v := newTestValidator(subT)
+
+		err := v.Validate(context.Background(), map[string]interface{}{"name": "test"})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should reject invalid metadata", func(subT *testing.T) {
+		v := newTestValidator(subT)
+
+		err := v.Validate(context.Background(), map[string]interface{}{"name": 1})
+		assert.Error(subT, err)
+	})
+}
+
+func TestMetadataValidation(t *testing.T) {
+	t.Run("should not index invalid metadata", func(subT *testing.T) {
+		objStore := NewInMemoryObjectStore()
+		docStore := NewInMemoryDocumentStore()
+
+		s := New(Config{
+			ObjectStore:       objStore,
+			DocumentStore:     docStore,
+			MetadataValidator: newTestValidator(subT),
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"description": "no name"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.Index(context.Background(), &pb.IndexRequest{
+			Id:       "test",
+			Metadata: metadata,
+			Object:   []byte("content"),
+		})
+
+		var verr MetadataValidationErr
+		if !assert.ErrorAs(subT, err, &verr) {
+			return
+		}
+		assert.Equal(subT, "test", verr.ID)
+		assert.Equal(subT, 0, objStore.NumOfObects())
+	})
+
+	t.Run("should index valid metadata", func(subT *testing.T) {
+		s := New(Config{
+			ObjectStore:       NewInMemoryObjectStore(),
+			DocumentStore:     NewInMemoryDocumentStore(),
+			RandSrc:           rand.Reader,
+			MetadataValidator: newTestValidator(subT),
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": "test"})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.Index(context.Background(), &pb.IndexRequest{
+			Metadata: metadata,
+			Object:   []byte("content"),
+		})
+		assert.Nil(subT, err)
+	})
+
+	t.Run("should not update metadata with invalid metadata", func(subT *testing.T) {
+		docStore := NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{"name": "test"})
+
+		s := New(Config{
+			DocumentStore:     docStore,
+			MetadataValidator: newTestValidator(subT),
+		})
+
+		metadata, err := marshalJSONToAny(map[string]interface{}{"name": 1})
+		if !assert.Nil(subT, err) {
+			return
+		}
+
+		_, err = s.UpdateMetadata(context.Background(), &pb.UpdateMetadataRequest{
+			Id:       "test",
+			Metadata: metadata,
+		})
+
+		var verr MetadataValidationErr
+		if !assert.ErrorAs(subT, err, &verr) {
+			return
+		}
+
+		doc, err := docStore.Get(context.Background(), "test")
+		if !assert.Nil(subT, err) {
+			return
+		}
+		assert.Equal(subT, "test", doc["name"])
+	})
+
+	t.Run("should not merge patch into invalid metadata", func(subT *testing.T) {
+		s := New(Config{
+			DocumentStore: NewInMemoryDocumentStore().WithDocument("test", map[string]interface{}{
+				"name":              "test",
+				ReservedMetadataKey: map[string]interface{}{checksumMetadataKey: "sha256:abc"},
+			}),
+			MetadataValidator: newTestValidator(subT),
+		})
+
+		_, err := s.MergePatchMetadata(context.Background(), "test", json.RawMessage(`{"name": null}`))
+
+		var verr MetadataValidationErr
+		assert.ErrorAs(subT, err, &verr)
+	})
+}